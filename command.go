@@ -0,0 +1,226 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ctxswitch/gdoc/internal/api"
+	"github.com/ctxswitch/gdoc/internal/bundle"
+	"github.com/ctxswitch/gdoc/internal/config"
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+)
+
+// usage is printed when an unknown command is given.
+const usage = `usage: gdoc [command]
+
+Without a command the service is started.
+
+Commands:
+  state export [file]  write a snapshot of the syncer state to the file or stdout
+  state import [file]  replace the syncer state with a snapshot from the file or stdin
+  token create <name> <role> [ttl]
+                       create an api token with the viewer, operator or admin role
+  token list           list the api tokens
+  token revoke <id>    revoke an api token
+  bundle keygen <private> <public>
+                       write a new key pair for signing and verifying bundles
+  bundle create [file] write a signed bundle of the repositories to the file or stdout
+  bundle load [file]   verify and install a bundle from the file or stdin
+
+Tokens are written to the state file, so the service should be stopped while
+they are changed.  Use the /api/tokens endpoints of a running service instead.
+Bundles are signed with the BUNDLE_SIGNING_KEY and verified with the
+BUNDLE_VERIFY_KEY, and should only be loaded while the service is stopped.
+`
+
+// command runs the command given on the command line.
+func command(cfg *config.Config, args []string) error {
+	if len(args) >= 2 && args[0] == "state" {
+		name := syncer.StatePath(cfg.GodocRoot, cfg.StatePath)
+		switch args[1] {
+		case "export":
+			return exportState(name, args[2:])
+		case "import":
+			return importState(name, args[2:])
+		}
+	}
+
+	if len(args) >= 2 && args[0] == "token" {
+		name := syncer.StatePath(cfg.GodocRoot, cfg.StatePath)
+		switch {
+		case args[1] == "create" && (len(args) == 4 || len(args) == 5):
+			return createToken(name, args[2:])
+		case args[1] == "list" && len(args) == 2:
+			return listTokens(name)
+		case args[1] == "revoke" && len(args) == 3:
+			return syncer.RevokeStateToken(name, args[2])
+		}
+	}
+
+	if len(args) >= 2 && args[0] == "bundle" {
+		o := bundle.Options{
+			Root:       cfg.GodocRoot,
+			StatePath:  cfg.StatePath,
+			SigningKey: cfg.BundleSigningKey,
+			VerifyKey:  cfg.BundleVerifyKey,
+			Instance:   cfg.InstanceName,
+		}
+		switch {
+		case args[1] == "keygen" && len(args) == 4:
+			return bundle.GenerateKey(args[2], args[3])
+		case args[1] == "create" && len(args) <= 3:
+			return createBundle(o, args[2:])
+		case args[1] == "load" && len(args) <= 3:
+			return loadBundle(o, args[2:])
+		}
+	}
+
+	fmt.Fprint(os.Stderr, usage)
+	return fmt.Errorf("unknown command: %s", strings.Join(args, " "))
+}
+
+// exportState writes the state snapshot to the file named in the arguments
+// or to stdout.
+func exportState(name string, args []string) error {
+	var w io.Writer = os.Stdout
+	if len(args) > 0 && args[0] != "-" {
+		f, err := os.Create(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	return syncer.ExportState(name, w)
+}
+
+// importState reads the state snapshot from the file named in the arguments
+// or from stdin.
+func importState(name string, args []string) error {
+	var r io.Reader = os.Stdin
+	if len(args) > 0 && args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	return syncer.ImportState(name, r)
+}
+
+// createToken creates an api token from the name, role and optional ttl in
+// the arguments and prints its value.
+func createToken(name string, args []string) error {
+	if !api.ValidRole(args[1]) {
+		return fmt.Errorf("invalid role %q: expected viewer, operator or admin", args[1])
+	}
+
+	var ttl time.Duration
+	if len(args) == 3 {
+		var err error
+		if ttl, err = time.ParseDuration(args[2]); err != nil {
+			return err
+		}
+	}
+
+	value, t, err := syncer.CreateStateToken(name, args[0], args[1], ttl)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\t%s\n", t.ID, value)
+	return nil
+}
+
+// listTokens prints the id, name, role and expiry of every api token.
+func listTokens(name string) error {
+	tokens, err := syncer.StateTokens(name)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tokens {
+		expires := "never"
+		if t.Expires != nil {
+			expires = t.Expires.Format(time.RFC3339)
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\n", t.ID, t.Name, t.Role, expires)
+	}
+	return nil
+}
+
+// createBundle writes a bundle to the file named in the arguments or to
+// stdout.  The file is only created once the bundle is complete.
+func createBundle(o bundle.Options, args []string) error {
+	if len(args) == 0 || args[0] == "-" {
+		n, err := bundle.Create(o, os.Stdout)
+		if err == nil {
+			fmt.Fprintf(os.Stderr, "bundled %d repositories\n", n)
+		}
+		return err
+	}
+
+	tmp := args[0] + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	n, err := bundle.Create(o, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, args[0]); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "bundled %d repositories\n", n)
+	return nil
+}
+
+// loadBundle installs the bundle from the file named in the arguments or
+// from stdin.
+func loadBundle(o bundle.Options, args []string) error {
+	var r io.Reader = os.Stdin
+	if len(args) > 0 && args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	n, err := bundle.Load(o, r)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "loaded %d repositories\n", n)
+	return nil
+}
@@ -0,0 +1,76 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// apiPolicy is the content security policy of the API responses, which
+// are not meant to be rendered as pages.
+const apiPolicy = "default-src 'none'; frame-ancestors 'none'"
+
+// adminPage is the admin console.  It is a single page that calls the
+// management API from the browser, so the data it shows and the actions it
+// takes are protected by the same authenticators as the API.
+//
+//go:embed admin.html
+var adminPage []byte
+
+// adminPolicy is the content security policy of the admin console.  It
+// only allows the inline script and style of the page to run and the page
+// to call the API it was served from.
+var adminPolicy = fmt.Sprintf("default-src 'self'; script-src '%s'; style-src '%s'; frame-ancestors 'none'; base-uri 'none'; form-action 'none'",
+	inlineHash(adminPage, "script"), inlineHash(adminPage, "style"))
+
+// inlineHash returns the CSP hash source of the content of the first
+// element with the tag in the page.
+func inlineHash(page []byte, tag string) string {
+	start := bytes.Index(page, []byte("<"+tag+">"))
+	end := bytes.Index(page, []byte("</"+tag+">"))
+	if start < 0 || end < start {
+		return "none"
+	}
+
+	sum := sha256.Sum256(page[start+len(tag)+2 : end])
+	return "sha256-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// admin writes the admin console.
+func (a *API) admin(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/admin" && r.URL.Path != "/admin/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Security-Policy", adminPolicy)
+	a.setCSRFCookie(w, r)
+	if _, err := w.Write(adminPage); err != nil {
+		a.logger.Error("unable to write the admin console", zap.Error(err))
+	}
+}
@@ -0,0 +1,643 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ctxswitch/gdoc/internal/config"
+	"github.com/ctxswitch/gdoc/internal/report"
+	"github.com/ctxswitch/gdoc/internal/search"
+	"github.com/ctxswitch/gdoc/internal/server"
+	"github.com/ctxswitch/gdoc/pkg/docserver"
+	"github.com/ctxswitch/gdoc/pkg/plugins"
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+	"go.uber.org/zap"
+)
+
+// APIOptions defines the options available for running the management
+// API service.
+type APIOptions struct {
+	// The port that the management API will run on.  Initially set in
+	// the config.
+	APIPort int
+	// The address that the management API listens on.  Empty to listen
+	// on every address.  Initially set in the config.
+	BindAddress string
+	// The address families that the management API listens on.
+	// Initially set in the config.
+	AddressFamily string
+	// The licenses that repositories are allowed to use.  When empty, all
+	// licenses are allowed.  Initially set in the config.
+	AllowedLicenses []string
+	// The oldest Go version that modules are expected to use.  When empty,
+	// the oldest supported Go release is used.  Initially set in the
+	// config.
+	MinimumGoVersion string
+	// How long active requests are given to finish when the service is
+	// stopped.  Defaults to server.DefaultShutdownTimeout.  Initially set
+	// in the config.
+	ShutdownTimeout time.Duration
+	// The read and idle timeouts of the connections to the management
+	// API.  Initially set in the config.
+	Timeouts server.Timeouts
+	// The time after which requests to the management API are logged as
+	// slow.  Zero disables the logging.  Initially set in the config.
+	SlowRequestThreshold time.Duration
+	// The path of a unix domain socket that the management API listens on
+	// in addition to the port.  Initially set in the config.
+	APISocket string
+	// The PEM encoded certificate that the port is served with over TLS.
+	// Empty to serve plain HTTP.  Initially set in the config.
+	TLSCert string
+	// The PEM encoded private key of the certificate.  Initially set in
+	// the config.
+	TLSKey string
+	// The PEM encoded CA certificates that clients must present a
+	// certificate signed by.  The certificate is also presented to the
+	// peers, whose certificates are verified with the CA.  Initially set
+	// in the config.
+	ClientCA string
+	// The largest request body, in bytes, that is accepted.  Defaults to
+	// DefaultMaxBodySize.  Module uploads are limited by
+	// modules.MaxZipSize instead.  Initially set in the config.
+	MaxBodySize int64
+	// The security headers sent with every response.  The content security
+	// policy is replaced with apiPolicy.  Initially set in the config.
+	Headers docserver.SecurityHeaders
+	// The SameSite attribute of the cookies set by the API, either
+	// strict, lax or none.  Defaults to strict.  Initially set in the
+	// config.
+	CookieSameSite string
+	// Mark the cookies set by the API as secure even when the request was
+	// not served over TLS, such as behind a proxy that terminates TLS.
+	// Initially set in the config.
+	CookieSecure bool
+	// The name of this instance.  Initially set in the config.
+	InstanceName string
+	// The version of gdoc that is running.
+	Version string
+	// The management API addresses of the other instances, such as
+	// http://gdoc-1:6061, that are shown on the cluster status.
+	// Initially set in the config.
+	Peers []string
+	// The markers of the notes included in the notes report as a regular
+	// expression.  Defaults to docserver.DefaultNotesPattern.  Initially
+	// set in the config.
+	NotesPattern string
+	// The repositories left out of the repository and package searches as
+	// owner/name patterns.  Initially set in the config.
+	NoIndexRepos []string
+	// The signing secret of the Slack app whose slash commands are
+	// handled.  Empty disables the slash commands.  Initially set in the
+	// config.
+	SlackSigningSecret string
+	// The workspace that uploaded modules are extracted into.  Initially
+	// set in the config.
+	GodocRoot string
+	// Accept module zips posted to /api/modules.  Initially set in the
+	// config.
+	ModuleUploads bool
+	// The authenticators registered by plugins.  When any are set, only
+	// the requests that one of them accepts are handled.
+	Authenticators []plugins.Authenticator
+	// The roles of the callers accepted by the authenticators keyed by
+	// user name, by group:<name> for the groups reported by authenticators
+	// or by * for every caller.  Every caller is an admin when empty.
+	// Initially set in the config.
+	Roles map[string]string
+	// Listen on the BindAddress even though callers can not be
+	// authenticated, which makes every caller an admin.  Otherwise the
+	// port only listens on the loopback address until authentication is
+	// configured.  Initially set in the config.
+	AllowAnonymous bool
+	// The configuration that is reported by the config endpoint.
+	Config *config.Config
+	// The syncer service that status information is gathered from.
+	Syncer *syncer.Syncer
+	// The vulnerability scanner that findings are gathered from.  Nil if
+	// vulnerability scanning is disabled.
+	Vulns *report.VulnScanner
+	// The dependency checker that outdated requirements are gathered from.
+	// Nil if dependency checking is disabled.
+	Dependencies *report.DependencyChecker
+	// The semantic search index that documentation searches are served
+	// from.  Nil if semantic search is disabled.
+	Search *search.Index
+	// The logger used by the management API service. Initially set in the
+	// config.
+	Logger *zap.Logger
+}
+
+// Status is the response returned from the status endpoint.
+type Status struct {
+	// The summary of the last completed sync cycle.
+	Sync syncer.Summary `json:"sync"`
+	// Whether Github accepts the configured credentials.
+	Credentials syncer.Credentials `json:"credentials"`
+	// The time that the next sync cycle is scheduled for.
+	NextSync *time.Time `json:"next_sync,omitempty"`
+	// Whether the repositories on disk are served without synchronizing.
+	Offline bool `json:"offline,omitempty"`
+}
+
+// Health is the response returned from the health endpoint.
+type Health struct {
+	// Either "ok" or "degraded".
+	Status string `json:"status"`
+	// The problems that degrade the service.
+	Problems []string `json:"problems,omitempty"`
+}
+
+// Trace is the response returned from the trace endpoint.
+type Trace struct {
+	// Whether the calls made to the Github API are being logged.
+	Enabled bool `json:"enabled"`
+}
+
+// Configuration is the response returned from the config endpoint.
+type Configuration struct {
+	// The effective value of every setting.
+	Settings []config.Setting `json:"settings"`
+	// Problems found while reading the configuration.
+	Warnings []string `json:"warnings"`
+}
+
+// API is a service that exposes the state of the running services over
+// HTTP.
+type API struct {
+	// The APIOptions that was passed into New.
+	options APIOptions
+	// The logger used by the management API service.
+	logger *zap.Logger
+	// The client used to query the peers.
+	peers *http.Client
+	// Whether requests are passed through unchecked while there are no
+	// tokens.  Decided once when the service is started, along with the
+	// address that it listens on.
+	open bool
+}
+
+// New returns an initialized API struct
+func New(a APIOptions) *API {
+	return &API{
+		options: a,
+		logger:  a.Logger,
+		peers:   http.DefaultClient,
+	}
+}
+
+// Start runs the management API service until the context is cancelled.
+func (a *API) Start(ctx context.Context) error {
+	tlsConfig, err := a.tls()
+	if err != nil {
+		return err
+	}
+
+	a.open = a.anonymous()
+	srv := &http.Server{
+		Handler: a.handler(),
+	}
+
+	return server.Serve(ctx, srv, server.Options{
+		Addr:            a.address(),
+		Network:         server.Network(a.options.AddressFamily),
+		Socket:          a.options.APISocket,
+		ActivationName:  "api",
+		ShutdownTimeout: a.options.ShutdownTimeout,
+		Timeouts:        a.options.Timeouts,
+		TLSConfig:       tlsConfig,
+		Logger:          a.logger,
+	})
+}
+
+// handler returns the handler of the management API with the middleware
+// applied.
+func (a *API) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/openapi.json", a.openAPI)
+	mux.HandleFunc("/api/status", a.status)
+	mux.HandleFunc("/api/health", a.health)
+	mux.HandleFunc("/api/config", a.config)
+	mux.HandleFunc("/api/trace/github", a.trace)
+	mux.HandleFunc("/api/repos", a.repos)
+	mux.HandleFunc("/api/repos/", a.repo)
+	mux.HandleFunc("/api/history", a.history)
+	mux.HandleFunc("/api/failures", a.failures)
+	mux.HandleFunc("/api/events", a.events)
+	mux.HandleFunc("/api/paused", a.paused)
+	mux.HandleFunc("/api/search", a.searchRepos)
+	mux.HandleFunc("/api/search/docs", a.searchDocs)
+	mux.HandleFunc("/api/slack/commands", a.slack)
+	mux.HandleFunc("/api/docs", a.docs)
+	mux.HandleFunc("/api/docs/", a.docs)
+	mux.HandleFunc("/mcp", a.mcp)
+	mux.HandleFunc("/graphql", a.graphql)
+	mux.HandleFunc("/admin", a.admin)
+	mux.HandleFunc("/admin/", a.admin)
+	mux.HandleFunc("/download/", a.download)
+	mux.HandleFunc("/api/reports/licenses", a.licenses)
+	mux.HandleFunc("/api/reports/go-versions", a.goVersions)
+	mux.HandleFunc("/api/reports/deprecations", a.deprecations)
+	mux.HandleFunc("/api/reports/notes", a.notes)
+	mux.HandleFunc("/api/reports/vulnerabilities", a.vulnerabilities)
+	mux.HandleFunc("/api/reports/dependencies", a.dependencies)
+	mux.HandleFunc("/api/sbom/", a.sbom)
+	mux.HandleFunc("/api/owners", a.owners)
+	mux.HandleFunc("/api/inventory", a.inventory)
+	mux.HandleFunc("/api/modules", a.uploadModule)
+	mux.HandleFunc("/api/cluster", a.cluster)
+	mux.HandleFunc("/api/cluster/self", a.self)
+	mux.HandleFunc("/api/tokens", a.tokens)
+	mux.HandleFunc("/api/tokens/", a.token)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	headers := a.options.Headers
+	headers.ContentSecurityPolicy = apiPolicy
+	return server.Slow(headers.Handler(a.limitBody(a.csrf(a.authenticate(a.audit(mux))))), a.options.SlowRequestThreshold, a.logger, target)
+}
+
+// anonymous returns true if callers of the management API can not be
+// authenticated, in which case every caller is an admin.  Client
+// certificates are only verified when the port is served over TLS.
+func (a *API) anonymous() bool {
+	return len(a.options.Authenticators) == 0 && (a.options.ClientCA == "" || a.options.TLSCert == "") && !a.options.Syncer.HasTokens()
+}
+
+// address returns the TCP address that the management API listens on.
+// Without authentication the API only listens on the loopback address
+// unless anonymous access was allowed.
+func (a *API) address() string {
+	host := a.options.BindAddress
+	if a.open {
+		if a.options.AllowAnonymous {
+			a.logger.Warn("the management API has no authentication and API_ALLOW_ANONYMOUS is set, every caller that can reach it is an admin", zap.String("address", host))
+		} else if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			host = server.Loopback(a.options.AddressFamily)
+			a.logger.Warn("the management API has no authentication and only listens on the loopback address, configure an API token, an authenticator or API_CLIENT_CA, or set API_ALLOW_ANONYMOUS", zap.String("address", host))
+		}
+	}
+	return server.Address(host, a.options.APIPort, a.options.AddressFamily)
+}
+
+// target returns the path of the request for the slow request log.  The
+// event stream and downloads are long lived and are not measured.
+func target(r *http.Request) string {
+	if r.URL.Path == "/api/events" || strings.HasPrefix(r.URL.Path, "/download/") {
+		return ""
+	}
+	return r.URL.Path
+}
+
+// status writes the current status of the services.
+func (a *API) status(w http.ResponseWriter, r *http.Request) {
+	status := Status{
+		Sync:        a.options.Syncer.Summary(),
+		Credentials: a.options.Syncer.Credentials(),
+		Offline:     a.options.Syncer.Offline(),
+	}
+	if next := a.options.Syncer.NextRun(); !next.IsZero() {
+		status.NextSync = &next
+	}
+	a.json(w, http.StatusOK, status)
+}
+
+// health writes whether the service is healthy.  The service is degraded,
+// and answers with a 503, while Github rejects the credentials.
+func (a *API) health(w http.ResponseWriter, r *http.Request) {
+	h := Health{Status: "ok"}
+	if !a.options.Syncer.Credentials().Valid {
+		h.Problems = append(h.Problems, "github credentials are invalid")
+	}
+
+	if len(h.Problems) > 0 {
+		h.Status = "degraded"
+		a.json(w, http.StatusServiceUnavailable, h)
+		return
+	}
+	a.json(w, http.StatusOK, h)
+}
+
+// config writes the effective configuration with the secrets redacted.
+func (a *API) config(w http.ResponseWriter, r *http.Request) {
+	c := Configuration{
+		Settings: a.options.Config.Settings(),
+		Warnings: a.options.Config.Warnings,
+	}
+	if c.Warnings == nil {
+		c.Warnings = []string{}
+	}
+	a.json(w, http.StatusOK, c)
+}
+
+// trace writes whether the calls made to the Github API are being logged.
+// Posting with the enabled query parameter toggles the logging.
+func (a *API) trace(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		enabled, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+		if err != nil {
+			http.Error(w, "enabled must be true or false", http.StatusBadRequest)
+			return
+		}
+
+		if err := a.options.Syncer.SetTrace(enabled); err != nil {
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+			return
+		}
+	}
+
+	a.json(w, http.StatusOK, Trace{Enabled: a.options.Syncer.Tracing()})
+}
+
+// repos writes the repositories that have been synchronized along with
+// their metadata.
+func (a *API) repos(w http.ResponseWriter, r *http.Request) {
+	a.json(w, http.StatusOK, a.options.Syncer.Repos())
+}
+
+// repo handles the requests for a single repository below
+// /api/repos/{owner}/{name}/.  The resync and reclone actions must be
+// posted and return once the repository has been updated.  The pause and
+// resume actions must be posted as well.
+func (a *API) repo(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/repos/"), "/"), "/")
+	if len(parts) != 3 {
+		http.NotFound(w, r)
+		return
+	}
+
+	owner, name, action := parts[0], parts[1], parts[2]
+	switch action {
+	case "history":
+		events := a.options.Syncer.RepoHistory(owner, name)
+		if events == nil {
+			events = []syncer.Event{}
+		}
+		a.json(w, http.StatusOK, events)
+	case "resync", "reclone":
+		if !a.post(w, r) {
+			return
+		}
+
+		update := a.options.Syncer.Resync
+		if action == "reclone" {
+			update = a.options.Syncer.Reclone
+		}
+
+		err := update(r.Context(), owner, name)
+		switch {
+		case errors.Is(err, syncer.ErrRepoNotFound):
+			http.NotFound(w, r)
+		case errors.Is(err, syncer.ErrLocked), errors.Is(err, syncer.ErrOffline):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, syncer.ErrRateLimited):
+			w.Header().Set("Retry-After", "60")
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		case errors.Is(err, syncer.ErrAuth):
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		case err != nil:
+			a.logger.Error("unable to update repository", zap.String("repo", owner+"/"+name), zap.String("action", action), zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case "pause", "resume":
+		if !a.post(w, r) {
+			return
+		}
+
+		var err error
+		if action == "pause" {
+			err = a.options.Syncer.Pause(owner, name, r.URL.Query().Get("reason"))
+		} else {
+			err = a.options.Syncer.Resume(owner, name)
+		}
+
+		switch {
+		case errors.Is(err, syncer.ErrRepoNotFound):
+			http.NotFound(w, r)
+		case err != nil:
+			a.logger.Error("unable to save the pause", zap.String("repo", owner+"/"+name), zap.String("action", action), zap.Error(err))
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// post returns true if the request was posted.  Otherwise it writes a
+// method not allowed response.
+func (a *API) post(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method == http.MethodPost {
+		return true
+	}
+	w.Header().Set("Allow", http.MethodPost)
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	return false
+}
+
+// paused writes the repositories whose syncing has been paused.
+func (a *API) paused(w http.ResponseWriter, r *http.Request) {
+	a.json(w, http.StatusOK, a.options.Syncer.Paused())
+}
+
+// history writes the recorded sync cycles along with the repositories that
+// changed in each of them, newest first.
+func (a *API) history(w http.ResponseWriter, r *http.Request) {
+	a.json(w, http.StatusOK, a.options.Syncer.History())
+}
+
+// failures writes the repositories that are backing off after failures
+// along with the ones on the dead letter list.
+func (a *API) failures(w http.ResponseWriter, r *http.Request) {
+	a.json(w, http.StatusOK, a.options.Syncer.Failures())
+}
+
+// licenses writes the license report.  The report is written as CSV when
+// the format query parameter is set to csv.
+func (a *API) licenses(w http.ResponseWriter, r *http.Request) {
+	lr := report.Licenses(a.options.Syncer.Repos(), a.options.AllowedLicenses)
+
+	if r.URL.Query().Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="licenses.csv"`)
+		if err := lr.WriteCSV(w); err != nil {
+			a.logger.Error("unable to write license report", zap.Error(err))
+		}
+		return
+	}
+
+	a.json(w, http.StatusOK, lr)
+}
+
+// goVersions writes the Go version report.
+func (a *API) goVersions(w http.ResponseWriter, r *http.Request) {
+	a.json(w, http.StatusOK, report.GoVersions(a.options.Syncer.Repos(), a.options.MinimumGoVersion))
+}
+
+// deprecations writes the deprecation report.  The report is limited to a
+// single repository when the repo query parameter is set to owner/name.
+func (a *API) deprecations(w http.ResponseWriter, r *http.Request) {
+	repos := a.options.Syncer.Repos()
+	if name := r.URL.Query().Get("repo"); name != "" {
+		var filtered []syncer.Repo
+		for _, repo := range repos {
+			if repo.Owner+"/"+repo.Name == name {
+				filtered = append(filtered, repo)
+			}
+		}
+		repos = filtered
+	}
+
+	a.json(w, http.StatusOK, report.Deprecations(repos))
+}
+
+// notes writes the notes report.  The report is limited to a single
+// repository when the repo query parameter is set to owner/name and to a
+// single marker when the marker query parameter is set.
+func (a *API) notes(w http.ResponseWriter, r *http.Request) {
+	pattern := a.options.NotesPattern
+	if m := r.URL.Query().Get("marker"); m != "" {
+		pattern = regexp.QuoteMeta(m)
+	}
+
+	marker, err := docserver.NotesPattern(pattern)
+	if err != nil {
+		a.logger.Error("invalid notes pattern", zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	repos := a.options.Syncer.Repos()
+	if name := r.URL.Query().Get("repo"); name != "" {
+		var filtered []syncer.Repo
+		for _, repo := range repos {
+			if repo.Owner+"/"+repo.Name == name {
+				filtered = append(filtered, repo)
+			}
+		}
+		repos = filtered
+	}
+
+	a.json(w, http.StatusOK, report.Notes(repos, marker))
+}
+
+// vulnerabilities writes the findings of the last vulnerability scan.
+func (a *API) vulnerabilities(w http.ResponseWriter, r *http.Request) {
+	if a.options.Vulns == nil {
+		http.Error(w, "vulnerability scanning is disabled", http.StatusNotFound)
+		return
+	}
+
+	a.json(w, http.StatusOK, a.options.Vulns.Report())
+}
+
+// dependencies writes the outdated requirements found by the last
+// dependency check.
+func (a *API) dependencies(w http.ResponseWriter, r *http.Request) {
+	if a.options.Dependencies == nil {
+		http.Error(w, "dependency checking is disabled", http.StatusNotFound)
+		return
+	}
+
+	a.json(w, http.StatusOK, a.options.Dependencies.Report())
+}
+
+// sbom writes the CycloneDX SBOM of the repository named in the path as
+// /api/sbom/{owner}/{repo}.
+func (a *API) sbom(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/sbom/"), "/"), "/")
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+
+	for _, repo := range a.options.Syncer.Repos() {
+		if repo.Owner == parts[0] && repo.Name == parts[1] {
+			w.Header().Set("Content-Type", "application/vnd.cyclonedx+json")
+			a.json(w, http.StatusOK, report.NewSBOM(repo))
+			return
+		}
+	}
+
+	http.NotFound(w, r)
+}
+
+// Owners is the response returned from the owners endpoint.
+type Owners struct {
+	Repo string `json:"repo"`
+	Path string `json:"path"`
+	// The owners from the CODEOWNERS file of the repository.  Empty if the
+	// path is unowned.
+	Owners []string `json:"owners"`
+}
+
+// owners writes the code owners of the path given in the path query
+// parameter in the repository given as owner/name in the repo query
+// parameter.  The owners of the repository root are written if no path is
+// given.
+func (a *API) owners(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("repo")
+	p := r.URL.Query().Get("path")
+
+	for _, repo := range a.options.Syncer.Repos() {
+		if repo.Owner+"/"+repo.Name != name {
+			continue
+		}
+
+		co, err := docserver.LoadCodeOwners(repo.LocalPath)
+		if err != nil {
+			a.logger.Error("unable to read the code owners", zap.String("repo", name), zap.Error(err))
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		owners := co.Owners(p)
+		if owners == nil {
+			owners = []string{}
+		}
+		a.json(w, http.StatusOK, Owners{Repo: name, Path: p, Owners: owners})
+		return
+	}
+
+	http.NotFound(w, r)
+}
+
+// json writes the value to the response as a json document.  The content
+// type defaults to application/json if it has not already been set.
+func (a *API) json(w http.ResponseWriter, code int, v interface{}) {
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		a.logger.Error("unable to encode response", zap.Error(err))
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ctxswitch/gdoc/pkg/plugins"
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+	"go.uber.org/zap"
+)
+
+func TestAddressWithoutAuthentication(t *testing.T) {
+	s := syncer.New(context.Background(), syncer.SyncerOptions{
+		GodocRoot: t.TempDir(),
+		Offline:   true,
+		Logger:    zap.NewNop(),
+	})
+
+	tests := []struct {
+		name    string
+		options APIOptions
+		want    string
+	}{
+		{"anonymous", APIOptions{}, "127.0.0.1:6061"},
+		{"anonymous ipv6", APIOptions{AddressFamily: "ipv6"}, "[::1]:6061"},
+		{"anonymous bind address", APIOptions{BindAddress: "10.0.0.5"}, "127.0.0.1:6061"},
+		{"anonymous loopback", APIOptions{BindAddress: "::1"}, "[::1]:6061"},
+		{"anonymous allowed", APIOptions{BindAddress: "10.0.0.5", AllowAnonymous: true}, "10.0.0.5:6061"},
+		{"client certificates", APIOptions{BindAddress: "10.0.0.5", TLSCert: "cert.pem", ClientCA: "ca.pem"}, "10.0.0.5:6061"},
+		{"client ca without tls", APIOptions{BindAddress: "10.0.0.5", ClientCA: "ca.pem"}, "127.0.0.1:6061"},
+		{"authenticator", APIOptions{BindAddress: "10.0.0.5", Authenticators: []plugins.Authenticator{nil}}, "10.0.0.5:6061"},
+	}
+
+	for _, tt := range tests {
+		o := tt.options
+		o.APIPort = 6061
+		o.Syncer = s
+		o.Logger = zap.NewNop()
+		a := New(o)
+		a.open = a.anonymous()
+		if got := a.address(); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+
+	if _, _, err := s.CreateToken("ci", RoleOperator, 0); err != nil {
+		t.Fatal(err)
+	}
+	a := New(APIOptions{APIPort: 6061, BindAddress: "10.0.0.5", Syncer: s, Logger: zap.NewNop()})
+	a.open = a.anonymous()
+	if got := a.address(); got != "10.0.0.5:6061" {
+		t.Errorf("tokens: expected 10.0.0.5:6061, got %s", got)
+	}
+}
+
+func TestClientCAWithoutCertificate(t *testing.T) {
+	a := New(APIOptions{ClientCA: "ca.pem", Logger: zap.NewNop()})
+	if _, err := a.tls(); err == nil {
+		t.Fatal("expected an error for a client CA without a certificate")
+	}
+}
+
+func TestRevokingLastTokenRejectsRequests(t *testing.T) {
+	s := syncer.New(context.Background(), syncer.SyncerOptions{
+		GodocRoot: t.TempDir(),
+		Offline:   true,
+		Logger:    zap.NewNop(),
+	})
+	value, token, err := s.CreateToken("ci", RoleAdmin, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := New(APIOptions{APIPort: 6061, BindAddress: "10.0.0.5", Syncer: s, Logger: zap.NewNop()})
+	a.open = a.anonymous()
+	h := a.handler()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/tokens/"+token.ID+"/revoke", nil)
+	req.Header.Set("Authorization", "Bearer "+value)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected the token to be revoked with 204, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/repos", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 once the last token was revoked, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/ctxswitch/gdoc/pkg/plugins"
+	"go.uber.org/zap"
+)
+
+// authenticate only passes the requests that carry an API token or a
+// verified client certificate, or that one of the authenticators accepts,
+// and whose caller has the role needed for the request, to the handler.
+// Requests are only passed through unchecked when the service was started
+// without any way to authenticate callers, and no token has been created
+// since.  Revoking the last token of a service that was started with
+// tokens leaves every request rejected.  Slack commands are verified by their
+// signature instead, the health endpoint is left open for load balancers
+// and the admin console only holds the page that calls the API.
+func (a *API) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/slack/commands" || r.URL.Path == "/api/health" || r.URL.Path == "/admin" || r.URL.Path == "/admin/" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if value, ok := bearerToken(r); ok {
+			t, ok := a.options.Syncer.VerifyToken(value)
+			if !ok {
+				a.logger.Info("request rejected", zap.String("authenticator", "token"), zap.String("path", r.URL.Path))
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			a.authorize(w, r, next, "token", caller{User: "token:" + t.Name, Role: t.Role})
+			return
+		}
+
+		if c, ok := a.certificateCaller(r); ok {
+			a.authorize(w, r, next, "certificate", c)
+			return
+		}
+
+		if a.open && !a.options.Syncer.HasTokens() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		for _, auth := range a.options.Authenticators {
+			var user string
+			var groups []string
+			var err error
+			if ga, ok := auth.(plugins.GroupAuthenticator); ok {
+				user, groups, err = ga.AuthenticateGroups(r)
+			} else {
+				user, err = auth.Authenticate(r)
+			}
+			if err != nil {
+				a.logger.Info("request rejected", zap.String("authenticator", auth.Name()), zap.String("path", r.URL.Path), zap.Error(err))
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			if user == "" {
+				continue
+			}
+
+			a.authorize(w, r, next, auth.Name(), caller{User: user, Role: a.role(user, groups)})
+			return
+		}
+
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	})
+}
+
+// authorize passes the request to the handler if the role of the
+// authenticated caller has the permissions needed for it.
+func (a *API) authorize(w http.ResponseWriter, r *http.Request, next http.Handler, authenticator string, c caller) {
+	if !authorized(c.Role, r) {
+		a.logger.Info("request forbidden", zap.String("authenticator", authenticator), zap.String("user", c.User), zap.String("role", c.Role), zap.String("method", r.Method), zap.String("path", r.URL.Path))
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	a.logger.Debug("request authenticated", zap.String("authenticator", authenticator), zap.String("user", c.User), zap.String("role", c.Role), zap.String("path", r.URL.Path))
+	next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), callerKey{}, c)))
+}
@@ -0,0 +1,123 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// peerTimeout is the maximum time a peer is given to report its status.
+const peerTimeout = 5 * time.Second
+
+// Instance describes a single gdoc instance of a cluster.
+type Instance struct {
+	// The name of the instance.
+	Name string `json:"name"`
+	// The management API address the instance was reached at.  Empty for
+	// the instance that served the request.
+	Address string `json:"address,omitempty"`
+	// The version of gdoc the instance is running.
+	Version string `json:"version"`
+	// The number of repositories synchronized by the instance.
+	Repositories int `json:"repositories"`
+	// The time the last sync cycle of the instance finished.
+	LastSync time.Time `json:"last_sync"`
+	// The error returned when the peer could not be reached.
+	Error string `json:"error,omitempty"`
+}
+
+// Cluster is the response returned from the cluster endpoint.
+type Cluster struct {
+	Instances []Instance `json:"instances"`
+}
+
+// self writes the status of this instance.
+func (a *API) self(w http.ResponseWriter, r *http.Request) {
+	a.json(w, http.StatusOK, a.instance())
+}
+
+// cluster writes the status of this instance and each of its peers.  The
+// peers are queried concurrently and unreachable peers are reported with
+// the error.
+func (a *API) cluster(w http.ResponseWriter, r *http.Request) {
+	instances := make([]Instance, len(a.options.Peers)+1)
+	instances[0] = a.instance()
+
+	var wg sync.WaitGroup
+	for i, peer := range a.options.Peers {
+		wg.Add(1)
+		go func(i int, peer string) {
+			defer wg.Done()
+			instances[i+1] = peerInstance(r.Context(), a.peers, peer)
+		}(i, peer)
+	}
+	wg.Wait()
+
+	a.json(w, http.StatusOK, Cluster{Instances: instances})
+}
+
+// instance returns the status of this instance.
+func (a *API) instance() Instance {
+	return Instance{
+		Name:         a.options.InstanceName,
+		Version:      a.options.Version,
+		Repositories: len(a.options.Syncer.Repos()),
+		LastSync:     a.options.Syncer.Summary().Finished,
+	}
+}
+
+// peerInstance asks the management API of a peer for its status.
+func peerInstance(ctx context.Context, client *http.Client, peer string) Instance {
+	peer = strings.TrimSuffix(peer, "/")
+	instance := Instance{Address: peer}
+
+	ctx, cancel := context.WithTimeout(ctx, peerTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, peer+"/api/cluster/self", nil)
+	if err != nil {
+		instance.Error = err.Error()
+		return instance
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		instance.Error = err.Error()
+		return instance
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		instance.Error = fmt.Sprintf("unexpected status: %s", resp.Status)
+		return instance
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&instance); err != nil {
+		instance.Error = err.Error()
+	}
+	instance.Address = peer
+
+	return instance
+}
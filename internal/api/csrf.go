@@ -0,0 +1,105 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// csrfCookie is the cookie holding the CSRF token of the admin
+	// console.  It is readable by the console, which sends its value back
+	// in the csrfHeader.
+	csrfCookie = "gdoc_csrf"
+	// csrfHeader is the header that carries the CSRF token.
+	csrfHeader = "X-CSRF-Token"
+)
+
+// csrf refuses the requests that change the state of the service when they
+// come from a browser, which sends the Origin or Sec-Fetch-Site headers or
+// cookies, unless they carry the CSRF token of the admin console.  Browsers
+// attach cookies, basic credentials and client certificates to cross-site
+// requests on their own, but never the custom header.  Requests with a
+// bearer token and signed Slack commands are not affected since they can
+// not be forged by another site, and neither are clients such as scripts
+// that send none of the browser headers.
+func (a *API) csrf(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions:
+		case r.URL.Path == "/api/slack/commands":
+		case strings.HasPrefix(r.Header.Get("Authorization"), "Bearer "):
+		case r.Header.Get("Origin") == "" && r.Header.Get("Sec-Fetch-Site") == "" && r.Header.Get("Cookie") == "":
+		default:
+			c, err := r.Cookie(csrfCookie)
+			token := r.Header.Get(csrfHeader)
+			if err != nil || c.Value == "" || subtle.ConstantTimeCompare([]byte(c.Value), []byte(token)) != 1 {
+				a.logger.Info("request refused without a csrf token", zap.String("method", r.Method), zap.String("path", r.URL.Path), zap.String("origin", r.Header.Get("Origin")))
+				http.Error(w, "missing or invalid csrf token", http.StatusForbidden)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// setCSRFCookie gives the browser a CSRF token unless it already has one.
+// The cookie is marked secure when the request was served over TLS, when
+// secure cookies are configured or when it is sent to other sites, which
+// browsers only allow for secure cookies.
+func (a *API) setCSRFCookie(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(csrfCookie); err == nil && len(c.Value) == 64 {
+		return
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		a.logger.Error("unable to create a csrf token", zap.Error(err))
+		return
+	}
+
+	mode := sameSite(a.options.CookieSameSite)
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    hex.EncodeToString(b),
+		Path:     "/",
+		SameSite: mode,
+		Secure:   r.TLS != nil || a.options.CookieSecure || mode == http.SameSiteNoneMode,
+	})
+}
+
+// sameSite returns the SameSite attribute with the name.  Unknown names
+// are treated as strict.
+func sameSite(name string) http.SameSite {
+	switch strings.ToLower(name) {
+	case "lax":
+		return http.SameSiteLaxMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteStrictMode
+	}
+}
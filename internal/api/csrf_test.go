@@ -0,0 +1,66 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestCSRF(t *testing.T) {
+	a := New(APIOptions{Logger: zap.NewNop()})
+	h := a.csrf(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	token := "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string]string
+		want    int
+	}{
+		{"cross origin", http.MethodPost, "/api/repos/ctxswitch/gdoc/resync", map[string]string{"Origin": "https://evil.example.com"}, http.StatusForbidden},
+		{"cross site", http.MethodPost, "/api/repos/ctxswitch/gdoc/resync", map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusForbidden},
+		{"missing token", http.MethodPost, "/api/modules", map[string]string{"Cookie": csrfCookie + "=" + token}, http.StatusForbidden},
+		{"missing cookie", http.MethodPost, "/api/modules", map[string]string{"Origin": "https://gdoc.example.com", csrfHeader: token}, http.StatusForbidden},
+		{"mismatched token", http.MethodPost, "/api/modules", map[string]string{"Cookie": csrfCookie + "=" + token, csrfHeader: "forged"}, http.StatusForbidden},
+		{"matching token", http.MethodPost, "/api/modules", map[string]string{"Origin": "https://gdoc.example.com", "Cookie": csrfCookie + "=" + token, csrfHeader: token}, http.StatusNoContent},
+		{"read only", http.MethodGet, "/api/repos", map[string]string{"Origin": "https://evil.example.com"}, http.StatusNoContent},
+		{"bearer token", http.MethodPost, "/api/modules", map[string]string{"Origin": "https://evil.example.com", "Authorization": "Bearer token"}, http.StatusNoContent},
+		{"slack command", http.MethodPost, "/api/slack/commands", map[string]string{"Origin": "https://slack.com"}, http.StatusNoContent},
+		{"script", http.MethodPost, "/api/modules", nil, http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package api
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/ctxswitch/gdoc/internal/report"
+	"github.com/ctxswitch/gdoc/pkg/docserver"
+	"go.uber.org/zap"
+)
+
+// maxPackageResults is the number of packages returned by a package
+// search.
+const maxPackageResults = 50
+
+// PackageResult is a package returned from a package search.
+type PackageResult struct {
+	Owner      string `json:"owner"`
+	Name       string `json:"name"`
+	ImportPath string `json:"import_path"`
+	Synopsis   string `json:"synopsis"`
+}
+
+// findPackages returns the packages whose import path contains every term
+// of the query.  The match is case insensitive.  Packages of repositories
+// that are kept out of searches are never returned.
+func (a *API) findPackages(q string) []PackageResult {
+	terms := strings.Fields(strings.ToLower(q))
+	results := []PackageResult{}
+
+	for _, p := range report.Packages(a.searchable()) {
+		ip := strings.ToLower(p.ImportPath)
+		matched := true
+		for _, t := range terms {
+			if !strings.Contains(ip, t) {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		result := PackageResult{Owner: p.Owner, Name: p.Name, ImportPath: p.ImportPath}
+		if pd, err := docserver.ReadPackage(p.Dir, p.ImportPath); err == nil {
+			result.Synopsis = pd.Synopsis
+		}
+		results = append(results, result)
+		if len(results) == maxPackageResults {
+			break
+		}
+	}
+
+	return results
+}
+
+// packageDoc returns the documentation of the package with the import
+// path.
+func (a *API) packageDoc(importPath string) (*docserver.PackageDoc, error) {
+	for _, p := range report.Packages(a.options.Syncer.Repos()) {
+		if p.ImportPath == importPath {
+			return docserver.ReadPackage(p.Dir, p.ImportPath)
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+// docs handles /api/docs, which searches the packages by the q query
+// parameter, and /api/docs/{import path}, which writes the documentation of
+// a package.  A single declaration is written when the symbol query
+// parameter is set.
+func (a *API) docs(w http.ResponseWriter, r *http.Request) {
+	importPath := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/docs"), "/")
+	if importPath == "" {
+		a.json(w, http.StatusOK, a.findPackages(r.URL.Query().Get("q")))
+		return
+	}
+
+	pd, err := a.packageDoc(importPath)
+	switch {
+	case errors.Is(err, os.ErrNotExist), errors.Is(err, docserver.ErrNoPackage):
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		a.logger.Error("unable to read the package", zap.String("package", importPath), zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if name := r.URL.Query().Get("symbol"); name != "" {
+		s, ok := pd.Symbol(name)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		a.json(w, http.StatusOK, s)
+		return
+	}
+
+	a.json(w, http.StatusOK, pd)
+}
@@ -0,0 +1,138 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package api
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ctxswitch/gdoc/internal/modules"
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+	"go.uber.org/zap"
+)
+
+// downloadPattern matches the path of a download and captures the owner,
+// name, ref and archive format.
+var downloadPattern = regexp.MustCompile(`^/download/([^/]+)/([^/@]+)@([^/]+?)\.(zip|tar\.gz|tgz)$`)
+
+// commitPattern matches abbreviated or full commit shas.
+var commitPattern = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// download writes an archive of a synchronized repository.  The path is of
+// the form /download/{owner}/{name}@{ref}.zip for a module zip as created
+// by the go command, or .tar.gz for a tarball of the whole tree.  The ref
+// is the default branch, one of the additional branches or a commit that
+// is present in the local copy.
+func (a *API) download(w http.ResponseWriter, r *http.Request) {
+	m := downloadPattern.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		http.NotFound(w, r)
+		return
+	}
+	owner, name, ref, format := m[1], m[2], m[3], m[4]
+
+	var repo *syncer.Repo
+	for _, rp := range a.options.Syncer.Repos() {
+		if rp.Owner == owner && rp.Name == name {
+			rp := rp
+			repo = &rp
+			break
+		}
+	}
+	if repo == nil || repo.LocalPath == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	dir, rev := repo.LocalPath, ""
+	immutable := false
+	switch {
+	case ref == repo.DefaultBranch || ref == "HEAD":
+	case branchPath(repo, ref) != "":
+		dir = branchPath(repo, ref)
+	case commitPattern.MatchString(ref):
+		rev, immutable = ref, true
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	c, err := modules.Commit(dir, rev)
+	if err != nil {
+		a.logger.Debug("unable to open commit", zap.String("repo", owner+"/"+name), zap.String("ref", ref), zap.Error(err))
+		http.NotFound(w, r)
+		return
+	}
+
+	// The archive is spooled to disk so that failures are reported instead
+	// of truncating the response.
+	f, err := os.CreateTemp("", "gdoc-download-*")
+	if err != nil {
+		a.logger.Error("unable to create archive", zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	filename := name + "-" + c.Hash.String()[:12]
+	if format == "zip" {
+		fallback, _ := filepath.Rel(filepath.Join(a.options.GodocRoot, "src"), repo.LocalPath)
+		var mod modules.Module
+		if mod, err = modules.WriteZip(f, c, filepath.ToSlash(fallback)); err == nil {
+			filename = strings.ReplaceAll(mod.Path, "/", "_") + "@" + mod.Version + ".zip"
+			w.Header().Set("Content-Type", "application/zip")
+		}
+	} else {
+		if err = modules.WriteTarball(f, c, filename); err == nil {
+			filename += ".tar.gz"
+			w.Header().Set("Content-Type", "application/gzip")
+		}
+	}
+	switch {
+	case errors.Is(err, modules.ErrArchiveTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		a.logger.Error("unable to create archive", zap.String("repo", owner+"/"+name), zap.String("ref", ref), zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	if immutable {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+	http.ServeContent(w, r, filename, c.Committer.When, f)
+}
+
+// branchPath returns the checkout of the additional branch of the
+// repository, or an empty string if the branch is not checked out.
+func branchPath(r *syncer.Repo, name string) string {
+	for _, b := range r.Branches {
+		if b.Name == name {
+			return b.LocalPath
+		}
+	}
+	return ""
+}
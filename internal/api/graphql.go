@@ -0,0 +1,1443 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ctxswitch/gdoc/internal/report"
+	"github.com/ctxswitch/gdoc/pkg/docserver"
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+)
+
+// The GraphQL endpoint is a small handwritten subset of GraphQL over the
+// data of the REST endpoints.  Queries with fields, aliases, arguments and
+// variables are supported.  Fragments, directives, mutations and
+// introspection beyond __typename are not.
+//
+//	type Query {
+//	  status: SyncStatus
+//	  repositories(first: Int, after: String, owner: String): RepositoryConnection
+//	  repository(owner: String!, name: String!): Repository
+//	  packages(first: Int, after: String, query: String): PackageConnection
+//	  package(importPath: String!): Package
+//	}
+//
+//	type Repository {
+//	  owner, name, fullName, cloneUrl, defaultBranch, commitSha, htmlUrl,
+//	  description, license, version: String
+//	  stars: Int
+//	  topics: [String]
+//	  archived, paused: Boolean
+//	  packages(first: Int, after: String): PackageConnection
+//	}
+//
+//	type Package {
+//	  importPath, name, synopsis, doc: String
+//	  repository: Repository
+//	  symbols(first: Int, after: String, kind: String): SymbolConnection
+//	}
+//
+//	type Symbol {
+//	  name, kind, signature, doc, deprecated: String
+//	}
+//
+// Every connection has totalCount, nodes, edges { cursor node } and
+// pageInfo { hasNextPage endCursor }.
+
+const (
+	// gqlMaxDepth is the deepest nesting of selection sets and argument
+	// values that a document may have.
+	gqlMaxDepth = 12
+	// gqlMaxFields is the number of fields that a document may select.
+	gqlMaxFields = 500
+	// gqlMaxCost is the highest cost that a query may have.  Each field
+	// costs one and the fields below a connection are counted once for
+	// every node of the page it asks for.
+	gqlMaxCost = 10000
+)
+
+// gqlConnections are the fields that return a page of a list.
+var gqlConnections = map[string]bool{
+	"repositories": true,
+	"packages":     true,
+	"symbols":      true,
+}
+
+// gqlRequest is a GraphQL request.
+type gqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// gqlResponse is a GraphQL response.  Data is left out when the request
+// could not be executed at all.
+type gqlResponse struct {
+	Data   interface{} `json:"data,omitempty"`
+	Errors []gqlError  `json:"errors,omitempty"`
+}
+
+// gqlError is an error of a GraphQL request along with the path of the
+// field that failed.
+type gqlError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+// graphql handles GraphQL queries posted as JSON or sent as the query
+// parameter of a GET request.
+func (a *API) graphql(w http.ResponseWriter, r *http.Request) {
+	var req gqlRequest
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				invalidPayload("graphql")
+				a.json(w, http.StatusBadRequest, gqlResponse{Errors: []gqlError{{Message: "invalid variables: " + err.Error()}}})
+				return
+			}
+		}
+	case http.MethodPost:
+		body, ok := a.readBody(w, r)
+		if !ok {
+			return
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			invalidPayload("graphql")
+			a.json(w, http.StatusBadRequest, gqlResponse{Errors: []gqlError{{Message: err.Error()}}})
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	selections, err := parseQuery(req.Query, req.OperationName, req.Variables)
+	if err != nil {
+		invalidPayload("graphql")
+		a.json(w, http.StatusBadRequest, gqlResponse{Errors: []gqlError{{Message: err.Error()}}})
+		return
+	}
+
+	e := &gqlExecutor{a: a}
+	data := e.object(gqlQuery{e: e}, selections, nil)
+	a.json(w, http.StatusOK, gqlResponse{Data: data, Errors: e.errors})
+}
+
+// gqlField is a field of a selection set.
+type gqlField struct {
+	Alias string
+	Name  string
+	// The arguments of the field.  Variables are gqlVariable values until
+	// the field is resolved.
+	Args       map[string]interface{}
+	Selections []gqlField
+}
+
+// key returns the name of the field in the response.
+func (f gqlField) key() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+// gqlVariable is a reference to a variable in an argument.
+type gqlVariable string
+
+// gqlVariableDef is a variable declared by an operation.
+type gqlVariableDef struct {
+	Name     string
+	Required bool
+	// The default value.  Nil if there is none.
+	Default interface{}
+}
+
+// gqlOperation is a query of a GraphQL document.
+type gqlOperation struct {
+	Name       string
+	Variables  []gqlVariableDef
+	Selections []gqlField
+}
+
+// parseQuery parses the document and returns the selections of the
+// operation with the name, or of its only operation when name is empty,
+// with the variables substituted.  Documents that nest too deeply or select
+// too many fields are rejected while they are parsed, and queries that
+// cost too much once their page sizes are known.
+func parseQuery(src, name string, vars map[string]interface{}) ([]gqlField, error) {
+	p := &gqlParser{src: src}
+	ops, err := p.document()
+	if err != nil {
+		return nil, err
+	}
+
+	var op *gqlOperation
+	switch {
+	case len(ops) == 0:
+		return nil, errors.New("the document has no operation")
+	case name == "" && len(ops) > 1:
+		return nil, errors.New("an operation name is required when the document has several operations")
+	case name == "":
+		op = &ops[0]
+	default:
+		for i := range ops {
+			if ops[i].Name == name {
+				op = &ops[i]
+			}
+		}
+		if op == nil {
+			return nil, fmt.Errorf("unknown operation %s", name)
+		}
+	}
+
+	values := make(map[string]interface{})
+	for _, v := range op.Variables {
+		value, ok := vars[v.Name]
+		if !ok || value == nil {
+			value = v.Default
+		}
+		if value == nil && v.Required {
+			return nil, fmt.Errorf("variable $%s is required", v.Name)
+		}
+		values[v.Name] = value
+	}
+
+	selections, err := substitute(op.Selections, values)
+	if err != nil {
+		return nil, err
+	}
+	if c := cost(selections); c > gqlMaxCost {
+		return nil, fmt.Errorf("the query costs %d, more than the maximum of %d", c, gqlMaxCost)
+	}
+	return selections, nil
+}
+
+// cost returns the cost of the selections.  The selections of a connection
+// are counted for every node of its page, which holds defaultPageSize
+// nodes unless the first argument asks for another size.
+func cost(fields []gqlField) int {
+	total := 0
+	for _, f := range fields {
+		n := 1
+		if gqlConnections[f.Name] {
+			first, err := intArg(f.Args, "first", defaultPageSize)
+			if err != nil || first > maxPageSize {
+				first = maxPageSize
+			}
+			n = first
+		}
+		total += 1 + n*cost(f.Selections)
+		if total > gqlMaxCost {
+			return total
+		}
+	}
+	return total
+}
+
+// substitute returns the fields with the variables in their arguments
+// replaced by their values.
+func substitute(fields []gqlField, values map[string]interface{}) ([]gqlField, error) {
+	out := make([]gqlField, len(fields))
+	for i, f := range fields {
+		args := make(map[string]interface{}, len(f.Args))
+		for k, v := range f.Args {
+			value, err := substituteValue(v, values)
+			if err != nil {
+				return nil, err
+			}
+			args[k] = value
+		}
+
+		selections, err := substitute(f.Selections, values)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = gqlField{Alias: f.Alias, Name: f.Name, Args: args, Selections: selections}
+	}
+	return out, nil
+}
+
+// substituteValue returns the value with its variables replaced.
+func substituteValue(v interface{}, values map[string]interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case gqlVariable:
+		value, ok := values[string(v)]
+		if !ok {
+			return nil, fmt.Errorf("variable $%s is not declared", v)
+		}
+		return value, nil
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			value, err := substituteValue(item, values)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = value
+		}
+		return list, nil
+	case map[string]interface{}:
+		obj := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			value, err := substituteValue(item, values)
+			if err != nil {
+				return nil, err
+			}
+			obj[k] = value
+		}
+		return obj, nil
+	default:
+		return v, nil
+	}
+}
+
+// Token kinds of a GraphQL document.
+const (
+	gqlEOF = iota
+	gqlPunct
+	gqlName
+	gqlString
+	gqlNumber
+)
+
+// gqlToken is a lexical token of a GraphQL document.
+type gqlToken struct {
+	kind int
+	text string
+}
+
+// gqlParser parses a GraphQL document.
+type gqlParser struct {
+	src string
+	pos int
+	tok gqlToken
+	// The nesting of the current selection set or value.
+	depth int
+	// The number of fields parsed so far.
+	fields int
+}
+
+// enter records that the parser descends into a selection set or value
+// and returns an error if the document nests too deeply.
+func (p *gqlParser) enter() error {
+	p.depth++
+	if p.depth > gqlMaxDepth {
+		return fmt.Errorf("the document nests deeper than %d levels", gqlMaxDepth)
+	}
+	return nil
+}
+
+// leave records that the parser is done with a selection set or value.
+func (p *gqlParser) leave() {
+	p.depth--
+}
+
+// document parses the operations of the document.
+func (p *gqlParser) document() ([]gqlOperation, error) {
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	var ops []gqlOperation
+	for p.tok.kind != gqlEOF {
+		var op gqlOperation
+		switch {
+		case p.is(gqlPunct, "{"):
+		case p.is(gqlName, "query"):
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			if p.tok.kind == gqlName {
+				op.Name = p.tok.text
+				if err := p.next(); err != nil {
+					return nil, err
+				}
+			}
+			if p.is(gqlPunct, "(") {
+				vars, err := p.variableDefs()
+				if err != nil {
+					return nil, err
+				}
+				op.Variables = vars
+			}
+		case p.is(gqlName, "mutation"), p.is(gqlName, "subscription"):
+			return nil, fmt.Errorf("%s operations are not supported", p.tok.text)
+		case p.is(gqlName, "fragment"):
+			return nil, errors.New("fragments are not supported")
+		default:
+			return nil, p.unexpected()
+		}
+
+		selections, err := p.selectionSet()
+		if err != nil {
+			return nil, err
+		}
+		op.Selections = selections
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// variableDefs parses the variable definitions of an operation.
+func (p *gqlParser) variableDefs() ([]gqlVariableDef, error) {
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	var defs []gqlVariableDef
+	for !p.is(gqlPunct, ")") {
+		if err := p.expect(gqlPunct, "$"); err != nil {
+			return nil, err
+		}
+		if p.tok.kind != gqlName {
+			return nil, p.unexpected()
+		}
+		def := gqlVariableDef{Name: p.tok.text}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(gqlPunct, ":"); err != nil {
+			return nil, err
+		}
+
+		required, err := p.typeRef()
+		if err != nil {
+			return nil, err
+		}
+		def.Required = required
+
+		if p.is(gqlPunct, "=") {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			if def.Default, err = p.value(true); err != nil {
+				return nil, err
+			}
+		}
+		defs = append(defs, def)
+	}
+	return defs, p.next()
+}
+
+// typeRef parses the type of a variable and returns true if it is non
+// null.  Types are not checked otherwise, arguments are converted when the
+// fields are resolved.
+func (p *gqlParser) typeRef() (bool, error) {
+	switch {
+	case p.tok.kind == gqlName:
+		if err := p.next(); err != nil {
+			return false, err
+		}
+	case p.is(gqlPunct, "["):
+		if err := p.enter(); err != nil {
+			return false, err
+		}
+		defer p.leave()
+		if err := p.next(); err != nil {
+			return false, err
+		}
+		if _, err := p.typeRef(); err != nil {
+			return false, err
+		}
+		if err := p.expect(gqlPunct, "]"); err != nil {
+			return false, err
+		}
+	default:
+		return false, p.unexpected()
+	}
+
+	if p.is(gqlPunct, "!") {
+		return true, p.next()
+	}
+	return false, nil
+}
+
+// selectionSet parses the fields between braces.
+func (p *gqlParser) selectionSet() ([]gqlField, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	if err := p.expect(gqlPunct, "{"); err != nil {
+		return nil, err
+	}
+
+	var fields []gqlField
+	for !p.is(gqlPunct, "}") {
+		switch {
+		case p.is(gqlPunct, "..."):
+			return nil, errors.New("fragments are not supported")
+		case p.tok.kind != gqlName:
+			return nil, p.unexpected()
+		}
+
+		p.fields++
+		if p.fields > gqlMaxFields {
+			return nil, fmt.Errorf("the document selects more than %d fields", gqlMaxFields)
+		}
+		f := gqlField{Name: p.tok.text}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if p.is(gqlPunct, ":") {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			if p.tok.kind != gqlName {
+				return nil, p.unexpected()
+			}
+			f.Alias, f.Name = f.Name, p.tok.text
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		}
+
+		if p.is(gqlPunct, "(") {
+			args, err := p.arguments()
+			if err != nil {
+				return nil, err
+			}
+			f.Args = args
+		}
+		if p.is(gqlPunct, "@") {
+			return nil, errors.New("directives are not supported")
+		}
+		if p.is(gqlPunct, "{") {
+			selections, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			f.Selections = selections
+		}
+		fields = append(fields, f)
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("empty selection set")
+	}
+	return fields, p.next()
+}
+
+// arguments parses the arguments of a field.
+func (p *gqlParser) arguments() (map[string]interface{}, error) {
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	args := make(map[string]interface{})
+	for !p.is(gqlPunct, ")") {
+		if p.tok.kind != gqlName {
+			return nil, p.unexpected()
+		}
+		name := p.tok.text
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(gqlPunct, ":"); err != nil {
+			return nil, err
+		}
+
+		v, err := p.value(false)
+		if err != nil {
+			return nil, err
+		}
+		args[name] = v
+	}
+	return args, p.next()
+}
+
+// value parses a value.  Constant values, such as the defaults of
+// variables, may not refer to variables.
+func (p *gqlParser) value(constant bool) (interface{}, error) {
+	tok := p.tok
+	switch {
+	case tok.kind == gqlPunct && tok.text == "$" && !constant:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind != gqlName {
+			return nil, p.unexpected()
+		}
+		name := p.tok.text
+		return gqlVariable(name), p.next()
+	case tok.kind == gqlString:
+		return tok.text, p.next()
+	case tok.kind == gqlNumber:
+		if n, err := strconv.Atoi(tok.text); err == nil {
+			return n, p.next()
+		}
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", tok.text)
+		}
+		return f, p.next()
+	case tok.kind == gqlName:
+		var v interface{}
+		switch tok.text {
+		case "true":
+			v = true
+		case "false":
+			v = false
+		case "null":
+		default:
+			// Enum values are passed on as their name.
+			v = tok.text
+		}
+		return v, p.next()
+	case tok.kind == gqlPunct && tok.text == "[":
+		if err := p.enter(); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		list := []interface{}{}
+		for !p.is(gqlPunct, "]") {
+			item, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		return list, p.next()
+	case tok.kind == gqlPunct && tok.text == "{":
+		if err := p.enter(); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		obj := make(map[string]interface{})
+		for !p.is(gqlPunct, "}") {
+			if p.tok.kind != gqlName {
+				return nil, p.unexpected()
+			}
+			name := p.tok.text
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			if err := p.expect(gqlPunct, ":"); err != nil {
+				return nil, err
+			}
+			item, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			obj[name] = item
+		}
+		return obj, p.next()
+	default:
+		return nil, p.unexpected()
+	}
+}
+
+// is returns true if the current token is of the kind and has the text.
+func (p *gqlParser) is(kind int, text string) bool {
+	return p.tok.kind == kind && p.tok.text == text
+}
+
+// expect moves past the current token if it is of the kind and has the
+// text, and returns an error otherwise.
+func (p *gqlParser) expect(kind int, text string) error {
+	if !p.is(kind, text) {
+		return p.unexpected()
+	}
+	return p.next()
+}
+
+// unexpected returns the error for the current token.
+func (p *gqlParser) unexpected() error {
+	if p.tok.kind == gqlEOF {
+		return errors.New("syntax error: unexpected end of document")
+	}
+	return fmt.Errorf("syntax error: unexpected %q at offset %d", p.tok.text, p.pos)
+}
+
+// next reads the next token.  Whitespace, commas and comments are
+// skipped.
+func (p *gqlParser) next() error {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '#' {
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' && p.src[p.pos] != '\r' {
+				p.pos++
+			}
+			continue
+		}
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' && c != ',' {
+			break
+		}
+		p.pos++
+	}
+	if strings.HasPrefix(p.src[p.pos:], "\ufeff") {
+		p.pos += len("\ufeff")
+		return p.next()
+	}
+	if p.pos >= len(p.src) {
+		p.tok = gqlToken{kind: gqlEOF}
+		return nil
+	}
+
+	start := p.pos
+	c := p.src[p.pos]
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.pos += 3
+		p.tok = gqlToken{kind: gqlPunct, text: "..."}
+	case strings.IndexByte("!$()[]{}:=@|&", c) >= 0:
+		p.pos++
+		p.tok = gqlToken{kind: gqlPunct, text: string(c)}
+	case c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+		for p.pos < len(p.src) && nameByte(p.src[p.pos]) {
+			p.pos++
+		}
+		p.tok = gqlToken{kind: gqlName, text: p.src[start:p.pos]}
+	case c == '-' || '0' <= c && c <= '9':
+		p.pos++
+		for p.pos < len(p.src) && strings.IndexByte("0123456789.eE+-", p.src[p.pos]) >= 0 {
+			p.pos++
+		}
+		p.tok = gqlToken{kind: gqlNumber, text: p.src[start:p.pos]}
+	case c == '"':
+		if strings.HasPrefix(p.src[p.pos:], `"""`) {
+			return errors.New("block strings are not supported")
+		}
+		return p.str()
+	default:
+		return fmt.Errorf("syntax error: unexpected character %q at offset %d", c, p.pos)
+	}
+	return nil
+}
+
+// str reads a string token.  The escapes of GraphQL are the escapes of
+// JSON, so the string is decoded as a JSON string.
+func (p *gqlParser) str() error {
+	start := p.pos
+	p.pos++
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case '\\':
+			p.pos += 2
+			continue
+		case '\n', '\r':
+			return errors.New("syntax error: unterminated string")
+		case '"':
+			p.pos++
+			var s string
+			if err := json.Unmarshal([]byte(p.src[start:p.pos]), &s); err != nil {
+				return fmt.Errorf("syntax error: invalid string at offset %d", start)
+			}
+			p.tok = gqlToken{kind: gqlString, text: s}
+			return nil
+		}
+		p.pos++
+	}
+	return errors.New("syntax error: unterminated string")
+}
+
+// nameByte returns true if the byte may be part of a name.
+func nameByte(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// gqlObject is a value of an object type that resolves its fields.
+type gqlObject interface {
+	// typename returns the name of the type of the object.
+	typename() string
+	// field returns the value of the field.  Values are either scalars,
+	// which are encoded as JSON, objects or lists of objects.  Nil is
+	// returned as null.
+	field(name string, args map[string]interface{}) (interface{}, error)
+}
+
+// gqlResult is an object of the response.  The fields keep the order of
+// the selection set.
+type gqlResult []gqlEntry
+
+// gqlEntry is a field of a response object.
+type gqlEntry struct {
+	key   string
+	value interface{}
+}
+
+// MarshalJSON encodes the result as a JSON object in field order.
+func (r gqlResult) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, e := range r {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, err := json.Marshal(e.key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(e.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// gqlExecutor resolves the selections of a query.  Fields that fail are
+// null in the response and their errors are collected.  The repositories
+// and their packages are only read once per request, however often the
+// selections ask for them.
+type gqlExecutor struct {
+	a      *API
+	errors []gqlError
+
+	repos     []syncer.Repo
+	reposRead bool
+	// The packages of every repository, and of single repositories keyed
+	// by owner/name.
+	packages     []report.Package
+	packagesRead bool
+	repoPackages map[string][]report.Package
+}
+
+// repositories returns the synchronized repositories.
+func (e *gqlExecutor) repositories() []syncer.Repo {
+	if !e.reposRead {
+		e.repos = e.a.options.Syncer.Repos()
+		e.reposRead = true
+	}
+	return e.repos
+}
+
+// findRepo returns the synchronized repository with the owner and name.
+func (e *gqlExecutor) findRepo(owner, name string) (syncer.Repo, bool) {
+	for _, r := range e.repositories() {
+		if r.Owner == owner && r.Name == name {
+			return r, true
+		}
+	}
+	return syncer.Repo{}, false
+}
+
+// allPackages returns the packages of every synchronized repository.
+func (e *gqlExecutor) allPackages() []report.Package {
+	if !e.packagesRead {
+		e.packages = report.Packages(e.repositories())
+		e.packagesRead = true
+	}
+	return e.packages
+}
+
+// packagesOf returns the packages of the repository.
+func (e *gqlExecutor) packagesOf(r syncer.Repo) []report.Package {
+	key := r.Owner + "/" + r.Name
+	if pkgs, ok := e.repoPackages[key]; ok {
+		return pkgs
+	}
+	if e.repoPackages == nil {
+		e.repoPackages = make(map[string][]report.Package)
+	}
+	pkgs := report.Packages([]syncer.Repo{r})
+	e.repoPackages[key] = pkgs
+	return pkgs
+}
+
+// fail records the error of the field at the path.
+func (e *gqlExecutor) fail(path []interface{}, err error) {
+	e.errors = append(e.errors, gqlError{Message: err.Error(), Path: path})
+}
+
+// object resolves the selections on the object.
+func (e *gqlExecutor) object(obj gqlObject, selections []gqlField, path []interface{}) gqlResult {
+	result := gqlResult{}
+	for _, f := range selections {
+		p := append(append([]interface{}{}, path...), f.key())
+
+		var v interface{}
+		var err error
+		if f.Name == "__typename" {
+			v = obj.typename()
+		} else {
+			v, err = obj.field(f.Name, f.Args)
+		}
+		if err != nil {
+			e.fail(p, err)
+			result = append(result, gqlEntry{key: f.key()})
+			continue
+		}
+		result = append(result, gqlEntry{key: f.key(), value: e.complete(f, v, p)})
+	}
+	return result
+}
+
+// complete resolves the selections of the field on its value.
+func (e *gqlExecutor) complete(f gqlField, v interface{}, path []interface{}) interface{} {
+	switch v := v.(type) {
+	case gqlObject:
+		if len(f.Selections) == 0 {
+			e.fail(path, fmt.Errorf("field %s of type %s must have a selection of subfields", f.Name, v.typename()))
+			return nil
+		}
+		return e.object(v, f.Selections, path)
+	case []gqlObject:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = e.complete(f, item, append(append([]interface{}{}, path...), i))
+		}
+		return list
+	default:
+		if len(f.Selections) > 0 && v != nil {
+			e.fail(path, fmt.Errorf("field %s is a scalar and has no subfields", f.Name))
+			return nil
+		}
+		return v
+	}
+}
+
+// unknownField returns the error for a field that the type does not have.
+func unknownField(typename, name string) error {
+	return fmt.Errorf("cannot query field %s on type %s", name, typename)
+}
+
+// stringArg returns the string argument.  Missing and null arguments are
+// empty.
+func stringArg(args map[string]interface{}, name string) (string, error) {
+	switch v := args[name].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	default:
+		return "", fmt.Errorf("argument %s must be a string", name)
+	}
+}
+
+// requiredArg returns the string argument and fails if it is empty.
+func requiredArg(args map[string]interface{}, name string) (string, error) {
+	v, err := stringArg(args, name)
+	if err == nil && v == "" {
+		err = fmt.Errorf("argument %s is required", name)
+	}
+	return v, err
+}
+
+// intArg returns the integer argument, or def when it is missing or null.
+// Variables decoded from JSON are floats.
+func intArg(args map[string]interface{}, name string, def int) (int, error) {
+	switch v := args[name].(type) {
+	case nil:
+		return def, nil
+	case int:
+		return v, nil
+	case float64:
+		if v == float64(int(v)) {
+			return int(v), nil
+		}
+	}
+	return 0, fmt.Errorf("argument %s must be an integer", name)
+}
+
+// gqlCursorPrefix is the prefix of the decoded cursors.
+const gqlCursorPrefix = "cursor:"
+
+// cursor returns the opaque cursor of the item at the offset.
+func cursor(offset int) string {
+	return base64.StdEncoding.EncodeToString([]byte(gqlCursorPrefix + strconv.Itoa(offset)))
+}
+
+// page returns the bounds of the page of a list with n items selected by
+// the first and after arguments.  Pages hold defaultPageSize items unless
+// first is given, and at most maxPageSize.
+func page(args map[string]interface{}, n int) (int, int, error) {
+	first, err := intArg(args, "first", defaultPageSize)
+	if err != nil {
+		return 0, 0, err
+	}
+	if first < 0 || first > maxPageSize {
+		return 0, 0, fmt.Errorf("argument first must be between 0 and %d", maxPageSize)
+	}
+	after, err := stringArg(args, "after")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	start := 0
+	if after != "" {
+		b, err := base64.StdEncoding.DecodeString(after)
+		if err != nil || !strings.HasPrefix(string(b), gqlCursorPrefix) {
+			return 0, 0, errors.New("invalid cursor")
+		}
+		offset, err := strconv.Atoi(strings.TrimPrefix(string(b), gqlCursorPrefix))
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("invalid cursor")
+		}
+		start = offset + 1
+	}
+
+	if start > n {
+		start = n
+	}
+	end := start + first
+	if end > n {
+		end = n
+	}
+	return start, end, nil
+}
+
+// gqlConnection is a page of a list.
+type gqlConnection struct {
+	// The name of the type of the connection.
+	name  string
+	nodes []gqlObject
+	// The offset of the first node in the list.
+	offset int
+	// The number of items in the list.
+	total int
+}
+
+// connection returns the page of the list selected by the arguments.  The
+// nodes are only created for the items on the page.
+func connection(name string, args map[string]interface{}, n int, node func(i int) gqlObject) (interface{}, error) {
+	start, end, err := page(args, n)
+	if err != nil {
+		return nil, err
+	}
+
+	c := gqlConnection{name: name, nodes: []gqlObject{}, offset: start, total: n}
+	for i := start; i < end; i++ {
+		c.nodes = append(c.nodes, node(i))
+	}
+	return c, nil
+}
+
+func (c gqlConnection) typename() string {
+	return c.name
+}
+
+func (c gqlConnection) field(name string, args map[string]interface{}) (interface{}, error) {
+	switch name {
+	case "totalCount":
+		return c.total, nil
+	case "nodes":
+		return c.nodes, nil
+	case "edges":
+		edges := make([]gqlObject, len(c.nodes))
+		for i, n := range c.nodes {
+			edges[i] = gqlEdge{name: strings.TrimSuffix(c.name, "Connection") + "Edge", cursor: cursor(c.offset + i), node: n}
+		}
+		return edges, nil
+	case "pageInfo":
+		info := gqlPageInfo{hasNext: c.offset+len(c.nodes) < c.total, hasPrevious: c.offset > 0}
+		if len(c.nodes) > 0 {
+			info.start, info.end = cursor(c.offset), cursor(c.offset+len(c.nodes)-1)
+		}
+		return info, nil
+	default:
+		return nil, unknownField(c.name, name)
+	}
+}
+
+// gqlEdge is a node of a connection with its cursor.
+type gqlEdge struct {
+	name   string
+	cursor string
+	node   gqlObject
+}
+
+func (e gqlEdge) typename() string {
+	return e.name
+}
+
+func (e gqlEdge) field(name string, args map[string]interface{}) (interface{}, error) {
+	switch name {
+	case "cursor":
+		return e.cursor, nil
+	case "node":
+		return e.node, nil
+	default:
+		return nil, unknownField(e.name, name)
+	}
+}
+
+// gqlPageInfo describes the position of a page in its list.
+type gqlPageInfo struct {
+	hasNext     bool
+	hasPrevious bool
+	// The cursors of the first and last nodes.  Empty when the page is
+	// empty.
+	start string
+	end   string
+}
+
+func (p gqlPageInfo) typename() string {
+	return "PageInfo"
+}
+
+func (p gqlPageInfo) field(name string, args map[string]interface{}) (interface{}, error) {
+	nullable := func(s string) interface{} {
+		if s == "" {
+			return nil
+		}
+		return s
+	}
+
+	switch name {
+	case "hasNextPage":
+		return p.hasNext, nil
+	case "hasPreviousPage":
+		return p.hasPrevious, nil
+	case "startCursor":
+		return nullable(p.start), nil
+	case "endCursor":
+		return nullable(p.end), nil
+	default:
+		return nil, unknownField("PageInfo", name)
+	}
+}
+
+// gqlQuery is the root of the queries.
+type gqlQuery struct {
+	e *gqlExecutor
+}
+
+func (q gqlQuery) typename() string {
+	return "Query"
+}
+
+func (q gqlQuery) field(name string, args map[string]interface{}) (interface{}, error) {
+	switch name {
+	case "status":
+		return gqlStatus{a: q.e.a}, nil
+	case "repositories":
+		owner, err := stringArg(args, "owner")
+		if err != nil {
+			return nil, err
+		}
+		var repos []syncer.Repo
+		for _, r := range q.e.repositories() {
+			if owner == "" || r.Owner == owner {
+				repos = append(repos, r)
+			}
+		}
+		return connection("RepositoryConnection", args, len(repos), func(i int) gqlObject {
+			return gqlRepository{e: q.e, repo: repos[i]}
+		})
+	case "repository":
+		owner, err := requiredArg(args, "owner")
+		if err != nil {
+			return nil, err
+		}
+		repo, err := requiredArg(args, "name")
+		if err != nil {
+			return nil, err
+		}
+		if r, ok := q.e.findRepo(owner, repo); ok {
+			return gqlRepository{e: q.e, repo: r}, nil
+		}
+		return nil, nil
+	case "packages":
+		query, err := stringArg(args, "query")
+		if err != nil {
+			return nil, err
+		}
+		// Searches leave out the repositories that are kept out of
+		// searches, like /api/docs?q= does.
+		pkgs := q.e.allPackages()
+		if query != "" {
+			pkgs = searchablePackages(pkgs, q.e.a.searchable())
+		}
+		pkgs = matchPackages(pkgs, query)
+		return connection("PackageConnection", args, len(pkgs), func(i int) gqlObject {
+			return &gqlPackage{e: q.e, pkg: pkgs[i]}
+		})
+	case "package":
+		importPath, err := requiredArg(args, "importPath")
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range q.e.allPackages() {
+			if p.ImportPath == importPath {
+				return &gqlPackage{e: q.e, pkg: p}, nil
+			}
+		}
+		return nil, nil
+	default:
+		return nil, unknownField("Query", name)
+	}
+}
+
+// searchablePackages returns the packages that belong to the
+// repositories.
+func searchablePackages(pkgs []report.Package, repos []syncer.Repo) []report.Package {
+	keep := make(map[string]bool, len(repos))
+	for _, r := range repos {
+		keep[r.Owner+"/"+r.Name] = true
+	}
+
+	var matched []report.Package
+	for _, p := range pkgs {
+		if keep[p.Owner+"/"+p.Name] {
+			matched = append(matched, p)
+		}
+	}
+	return matched
+}
+
+// matchPackages returns the packages whose import path contains every
+// term of the query.  The match is case insensitive.
+func matchPackages(pkgs []report.Package, query string) []report.Package {
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return pkgs
+	}
+
+	var matched []report.Package
+	for _, p := range pkgs {
+		ip := strings.ToLower(p.ImportPath)
+		ok := true
+		for _, t := range terms {
+			if !strings.Contains(ip, t) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			matched = append(matched, p)
+		}
+	}
+	return matched
+}
+
+// gqlStatus is the status of the services.
+type gqlStatus struct {
+	a *API
+}
+
+func (s gqlStatus) typename() string {
+	return "SyncStatus"
+}
+
+func (s gqlStatus) field(name string, args map[string]interface{}) (interface{}, error) {
+	rs := s.a.options.Syncer
+	summary := rs.Summary()
+	timestamp := func(t time.Time) interface{} {
+		if t.IsZero() {
+			return nil
+		}
+		return t
+	}
+
+	switch name {
+	case "started":
+		return timestamp(summary.Started), nil
+	case "finished":
+		return timestamp(summary.Finished), nil
+	case "durationSeconds":
+		return summary.Duration, nil
+	case "checked":
+		return summary.Checked, nil
+	case "updated":
+		return summary.Updated, nil
+	case "cloned":
+		return summary.Cloned, nil
+	case "upToDate":
+		return summary.UpToDate, nil
+	case "failed":
+		return summary.Failed, nil
+	case "skipped":
+		return summary.Skipped, nil
+	case "deferred":
+		return summary.Deferred, nil
+	case "paused":
+		return summary.Paused, nil
+	case "apiCalls":
+		return summary.APICalls, nil
+	case "credentialsValid":
+		return rs.Credentials().Valid, nil
+	case "nextSync":
+		return timestamp(rs.NextRun()), nil
+	case "offline":
+		return rs.Offline(), nil
+	default:
+		return nil, unknownField("SyncStatus", name)
+	}
+}
+
+// gqlRepository is a synchronized repository.
+type gqlRepository struct {
+	e    *gqlExecutor
+	repo syncer.Repo
+}
+
+func (r gqlRepository) typename() string {
+	return "Repository"
+}
+
+func (r gqlRepository) field(name string, args map[string]interface{}) (interface{}, error) {
+	switch name {
+	case "owner":
+		return r.repo.Owner, nil
+	case "name":
+		return r.repo.Name, nil
+	case "fullName":
+		return r.repo.Owner + "/" + r.repo.Name, nil
+	case "cloneUrl":
+		return r.repo.CloneURL, nil
+	case "defaultBranch":
+		return r.repo.DefaultBranch, nil
+	case "commitSha":
+		return r.repo.CommitSHA, nil
+	case "htmlUrl":
+		return r.repo.HTMLURL, nil
+	case "description":
+		return r.repo.Description, nil
+	case "stars":
+		return r.repo.Stars, nil
+	case "topics":
+		if r.repo.Topics == nil {
+			return []string{}, nil
+		}
+		return r.repo.Topics, nil
+	case "license":
+		return r.repo.License, nil
+	case "archived":
+		return r.repo.Archived, nil
+	case "version":
+		return r.repo.Version, nil
+	case "paused":
+		return r.repo.Paused, nil
+	case "packages":
+		pkgs := r.e.packagesOf(r.repo)
+		return connection("PackageConnection", args, len(pkgs), func(i int) gqlObject {
+			return &gqlPackage{e: r.e, pkg: pkgs[i]}
+		})
+	default:
+		return nil, unknownField("Repository", name)
+	}
+}
+
+// gqlPackage is a package of a synchronized repository.  Its
+// documentation is only read when one of its fields is requested.
+type gqlPackage struct {
+	e   *gqlExecutor
+	pkg report.Package
+	doc *docserver.PackageDoc
+}
+
+func (p *gqlPackage) typename() string {
+	return "Package"
+}
+
+// read returns the documentation of the package.
+func (p *gqlPackage) read() (*docserver.PackageDoc, error) {
+	if p.doc == nil {
+		pd, err := docserver.ReadPackage(p.pkg.Dir, p.pkg.ImportPath)
+		if err != nil {
+			return nil, err
+		}
+		p.doc = pd
+	}
+	return p.doc, nil
+}
+
+func (p *gqlPackage) field(name string, args map[string]interface{}) (interface{}, error) {
+	switch name {
+	case "importPath":
+		return p.pkg.ImportPath, nil
+	case "repository":
+		if r, ok := p.e.findRepo(p.pkg.Owner, p.pkg.Name); ok {
+			return gqlRepository{e: p.e, repo: r}, nil
+		}
+		return nil, nil
+	case "name", "synopsis", "doc", "symbols":
+	default:
+		return nil, unknownField("Package", name)
+	}
+
+	pd, err := p.read()
+	if err != nil {
+		return nil, err
+	}
+
+	switch name {
+	case "name":
+		return pd.Name, nil
+	case "synopsis":
+		return pd.Synopsis, nil
+	case "doc":
+		return pd.Doc, nil
+	default:
+		kind, err := stringArg(args, "kind")
+		if err != nil {
+			return nil, err
+		}
+		var symbols []docserver.Symbol
+		for _, s := range pd.Symbols {
+			if kind == "" || s.Kind == kind {
+				symbols = append(symbols, s)
+			}
+		}
+		return connection("SymbolConnection", args, len(symbols), func(i int) gqlObject {
+			return gqlSymbol(symbols[i])
+		})
+	}
+}
+
+// gqlSymbol is an exported declaration of a package.
+type gqlSymbol docserver.Symbol
+
+func (s gqlSymbol) typename() string {
+	return "Symbol"
+}
+
+func (s gqlSymbol) field(name string, args map[string]interface{}) (interface{}, error) {
+	switch name {
+	case "name":
+		return s.Name, nil
+	case "kind":
+		return s.Kind, nil
+	case "signature":
+		return s.Signature, nil
+	case "doc":
+		return s.Doc, nil
+	case "deprecated":
+		if s.Deprecated == "" {
+			return nil, nil
+		}
+		return s.Deprecated, nil
+	default:
+		return nil, unknownField("Symbol", name)
+	}
+}
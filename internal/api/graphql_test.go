@@ -0,0 +1,147 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+	"go.uber.org/zap"
+)
+
+func TestParseQuery(t *testing.T) {
+	doc := `
+		# The repositories of an owner.
+		query Repos($owner: String!, $first: Int = 10) {
+			repos: repositories(owner: $owner, first: $first) {
+				totalCount
+				nodes { fullName }
+			}
+		}
+		query Status { status { checked } }
+	`
+
+	fields, err := parseQuery(doc, "Repos", map[string]interface{}{"owner": "ctxswitch"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fields) != 1 || fields[0].Alias != "repos" || fields[0].Name != "repositories" {
+		t.Fatalf("expected the aliased repositories field, got %+v", fields)
+	}
+	if owner := fields[0].Args["owner"]; owner != "ctxswitch" {
+		t.Fatalf("expected the owner variable to be substituted, got %v", owner)
+	}
+	if first := fields[0].Args["first"]; first != 10 {
+		t.Fatalf("expected the default of first, got %v", first)
+	}
+	if len(fields[0].Selections) != 2 || fields[0].Selections[1].Selections[0].Name != "fullName" {
+		t.Fatalf("unexpected selections %+v", fields[0].Selections)
+	}
+
+	invalid := map[string]string{
+		"ambiguous operation": doc,
+		"missing variable":    `query ($owner: String!) { repositories(owner: $owner) { totalCount } }`,
+		"undeclared variable": `{ repositories(owner: $owner) { totalCount } }`,
+		"mutation":            `mutation { resync }`,
+		"fragment":            `{ status { ...F } }`,
+		"unterminated":        `{ status { checked }`,
+		"empty":               ``,
+	}
+	for name, q := range invalid {
+		if _, err := parseQuery(q, "", nil); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestGraphQL(t *testing.T) {
+	s := syncer.New(context.Background(), syncer.SyncerOptions{
+		GodocRoot: t.TempDir(),
+		Offline:   true,
+		Logger:    zap.NewNop(),
+	})
+	a := New(APIOptions{Syncer: s, Logger: zap.NewNop()})
+
+	body := `{"query": "{ __typename status { offline } repositories(first: 5) { totalCount pageInfo { hasNextPage endCursor } } missing }"}`
+	rec := httptest.NewRecorder()
+	a.graphql(rec, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	want := `{"data":{"__typename":"Query","status":{"offline":true},"repositories":{"totalCount":0,"pageInfo":{"hasNextPage":false,"endCursor":null}},"missing":null},"errors":[{"message":"cannot query field missing on type Query","path":["missing"]}]}`
+	if got := strings.TrimSpace(rec.Body.String()); got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+
+	rec = httptest.NewRecorder()
+	a.graphql(rec, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(`{"query": "{ status {"}`)))
+	var resp gqlResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusBadRequest || len(resp.Errors) != 1 {
+		t.Fatalf("expected a 400 with a syntax error, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestPage(t *testing.T) {
+	start, end, err := page(map[string]interface{}{"first": 2, "after": cursor(3)}, 5)
+	if err != nil || start != 4 || end != 5 {
+		t.Fatalf("expected items 4 to 5, got %d to %d, %v", start, end, err)
+	}
+	if _, _, err := page(map[string]interface{}{"after": "bogus"}, 5); err == nil {
+		t.Fatal("expected an error for an invalid cursor")
+	}
+	if _, _, err := page(map[string]interface{}{"first": maxPageSize + 1}, 5); err == nil {
+		t.Fatal("expected an error for a page that is too large")
+	}
+}
+
+func TestParseQueryLimits(t *testing.T) {
+	deep := strings.Repeat("{ packages ", gqlMaxDepth) + "{ totalCount }" + strings.Repeat(" }", gqlMaxDepth)
+	if _, err := parseQuery(deep, "", nil); err == nil || !strings.Contains(err.Error(), "nests deeper") {
+		t.Errorf("deep query: expected a depth error, got %v", err)
+	}
+
+	value := `{ packages(query: ` + strings.Repeat("[", gqlMaxDepth) + strings.Repeat("]", gqlMaxDepth) + `) { totalCount } }`
+	if _, err := parseQuery(value, "", nil); err == nil {
+		t.Error("deep value: expected an error")
+	}
+
+	wide := "{ status { " + strings.Repeat("checked ", gqlMaxFields) + "} }"
+	if _, err := parseQuery(wide, "", nil); err == nil || !strings.Contains(err.Error(), "fields") {
+		t.Errorf("wide query: expected a field error, got %v", err)
+	}
+
+	nested := `{ packages { nodes { repository { packages { nodes { name } } } } } }`
+	if _, err := parseQuery(nested, "", nil); err == nil || !strings.Contains(err.Error(), "costs") {
+		t.Errorf("nested lists: expected a cost error, got %v", err)
+	}
+
+	small := `query ($first: Int) { packages(first: $first) { nodes { repository { packages(first: 10) { nodes { name } } } } } }`
+	if _, err := parseQuery(small, "", map[string]interface{}{"first": 10}); err != nil {
+		t.Errorf("small pages: unexpected error: %v", err)
+	}
+	if _, err := parseQuery(small, "", map[string]interface{}{"first": 1000}); err == nil {
+		t.Error("large variable page: expected a cost error")
+	}
+}
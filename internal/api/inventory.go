@@ -0,0 +1,84 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ctxswitch/gdoc/internal/report"
+)
+
+const (
+	// defaultPageSize is the number of modules on a page of the inventory
+	// when no size is given.
+	defaultPageSize = 100
+	// maxPageSize is the largest page of the inventory.
+	maxPageSize = 1000
+)
+
+// InventoryPage is a page of the module inventory.
+type InventoryPage struct {
+	Modules []report.InventoryModule `json:"modules"`
+	// The number of modules on all pages.
+	Total   int `json:"total"`
+	Page    int `json:"page"`
+	PerPage int `json:"per_page"`
+	// The number of the next page.  Zero on the last page.
+	NextPage int `json:"next_page"`
+}
+
+// inventory writes a page of the modules in the synchronized repositories
+// with the import paths of their packages.  The page and per_page query
+// parameters select the page; pages start at 1.  The modules are ordered
+// by module path so that pages are stable between sync cycles.
+func (a *API) inventory(w http.ResponseWriter, r *http.Request) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	perPage, err := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if err != nil || perPage < 1 {
+		perPage = defaultPageSize
+	}
+	if perPage > maxPageSize {
+		perPage = maxPageSize
+	}
+
+	modules := report.Inventory(a.options.Syncer.Repos())
+	resp := InventoryPage{
+		Modules: []report.InventoryModule{},
+		Total:   len(modules),
+		Page:    page,
+		PerPage: perPage,
+	}
+
+	start := (page - 1) * perPage
+	if start < len(modules) {
+		end := start + perPage
+		if end < len(modules) {
+			resp.NextPage = page + 1
+		} else {
+			end = len(modules)
+		}
+		resp.Modules = modules[start:end]
+	}
+
+	a.json(w, http.StatusOK, resp)
+}
@@ -0,0 +1,115 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package api
+
+import (
+	"errors"
+	"expvar"
+	"io"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// DefaultMaxBodySize is the largest request body, in bytes, that is
+// accepted when no limit is configured.
+const DefaultMaxBodySize = 1 << 20
+
+// errBodyTooLarge is returned when reading a request body past its limit.
+var errBodyTooLarge = errors.New("request body too large")
+
+// metrics holds the counters of the requests that were refused.  They are
+// published through expvar and are available from the /debug/vars
+// endpoint.
+var metrics = expvar.NewMap("api")
+
+// limitBody refuses the requests whose declared body is larger than the
+// limit and stops reading the others once they reach it.  Module uploads
+// are limited by the size of a module zip instead.
+func (a *API) limitBody(next http.Handler) http.Handler {
+	limit := a.options.MaxBodySize
+	if limit <= 0 {
+		limit = DefaultMaxBodySize
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/modules" {
+			if r.ContentLength > limit {
+				a.tooLarge(w, r)
+				return
+			}
+			r.Body = maxBytesReader(w, r.Body, limit)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// readBody reads the body of the request.  It writes a 413 and returns
+// false if the body is larger than the limit, or a 400 if it could not be
+// read.
+func (a *API) readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(r.Body)
+	switch {
+	case errors.Is(err, errBodyTooLarge):
+		a.tooLarge(w, r)
+		return nil, false
+	case err != nil:
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return nil, false
+	}
+	return body, true
+}
+
+// limitReader is a request body limited by http.MaxBytesReader whose error
+// can be told apart from the other errors of the body.
+type limitReader struct {
+	io.ReadCloser
+	remaining int64
+}
+
+// maxBytesReader limits the body like http.MaxBytesReader but returns
+// errBodyTooLarge once the limit is reached.
+func maxBytesReader(w http.ResponseWriter, body io.ReadCloser, limit int64) io.ReadCloser {
+	return &limitReader{ReadCloser: http.MaxBytesReader(w, body, limit), remaining: limit}
+}
+
+// Read reads from the limited body.  http.MaxBytesReader only fails after
+// the whole limit was read when the body is too large.
+func (l *limitReader) Read(p []byte) (int, error) {
+	n, err := l.ReadCloser.Read(p)
+	l.remaining -= int64(n)
+	if err != nil && err != io.EOF && l.remaining <= 0 {
+		return n, errBodyTooLarge
+	}
+	return n, err
+}
+
+// tooLarge refuses a request whose body is too large.
+func (a *API) tooLarge(w http.ResponseWriter, r *http.Request) {
+	metrics.Add("body_too_large", 1)
+	a.logger.Info("request body too large", zap.String("method", r.Method), zap.String("path", r.URL.Path), zap.Int64("length", r.ContentLength))
+	http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+}
+
+// invalidPayload counts a request to the endpoint whose payload did not
+// match what the endpoint expects.
+func invalidPayload(endpoint string) {
+	metrics.Add("invalid_payload_"+endpoint, 1)
+}
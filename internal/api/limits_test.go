@@ -0,0 +1,65 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// failingReader fails like a client that broke off the upload.
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("unexpected EOF")
+}
+
+func TestReadBody(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   io.Reader
+		ok     bool
+		status int
+	}{
+		{"within the limit", strings.NewReader("12345678"), true, http.StatusOK},
+		{"too large", strings.NewReader("123456789"), false, http.StatusRequestEntityTooLarge},
+		{"broken off", failingReader{}, false, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &API{logger: zap.NewNop()}
+			rec := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/api/repos", nil)
+			r.Body = maxBytesReader(rec, io.NopCloser(tt.body), 8)
+
+			if _, ok := a.readBody(rec, r); ok != tt.ok {
+				t.Fatalf("expected %v, got %v", tt.ok, ok)
+			}
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, rec.Code)
+			}
+		})
+	}
+}
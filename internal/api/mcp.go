@@ -0,0 +1,276 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// mcpProtocolVersion is the version of the Model Context Protocol that is
+// implemented.
+const mcpProtocolVersion = "2024-11-05"
+
+// JSON-RPC error codes.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+// rpcRequest is a JSON-RPC 2.0 request or notification.
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// rpcResponse is a JSON-RPC 2.0 response.
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcError is the error of a failed JSON-RPC request.
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// mcpTool describes a tool offered to the client.
+type mcpTool struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	InputSchema interface{} `json:"inputSchema"`
+}
+
+// mcpContent is the text content of a tool result.
+type mcpContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// mcpToolResult is the result of a tool call.
+type mcpToolResult struct {
+	Content []mcpContent `json:"content"`
+	IsError bool         `json:"isError,omitempty"`
+}
+
+// schema returns the JSON schema of an object with required string
+// properties.
+func schema(props map[string]string) interface{} {
+	properties := make(map[string]interface{})
+	required := []string{}
+	for name, desc := range props {
+		properties[name] = map[string]string{"type": "string", "description": desc}
+		required = append(required, name)
+	}
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+// mcpTools are the tools offered by the server.
+var mcpTools = []mcpTool{
+	{
+		Name:        "search_packages",
+		Description: "Search the Go packages of the synchronized repositories by import path and return their synopses.",
+		InputSchema: schema(map[string]string{"query": "Words that must appear in the import path."}),
+	},
+	{
+		Name:        "get_package_doc",
+		Description: "Return the documentation of a Go package along with the signatures of its exported declarations.",
+		InputSchema: schema(map[string]string{"import_path": "The import path of the package."}),
+	},
+	{
+		Name:        "get_symbol",
+		Description: "Return the signature and documentation of a single exported declaration.  Methods are named Type.Method.",
+		InputSchema: schema(map[string]string{
+			"import_path": "The import path of the package.",
+			"symbol":      "The name of the declaration.",
+		}),
+	},
+}
+
+// mcp handles Model Context Protocol requests over HTTP so that assistants
+// can look up the documentation of the synchronized packages.  Only the
+// tools capability is offered.
+func (a *API) mcp(w http.ResponseWriter, r *http.Request) {
+	if !a.post(w, r) {
+		return
+	}
+
+	body, ok := a.readBody(w, r)
+	if !ok {
+		return
+	}
+
+	var req rpcRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		invalidPayload("mcp")
+		a.json(w, http.StatusOK, rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: rpcParseError, Message: err.Error()}})
+		return
+	}
+
+	// Notifications do not get a response.
+	if len(req.ID) == 0 {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	resp := rpcResponse{JSONRPC: "2.0", ID: req.ID}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		invalidPayload("mcp")
+		resp.Error = &rpcError{Code: rpcInvalidRequest, Message: "invalid jsonrpc version or missing method"}
+		a.json(w, http.StatusOK, resp)
+		return
+	}
+
+	switch req.Method {
+	case "initialize":
+		resp.Result = map[string]interface{}{
+			"protocolVersion": mcpProtocolVersion,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]string{"name": "gdoc", "version": a.options.Version},
+		}
+	case "ping":
+		resp.Result = map[string]interface{}{}
+	case "tools/list":
+		resp.Result = map[string]interface{}{"tools": mcpTools}
+	case "tools/call":
+		var params struct {
+			Name      string            `json:"name"`
+			Arguments map[string]string `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			invalidPayload("mcp")
+			resp.Error = &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+			break
+		}
+		tool, ok := findTool(params.Name)
+		if !ok {
+			resp.Error = &rpcError{Code: rpcInvalidParams, Message: "unknown tool: " + params.Name}
+			break
+		}
+		if err := validateArguments(tool.InputSchema, params.Arguments); err != nil {
+			invalidPayload("mcp")
+			resp.Error = &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+			break
+		}
+		result, ok := a.callTool(params.Name, params.Arguments)
+		if !ok {
+			resp.Error = &rpcError{Code: rpcInvalidParams, Message: "unknown tool: " + params.Name}
+			break
+		}
+		resp.Result = result
+	default:
+		resp.Error = &rpcError{Code: rpcMethodNotFound, Message: "method not found: " + req.Method}
+	}
+
+	a.json(w, http.StatusOK, resp)
+}
+
+// findTool returns the tool with the name.
+func findTool(name string) (mcpTool, bool) {
+	for _, t := range mcpTools {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return mcpTool{}, false
+}
+
+// validateArguments checks the arguments of a tool call against the input
+// schema of the tool.  Every required property has to be set and no other
+// properties are accepted.
+func validateArguments(schema interface{}, args map[string]string) error {
+	s, _ := schema.(map[string]interface{})
+	properties, _ := s["properties"].(map[string]interface{})
+	required, _ := s["required"].([]string)
+
+	for _, name := range required {
+		if args[name] == "" {
+			return fmt.Errorf("missing argument: %s", name)
+		}
+	}
+	for name := range args {
+		if _, ok := properties[name]; !ok {
+			return fmt.Errorf("unknown argument: %s", name)
+		}
+	}
+	return nil
+}
+
+// callTool runs the named tool.  It returns false if the tool does not
+// exist.
+func (a *API) callTool(name string, args map[string]string) (mcpToolResult, bool) {
+	text := func(s string, isError bool) mcpToolResult {
+		return mcpToolResult{Content: []mcpContent{{Type: "text", Text: s}}, IsError: isError}
+	}
+
+	switch name {
+	case "search_packages":
+		results := a.findPackages(args["query"])
+		if len(results) == 0 {
+			return text("No packages match the query.", false), true
+		}
+		var b strings.Builder
+		for _, p := range results {
+			fmt.Fprintf(&b, "%s", p.ImportPath)
+			if p.Synopsis != "" {
+				fmt.Fprintf(&b, ": %s", p.Synopsis)
+			}
+			b.WriteString("\n")
+		}
+		return text(b.String(), false), true
+	case "get_package_doc", "get_symbol":
+		pd, err := a.packageDoc(args["import_path"])
+		if err != nil {
+			return text(fmt.Sprintf("Unable to read package %s: %s", args["import_path"], err), true), true
+		}
+
+		if name == "get_symbol" {
+			s, ok := pd.Symbol(args["symbol"])
+			if !ok {
+				return text(fmt.Sprintf("%s has no exported symbol %s.", pd.ImportPath, args["symbol"]), true), true
+			}
+			return text(s.Signature+"\n\n"+s.Doc, false), true
+		}
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "package %s // import %q\n\n%s", pd.Name, pd.ImportPath, pd.Doc)
+		for _, s := range pd.Symbols {
+			fmt.Fprintf(&b, "\n%s\n", s.Signature)
+			if s.Doc != "" {
+				fmt.Fprintf(&b, "    %s\n", strings.ReplaceAll(strings.TrimSpace(s.Doc), "\n", "\n    "))
+			}
+		}
+		return text(b.String(), false), true
+	default:
+		return mcpToolResult{}, false
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/ctxswitch/gdoc/internal/modules"
+	"go.uber.org/zap"
+)
+
+// uploadModule extracts a module zip posted as the request body into the
+// workspace so that modules outside of any supported version control
+// system can be documented.
+func (a *API) uploadModule(w http.ResponseWriter, r *http.Request) {
+	if !a.options.ModuleUploads {
+		http.Error(w, "module uploads are disabled", http.StatusNotFound)
+		return
+	}
+	if !a.post(w, r) {
+		return
+	}
+
+	// The zip is spooled to disk since its directory is at the end.
+	f, err := os.CreateTemp("", "gdoc-module-*.zip")
+	if err != nil {
+		a.logger.Error("unable to store module zip", zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	body := &bodyReader{Reader: maxBytesReader(w, r.Body, modules.MaxZipSize)}
+	size, err := io.Copy(f, body)
+	switch {
+	case errors.Is(err, errBodyTooLarge):
+		a.tooLarge(w, r)
+		return
+	case err != nil && body.err != nil:
+		a.logger.Info("module upload broken off", zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	case err != nil:
+		a.logger.Error("unable to store module zip", zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	m, err := modules.Extract(a.options.GodocRoot, a.options.Syncer.Locks(), f, size)
+	switch {
+	case errors.Is(err, modules.ErrInvalidZip):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, modules.ErrPathInUse):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		a.logger.Error("unable to extract module zip", zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	a.logger.Info("extracted uploaded module", zap.String("path", m.Path), zap.String("version", m.Version))
+	a.json(w, http.StatusCreated, m)
+}
+
+// bodyReader records the error of reading a request body so that it can be
+// told apart from the errors of writing it elsewhere.
+type bodyReader struct {
+	io.Reader
+	err error
+}
+
+// Read reads from the body and records its error.
+func (b *bodyReader) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,40 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package api
+
+import (
+	_ "embed"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// openAPISpec is the OpenAPI specification of the management API.  Keep it
+// in sync with the handlers and with the client in pkg/client.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// openAPI writes the OpenAPI specification of the management API.
+func (a *API) openAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(openAPISpec); err != nil {
+		a.logger.Error("unable to write the openapi specification", zap.Error(err))
+	}
+}
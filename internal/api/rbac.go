@@ -0,0 +1,158 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package api
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// The roles that callers of the management API are given.  Each role has
+// the permissions of the roles before it.
+const (
+	// RoleViewer reads the state of the service.
+	RoleViewer = "viewer"
+	// RoleOperator also syncs, pauses and resumes repositories.
+	RoleOperator = "operator"
+	// RoleAdmin also reclones repositories, uploads modules and changes
+	// the runtime settings.
+	RoleAdmin = "admin"
+)
+
+// roleRank orders the roles by their permissions.  Unknown roles have no
+// permissions.
+var roleRank = map[string]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// operatorActions are the repository actions that operators can take.
+var operatorActions = map[string]bool{
+	"resync": true,
+	"pause":  true,
+	"resume": true,
+}
+
+// ValidRole returns true if the role is one of the known roles.
+func ValidRole(role string) bool {
+	return roleRank[role] > 0
+}
+
+// caller identifies the caller of a request.
+type caller struct {
+	User string
+	Role string
+}
+
+// callerKey is the context key of the caller.
+type callerKey struct{}
+
+// callerFrom returns the caller of the request.  The caller is empty when
+// no authenticators are configured.
+func callerFrom(ctx context.Context) caller {
+	c, _ := ctx.Value(callerKey{}).(caller)
+	return c
+}
+
+// requiredRole returns the role a caller needs for the request.  Requests
+// that only read are open to viewers, as are the read only tools of the MCP
+// endpoint and the GraphQL queries.  Only admins manage API tokens.
+func requiredRole(r *http.Request) string {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/api/tokens"):
+		return RoleAdmin
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return RoleViewer
+	case r.URL.Path == "/mcp", r.URL.Path == "/graphql":
+		return RoleViewer
+	case strings.HasPrefix(r.URL.Path, "/api/repos/") && operatorActions[path.Base(r.URL.Path)]:
+		return RoleOperator
+	default:
+		return RoleAdmin
+	}
+}
+
+// role returns the highest role given to the user, to one of its groups or
+// to every caller.  Every caller is an admin when no roles are configured.
+func (a *API) role(user string, groups []string) string {
+	if len(a.options.Roles) == 0 {
+		return RoleAdmin
+	}
+
+	best := ""
+	consider := func(role string) {
+		if roleRank[role] > roleRank[best] {
+			best = role
+		}
+	}
+	consider(a.options.Roles["*"])
+	consider(a.options.Roles[user])
+	for _, g := range groups {
+		consider(a.options.Roles["group:"+g])
+	}
+	return best
+}
+
+// authorized returns true if the role has the permissions needed for the
+// request.
+func authorized(role string, r *http.Request) bool {
+	return roleRank[role] >= roleRank[requiredRole(r)]
+}
+
+// statusRecorder records the status code written to a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status code and writes it to the response.
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// audit logs the requests that change the state of the service along with
+// their caller and outcome.
+func (a *API) audit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requiredRole(r) == RoleViewer {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		c := callerFrom(r.Context())
+		a.logger.Info("audit",
+			zap.String("user", c.User),
+			zap.String("role", c.Role),
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.String("query", r.URL.RawQuery),
+			zap.String("remote", r.RemoteAddr),
+			zap.Int("status", rec.status),
+		)
+	})
+}
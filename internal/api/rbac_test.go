@@ -0,0 +1,106 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+	"go.uber.org/zap"
+)
+
+func TestRequiredRole(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{http.MethodGet, "/api/repos", RoleViewer},
+		{http.MethodHead, "/api/status", RoleViewer},
+		{http.MethodPost, "/mcp", RoleViewer},
+		{http.MethodPost, "/graphql", RoleViewer},
+		{http.MethodPost, "/api/repos/ctxswitch/gdoc/resync", RoleOperator},
+		{http.MethodPost, "/api/repos/ctxswitch/gdoc/pause", RoleOperator},
+		{http.MethodPost, "/api/repos/ctxswitch/gdoc/resume", RoleOperator},
+		{http.MethodPost, "/api/repos/ctxswitch/gdoc/reclone", RoleAdmin},
+		{http.MethodPost, "/api/modules", RoleAdmin},
+		{http.MethodPut, "/api/config", RoleAdmin},
+		{http.MethodGet, "/api/tokens", RoleAdmin},
+		{http.MethodPost, "/api/tokens", RoleAdmin},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if got := requiredRole(r); got != tt.want {
+			t.Errorf("%s %s: expected %s, got %s", tt.method, tt.path, tt.want, got)
+		}
+	}
+}
+
+func TestRolesOnMutatingRoutes(t *testing.T) {
+	s := syncer.New(context.Background(), syncer.SyncerOptions{
+		GodocRoot: t.TempDir(),
+		Offline:   true,
+		Logger:    zap.NewNop(),
+	})
+
+	tokens := make(map[string]string)
+	for _, role := range []string{RoleViewer, RoleOperator, RoleAdmin} {
+		value, _, err := s.CreateToken(role, role, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens[role] = value
+	}
+
+	a := New(APIOptions{APIPort: 6061, Syncer: s, Logger: zap.NewNop()})
+	a.open = a.anonymous()
+	h := a.handler()
+
+	// The routes are listed with the lowest role allowed to call them.
+	routes := []struct {
+		method string
+		path   string
+		role   string
+	}{
+		{http.MethodPost, "/api/repos/ctxswitch/gdoc/resync", RoleOperator},
+		{http.MethodPost, "/api/repos/ctxswitch/gdoc/pause", RoleOperator},
+		{http.MethodPost, "/api/repos/ctxswitch/gdoc/resume", RoleOperator},
+		{http.MethodPost, "/api/repos/ctxswitch/gdoc/reclone", RoleAdmin},
+		{http.MethodPost, "/api/modules", RoleAdmin},
+		{http.MethodPost, "/api/tokens", RoleAdmin},
+	}
+
+	for _, rt := range routes {
+		for _, role := range []string{RoleViewer, RoleOperator, RoleAdmin} {
+			req := httptest.NewRequest(rt.method, rt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tokens[role])
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			allowed := roleRank[role] >= roleRank[rt.role]
+			if forbidden := rec.Code == http.StatusForbidden; forbidden == allowed {
+				t.Errorf("%s %s as %s: expected allowed to be %t, got %d", rt.method, rt.path, role, allowed, rec.Code)
+			}
+		}
+	}
+}
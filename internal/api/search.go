@@ -0,0 +1,99 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+	"go.uber.org/zap"
+)
+
+// defaultSearchLimit is the number of documentation results returned when
+// no limit is given.
+const defaultSearchLimit = 20
+
+// search returns the repositories whose owner, name, description or topics
+// contain every term of the query.  The match is case insensitive.
+// Repositories that are kept out of searches are never returned.
+func (a *API) search(q string) []syncer.Repo {
+	terms := strings.Fields(strings.ToLower(q))
+	repos := []syncer.Repo{}
+	if len(terms) == 0 {
+		return repos
+	}
+
+	for _, r := range a.searchable() {
+		text := strings.ToLower(strings.Join(append([]string{r.Owner + "/" + r.Name, r.Description}, r.Topics...), " "))
+		matched := true
+		for _, t := range terms {
+			if !strings.Contains(text, t) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			repos = append(repos, r)
+		}
+	}
+
+	return repos
+}
+
+// searchDocs writes the documentation matching the q query parameter
+// ranked by the semantic search index.  The number of results can be set
+// with the limit query parameter.
+func (a *API) searchDocs(w http.ResponseWriter, r *http.Request) {
+	if a.options.Search == nil {
+		http.Error(w, "semantic search is disabled", http.StatusNotFound)
+		return
+	}
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultSearchLimit
+	}
+
+	results, err := a.options.Search.Search(r.Context(), r.URL.Query().Get("q"), limit)
+	if err != nil {
+		a.logger.Error("unable to search the documentation", zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+
+	a.json(w, http.StatusOK, results)
+}
+
+// searchRepos writes the repositories matching the q query parameter.
+func (a *API) searchRepos(w http.ResponseWriter, r *http.Request) {
+	a.json(w, http.StatusOK, a.search(r.URL.Query().Get("q")))
+}
+
+// searchable returns the repositories that are not kept out of searches.
+func (a *API) searchable() []syncer.Repo {
+	var repos []syncer.Repo
+	for _, r := range a.options.Syncer.Repos() {
+		if !syncer.MatchRepo(a.options.NoIndexRepos, r.Owner, r.Name) {
+			repos = append(repos, r)
+		}
+	}
+	return repos
+}
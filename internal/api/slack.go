@@ -0,0 +1,212 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// slackMaxAge is the oldest request timestamp that is accepted.  Older
+// requests are rejected to prevent replays.
+const slackMaxAge = 5 * time.Minute
+
+// slackMaxResults is the number of search results listed in a response.
+const slackMaxResults = 10
+
+// slackMaxText is the longest command text, in bytes, that is accepted.
+// Slack limits the text of slash commands to 4000 characters.
+const slackMaxText = 16000
+
+// slackResponseURL is the prefix of the response URLs of slash commands.
+const slackResponseURL = "https://hooks.slack.com/"
+
+// slackHelp is the response to an unknown command.
+const slackHelp = "Usage: `/gdoc search <terms>`, `/gdoc sync <owner>/<name>` or `/gdoc status`"
+
+// slackMessage is the response sent back to Slack.
+type slackMessage struct {
+	// Either ephemeral, shown only to the user who ran the command, or
+	// in_channel.
+	ResponseType string `json:"response_type"`
+	Text         string `json:"text"`
+}
+
+// slack handles Slack slash commands.  Requests are authenticated with the
+// signing secret of the Slack app.  Syncing a repository can take longer
+// than Slack waits for a response, so the result is posted to the response
+// URL once it has completed.
+func (a *API) slack(w http.ResponseWriter, r *http.Request) {
+	if a.options.SlackSigningSecret == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if !a.post(w, r) {
+		return
+	}
+
+	body, ok := a.readBody(w, r)
+	if !ok {
+		return
+	}
+
+	if !slackVerify(a.options.SlackSigningSecret, r.Header, body, time.Now()) {
+		metrics.Add("signature_failures", 1)
+		a.logger.Info("slack command rejected", zap.String("reason", "invalid signature"), zap.String("remote", r.RemoteAddr))
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err == nil {
+		err = slackValidate(form)
+	}
+	if err != nil {
+		invalidPayload("slack")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	args := strings.Fields(form.Get("text"))
+	if len(args) == 0 {
+		a.json(w, http.StatusOK, slackMessage{ResponseType: "ephemeral", Text: slackHelp})
+		return
+	}
+
+	switch args[0] {
+	case "search":
+		a.json(w, http.StatusOK, slackMessage{ResponseType: "ephemeral", Text: a.slackSearch(strings.Join(args[1:], " "))})
+	case "status":
+		a.json(w, http.StatusOK, slackMessage{ResponseType: "ephemeral", Text: a.slackStatus()})
+	case "sync":
+		parts := []string{}
+		if len(args) == 2 {
+			parts = strings.Split(args[1], "/")
+		}
+		if len(parts) != 2 {
+			a.json(w, http.StatusOK, slackMessage{ResponseType: "ephemeral", Text: slackHelp})
+			return
+		}
+
+		go a.slackSync(parts[0], parts[1], form.Get("response_url"), form.Get("user_name"))
+		a.json(w, http.StatusOK, slackMessage{ResponseType: "ephemeral", Text: fmt.Sprintf("Syncing %s/%s...", parts[0], parts[1])})
+	default:
+		a.json(w, http.StatusOK, slackMessage{ResponseType: "ephemeral", Text: slackHelp})
+	}
+}
+
+// slackSearch returns the response listing the repositories matching the
+// query.
+func (a *API) slackSearch(q string) string {
+	repos := a.search(q)
+	if len(repos) == 0 {
+		return fmt.Sprintf("No repositories match `%s`.", q)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d repositories match `%s`:", len(repos), q)
+	for i, r := range repos {
+		if i == slackMaxResults {
+			fmt.Fprintf(&b, "\n…and %d more", len(repos)-slackMaxResults)
+			break
+		}
+		fmt.Fprintf(&b, "\n• *%s/%s*", r.Owner, r.Name)
+		if r.Description != "" {
+			fmt.Fprintf(&b, " – %s", r.Description)
+		}
+	}
+	return b.String()
+}
+
+// slackStatus returns the response describing the last sync cycle.
+func (a *API) slackStatus() string {
+	s := a.options.Syncer.Summary()
+	if s.Finished.IsZero() {
+		return "No sync cycle has completed yet."
+	}
+
+	return fmt.Sprintf("*%s* last synced %s: %d checked, %d cloned, %d updated, %d failed.  %d repositories are failing.",
+		a.options.InstanceName, s.Finished.Format(time.RFC1123), s.Checked, s.Cloned, s.Updated, s.Failed, len(a.options.Syncer.Failures()))
+}
+
+// slackSync resyncs the repository and posts the result to the response
+// URL.
+func (a *API) slackSync(owner, name, responseURL, user string) {
+	a.logger.Info("slack resync requested", zap.String("repo", owner+"/"+name), zap.String("user", user))
+
+	text := fmt.Sprintf("%s/%s is up to date.", owner, name)
+	if err := a.options.Syncer.Resync(context.Background(), owner, name); err != nil {
+		text = fmt.Sprintf("Unable to sync %s/%s: %s", owner, name, err)
+	}
+
+	if responseURL == "" {
+		return
+	}
+
+	body, _ := json.Marshal(slackMessage{ResponseType: "ephemeral", Text: text})
+	resp, err := http.Post(responseURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		a.logger.Error("unable to respond to slack", zap.Error(err))
+		return
+	}
+	resp.Body.Close()
+}
+
+// slackValidate checks the fields of a slash command that are used.  The
+// result of a sync is posted to the response URL, so it has to point at
+// Slack.
+func slackValidate(form url.Values) error {
+	if len(form.Get("text")) > slackMaxText {
+		return fmt.Errorf("text is longer than %d bytes", slackMaxText)
+	}
+	if u := form.Get("response_url"); u != "" && !strings.HasPrefix(u, slackResponseURL) {
+		return fmt.Errorf("response_url does not start with %s", slackResponseURL)
+	}
+	return nil
+}
+
+// slackVerify returns true if the request was signed with the signing
+// secret and is recent.
+func slackVerify(secret string, h http.Header, body []byte, now time.Time) bool {
+	ts := h.Get("X-Slack-Request-Timestamp")
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || math.Abs(now.Sub(time.Unix(sec, 0)).Seconds()) > slackMaxAge.Seconds() {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:", ts)
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	return hmac.Equal([]byte(expected), []byte(h.Get("X-Slack-Signature")))
+}
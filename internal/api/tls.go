@@ -0,0 +1,68 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package api
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+
+	"github.com/ctxswitch/gdoc/internal/server"
+)
+
+// tls returns the TLS configuration of the port, or nil to serve plain
+// HTTP.  A client CA without a certificate is an error, since the client
+// certificates could not be verified over plain HTTP.  The client used to
+// query the peers is set up to present the same certificate and to trust
+// the client CA.
+func (a *API) tls() (*tls.Config, error) {
+	if a.options.TLSCert == "" {
+		if a.options.ClientCA != "" {
+			return nil, errors.New("a client CA requires a TLS certificate and key")
+		}
+		return nil, nil
+	}
+
+	c, err := server.TLSConfig(a.options.TLSCert, a.options.TLSKey, a.options.ClientCA)
+	if err != nil {
+		return nil, err
+	}
+
+	pc, err := server.ClientTLSConfig(a.options.TLSCert, a.options.TLSKey, a.options.ClientCA)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = pc
+	a.peers = &http.Client{Transport: transport}
+
+	return c, nil
+}
+
+// certificateCaller returns the caller identified by the verified client
+// certificate of the request.  The common name is the user and the
+// organizations are the groups.
+func (a *API) certificateCaller(r *http.Request) (caller, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return caller{}, false
+	}
+
+	subject := r.TLS.VerifiedChains[0][0].Subject
+	return caller{User: subject.CommonName, Role: a.role(subject.CommonName, subject.Organization)}, true
+}
@@ -0,0 +1,102 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+	"go.uber.org/zap"
+)
+
+// CreatedToken is the response returned when a token is created.  The
+// token value is not stored and can not be retrieved again.
+type CreatedToken struct {
+	syncer.Token
+	Value string `json:"token"`
+}
+
+// tokens lists the API tokens and creates a token when posted to with the
+// name, role and optional ttl query parameters.
+func (a *API) tokens(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		a.json(w, http.StatusOK, a.options.Syncer.Tokens())
+		return
+	}
+
+	q := r.URL.Query()
+	name, role := q.Get("name"), q.Get("role")
+	if name == "" || !ValidRole(role) {
+		http.Error(w, "a name and a role of viewer, operator or admin are required", http.StatusBadRequest)
+		return
+	}
+
+	var ttl time.Duration
+	if v := q.Get("ttl"); v != "" {
+		var err error
+		if ttl, err = time.ParseDuration(v); err != nil || ttl < 0 {
+			http.Error(w, "invalid ttl", http.StatusBadRequest)
+			return
+		}
+	}
+
+	value, t, err := a.options.Syncer.CreateToken(name, role, ttl)
+	if err != nil {
+		a.logger.Error("unable to create token", zap.String("name", name), zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	a.json(w, http.StatusCreated, CreatedToken{Token: t, Value: value})
+}
+
+// token revokes the token given as /api/tokens/{id}/revoke.
+func (a *API) token(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/tokens/"), "/"), "/")
+	if len(parts) != 2 || parts[1] != "revoke" {
+		http.NotFound(w, r)
+		return
+	}
+	if !a.post(w, r) {
+		return
+	}
+
+	err := a.options.Syncer.RevokeToken(parts[0])
+	switch {
+	case errors.Is(err, syncer.ErrTokenNotFound):
+		http.NotFound(w, r)
+	case err != nil:
+		a.logger.Error("unable to revoke token", zap.String("id", parts[0]), zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// bearerToken returns the API token sent in the authorization header.
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	if !strings.HasPrefix(h, "Bearer ") {
+		return "", false
+	}
+	value := strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))
+	return value, strings.HasPrefix(value, syncer.TokenPrefix)
+}
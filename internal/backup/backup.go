@@ -0,0 +1,413 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultInterval is the minimum time between backups when no
+	// interval is configured.
+	DefaultInterval = 24 * time.Hour
+	// DefaultKeep is the number of backups that are kept when no number
+	// is configured.
+	DefaultKeep = 7
+)
+
+// stagingDir is the directory relative to the root where the syncer
+// stages repositories.  Staged copies are temporary and never backed up.
+const stagingDir = ".gdoc/staging"
+
+// prefix and suffix make up the names of the backup archives together with
+// the time the backup was taken.
+const (
+	prefix = "gdoc-"
+	suffix = ".tar.gz"
+)
+
+// BackupOptions defines the options available for running the workspace
+// backup service.
+type BackupOptions struct {
+	// The workspace that is backed up.  Initially set in the config.
+	Root string
+	// The directory the backups are written to.  Initially set in the
+	// config.
+	Dir string
+	// The minimum time between backups.  Defaults to DefaultInterval.
+	// Initially set in the config.
+	Interval time.Duration
+	// The number of backups that are kept.  Defaults to DefaultKeep.
+	// Initially set in the config.
+	Keep int
+	// The syncer that signals the end of each sync cycle.
+	Syncer *syncer.Syncer
+	// The logger used by the backup service. Initially set in the config.
+	Logger *zap.Logger
+}
+
+// Backup is a service that archives the workspace after a sync cycle has
+// completed once the interval has passed since the last backup.
+type Backup struct {
+	// The BackupOptions that was passed into New.
+	options BackupOptions
+	// The time the last backup was taken.
+	last time.Time
+	// The logger used by the backup service.
+	logger *zap.Logger
+}
+
+// New returns an initialized Backup struct.
+func New(o BackupOptions) *Backup {
+	if o.Interval <= 0 {
+		o.Interval = DefaultInterval
+	}
+	if o.Keep <= 0 {
+		o.Keep = DefaultKeep
+	}
+
+	b := &Backup{
+		options: o,
+		logger:  o.Logger,
+	}
+
+	if backups, err := list(o.Dir); err == nil && len(backups) > 0 {
+		if fi, err := os.Stat(backups[len(backups)-1]); err == nil {
+			b.last = fi.ModTime()
+		}
+	}
+
+	return b
+}
+
+// Start runs the backup service until the context is cancelled.  Backups
+// are taken right after a sync cycle so that repositories are not being
+// updated while they are archived.
+func (b *Backup) Start(ctx context.Context) error {
+	synced := make(chan syncer.Message, 1)
+	b.options.Syncer.Bus().Subscribe(synced, syncer.EventSyncCompleted)
+	defer b.options.Syncer.Bus().Unsubscribe(synced)
+
+	for {
+		select {
+		case <-synced:
+			if time.Since(b.last) < b.options.Interval {
+				continue
+			}
+			name, err := b.Backup()
+			if err != nil {
+				b.logger.Error("unable to back up the workspace", zap.Error(err))
+				continue
+			}
+			b.logger.Info("workspace backed up", zap.String("file", name))
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Backup archives the workspace and removes the oldest backups beyond the
+// number that are kept.  The name of the archive is returned.
+func (b *Backup) Backup() (string, error) {
+	if err := os.MkdirAll(b.options.Dir, 0755); err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	name := filepath.Join(b.options.Dir, prefix+now.Format("20060102T150405Z")+suffix)
+	tmp := name + ".tmp"
+
+	if err := b.write(tmp); err != nil {
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return "", err
+	}
+	b.last = now
+
+	backups, err := list(b.options.Dir)
+	if err != nil {
+		return name, err
+	}
+	for len(backups) > b.options.Keep {
+		if err := os.Remove(backups[0]); err != nil {
+			return name, err
+		}
+		backups = backups[1:]
+	}
+
+	return name, nil
+}
+
+// write archives the workspace into the named file.  The workspace is
+// locked while it is archived so that no repository is updated half way.
+func (b *Backup) write(name string) error {
+	defer b.options.Syncer.Locks().LockWorkspace()()
+
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	root := b.options.Root
+	dir, _ := filepath.Abs(b.options.Dir)
+	err = filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		if abs, _ := filepath.Abs(p); fi.IsDir() && (abs == dir || filepath.ToSlash(rel) == stagingDir) {
+			return filepath.SkipDir
+		}
+
+		var link string
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		src, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Restore extracts the newest backup in the directory into the root if the
+// root is empty, apart from the backup directory itself.  It returns the
+// name of the backup that was restored or an empty string if there was
+// nothing to restore.
+func Restore(root, dir string) (string, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	abs, _ := filepath.Abs(dir)
+	for _, e := range entries {
+		if p, _ := filepath.Abs(filepath.Join(root, e.Name())); p != abs {
+			return "", nil
+		}
+	}
+
+	backups, err := list(dir)
+	if err != nil || len(backups) == 0 {
+		return "", err
+	}
+
+	name := backups[len(backups)-1]
+	return name, extract(name, root)
+}
+
+// extract unpacks the archive into the root.  Entries that would be written
+// outside of the root, or through a symbolic link, are rejected.  Symbolic
+// links are created once every other entry has been written and only if
+// they point inside the root.
+func extract(name, root string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	// The targets of the symbolic links by their slash separated path
+	// relative to the root.
+	links := make(map[string]string)
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		p := filepath.Join(root, filepath.FromSlash(hdr.Name))
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return &os.PathError{Op: "extract", Path: hdr.Name, Err: os.ErrInvalid}
+		}
+		if rel == "." {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		if through(links, rel) {
+			return &os.PathError{Op: "extract", Path: hdr.Name, Err: os.ErrInvalid}
+		}
+
+		if hdr.Typeflag == tar.TypeSymlink {
+			links[rel] = hdr.Linkname
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(p, os.FileMode(hdr.Mode).Perm())
+		case tar.TypeReg:
+			err = extractFile(tr, p, os.FileMode(hdr.Mode).Perm())
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for rel := range links {
+		if !contained(links, rel) {
+			return &os.PathError{Op: "extract", Path: rel, Err: os.ErrInvalid}
+		}
+	}
+	for rel, target := range links {
+		p := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+		if err := os.Symlink(target, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// through returns true if the name or one of its parent directories is a
+// symbolic link in the archive.  Writing through the link could place
+// files outside of the root.
+func through(links map[string]string, name string) bool {
+	for p := name; p != "." && p != "/"; p = path.Dir(p) {
+		if _, ok := links[p]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// contained returns true if the target of the symbolic link at the name is
+// a relative path that stays inside the root.  Targets that leave another
+// symbolic link with .. are rejected since where they lead depends on that
+// link rather than on the path.
+func contained(links map[string]string, name string) bool {
+	target := links[name]
+	if target == "" || path.IsAbs(target) || filepath.IsAbs(target) {
+		return false
+	}
+
+	var parts []string
+	if dir := path.Dir(name); dir != "." {
+		parts = strings.Split(dir, "/")
+	}
+	for _, c := range strings.Split(filepath.ToSlash(target), "/") {
+		switch c {
+		case "", ".":
+		case "..":
+			if len(parts) == 0 {
+				return false
+			}
+			if _, ok := links[strings.Join(parts, "/")]; ok {
+				return false
+			}
+			parts = parts[:len(parts)-1]
+		default:
+			parts = append(parts, c)
+		}
+	}
+	return true
+}
+
+// extractFile writes the current archive entry to the named file.
+func extractFile(r io.Reader, name string, mode os.FileMode) error {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// list returns the backups in the directory, oldest first.
+func list(dir string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, prefix+"*"+suffix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
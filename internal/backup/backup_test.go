@@ -0,0 +1,122 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// entry is an entry of a test archive.  Entries with a link are symbolic
+// links and entries whose name ends in a slash are directories.
+type entry struct {
+	name string
+	link string
+	body string
+}
+
+// archive writes the entries into a backup archive in a temporary
+// directory and returns its name.
+func archive(t *testing.T, entries []entry) string {
+	t.Helper()
+
+	name := filepath.Join(t.TempDir(), "backup.tar.gz")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(e.body))}
+		switch {
+		case e.link != "":
+			hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeSymlink, e.link, 0
+		case e.name[len(e.name)-1] == '/':
+			hdr.Typeflag, hdr.Mode = tar.TypeDir, 0755
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestExtract(t *testing.T) {
+	root := t.TempDir()
+	name := archive(t, []entry{
+		{name: "src/"},
+		{name: "src/a/README.md", body: "a"},
+		{name: "src/a/docs", link: "../b"},
+		{name: "src/b/"},
+		{name: "src/a/self", link: "."},
+	})
+
+	if err := extract(name, root); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b, err := os.ReadFile(filepath.Join(root, "src/a/README.md")); err != nil || string(b) != "a" {
+		t.Fatalf("expected the file to be extracted, got %q, %v", b, err)
+	}
+	if target, err := os.Readlink(filepath.Join(root, "src/a/docs")); err != nil || target != "../b" {
+		t.Fatalf("expected the link to be extracted, got %q, %v", target, err)
+	}
+}
+
+func TestExtractRejectsEscapes(t *testing.T) {
+	tests := map[string][]entry{
+		"parent":          {{name: "../evil", body: "x"}},
+		"absolute link":   {{name: "etc", link: "/etc"}},
+		"escaping link":   {{name: "src/up", link: "../../.."}},
+		"write via link":  {{name: "src/", link: ""}, {name: "src/out", link: "."}, {name: "src/out/file", body: "x"}},
+		"replace link":    {{name: "out", link: "src"}, {name: "out", body: "x"}},
+		"chained links":   {{name: "a/up", link: ".."}, {name: "b", link: "a/up/.."}},
+		"dir under link":  {{name: "out", link: "src"}, {name: "out/dir/"}},
+		"link under link": {{name: "out", link: "src"}, {name: "out/l", link: "."}},
+	}
+
+	for name, entries := range tests {
+		root := t.TempDir()
+		if err := extract(archive(t, entries), root); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+
+		// No link that escapes the root is left behind.
+		_ = filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+			if err == nil && fi.Mode()&os.ModeSymlink != 0 {
+				t.Errorf("%s: unexpected link %s", name, p)
+			}
+			return err
+		})
+	}
+}
@@ -0,0 +1,626 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+)
+
+// Format is the version of the bundle layout.  Since format 2 the
+// manifest and its signature lead the bundle.
+const Format = 2
+
+// DefaultMaxSize is the largest total size of the files of a bundle that
+// is loaded when no size is configured.
+const DefaultMaxSize = 32 << 30
+
+// maxManifestSize is the largest manifest that is read from a bundle.
+const maxManifestSize = 256 << 20
+
+// The entries of a bundle apart from the bundled files.  The manifest and
+// its signature are written first, so that a bundle is verified before
+// anything else is read from it.
+const (
+	reposFile     = "repos.json"
+	manifestFile  = "manifest.json"
+	signatureFile = "manifest.sig"
+	filesDir      = "files/"
+)
+
+// indexFile is the location of the search index relative to the root.
+const indexFile = ".gdoc/embeddings.json"
+
+// stagingDir is the directory relative to the root where bundles are
+// unpacked and verified before they are moved into place.
+const stagingDir = ".gdoc/staging"
+
+// The errors returned when a bundle fails verification.
+var (
+	// ErrSignature is returned when the manifest of a bundle is missing
+	// or was not signed by the verification key.
+	ErrSignature = errors.New("bundle signature is invalid")
+	// ErrIntegrity is returned when the content of a bundle does not match
+	// its signed manifest.
+	ErrIntegrity = errors.New("bundle content does not match its manifest")
+)
+
+// Options defines the options available for creating and loading bundles.
+type Options struct {
+	// The workspace that repositories are bundled from or loaded into.
+	// Initially set in the config.
+	Root string
+	// The syncer state file.  Defaults to .gdoc/state.json below the
+	// root.  Initially set in the config.
+	StatePath string
+	// The PEM file holding the ed25519 private key that bundles are
+	// signed with.  Initially set in the config.
+	SigningKey string
+	// The PEM file holding the ed25519 public key that bundles are
+	// verified with.  Initially set in the config.
+	VerifyKey string
+	// The name of the instance recorded in created bundles.  Initially
+	// set in the config.
+	Instance string
+	// The largest total size, in bytes, of the files of a bundle that is
+	// loaded.  Defaults to DefaultMaxSize.
+	MaxSize int64
+}
+
+// manifest lists every entry of a bundle along with its checksum.
+type manifest struct {
+	Format   int       `json:"format"`
+	Created  time.Time `json:"created"`
+	Instance string    `json:"instance,omitempty"`
+	Entries  []entry   `json:"entries"`
+}
+
+// entry is a single file, directory or symbolic link of a bundle.
+type entry struct {
+	Path   string `json:"path"`
+	Type   string `json:"type"`
+	Mode   uint32 `json:"mode"`
+	Size   int64  `json:"size,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	Link   string `json:"link,omitempty"`
+}
+
+// The types of the entries.
+const (
+	typeFile    = "file"
+	typeDir     = "dir"
+	typeSymlink = "symlink"
+)
+
+// Create writes a bundle of the repositories recorded in the state, their
+// branch checkouts and the search index to w.  Only repositories whose
+// local copy is inside the root are included.  The manifest of the bundle
+// is signed with the signing key.  The number of bundled repositories is
+// returned.
+func Create(o Options, w io.Writer) (int, error) {
+	key, err := loadPrivateKey(o.SigningKey)
+	if err != nil {
+		return 0, err
+	}
+
+	repos, err := syncer.StateRepos(syncer.StatePath(o.Root, o.StatePath))
+	if err != nil {
+		return 0, err
+	}
+
+	var bundled []syncer.Repo
+	var paths []string
+	for _, r := range repos {
+		rel, ok := relative(o.Root, r.LocalPath)
+		if !ok {
+			continue
+		}
+		r.LocalPath = rel
+		paths = append(paths, rel)
+
+		var branches []syncer.Branch
+		for _, b := range r.Branches {
+			if b.LocalPath, ok = relative(o.Root, b.LocalPath); ok {
+				branches = append(branches, b)
+				paths = append(paths, b.LocalPath)
+			}
+		}
+		r.Branches = branches
+		bundled = append(bundled, r)
+	}
+	if _, err := os.Stat(filepath.Join(o.Root, filepath.FromSlash(indexFile))); err == nil {
+		paths = append(paths, indexFile)
+	}
+
+	m := manifest{
+		Format:   Format,
+		Created:  time.Now().UTC(),
+		Instance: o.Instance,
+	}
+
+	data, err := json.MarshalIndent(bundled, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	sum := sha256.Sum256(data)
+	m.Entries = append(m.Entries, entry{Path: reposFile, Type: typeFile, Mode: 0644, Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:])})
+
+	// Every file is hashed before the manifest is written and hashed again
+	// while it is written, which fails if it changed in between.
+	var sources []source
+	for _, p := range paths {
+		found, err := scanTree(o.Root, p)
+		if err != nil {
+			return 0, err
+		}
+		sources = append(sources, found...)
+	}
+	for _, src := range sources {
+		m.Entries = append(m.Entries, src.entry)
+	}
+
+	signed, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	if err := writeData(tw, manifestFile, signed); err != nil {
+		return 0, err
+	}
+	if err := writeData(tw, signatureFile, ed25519.Sign(key, signed)); err != nil {
+		return 0, err
+	}
+	if err := writeData(tw, reposFile, data); err != nil {
+		return 0, err
+	}
+	for _, src := range sources {
+		if err := writeSource(tw, src); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return 0, err
+	}
+	return len(bundled), gz.Close()
+}
+
+// relative returns the slash separated path of the local copy relative to
+// the root.  It returns false if the copy is missing or outside the root.
+func relative(root, p string) (string, bool) {
+	if _, err := os.Stat(p); err != nil {
+		return "", false
+	}
+
+	rel, err := filepath.Rel(root, p)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// writeData adds a file with the data to the archive.
+func writeData(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// source is an entry of a bundle along with the file it is read from.
+type source struct {
+	entry
+	// The file, directory or symbolic link in the workspace.
+	file    string
+	modTime time.Time
+}
+
+// scanTree returns the entries of the file or directory at the path
+// relative to the root, placed below the files directory, with the
+// checksums of the files.  A local copy that is a symbolic link, such as a
+// seeded checkout, is followed.
+func scanTree(root, rel string) ([]source, error) {
+	src, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(rel)))
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []source
+	err = filepath.Walk(src, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		r, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		s := source{
+			entry: entry{
+				Path: filesDir + path.Join(rel, filepath.ToSlash(r)),
+				Mode: uint32(fi.Mode().Perm()),
+			},
+			file:    p,
+			modTime: fi.ModTime(),
+		}
+
+		switch {
+		case fi.IsDir():
+			s.Type = typeDir
+		case fi.Mode()&os.ModeSymlink != 0:
+			s.Type = typeSymlink
+			if s.Link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		case fi.Mode().IsRegular():
+			s.Type, s.Size = typeFile, fi.Size()
+			if s.SHA256, err = hashFile(p, s.Size); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+
+		sources = append(sources, s)
+		return nil
+	})
+
+	return sources, err
+}
+
+// hashFile returns the checksum of the first size bytes of the file.
+func hashFile(name string, size int64) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.CopyN(h, f, size); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeSource adds the entry to the archive.  Files are read again and
+// must still match the checksum in the manifest.
+func writeSource(tw *tar.Writer, s source) error {
+	hdr := &tar.Header{
+		Name:    s.Path,
+		Mode:    int64(s.Mode),
+		ModTime: s.modTime,
+	}
+	switch s.Type {
+	case typeDir:
+		hdr.Typeflag = tar.TypeDir
+	case typeSymlink:
+		hdr.Typeflag, hdr.Linkname = tar.TypeSymlink, s.Link
+	default:
+		hdr.Typeflag, hdr.Size = tar.TypeReg, s.Size
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if s.Type != typeFile {
+		return nil
+	}
+
+	f, err := os.Open(s.file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.CopyN(io.MultiWriter(tw, h), f, s.Size); err != nil {
+		return fmt.Errorf("%s changed while the bundle was created: %w", s.file, err)
+	}
+	if hex.EncodeToString(h.Sum(nil)) != s.SHA256 {
+		return fmt.Errorf("%s changed while the bundle was created", s.file)
+	}
+	return nil
+}
+
+// Load reads a bundle from r and installs its repositories into the root.
+// The manifest and its signature are read first and nothing else is read
+// from the bundle unless the manifest was signed by the verification key.
+// The bundle is then unpacked into the staging directory, where every entry
+// is checked against the manifest as it is written, and nothing is
+// installed unless every entry matches.  The local copies of the bundled
+// repositories are replaced and the repositories recorded in the state are
+// replaced by the bundled ones.  The service should be stopped while a
+// bundle is loaded.  The number of loaded repositories is returned.
+func Load(o Options, r io.Reader) (int, error) {
+	key, err := loadPublicKey(o.VerifyKey)
+	if err != nil {
+		return 0, err
+	}
+	limit := o.MaxSize
+	if limit <= 0 {
+		limit = DefaultMaxSize
+	}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	m, err := verify(tr, key, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	staging := filepath.Join(o.Root, filepath.FromSlash(stagingDir))
+	if err := os.MkdirAll(staging, 0755); err != nil {
+		return 0, err
+	}
+	dir, err := os.MkdirTemp(staging, "bundle-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(dir)
+
+	seen, err := unpack(tr, dir, m)
+	if err != nil {
+		return 0, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, reposFile))
+	if err != nil {
+		return 0, err
+	}
+	var repos []syncer.Repo
+	if err := json.Unmarshal(data, &repos); err != nil {
+		return 0, err
+	}
+
+	var paths []string
+	for i, r := range repos {
+		paths = append(paths, r.LocalPath)
+		repos[i].LocalPath = filepath.Join(o.Root, filepath.FromSlash(r.LocalPath))
+		for j, b := range r.Branches {
+			paths = append(paths, b.LocalPath)
+			repos[i].Branches[j].LocalPath = filepath.Join(o.Root, filepath.FromSlash(b.LocalPath))
+		}
+	}
+	if _, ok := seen[filesDir+indexFile]; ok {
+		paths = append(paths, indexFile)
+	}
+
+	files := filepath.Join(dir, strings.TrimSuffix(filesDir, "/"))
+	for _, p := range paths {
+		if err := place(files, o.Root, p); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(repos), syncer.ImportStateRepos(syncer.StatePath(o.Root, o.StatePath), repos)
+}
+
+// verify reads the manifest and its signature from the start of the bundle
+// and returns the manifest once the signature is verified.  Bundles whose
+// files add up to more than the limit are refused.
+func verify(tr *tar.Reader, key ed25519.PublicKey, limit int64) (*manifest, error) {
+	data, err := readEntry(tr, manifestFile, maxManifestSize)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := readEntry(tr, signatureFile, ed25519.SignatureSize)
+	if err != nil {
+		return nil, err
+	}
+	if !ed25519.Verify(key, data, sig) {
+		return nil, ErrSignature
+	}
+
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	if m.Format != Format {
+		return nil, fmt.Errorf("unsupported bundle format %d", m.Format)
+	}
+
+	var total int64
+	for _, e := range m.Entries {
+		if e.Size < 0 {
+			return nil, fmt.Errorf("%w: invalid size of %s", ErrIntegrity, e.Path)
+		}
+		if total += e.Size; total > limit {
+			return nil, fmt.Errorf("bundle is larger than %d bytes", limit)
+		}
+	}
+	return &m, nil
+}
+
+// readEntry reads the next entry of the archive, which has to be the named
+// file of at most limit bytes.  The manifest and its signature are the
+// only entries read this way, so anything else is reported as an invalid
+// signature.
+func readEntry(tr *tar.Reader, name string, limit int64) ([]byte, error) {
+	hdr, err := tr.Next()
+	if err == io.EOF {
+		return nil, ErrSignature
+	}
+	if err != nil {
+		return nil, err
+	}
+	if hdr.Name != name || hdr.Typeflag != tar.TypeReg || hdr.Size > limit {
+		return nil, ErrSignature
+	}
+	return io.ReadAll(tr)
+}
+
+// unpack extracts the rest of the bundle into the directory and returns
+// its entries.  Each entry has to match the manifest before it is written,
+// and files are checked against their signed size and checksum.  Entries
+// that would be written outside of the directory are rejected.
+func unpack(tr *tar.Reader, dir string, m *manifest) (map[string]entry, error) {
+	signed := make(map[string]entry, len(m.Entries))
+	for _, e := range m.Entries {
+		signed[e.Path] = e
+	}
+
+	seen := make(map[string]entry)
+	links := make(map[string]bool)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Directories are usually named with a trailing slash.
+		name := hdr.Name
+		if hdr.Typeflag == tar.TypeDir {
+			name = strings.TrimSuffix(name, "/")
+		}
+
+		want, ok := signed[name]
+		if !ok || (name != reposFile && !strings.HasPrefix(name, filesDir)) {
+			return nil, fmt.Errorf("%w: unexpected entry %s", ErrIntegrity, name)
+		}
+		if path.Clean("/" + name)[1:] != name || inside(links, name) {
+			return nil, &os.PathError{Op: "extract", Path: name, Err: os.ErrInvalid}
+		}
+		if _, ok := seen[name]; ok {
+			return nil, fmt.Errorf("%w: duplicate entry %s", ErrIntegrity, name)
+		}
+
+		e := entry{Path: name, Mode: uint32(os.FileMode(hdr.Mode).Perm())}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			e.Type = typeDir
+		case tar.TypeSymlink:
+			e.Type, e.Link = typeSymlink, hdr.Linkname
+		case tar.TypeReg:
+			e.Type, e.Size = typeFile, hdr.Size
+		default:
+			return nil, fmt.Errorf("%w: unsupported entry %s", ErrIntegrity, hdr.Name)
+		}
+		if e.Type != want.Type || e.Mode != want.Mode || e.Link != want.Link || e.Size != want.Size {
+			return nil, fmt.Errorf("%w: %s", ErrIntegrity, name)
+		}
+
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return nil, err
+		}
+		switch e.Type {
+		case typeDir:
+			err = os.MkdirAll(p, 0755)
+		case typeSymlink:
+			links[name] = true
+			err = os.Symlink(e.Link, p)
+		default:
+			e.SHA256, err = extractFile(tr, p, os.FileMode(e.Mode), e.Size)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if e.SHA256 != want.SHA256 {
+			return nil, fmt.Errorf("%w: %s", ErrIntegrity, name)
+		}
+		seen[name] = e
+	}
+
+	if len(seen) != len(m.Entries) {
+		return nil, fmt.Errorf("%w: entries are missing", ErrIntegrity)
+	}
+	return seen, nil
+}
+
+// inside returns true if one of the parent directories of the name is a
+// symbolic link that was extracted earlier.  Writing through the link
+// could place files outside of the staging directory.
+func inside(links map[string]bool, name string) bool {
+	for p := path.Dir(name); p != "." && p != "/"; p = path.Dir(p) {
+		if links[p] {
+			return true
+		}
+	}
+	return false
+}
+
+// extractFile writes the size bytes of the current archive entry to the
+// named file and returns their checksum.
+func extractFile(r io.Reader, name string, mode os.FileMode, size int64) (string, error) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	if _, err := io.CopyN(io.MultiWriter(f, h), r, size); err != nil {
+		f.Close()
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), f.Close()
+}
+
+// place moves the unpacked file or directory at the path relative to the
+// files directory into the root, replacing the existing copy.
+func place(files, root, rel string) error {
+	if rel == "" || path.Clean("/" + rel)[1:] != rel {
+		return &os.PathError{Op: "place", Path: rel, Err: os.ErrInvalid}
+	}
+
+	src := filepath.Join(files, filepath.FromSlash(rel))
+	if _, err := os.Lstat(src); err != nil {
+		return fmt.Errorf("%w: %s is missing", ErrIntegrity, rel)
+	}
+
+	dst := filepath.Join(root, filepath.FromSlash(rel))
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return os.Rename(src, dst)
+}
@@ -0,0 +1,216 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+)
+
+// fixture creates a workspace with a single repository and a key pair, and
+// returns the options to bundle it along with the bundle.
+func fixture(t *testing.T) (Options, []byte) {
+	t.Helper()
+
+	root := t.TempDir()
+	repo := filepath.Join(root, "src/github.com/ctxswitch/gdoc")
+	if err := os.MkdirAll(repo, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "gdoc.go"), []byte("package gdoc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	repos := []syncer.Repo{{Owner: "ctxswitch", Name: "gdoc", CommitSHA: "a1", LocalPath: repo}}
+	if err := syncer.ImportStateRepos(syncer.StatePath(root, ""), repos); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := t.TempDir()
+	o := Options{
+		Root:       root,
+		SigningKey: filepath.Join(keys, "bundle.key"),
+		VerifyKey:  filepath.Join(keys, "bundle.pub"),
+	}
+	if err := GenerateKey(o.SigningKey, o.VerifyKey); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := Create(o, &buf); err != nil {
+		t.Fatal(err)
+	}
+	return o, buf.Bytes()
+}
+
+// rewrite returns the bundle with the body of every entry passed through
+// fn.  Entries for which fn returns nil are dropped.
+func rewrite(t *testing.T, data []byte, fn func(name string, body []byte) []byte) []byte {
+	t.Helper()
+
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gr)
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body = fn(hdr.Name, body); body == nil {
+			continue
+		}
+		hdr.Size = int64(len(body))
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// target returns options that load into a new workspace with the keys of
+// the bundle.
+func target(t *testing.T, o Options) Options {
+	o.Root = t.TempDir()
+	return o
+}
+
+// installed returns true if the bundled file was placed in the workspace.
+func installed(o Options) bool {
+	_, err := os.Stat(filepath.Join(o.Root, "src/github.com/ctxswitch/gdoc/gdoc.go"))
+	return err == nil
+}
+
+func TestLoad(t *testing.T) {
+	o, data := fixture(t)
+
+	dst := target(t, o)
+	n, err := Load(dst, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 1 || !installed(dst) {
+		t.Fatalf("expected the repository to be installed, got %d", n)
+	}
+
+	repos, err := syncer.StateRepos(syncer.StatePath(dst.Root, ""))
+	if err != nil || len(repos) != 1 || repos[0].LocalPath != filepath.Join(dst.Root, "src/github.com/ctxswitch/gdoc") {
+		t.Fatalf("expected the repository to be recorded below the new root, got %+v, %v", repos, err)
+	}
+}
+
+func TestLoadRejectsTamperedBundle(t *testing.T) {
+	o, data := fixture(t)
+	tampered := rewrite(t, data, func(name string, body []byte) []byte {
+		if name == filesDir+"src/github.com/ctxswitch/gdoc/gdoc.go" {
+			return []byte("package evil\n")
+		}
+		return body
+	})
+
+	dst := target(t, o)
+	if _, err := Load(dst, bytes.NewReader(tampered)); !errors.Is(err, ErrIntegrity) {
+		t.Fatalf("expected ErrIntegrity, got %v", err)
+	}
+	if installed(dst) {
+		t.Fatal("expected nothing to be installed")
+	}
+}
+
+func TestLoadRejectsUnsignedBundle(t *testing.T) {
+	o, data := fixture(t)
+
+	tests := map[string][]byte{
+		"unsigned": rewrite(t, data, func(name string, body []byte) []byte {
+			if name == signatureFile {
+				return nil
+			}
+			return body
+		}),
+		"forged manifest": rewrite(t, data, func(name string, body []byte) []byte {
+			if name == manifestFile {
+				return bytes.Replace(body, []byte(`"format": 2`), []byte(`"format":  2`), 1)
+			}
+			return body
+		}),
+		"no manifest": rewrite(t, data, func(name string, body []byte) []byte {
+			if name == manifestFile || name == signatureFile {
+				return nil
+			}
+			return body
+		}),
+	}
+
+	for name, bundle := range tests {
+		dst := target(t, o)
+		if _, err := Load(dst, bytes.NewReader(bundle)); !errors.Is(err, ErrSignature) {
+			t.Errorf("%s: expected ErrSignature, got %v", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(dst.Root, stagingDir)); !os.IsNotExist(err) {
+			t.Errorf("%s: expected nothing to be unpacked, got %v", name, err)
+		}
+	}
+
+	other, _ := fixture(t)
+	o.VerifyKey = other.VerifyKey
+	if _, err := Load(target(t, o), bytes.NewReader(data)); !errors.Is(err, ErrSignature) {
+		t.Fatalf("other key: expected ErrSignature, got %v", err)
+	}
+}
+
+func TestLoadLimitsSize(t *testing.T) {
+	o, data := fixture(t)
+
+	dst := target(t, o)
+	dst.MaxSize = 8
+	if _, err := Load(dst, bytes.NewReader(data)); err == nil {
+		t.Fatal("expected an error for a bundle larger than the limit")
+	}
+	if installed(dst) {
+		t.Fatal("expected nothing to be installed")
+	}
+}
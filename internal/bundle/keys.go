@@ -0,0 +1,121 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package bundle
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// GenerateKey writes a new ed25519 key pair to the named files in PEM
+// format.  The private key is only readable by its owner.  Existing files
+// are never overwritten.
+func GenerateKey(private, public string) error {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return err
+	}
+	if err := writePEM(private, "PRIVATE KEY", der, 0600); err != nil {
+		return err
+	}
+
+	if der, err = x509.MarshalPKIXPublicKey(pub); err != nil {
+		return err
+	}
+	return writePEM(public, "PUBLIC KEY", der, 0644)
+}
+
+// writePEM creates the named file with a single PEM block.
+func writePEM(name, typ string, der []byte, mode os.FileMode) error {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	if err := pem.Encode(f, &pem.Block{Type: typ, Bytes: der}); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readPEM returns the first PEM block of the named file.
+func readPEM(name, typ string) ([]byte, error) {
+	if name == "" {
+		return nil, errors.New("no key file configured")
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != typ {
+		return nil, fmt.Errorf("%s does not contain a %s", name, typ)
+	}
+	return block.Bytes, nil
+}
+
+// loadPrivateKey reads the ed25519 private key that bundles are signed
+// with.
+func loadPrivateKey(name string) (ed25519.PrivateKey, error) {
+	der, err := readPEM(name, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an ed25519 private key", name)
+	}
+	return priv, nil
+}
+
+// loadPublicKey reads the ed25519 public key that bundles are verified
+// with.
+func loadPublicKey(name string) (ed25519.PublicKey, error) {
+	der, err := readPEM(name, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an ed25519 public key", name)
+	}
+	return pub, nil
+}
@@ -19,13 +19,19 @@
 package config
 
 import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
 	"github.com/kelseyhightower/envconfig"
 )
 
 type Config struct {
 	// A personal access token with permissions to access and list the
-	// repositories.
-	GithubToken string `envconfig:"GITHUB_TOKEN" required:"true"`
+	// repositories.  When empty, public repositories are synchronized
+	// without authentication.
+	GithubToken string `envconfig:"GITHUB_TOKEN" default:"" redact:"true"`
 	// The user who the token belongs to.  Defaults to the Github user.
 	GithubTokenUser string `envconfig:"GITHUB_TOKEN_USER" default:""`
 	// The Github user or organization that will be scraped.  Only single
@@ -40,25 +46,452 @@ type Config struct {
 	// The topic that will be used as a filter to identify repositories
 	// that will be synchronized.
 	GithubTopic string `envconfig:"GITHUB_TOPIC" default:"godoc"`
+	// How repositories are discovered.  "topic" searches for repositories
+	// tagged with the topic and "org" synchronizes every Go repository in
+	// the organization.
+	GithubDiscovery string `envconfig:"GITHUB_DISCOVERY" default:"topic"`
+	// A raw Github search query used instead of the query built from the
+	// user and topic when repositories are discovered by topic.
+	GithubSearchQuery string `envconfig:"GITHUB_SEARCH_QUERY" default:""`
+	// Log every call made to the Github API with the rate limit headers
+	// and latency.  Can be toggled at runtime through the management API.
+	GithubTrace bool `envconfig:"GITHUB_TRACE" default:"false"`
+	// The consecutive failed Github API calls, such as while Github is
+	// down or after the token was revoked, after which the API is no
+	// longer called until a probe succeeds.  0 to disable.
+	GithubBreakerThreshold int `envconfig:"GITHUB_BREAKER_THRESHOLD" default:"5"`
+	// How long the Github API is left alone before it is probed again.
+	// Doubled after each failed probe.
+	GithubBreakerCooldown time.Duration `envconfig:"GITHUB_BREAKER_COOLDOWN" default:"1m"`
+	// The method used to detect changes to a repository.  Either "api" to
+	// look up the default branch through the Github API or "git" to list
+	// the remote references directly, which does not count against the
+	// API limits.
+	SyncMode string `envconfig:"SYNC_MODE" default:"api"`
+	// Clone updates into a staging directory and swap them into place so
+	// that godoc never indexes a partially updated repository.
+	AtomicUpdates bool `envconfig:"ATOMIC_UPDATES" default:"false"`
+	// The directory that repositories are cloned into before they are
+	// moved into place.  Empty to use .gdoc/staging below the GODOC_ROOT.
+	StagingDir string `envconfig:"STAGING_DIR" default:""`
+	// Only discover repositories during the sync cycle and clone them the
+	// first time their documentation is requested from the html backend.
+	LazySync bool `envconfig:"LAZY_SYNC" default:"false"`
+	// Serve only the repositories on disk and suppress every outbound
+	// network call, for air-gapped environments.
+	Offline bool `envconfig:"OFFLINE" default:"false"`
+	// A comma separated list of branches that are checked out next to the
+	// default branch of every repository.
+	Branches []string `envconfig:"BRANCHES" default:""`
+	// The branches of individual repositories as a comma separated list of
+	// owner/name:branches pairs with the branches separated by "|".
+	// Replaces BRANCHES for those repositories.
+	RepoBranches map[string]string `envconfig:"REPO_BRANCHES" default:""`
+	// A directory with existing checkouts, such as the GOPATH of a hand
+	// maintained godoc server, that repositories missing from the
+	// workspace are seeded from instead of being cloned.
+	SeedDir string `envconfig:"SEED_DIR" default:""`
+	// How repositories are seeded from the seed directory.  Either "copy"
+	// or "symlink".  Symlinked checkouts are updated in place.
+	SeedMode string `envconfig:"SEED_MODE" default:"copy"`
+	// An expression that discovered repositories must match to be
+	// synchronized.  Empty synchronizes every repository.
+	SyncPolicy string `envconfig:"SYNC_POLICY" default:""`
+	// An expression matching the newly discovered repositories that are
+	// paused until they are resumed.  Empty disables the quarantine.
+	QuarantinePolicy string `envconfig:"QUARANTINE_POLICY" default:""`
+	// The maximum time a clone may take before it is cancelled.  0 to
+	// disable the timeout.
+	CloneTimeout time.Duration `envconfig:"CLONE_TIMEOUT" default:"10m"`
+	// The maximum time a pull may take before it is cancelled.  0 to
+	// disable the timeout.
+	PullTimeout time.Duration `envconfig:"PULL_TIMEOUT" default:"5m"`
+	// The maximum time a single Github API call or remote reference
+	// listing may take before it is cancelled.  0 to disable the timeout.
+	APITimeout time.Duration `envconfig:"API_TIMEOUT" default:"30s"`
+	// The backend used to serve the documentation.  Either "godoc",
+	// "pkgsite" or "html" for the built-in renderer.
+	DocBackend string `envconfig:"DOC_BACKEND" default:"godoc"`
+	// A directory containing templates and static files that replace the
+	// embedded web assets of the html backend.
+	WebOverrideDir string `envconfig:"WEB_OVERRIDE_DIR" default:""`
+	// The locale used by the html backend when none of the languages
+	// requested by the browser are available.
+	DefaultLocale string `envconfig:"DEFAULT_LOCALE" default:"en"`
+	// A comma separated list of owner/name patterns of the repositories
+	// that are kept out of search engines and searches.
+	NoIndexRepos []string `envconfig:"NOINDEX_REPOS" default:""`
+	// The URL of the mermaid script loaded by the html backend to render
+	// mermaid diagrams.  Empty to show the diagram sources.
+	MermaidURL string `envconfig:"MERMAID_URL" default:"https://cdn.jsdelivr.net/npm/mermaid@9/dist/mermaid.min.js"`
+	// The URL of the PlantUML server that renders PlantUML diagrams for
+	// the html backend.  Empty to show the diagram sources.
+	PlantUMLServer string `envconfig:"PLANTUML_SERVER" default:""`
+	// The largest image in MiB that the html backend serves from the
+	// synchronized repositories.
+	AssetMaxSize int64 `envconfig:"ASSET_MAX_SIZE" default:"5"`
+	// The Content-Security-Policy header sent with the pages of the html
+	// backend.  Empty to leave the header out.
+	ContentSecurityPolicy string `envconfig:"CONTENT_SECURITY_POLICY" default:"default-src 'self'; script-src 'self' https://cdn.jsdelivr.net; style-src 'self' 'unsafe-inline'; img-src 'self' data: https:; frame-ancestors 'none'; base-uri 'self'; form-action 'self'"`
+	// The X-Frame-Options header sent with the responses of the html
+	// backend and the management API.  Empty to leave the header out.
+	FrameOptions string `envconfig:"FRAME_OPTIONS" default:"DENY"`
+	// The Strict-Transport-Security header sent with the responses of the
+	// html backend and the management API.  Empty to leave the header out.
+	HSTS string `envconfig:"HSTS" default:"max-age=31536000"`
+	// The Referrer-Policy header sent with the responses of the html
+	// backend and the management API.  Empty to leave the header out.
+	ReferrerPolicy string `envconfig:"REFERRER_POLICY" default:"strict-origin-when-cross-origin"`
+	// A comma separated list of directory names that are left out of the
+	// html backend.
+	ExcludeDirs []string `envconfig:"EXCLUDE_DIRS" default:"vendor,testdata"`
+	// Leave generated files out of the html backend.
+	ExcludeGenerated bool `envconfig:"EXCLUDE_GENERATED" default:"false"`
+	// Whether internal packages are documented by the html backend.
+	// Either "show" or "hide".
+	InternalPackages string `envconfig:"INTERNAL_PACKAGES" default:"show"`
+	// The internal package policy of individual repositories as a comma
+	// separated list of owner/name:policy pairs.
+	InternalPackagesRepos map[string]string `envconfig:"INTERNAL_PACKAGES_REPOS" default:""`
 	// The port that godoc will run on.
 	GodocPort int `envconfig:"GODOC_PORT" default:"6060"`
+	// The address that the documentation and the management API listen
+	// on.  Empty to listen on every address.
+	BindAddress string `envconfig:"BIND_ADDRESS" default:""`
+	// The address families that the services listen on, either dual,
+	// ipv4 or ipv6.
+	AddressFamily string `envconfig:"ADDRESS_FAMILY" default:"dual"`
+	// The path of a unix domain socket that the html backend listens on in
+	// addition to the port.
+	GodocSocket string `envconfig:"GODOC_SOCKET" default:""`
 	// The GOROOT value that will be passed to godoc.
 	GodocRoot string `envconfig:"GODOC_ROOT" default:"/usr/local/go"`
+	// The template used to build the path of a repository relative to
+	// the GODOC_ROOT.  Has access to {{.Host}}, {{.Owner}}, {{.Name}} and
+	// {{.Ref}}.
+	PathTemplate string `envconfig:"PATH_TEMPLATE" default:"src/{{.Host}}/{{.Owner}}/{{.Name}}"`
 	// The indexing interval for godoc.  0 for default (5m), negative
 	// to only index once at startup.
 	GodocIndexInterval string `envconfig:"GODOC_INDEX_INTERVAL" default:"1m"`
+	// The number of CPUs the godoc or pkgsite process uses at the same
+	// time, passed as GOMAXPROCS.  0 leaves it unset.
+	GodocMaxProcs int `envconfig:"GODOC_MAX_PROCS" default:"0"`
+	// The garbage collection target percentage of the godoc or pkgsite
+	// process, passed as GOGC.  0 leaves it unset.
+	GodocGCPercent int `envconfig:"GODOC_GOGC" default:"0"`
+	// The memory limit of the godoc or pkgsite process in MiB.  0 leaves
+	// it unset.
+	GodocMemoryLimit int64 `envconfig:"GODOC_MEMORY_LIMIT" default:"0"`
+	// The number of CPUs the godoc or pkgsite process may use when it is
+	// run in a cgroup.  0 leaves it unset.
+	GodocCPULimit float64 `envconfig:"GODOC_CPU_LIMIT" default:"0"`
+	// The path of a cgroup v2 directory delegated to gdoc that the godoc
+	// or pkgsite process is moved into.  Linux only.
+	GodocCgroup string `envconfig:"GODOC_CGROUP" default:""`
+	// Pass the whole environment of gdoc on to the godoc or pkgsite
+	// process.  When false, only the variables in GodocEnvAllow are
+	// inherited.
+	GodocInheritEnv bool `envconfig:"GODOC_INHERIT_ENV" default:"true"`
+	// The names of the variables inherited by the godoc or pkgsite process
+	// when GodocInheritEnv is false.
+	GodocEnvAllow []string `envconfig:"GODOC_ENV_ALLOW" default:"PATH,HOME,TMPDIR"`
+	// Additional variables set for the godoc or pkgsite process, read from
+	// the variables prefixed with GODOC_ENV_ with the prefix removed.
+	GodocEnv []string `ignored:"true"`
+	// How long active requests are given to finish when the web and
+	// management API servers are stopped.
+	ShutdownTimeout time.Duration `envconfig:"SHUTDOWN_TIMEOUT" default:"30s"`
+	// The time allowed to read a request to the html backend or the
+	// management API, including its body.  Zero disables the timeout.
+	HTTPReadTimeout time.Duration `envconfig:"HTTP_READ_TIMEOUT" default:"1m"`
+	// The time a keep-alive connection to the html backend or the
+	// management API is kept open between requests.
+	HTTPIdleTimeout time.Duration `envconfig:"HTTP_IDLE_TIMEOUT" default:"2m"`
+	// The time allowed to write a response of the html backend.  Zero
+	// disables the timeout.
+	DocsWriteTimeout time.Duration `envconfig:"DOCS_WRITE_TIMEOUT" default:"1m"`
+	// The time after which requests to the html backend or the management
+	// API are logged as slow.  Zero disables the logging.
+	SlowRequestThreshold time.Duration `envconfig:"SLOW_REQUEST_THRESHOLD" default:"5s"`
+	// The port that the management API will run on.
+	APIPort int `envconfig:"API_PORT" default:"6061"`
+	// The path of a unix domain socket that the management API listens on
+	// in addition to the port.
+	APISocket string `envconfig:"API_SOCKET" default:""`
+	// The largest request body in KiB that the management API accepts.
+	// Module uploads are limited by the size of a module zip instead.
+	APIMaxBodySize int64 `envconfig:"API_MAX_BODY_SIZE" default:"1024"`
+	// The PEM encoded certificate that the management API serves TLS with
+	// on its port.  Empty to serve plain HTTP.
+	APITLSCert string `envconfig:"API_TLS_CERT" default:""`
+	// The PEM encoded private key of the API_TLS_CERT certificate.
+	APITLSKey string `envconfig:"API_TLS_KEY" default:""`
+	// The PEM encoded CA certificates that the clients of the management
+	// API must present a certificate signed by.  Also trusted for the
+	// certificates of the cluster peers.  Empty to not ask for client
+	// certificates.
+	APIClientCA string `envconfig:"API_CLIENT_CA" default:""`
+	// A comma separated list of SPDX license identifiers that repositories
+	// are allowed to use.  Repositories with other licenses are flagged in
+	// the license report.  Empty to allow all licenses.
+	AllowedLicenses []string `envconfig:"ALLOWED_LICENSES" default:""`
+	// The oldest Go version that modules are expected to use.  Modules
+	// with an older go directive are flagged in the Go version report.
+	// Empty to use the oldest supported Go release.
+	MinimumGoVersion string `envconfig:"MINIMUM_GO_VERSION" default:""`
+	// Check the dependencies of every module against the OSV database
+	// after each sync.
+	VulnScan bool `envconfig:"VULN_SCAN" default:"false"`
+	// The address of the OSV API used for vulnerability scanning.
+	OSVURL string `envconfig:"OSV_URL" default:"https://api.osv.dev"`
+	// Compare the requirements of every module with the latest versions
+	// available from the module proxy after each sync.
+	DependencyCheck bool `envconfig:"DEPENDENCY_CHECK" default:"false"`
+	// The address of the module proxy used for dependency checking and
+	// for downloading the proxy modules.
+	GoProxyURL string `envconfig:"GOPROXY_URL" default:"https://proxy.golang.org"`
+	// A comma separated list of modules downloaded from the module proxy
+	// and documented as path@query, where the query is "latest", an exact
+	// version or a version prefix such as v1.
+	ProxyModules []string `envconfig:"PROXY_MODULES" default:""`
+	// The time between checks of the proxy modules for new versions.
+	ProxyInterval time.Duration `envconfig:"PROXY_INTERVAL" default:"1h"`
+	// The Go release whose standard library is downloaded and documented
+	// instead of the one in the GODOC_ROOT.  Empty to keep the installed
+	// standard library.
+	StdlibVersion string `envconfig:"STDLIB_VERSION" default:""`
+	// A comma separated list of additional Go releases whose standard
+	// libraries are documented side by side by the html backend.
+	StdlibVersions []string `envconfig:"STDLIB_VERSIONS" default:""`
+	// The site that Go releases are downloaded from.
+	StdlibDownloadURL string `envconfig:"STDLIB_DOWNLOAD_URL" default:"https://go.dev/dl/"`
+	// The paths of Go plugins that are loaded on start to add providers,
+	// notifiers, processors and authenticators.  Empty to disable plugins.
+	Plugins []string `envconfig:"PLUGINS" default:""`
+	// The minimum severity of the events sent to the notifiers registered
+	// by plugins.
+	PluginSeverity string `envconfig:"PLUGIN_SEVERITY" default:"warning"`
+	// The roles of the callers of the management API as a comma separated
+	// list of subject:role pairs, where the subject is a user name,
+	// group:<name> or * for every caller.
+	APIRoles Roles `envconfig:"API_ROLES" default:""`
+	// Listen on the BIND_ADDRESS even though the management API has no
+	// authentication.  Otherwise it only listens on the loopback address.
+	APIAllowAnonymous bool `envconfig:"API_ALLOW_ANONYMOUS" default:"false"`
+	// The SameSite attribute of the cookies set by the management API,
+	// either strict, lax or none.
+	CookieSameSite string `envconfig:"COOKIE_SAMESITE" default:"strict"`
+	// Mark the cookies set by the management API as secure even when the
+	// request was not served over TLS.
+	CookieSecure bool `envconfig:"COOKIE_SECURE" default:"false"`
+	// A json file mapping the hosts of git servers to the headers added
+	// to the git requests sent to them.  Empty to add no headers.
+	GitHeadersFile string `envconfig:"GIT_HEADERS_FILE" default:""`
+	// A file in the Netscape cookie format with the cookies sent with git
+	// requests.  Empty to send no cookies.
+	GitCookieFile string `envconfig:"GIT_COOKIE_FILE" default:""`
+	// Leave the tags out of clones.  Tags are still fetched by pulls.
+	GitNoTags bool `envconfig:"GIT_NO_TAGS" default:"false"`
+	// Only clone the default branch of repositories.
+	GitSingleBranch bool `envconfig:"GIT_SINGLE_BRANCH" default:"false"`
+	// The size of the go-git object cache of each repository in MiB.
+	GitObjectCacheSize int64 `envconfig:"GIT_OBJECT_CACHE_SIZE" default:"96"`
+	// A json file defining the hooks that are run before and after a
+	// repository is updated.  Empty to disable hooks.
+	HooksFile string `envconfig:"HOOKS_FILE" default:""`
+	// The names of the variables of the gdoc environment that hook
+	// commands inherit.
+	HookEnvAllow []string `envconfig:"HOOK_ENV_ALLOW" default:"PATH,HOME,TMPDIR,GOPATH,GOCACHE,GOMODCACHE,GOFLAGS"`
+	// The name of this instance, sent in the User-Agent of Github API and
+	// git requests.  Defaults to the hostname.
+	InstanceName string `envconfig:"INSTANCE_NAME" default:""`
+	// A comma separated list of the management API addresses of the other
+	// instances that are shown on the cluster status.
+	ClusterPeers []string `envconfig:"CLUSTER_PEERS" default:""`
+	// The lock shared by the instances that synchronize the same storage,
+	// either none, file or redis.
+	SyncLock string `envconfig:"SYNC_LOCK" default:"none"`
+	// The file locked by the file lock.  Empty to use .gdoc/sync.lock
+	// below the GODOC_ROOT.
+	SyncLockPath string `envconfig:"SYNC_LOCK_PATH" default:""`
+	// The address of the redis server used by the redis lock as
+	// redis://[user:password@]host:port/db.
+	SyncLockRedisURL string `envconfig:"SYNC_LOCK_REDIS_URL" default:"" redact:"true"`
+	// The redis key that the lock is stored in.
+	SyncLockKey string `envconfig:"SYNC_LOCK_KEY" default:"gdoc/sync"`
+	// The expiry of the redis lock.  It is renewed while it is held.
+	SyncLockTTL time.Duration `envconfig:"SYNC_LOCK_TTL" default:"1m"`
+	// The file the syncer state is persisted to.  Empty to use
+	// .gdoc/state.json below the GODOC_ROOT.
+	StatePath string `envconfig:"STATE_PATH" default:""`
+	// The number of sync cycles kept in the history.
+	HistorySize int `envconfig:"HISTORY_SIZE" default:"50"`
+	// The wait after the first failure of a repository.  The wait is
+	// doubled after each consecutive failure.
+	RetryBackoff time.Duration `envconfig:"RETRY_BACKOFF" default:"5m"`
+	// The longest wait between attempts of a failing repository.
+	RetryMaxBackoff time.Duration `envconfig:"RETRY_MAX_BACKOFF" default:"6h"`
+	// The number of consecutive failures after which a repository is
+	// moved to the dead letter list.  Zero keeps retrying forever.
+	DeadLetterAfter int `envconfig:"DEAD_LETTER_AFTER" default:"10"`
+	// Local directories that are not under version control and are
+	// documented as a comma separated list of importpath:dir pairs.
+	LocalSources map[string]string `envconfig:"LOCAL_SOURCES" default:""`
+	// The time between checks of the local sources for changes.
+	LocalPollInterval time.Duration `envconfig:"LOCAL_POLL_INTERVAL" default:"30s"`
+	// Accept module zips posted to the management API and extract them
+	// into the workspace.
+	ModuleUploads bool `envconfig:"MODULE_UPLOADS" default:"false"`
+	// The PEM file with the ed25519 private key that bundles are signed
+	// with by "gdoc bundle create".
+	BundleSigningKey string `envconfig:"BUNDLE_SIGNING_KEY" default:""`
+	// The PEM file with the ed25519 public key that bundles are verified
+	// with by "gdoc bundle load".
+	BundleVerifyKey string `envconfig:"BUNDLE_VERIFY_KEY" default:""`
+	// The directory that workspace backups are written to.  Empty
+	// disables backups.
+	BackupDir string `envconfig:"BACKUP_DIR" default:""`
+	// The minimum time between workspace backups.
+	BackupInterval time.Duration `envconfig:"BACKUP_INTERVAL" default:"24h"`
+	// The number of workspace backups that are kept.
+	BackupKeep int `envconfig:"BACKUP_KEEP" default:"7"`
+	// Restores the newest backup from the backup directory when the
+	// GodocRoot is empty on start.
+	RestoreOnStart bool `envconfig:"RESTORE_ON_START" default:"false"`
+	// The address of a Microsoft Teams incoming webhook that events are
+	// sent to.  Empty disables the Teams notifications.
+	TeamsWebhookURL string `envconfig:"TEAMS_WEBHOOK_URL" default:"" redact:"true"`
+	// The minimum severity of the events sent to Teams.
+	TeamsSeverity string `envconfig:"TEAMS_SEVERITY" default:"warning"`
+	// The integration key of the PagerDuty service that alerts are raised
+	// on.  Empty disables the PagerDuty notifications.
+	PagerDutyRoutingKey string `envconfig:"PAGERDUTY_ROUTING_KEY" default:"" redact:"true"`
+	// The minimum severity of the events sent to PagerDuty.
+	PagerDutySeverity string `envconfig:"PAGERDUTY_SEVERITY" default:"critical"`
+	// The address of the PagerDuty Events API.
+	PagerDutyURL string `envconfig:"PAGERDUTY_URL" default:"https://events.pagerduty.com/v2/enqueue"`
+	// The address of the SMTP server the digest is sent through as
+	// host:port.  Empty disables the digest.
+	DigestSMTPAddr string `envconfig:"DIGEST_SMTP_ADDR" default:""`
+	// The user and password used to authenticate with the SMTP server.
+	DigestSMTPUser     string `envconfig:"DIGEST_SMTP_USER" default:""`
+	DigestSMTPPassword string `envconfig:"DIGEST_SMTP_PASSWORD" default:"" redact:"true"`
+	// The sender of the digest.
+	DigestFrom string `envconfig:"DIGEST_FROM" default:""`
+	// A comma separated list of the recipients of the digest.
+	DigestTo []string `envconfig:"DIGEST_TO" default:""`
+	// The time between digests.
+	DigestInterval time.Duration `envconfig:"DIGEST_INTERVAL" default:"24h"`
+	// The signing secret of the Slack app whose slash commands are
+	// handled.  Empty disables the slash commands.
+	SlackSigningSecret string `envconfig:"SLACK_SIGNING_SECRET" default:"" redact:"true"`
+	// The markers of the notes, such as BUG or TODO, that are collected as
+	// a regular expression.
+	NotesPattern string `envconfig:"NOTES_PATTERN" default:"BUG|TODO|NOTE"`
+	// The address of an OpenAI compatible API that the embeddings of the
+	// semantic search are requested from.  Empty disables semantic search.
+	SearchEmbeddingsURL string `envconfig:"SEARCH_EMBEDDINGS_URL" default:""`
+	// The embedding model.
+	SearchEmbeddingsModel string `envconfig:"SEARCH_EMBEDDINGS_MODEL" default:"text-embedding-3-small"`
+	// The bearer token sent to the embeddings API.
+	SearchEmbeddingsToken string `envconfig:"SEARCH_EMBEDDINGS_TOKEN" default:"" redact:"true"`
+	// The share of the search score given to semantic similarity.  The
+	// rest is given to the keyword match.
+	SearchSemanticWeight float64 `envconfig:"SEARCH_SEMANTIC_WEIGHT" default:"0.7"`
 	// Changes the verbosity of the logging system.
 	LogLevel string `envconfig:"LOG_LEVEL" default:"INFO"`
+	// Problems found while reading the configuration, such as values that
+	// could not be parsed or are not supported.
+	Warnings []string `ignored:"true"`
 }
 
 // New returns a configuration that has been processed and defaulted.
 func New() *Config {
 	config := &Config{}
-	_ = envconfig.Process("", config)
+	err := envconfig.Process("", config)
 
 	if config.GithubTokenUser == "" {
 		config.GithubTokenUser = config.GithubUser
 	}
 
+	if config.InstanceName == "" {
+		config.InstanceName, _ = os.Hostname()
+	}
+
+	config.GodocEnv = prefixed(os.Environ(), godocEnvPrefix)
+	config.Warnings = config.validate(err)
+	if config.Offline {
+		config.Warnings = append(config.Warnings, config.offline()...)
+	}
+
 	return config
 }
+
+// offline disables the settings that make outbound network calls and
+// returns a warning for each one that was set.  The syncer and the
+// standard library downloads check Offline themselves.
+func (c *Config) offline() []string {
+	var warnings []string
+	disable := func(name string, set bool, clear func()) {
+		if set {
+			warnings = append(warnings, name+" is ignored in offline mode")
+			clear()
+		}
+	}
+
+	disable("LAZY_SYNC", c.LazySync, func() { c.LazySync = false })
+	disable("VULN_SCAN", c.VulnScan, func() { c.VulnScan = false })
+	disable("DEPENDENCY_CHECK", c.DependencyCheck, func() { c.DependencyCheck = false })
+	disable("PROXY_MODULES", len(c.ProxyModules) > 0, func() { c.ProxyModules = nil })
+	disable("CLUSTER_PEERS", len(c.ClusterPeers) > 0, func() { c.ClusterPeers = nil })
+	disable("SYNC_LOCK", c.SyncLock == "redis", func() { c.SyncLock = "none" })
+	disable("TEAMS_WEBHOOK_URL", c.TeamsWebhookURL != "", func() { c.TeamsWebhookURL = "" })
+	disable("PAGERDUTY_ROUTING_KEY", c.PagerDutyRoutingKey != "", func() { c.PagerDutyRoutingKey = "" })
+	disable("DIGEST_SMTP_ADDR", c.DigestSMTPAddr != "", func() { c.DigestSMTPAddr = "" })
+	disable("SLACK_SIGNING_SECRET", c.SlackSigningSecret != "", func() { c.SlackSigningSecret = "" })
+	disable("SEARCH_EMBEDDINGS_URL", c.SearchEmbeddingsURL != "", func() { c.SearchEmbeddingsURL = "" })
+
+	return warnings
+}
+
+// godocEnvPrefix is the prefix of the variables that are passed to the
+// godoc or pkgsite process.
+const godocEnvPrefix = "GODOC_ENV_"
+
+// prefixed returns the variables of the environment whose name starts with
+// the prefix, with the prefix removed.  The ALLOW variable that shares the
+// prefix is left out.
+func prefixed(environ []string, prefix string) []string {
+	var env []string
+	for _, kv := range environ {
+		if !strings.HasPrefix(kv, prefix) || strings.HasPrefix(kv, prefix+"ALLOW=") {
+			continue
+		}
+		if kv = strings.TrimPrefix(kv, prefix); !strings.HasPrefix(kv, "=") {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
+
+// Roles maps the subjects of the management API roles to their role.
+type Roles map[string]string
+
+// Decode parses a comma separated list of subject:role pairs.  Subjects
+// may contain colons, such as group:sre, so each pair is split at its last
+// colon.
+func (r *Roles) Decode(value string) error {
+	roles := Roles{}
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		i := strings.LastIndex(pair, ":")
+		if i <= 0 {
+			return fmt.Errorf("invalid role %q, expected subject:role", pair)
+		}
+		roles[pair[:i]] = pair[i+1:]
+	}
+	*r = roles
+	return nil
+}
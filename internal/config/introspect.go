@@ -0,0 +1,195 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package config
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Sources of the effective value of a setting.
+const (
+	// SourceEnv is a value read from the environment.
+	SourceEnv = "env"
+	// SourceDefault is the default value of the setting.
+	SourceDefault = "default"
+	// SourceDerived is a value derived from other settings or the host,
+	// such as the instance name.
+	SourceDerived = "derived"
+)
+
+// redacted replaces the values of secret settings.
+const redacted = "REDACTED"
+
+// choices are the values supported by the settings that only accept a
+// fixed set of values.
+var choices = map[string][]string{
+	"GITHUB_DISCOVERY":   {"topic", "org"},
+	"SYNC_MODE":          {"api", "git"},
+	"SEED_MODE":          {"copy", "symlink"},
+	"DOC_BACKEND":        {"godoc", "pkgsite", "html"},
+	"INTERNAL_PACKAGES":  {"show", "hide"},
+	"TEAMS_SEVERITY":     {"info", "warning", "critical"},
+	"PAGERDUTY_SEVERITY": {"info", "warning", "critical"},
+	"PLUGIN_SEVERITY":    {"info", "warning", "critical"},
+	"COOKIE_SAMESITE":    {"strict", "lax", "none"},
+	"SYNC_LOCK":          {"none", "file", "redis"},
+	"ADDRESS_FAMILY":     {"dual", "ipv4", "ipv6"},
+}
+
+// Setting is the effective value of a single environment variable.
+type Setting struct {
+	Name string `json:"name"`
+	// The effective value.  Secrets are replaced with REDACTED when set.
+	Value interface{} `json:"value"`
+	// The default value of the setting.
+	Default string `json:"default"`
+	// Where the value came from.  Either "env", "default" or "derived".
+	Source string `json:"source"`
+	// Set when the value is a secret that has been redacted.
+	Secret bool `json:"secret,omitempty"`
+}
+
+// Settings returns the effective value of every setting in the order they
+// are defined.
+func (c *Config) Settings() []Setting {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+
+	var settings []Setting
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("envconfig")
+		if name == "" {
+			continue
+		}
+
+		s := Setting{
+			Name:    name,
+			Value:   v.Field(i).Interface(),
+			Default: f.Tag.Get("default"),
+			Source:  SourceDefault,
+			Secret:  f.Tag.Get("redact") == "true",
+		}
+
+		switch _, ok := os.LookupEnv(name); {
+		case ok:
+			s.Source = SourceEnv
+		case !isDefault(v.Field(i), s.Default):
+			s.Source = SourceDerived
+		}
+
+		if s.Secret && !v.Field(i).IsZero() {
+			s.Value = redacted
+		}
+		settings = append(settings, s)
+	}
+	return settings
+}
+
+// isDefault returns true if the value is the default of the setting.
+func isDefault(v reflect.Value, def string) bool {
+	if def == "" && v.IsZero() {
+		return true
+	}
+	if d, ok := v.Interface().(time.Duration); ok {
+		parsed, err := time.ParseDuration(def)
+		return err == nil && parsed == d
+	}
+	return format(v) == def
+}
+
+// format returns the value in the form used by the default tags.
+func format(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = fmt.Sprint(v.Index(i).Interface())
+		}
+		return strings.Join(items, ",")
+	case reflect.Map:
+		if v.Len() == 0 {
+			return ""
+		}
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// validate returns the problems with the configuration.  The error of
+// processing the environment is reported first since the settings that
+// follow the one that failed keep their defaults.
+func (c *Config) validate(err error) []string {
+	var warnings []string
+	if err != nil {
+		warnings = append(warnings, err.Error())
+	}
+
+	if c.GithubUser == "" {
+		warnings = append(warnings, "GITHUB_USER is not set")
+	}
+
+	for _, s := range c.Settings() {
+		allowed, ok := choices[s.Name]
+		if !ok || contains(allowed, strings.ToLower(fmt.Sprint(s.Value))) {
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("%s is %q, expected one of %s", s.Name, s.Value, strings.Join(allowed, ", ")))
+	}
+
+	if c.LazySync && c.DocBackend != "html" {
+		warnings = append(warnings, "LAZY_SYNC only fetches repositories on request with the html backend")
+	}
+	if (c.APITLSCert == "") != (c.APITLSKey == "") {
+		warnings = append(warnings, "API_TLS_CERT and API_TLS_KEY must be set together")
+	}
+	if c.APIClientCA != "" && c.APITLSCert == "" {
+		warnings = append(warnings, "API_CLIENT_CA requires API_TLS_CERT and API_TLS_KEY")
+	}
+	if c.SyncLock == "redis" && c.SyncLockRedisURL == "" {
+		warnings = append(warnings, "SYNC_LOCK is redis but SYNC_LOCK_REDIS_URL is not set")
+	}
+	if ip := net.ParseIP(c.BindAddress); ip != nil {
+		family := strings.ToLower(c.AddressFamily)
+		if (ip.To4() != nil && family == "ipv6") || (ip.To4() == nil && family == "ipv4") {
+			warnings = append(warnings, fmt.Sprintf("BIND_ADDRESS %s is not an %s address", c.BindAddress, family))
+		}
+	}
+	if len(c.StdlibVersions) > 0 && c.DocBackend != "html" {
+		warnings = append(warnings, "STDLIB_VERSIONS are only documented by the html backend")
+	}
+	if c.RestoreOnStart && c.BackupDir == "" {
+		warnings = append(warnings, "RESTORE_ON_START requires BACKUP_DIR")
+	}
+	return warnings
+}
+
+// contains returns true if the list contains the value.
+func contains(list []string, value string) bool {
+	for _, s := range list {
+		if s == value {
+			return true
+		}
+	}
+	return false
+}
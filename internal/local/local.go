@@ -0,0 +1,238 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package local
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+	"go.uber.org/zap"
+)
+
+// DefaultInterval is the time between checks for changes when no interval
+// is configured.
+const DefaultInterval = 30 * time.Second
+
+// stagingDir is the directory relative to the root where sources are
+// copied before they are moved into place.  Godoc ignores directories that
+// start with a dot, so staged copies are never indexed.
+const stagingDir = ".gdoc/staging/local"
+
+// WatcherOptions defines the options available for running the local
+// source watcher.
+type WatcherOptions struct {
+	// The workspace that the sources are copied into.  Initially set in
+	// the config.
+	Root string
+	// The local directories that are documented keyed by the import path
+	// they are served under.  Initially set in the config.
+	Sources map[string]string
+	// The time between checks for changes.  Defaults to DefaultInterval.
+	// Initially set in the config.
+	Interval time.Duration
+	// The locks of the workspace paths shared with the other services
+	// that modify the workspace.  Defaults to a new PathLocks.
+	Locks *syncer.PathLocks
+	// The logger used by the watcher. Initially set in the config.
+	Logger *zap.Logger
+}
+
+// Watcher is a service that copies local directories that are not under
+// version control, such as checked out monorepos or generated code, into
+// the workspace and copies them again whenever they change.  Changes are
+// detected by polling the size and modification time of the files.
+type Watcher struct {
+	// The WatcherOptions that was passed into New.
+	options WatcherOptions
+	// The fingerprints of the sources as of their last copy keyed by
+	// import path.
+	fingerprints map[string]string
+	// The logger used by the watcher.
+	logger *zap.Logger
+}
+
+// New returns an initialized Watcher struct.
+func New(o WatcherOptions) *Watcher {
+	if o.Interval <= 0 {
+		o.Interval = DefaultInterval
+	}
+	if o.Locks == nil {
+		o.Locks = syncer.NewPathLocks()
+	}
+
+	return &Watcher{
+		options:      o,
+		fingerprints: make(map[string]string),
+		logger:       o.Logger,
+	}
+}
+
+// Start copies the sources into the workspace and keeps them up to date
+// until the context is cancelled.
+func (w *Watcher) Start(ctx context.Context) error {
+	ticker := time.NewTicker(w.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		w.check()
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// check copies every source that has changed since its last copy.
+func (w *Watcher) check() {
+	for importPath, dir := range w.options.Sources {
+		fp, err := fingerprint(dir)
+		if err != nil {
+			w.logger.Error("unable to read local source", zap.String("import_path", importPath), zap.String("dir", dir), zap.Error(err))
+			continue
+		}
+		if fp == w.fingerprints[importPath] {
+			continue
+		}
+
+		w.logger.Info("copying local source", zap.String("import_path", importPath), zap.String("dir", dir))
+		if err := w.copy(importPath, dir); err != nil {
+			w.logger.Error("unable to copy local source", zap.String("import_path", importPath), zap.String("dir", dir), zap.Error(err))
+			continue
+		}
+		w.fingerprints[importPath] = fp
+	}
+}
+
+// copy copies the source into a staging directory and moves it into place
+// below the src directory of the workspace.
+func (w *Watcher) copy(importPath, dir string) error {
+	dst := filepath.Join(w.options.Root, "src", filepath.FromSlash(importPath))
+	staged := filepath.Join(w.options.Root, stagingDir, filepath.FromSlash(importPath))
+
+	if err := os.RemoveAll(staged); err != nil {
+		return err
+	}
+	if err := copyDir(dir, staged); err != nil {
+		_ = os.RemoveAll(staged)
+		return err
+	}
+
+	defer w.options.Locks.Lock(dst)()
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return os.Rename(staged, dst)
+}
+
+// skip returns true for the directories that are left out of the copy.
+func skip(name string) bool {
+	return name == ".git" || name == ".hg" || name == ".svn"
+}
+
+// fingerprint returns a hash of the paths, sizes and modification times of
+// the files below the directory.
+func fingerprint(dir string) (string, error) {
+	var entries []string
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() && p != dir && skip(fi.Name()) {
+			return filepath.SkipDir
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(dir, p)
+		entries = append(entries, fmt.Sprintf("%s %d %d", rel, fi.Size(), fi.ModTime().UnixNano()))
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sort.Strings(entries)
+	h := sha256.New()
+	for _, e := range entries {
+		io.WriteString(h, e+"\n")
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// copyDir copies the regular files below src to dst, leaving out version
+// control directories.
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case fi.IsDir():
+			if p != src && skip(fi.Name()) {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(target, 0755)
+		case fi.Mode().IsRegular():
+			return copyFile(p, target, fi.Mode().Perm())
+		default:
+			return nil
+		}
+	})
+}
+
+// copyFile copies the regular file src to dst with the given permissions.
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
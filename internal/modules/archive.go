@@ -0,0 +1,243 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package modules
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// maxModFileSize is the largest go.mod file accepted in a module zip,
+// matching the limit of the go command.
+const maxModFileSize = 16 << 20
+
+var (
+	// ErrArchiveTooLarge is returned when the content of a commit is larger
+	// than MaxZipSize.
+	ErrArchiveTooLarge = errors.New("archive too large")
+
+	// modulePattern matches the module directive of a go.mod file.
+	modulePattern = regexp.MustCompile(`(?m)^\s*module\s+"?([^"\s]+)"?`)
+	// majorPattern matches the major version suffix of a module path.
+	majorPattern = regexp.MustCompile(`(?:/|\.)v([0-9]+)$`)
+)
+
+// Commit opens the commit of the git repository at dir.  An empty revision
+// opens the checked out commit.
+func Commit(dir, rev string) (*object.Commit, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if rev == "" {
+		rev = "HEAD"
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, err
+	}
+	return repo.CommitObject(*hash)
+}
+
+// WriteZip writes a module zip of the commit, as created by the go command,
+// to w.  The module path is read from the go.mod file at the root of the
+// commit, falling back to the given path for repositories without one.
+// The version is a pseudo-version of the commit.  Files of nested modules,
+// vendored packages and symbolic links are left out like the go command
+// does.
+func WriteZip(w io.Writer, c *object.Commit, fallback string) (Module, error) {
+	m := Module{Path: fallback}
+	if f, err := c.File("go.mod"); err == nil && f.Size <= maxModFileSize {
+		if src, err := f.Contents(); err == nil {
+			if match := modulePattern.FindStringSubmatch(src); match != nil {
+				m.Path = match[1]
+			}
+		}
+	}
+	m.Version = PseudoVersion(m.Path, c)
+
+	files, err := moduleFiles(c)
+	if err != nil {
+		return Module{}, err
+	}
+
+	zw := zip.NewWriter(w)
+	prefix := m.Path + "@" + m.Version + "/"
+	for _, f := range files {
+		fw, err := zw.Create(prefix + f.Name)
+		if err != nil {
+			return Module{}, err
+		}
+		if err := copyBlob(fw, f); err != nil {
+			return Module{}, err
+		}
+	}
+	return m, zw.Close()
+}
+
+// WriteTarball writes a gzipped tarball of every file in the commit to w.
+// The files are placed below the prefix directory.
+func WriteTarball(w io.Writer, c *object.Commit, prefix string) error {
+	tree, err := c.Tree()
+	if err != nil {
+		return err
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	var total int64
+	err = tree.Files().ForEach(func(f *object.File) error {
+		if total += f.Size; total > MaxZipSize {
+			return ErrArchiveTooLarge
+		}
+
+		hdr := &tar.Header{
+			Name:    path.Join(prefix, f.Name),
+			Mode:    0644,
+			Size:    f.Size,
+			ModTime: c.Committer.When,
+		}
+		switch f.Mode {
+		case filemode.Executable:
+			hdr.Mode = 0755
+		case filemode.Symlink:
+			target, err := f.Contents()
+			if err != nil {
+				return err
+			}
+			hdr.Typeflag = tar.TypeSymlink
+			hdr.Linkname = target
+			hdr.Mode = 0777
+			hdr.Size = 0
+			return tw.WriteHeader(hdr)
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		return copyBlob(tw, f)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// PseudoVersion returns the pseudo-version of the commit for the module
+// path, such as v0.0.0-20220301120000-0123456789ab, using the major
+// version of the module path.
+func PseudoVersion(modPath string, c *object.Commit) string {
+	major := "v0"
+	if m := majorPattern.FindStringSubmatch(modPath); m != nil && m[1] != "0" && m[1] != "1" {
+		major = "v" + m[1]
+	}
+	return fmt.Sprintf("%s.0.0-%s-%s", major, c.Committer.When.UTC().Format("20060102150405"), c.Hash.String()[:12])
+}
+
+// moduleFiles returns the files of the commit that belong in its module
+// zip.
+func moduleFiles(c *object.Commit) ([]*object.File, error) {
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	// Directories with their own go.mod are separate modules.
+	var nested []string
+	var files []*object.File
+	err = tree.Files().ForEach(func(f *object.File) error {
+		if path.Base(f.Name) == "go.mod" && f.Name != "go.mod" {
+			nested = append(nested, path.Dir(f.Name)+"/")
+		}
+		if (f.Mode == filemode.Regular || f.Mode == filemode.Executable) && !vendored(f.Name) {
+			files = append(files, f)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var out []*object.File
+	var total int64
+	for _, f := range files {
+		if inside(f.Name, nested) {
+			continue
+		}
+		if total += f.Size; total > MaxZipSize {
+			return nil, ErrArchiveTooLarge
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// vendored returns true if the file belongs to a vendored package.  Files
+// directly in a vendor directory, such as vendor/modules.txt, are kept.
+func vendored(name string) bool {
+	var i int
+	switch {
+	case strings.HasPrefix(name, "vendor/"):
+		i = len("vendor/")
+	case strings.Contains(name, "/vendor/"):
+		i = strings.Index(name, "/vendor/") + len("/vendor/")
+	default:
+		return false
+	}
+	return strings.Contains(name[i:], "/")
+}
+
+// inside returns true if the file is below one of the directories.
+func inside(name string, dirs []string) bool {
+	for _, d := range dirs {
+		if strings.HasPrefix(name, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// copyBlob copies the contents of the file to w.
+func copyBlob(w io.Writer, f *object.File) error {
+	r, err := f.Reader()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	_, err = io.Copy(w, r)
+	return err
+}
@@ -0,0 +1,271 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultProxyURL is the address of the public Go module proxy.
+	DefaultProxyURL = "https://proxy.golang.org"
+	// DefaultProxyInterval is the time between checks for new versions
+	// when no interval is configured.
+	DefaultProxyInterval = time.Hour
+)
+
+var (
+	// releasePattern matches release versions and captures their major,
+	// minor and patch numbers.
+	releasePattern = regexp.MustCompile(`^v(\d+)\.(\d+)\.(\d+)$`)
+	// versionPattern matches complete versions including pre-releases,
+	// pseudo-versions and incompatible versions.
+	versionPattern = regexp.MustCompile(`^v\d+\.\d+\.\d+`)
+)
+
+// ProxyOptions defines the options available for running the module proxy
+// source.
+type ProxyOptions struct {
+	// The workspace that the modules are extracted into.  Initially set
+	// in the config.
+	Root string
+	// The address of the module proxy.  Defaults to DefaultProxyURL.
+	// Initially set in the config.
+	URL string
+	// The modules that are documented as path@query, where the query is
+	// either "latest", an exact version such as v1.2.3 or a version prefix
+	// such as v1 or v1.2 that selects the newest matching release.  A
+	// path without a query is the same as path@latest.  Initially set in
+	// the config.
+	Modules []string
+	// The time between checks for new versions.  Defaults to
+	// DefaultProxyInterval.  Initially set in the config.
+	Interval time.Duration
+	// The maximum time a single request to the module proxy may take.
+	// Zero disables the timeout.  Initially set in the config.
+	Timeout time.Duration
+	// The locks of the workspace paths shared with the other services
+	// that modify the workspace.  Defaults to a new PathLocks.
+	Locks *syncer.PathLocks
+	// The logger used by the module proxy source. Initially set in the
+	// config.
+	Logger *zap.Logger
+}
+
+// Proxy is a service that downloads modules from a module proxy, such as a
+// private Athens instance, and extracts them into the workspace so that
+// they can be documented without access to their repositories.
+type Proxy struct {
+	// The ProxyOptions that was passed into NewProxy.
+	options ProxyOptions
+	// The HTTP client used for requests to the module proxy.
+	client *http.Client
+	// The versions that have been extracted keyed by module path.
+	versions map[string]string
+	// The logger used by the module proxy source.
+	logger *zap.Logger
+}
+
+// NewProxy returns an initialized Proxy struct.
+func NewProxy(o ProxyOptions) *Proxy {
+	if o.URL == "" {
+		o.URL = DefaultProxyURL
+	}
+	if o.Interval <= 0 {
+		o.Interval = DefaultProxyInterval
+	}
+	if o.Locks == nil {
+		o.Locks = syncer.NewPathLocks()
+	}
+
+	return &Proxy{
+		options:  o,
+		client:   &http.Client{Timeout: o.Timeout},
+		versions: make(map[string]string),
+		logger:   o.Logger,
+	}
+}
+
+// Start downloads the modules and checks for new versions at the interval
+// until the context is cancelled.
+func (p *Proxy) Start(ctx context.Context) error {
+	ticker := time.NewTicker(p.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		p.check(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// check resolves the version of every module and downloads the ones that
+// have changed since they were last extracted.
+func (p *Proxy) check(ctx context.Context) {
+	for _, m := range p.options.Modules {
+		path, query := m, "latest"
+		if i := strings.LastIndex(m, "@"); i >= 0 {
+			path, query = m[:i], m[i+1:]
+		}
+
+		version, err := p.resolve(ctx, path, query)
+		if err != nil {
+			p.logger.Error("unable to resolve module version", zap.String("module", m), zap.Error(err))
+			continue
+		}
+		if version == p.versions[path] {
+			continue
+		}
+
+		p.logger.Info("downloading module", zap.String("path", path), zap.String("version", version))
+		if err := p.download(ctx, path, version); err != nil {
+			p.logger.Error("unable to download module", zap.String("path", path), zap.String("version", version), zap.Error(err))
+			continue
+		}
+		p.versions[path] = version
+	}
+}
+
+// resolve returns the version of the module selected by the query.
+func (p *Proxy) resolve(ctx context.Context, path, query string) (string, error) {
+	switch {
+	case query == "latest" || query == "":
+		var info struct {
+			Version string
+		}
+		if err := p.get(ctx, path, "@latest", func(r io.Reader) error {
+			return json.NewDecoder(r).Decode(&info)
+		}); err != nil {
+			return "", err
+		}
+		return info.Version, nil
+	case versionPattern.MatchString(query):
+		return query, nil
+	}
+
+	var versions []string
+	if err := p.get(ctx, path, "@v/list", func(r io.Reader) error {
+		b, err := io.ReadAll(r)
+		versions = strings.Fields(string(b))
+		return err
+	}); err != nil {
+		return "", err
+	}
+
+	var best string
+	for _, v := range versions {
+		if strings.HasPrefix(v, query+".") && releasePattern.MatchString(v) && (best == "" || newer(v, best)) {
+			best = v
+		}
+	}
+	if best == "" {
+		return "", fmt.Errorf("no release of %s matches %s", path, query)
+	}
+	return best, nil
+}
+
+// download fetches the zip of the module version and extracts it into the
+// workspace.
+func (p *Proxy) download(ctx context.Context, path, version string) error {
+	f, err := os.CreateTemp("", "gdoc-module-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	var size int64
+	err = p.get(ctx, path, "@v/"+EscapePath(version)+".zip", func(r io.Reader) error {
+		size, err = io.Copy(f, io.LimitReader(r, MaxZipSize+1))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = Extract(p.options.Root, p.options.Locks, f, size)
+	return err
+}
+
+// get requests the file of the module from the module proxy and passes the
+// body to fn.
+func (p *Proxy) get(ctx context.Context, path, file string, fn func(io.Reader) error) error {
+	url := fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(p.options.URL, "/"), EscapePath(path), file)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("module proxy request failed: %s", resp.Status)
+	}
+
+	return fn(resp.Body)
+}
+
+// newer returns true if the release version a is newer than b.
+func newer(a, b string) bool {
+	am, bm := releasePattern.FindStringSubmatch(a), releasePattern.FindStringSubmatch(b)
+	for i := 1; i < len(am); i++ {
+		x, _ := strconv.Atoi(am[i])
+		y, _ := strconv.Atoi(bm[i])
+		if x != y {
+			return x > y
+		}
+	}
+	return false
+}
+
+// EscapePath escapes a module path or version for use in a module proxy
+// request.  Upper case letters are replaced with an exclamation mark
+// followed by the lower case letter.
+func EscapePath(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
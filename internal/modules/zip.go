@@ -0,0 +1,305 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package modules
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+)
+
+// MaxZipSize is the largest module zip that is extracted, matching the
+// limit of the go command.
+const MaxZipSize = 500 << 20
+
+// stagingDir is the directory relative to the root where modules are
+// extracted before they are moved into place.  Godoc ignores directories
+// that start with a dot, so staged copies are never indexed.
+const stagingDir = ".gdoc/staging/modules"
+
+var (
+	// ErrInvalidZip is returned when an archive is not a module zip.
+	ErrInvalidZip = errors.New("invalid module zip")
+	// ErrPathInUse is returned when the directory of a module holds a
+	// repository or source that was not extracted from a module zip.
+	ErrPathInUse = errors.New("module path is used by another source")
+)
+
+// markerFile is the file written to the directory of every extracted
+// module.  Only directories holding it are ever replaced.
+const markerFile = ".gdoc-module"
+
+// Module is a module version that has been extracted into the workspace.
+type Module struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	// The directory the module was extracted to.
+	Dir string `json:"dir"`
+}
+
+// Extract extracts a module zip, as created by the go command or served by
+// a module proxy, into the src directory of the workspace at root.  Every
+// file in the zip is below a path@version directory that identifies the
+// module.  A previously extracted version of the module is replaced while
+// its directory is locked, but directories that hold synced repositories,
+// local sources or the standard library are never touched.
+func Extract(root string, locks *syncer.PathLocks, r io.ReaderAt, size int64) (Module, error) {
+	return extract(root, locks, r, size, MaxZipSize)
+}
+
+// extract extracts the module zip, refusing archives whose compressed or
+// uncompressed size is larger than the limit.
+func extract(root string, locks *syncer.PathLocks, r io.ReaderAt, size, limit int64) (Module, error) {
+	if size > limit {
+		return Module{}, fmt.Errorf("%w: larger than %d bytes", ErrInvalidZip, limit)
+	}
+
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return Module{}, fmt.Errorf("%w: %v", ErrInvalidZip, err)
+	}
+	if len(zr.File) == 0 {
+		return Module{}, fmt.Errorf("%w: empty archive", ErrInvalidZip)
+	}
+
+	m, err := identify(zr.File[0].Name)
+	if err != nil {
+		return Module{}, err
+	}
+	prefix := m.Path + "@" + m.Version + "/"
+
+	src := filepath.Join(root, "src")
+	m.Dir = filepath.Join(src, filepath.FromSlash(m.Path))
+	if err := claimable(src, m.Dir); err != nil {
+		return Module{}, err
+	}
+
+	staged := filepath.Join(root, stagingDir, filepath.FromSlash(prefix))
+	if err := os.RemoveAll(staged); err != nil {
+		return Module{}, err
+	}
+	if err := os.MkdirAll(staged, 0755); err != nil {
+		return Module{}, err
+	}
+	defer os.RemoveAll(staged)
+
+	// The sizes recorded in the zip are not trusted, the bytes actually
+	// written are counted against the limit instead, as the go command
+	// does.
+	var total int64
+	for _, f := range zr.File {
+		name := strings.TrimPrefix(f.Name, prefix)
+		if name == f.Name || !safe(name) {
+			return Module{}, fmt.Errorf("%w: unexpected file %s", ErrInvalidZip, f.Name)
+		}
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		n, err := extractFile(f, filepath.Join(staged, filepath.FromSlash(name)), limit-total)
+		if err != nil {
+			return Module{}, err
+		}
+		total += n
+	}
+	if err := os.WriteFile(filepath.Join(staged, markerFile), []byte(m.Path+"@"+m.Version+"\n"), 0644); err != nil {
+		return Module{}, err
+	}
+
+	defer locks.Lock(m.Dir)()
+	if err := claimable(src, m.Dir); err != nil {
+		return Module{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(m.Dir), 0755); err != nil {
+		return Module{}, err
+	}
+
+	// The previous version is moved aside into its own staging directory
+	// rather than removed in place, so a failure never leaves a partly
+	// removed module below src.
+	previous := staged + ".previous"
+	if err := os.RemoveAll(previous); err != nil {
+		return Module{}, err
+	}
+	if err := os.Rename(m.Dir, previous); err != nil && !os.IsNotExist(err) {
+		return Module{}, err
+	}
+	defer os.RemoveAll(previous)
+
+	if err := os.Rename(staged, m.Dir); err != nil {
+		_ = os.Rename(previous, m.Dir)
+		return Module{}, err
+	}
+
+	return m, nil
+}
+
+// claimable returns ErrPathInUse unless the module directory is either
+// missing or holds a module extracted earlier with nothing else below it,
+// and none of its parents below src holds a repository or module.
+func claimable(src, dir string) error {
+	for p := filepath.Dir(dir); p != src && strings.HasPrefix(p, src); p = filepath.Dir(p) {
+		if owned(p) {
+			return fmt.Errorf("%w: %s is inside %s", ErrPathInUse, dir, p)
+		}
+	}
+
+	fi, err := os.Stat(dir)
+	switch {
+	case os.IsNotExist(err):
+		return nil
+	case err != nil:
+		return err
+	case !fi.IsDir() || !exists(filepath.Join(dir, markerFile)):
+		return fmt.Errorf("%w: %s", ErrPathInUse, dir)
+	}
+
+	return filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != dir && fi.IsDir() && owned(p) {
+			return fmt.Errorf("%w: %s holds %s", ErrPathInUse, dir, p)
+		}
+		return nil
+	})
+}
+
+// owned returns true if the directory holds a git repository or an
+// extracted module.
+func owned(dir string) bool {
+	return exists(filepath.Join(dir, ".git")) || exists(filepath.Join(dir, markerFile))
+}
+
+// exists returns true if the path exists.
+func exists(p string) bool {
+	_, err := os.Lstat(p)
+	return err == nil
+}
+
+// identify returns the module path and version from the name of a file in
+// a module zip.
+func identify(name string) (Module, error) {
+	i := strings.Index(name, "@")
+	if i <= 0 {
+		return Module{}, fmt.Errorf("%w: %s is not below a path@version directory", ErrInvalidZip, name)
+	}
+
+	j := strings.Index(name[i:], "/")
+	if j < 0 {
+		return Module{}, fmt.Errorf("%w: %s is not below a path@version directory", ErrInvalidZip, name)
+	}
+
+	m := Module{Path: name[:i], Version: name[i+1 : i+j]}
+	if err := checkPath(m.Path); err != nil {
+		return Module{}, fmt.Errorf("%w: invalid module path %s: %v", ErrInvalidZip, m.Path, err)
+	}
+	if !versionPattern.MatchString(m.Version) || strings.ContainsAny(m.Version, `/\`) {
+		return Module{}, fmt.Errorf("%w: invalid module version %s", ErrInvalidZip, m.Version)
+	}
+	return m, nil
+}
+
+// checkPath returns an error if the module path is not valid, following
+// the rules of the go command: the path is made of slash separated
+// elements of letters, digits and the characters "-._~", no element
+// starts or ends with a dot, and the first element is a lower case host
+// name that contains a dot.  Standard library paths are therefore never
+// valid.
+func checkPath(p string) error {
+	if p == "" {
+		return errors.New("empty path")
+	}
+
+	for i, elem := range strings.Split(p, "/") {
+		if elem == "" {
+			return errors.New("empty path element")
+		}
+		if elem[0] == '.' || elem[len(elem)-1] == '.' {
+			return fmt.Errorf("element %q starts or ends with a dot", elem)
+		}
+		for _, r := range elem {
+			if !pathRune(r, i == 0) {
+				return fmt.Errorf("invalid character %q in element %q", r, elem)
+			}
+		}
+		if i == 0 && (!strings.Contains(elem, ".") || elem[0] == '-') {
+			return fmt.Errorf("first element %q is not a host name", elem)
+		}
+	}
+	return nil
+}
+
+// safe returns true if the slash separated path is relative and stays
+// below the directory it is joined to.
+func safe(p string) bool {
+	return p != "" && !strings.Contains(p, `\`) && !path.IsAbs(p) && path.Clean("/" + p)[1:] == strings.TrimSuffix(p, "/")
+}
+
+// pathRune returns true if the character is allowed in an element of a
+// module path.  Upper case letters are not allowed in the host name.
+func pathRune(r rune, host bool) bool {
+	switch {
+	case 'a' <= r && r <= 'z', '0' <= r && r <= '9':
+		return true
+	case 'A' <= r && r <= 'Z':
+		return !host
+	}
+	return r == '-' || r == '.' || r == '_' || r == '~'
+}
+
+// extractFile writes the zip file to the path and returns the number of
+// bytes written.  Files larger than the limit are refused.
+func extractFile(f *zip.File, target string, limit int64) (int64, error) {
+	if f.UncompressedSize64 > uint64(limit) {
+		return 0, fmt.Errorf("%w: %s is past the uncompressed size limit", ErrInvalidZip, f.Name)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return 0, err
+	}
+
+	in, err := f.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(out, io.LimitReader(in, limit+1))
+	if err != nil {
+		out.Close()
+		return n, err
+	}
+	if n > limit {
+		out.Close()
+		return n, fmt.Errorf("%w: %s is past the uncompressed size limit", ErrInvalidZip, f.Name)
+	}
+	return n, out.Close()
+}
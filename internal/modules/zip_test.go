@@ -0,0 +1,137 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package modules
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+)
+
+// moduleZip returns a zip holding the files keyed by name.
+func moduleZip(t *testing.T, files map[string]string) *bytes.Reader {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestExtract(t *testing.T) {
+	root := t.TempDir()
+	locks := syncer.NewPathLocks()
+
+	for _, v := range []string{"v1.0.0", "v1.1.0"} {
+		r := moduleZip(t, map[string]string{"example.com/mod@" + v + "/mod.go": "package mod // " + v})
+		m, err := Extract(root, locks, r, r.Size())
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", v, err)
+		}
+		if m.Path != "example.com/mod" || m.Version != v {
+			t.Fatalf("expected example.com/mod@%s, got %+v", v, m)
+		}
+	}
+
+	b, err := os.ReadFile(filepath.Join(root, "src/example.com/mod/mod.go"))
+	if err != nil || !strings.HasSuffix(string(b), "v1.1.0") {
+		t.Fatalf("expected the second version to replace the first, got %q, %v", b, err)
+	}
+}
+
+func TestExtractRejectsInvalidZips(t *testing.T) {
+	tests := map[string]map[string]string{
+		"parent":          {"example.com/mod@v1.0.0/../../../evil.go": "x"},
+		"other module":    {"example.com/mod@v1.0.0/a.go": "x", "example.com/other@v1.0.0/b.go": "x"},
+		"absolute":        {"/example.com/mod@v1.0.0/a.go": "x"},
+		"host only":       {"github@v1.0.0/a.go": "x"},
+		"standard lib":    {"fmt@v1.0.0/print.go": "x"},
+		"dot element":     {"example.com/../mod@v1.0.0/a.go": "x"},
+		"upper case host": {"Example.com/mod@v1.0.0/a.go": "x"},
+		"bad version":     {"example.com/mod@latest/a.go": "x"},
+	}
+
+	for name, files := range tests {
+		root := t.TempDir()
+		r := moduleZip(t, files)
+		if _, err := Extract(root, syncer.NewPathLocks(), r, r.Size()); !errors.Is(err, ErrInvalidZip) {
+			t.Errorf("%s: expected ErrInvalidZip, got %v", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(filepath.Dir(root), "evil.go")); err == nil {
+			t.Errorf("%s: file written outside of the root", name)
+		}
+	}
+}
+
+func TestExtractRefusesPathsInUse(t *testing.T) {
+	root := t.TempDir()
+	repo := filepath.Join(root, "src/github.com/ctxswitch/gdoc")
+	if err := os.MkdirAll(filepath.Join(repo, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"github.com", "github.com/ctxswitch", "github.com/ctxswitch/gdoc", "github.com/ctxswitch/gdoc/sub"} {
+		r := moduleZip(t, map[string]string{path + "@v1.0.0/a.go": "package a"})
+		if _, err := Extract(root, syncer.NewPathLocks(), r, r.Size()); !errors.Is(err, ErrPathInUse) {
+			t.Errorf("%s: expected ErrPathInUse, got %v", path, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(repo, ".git")); err != nil {
+		t.Fatalf("expected the repository to be left in place: %v", err)
+	}
+}
+
+func TestExtractLimitsUncompressedSize(t *testing.T) {
+	files := map[string]string{
+		"example.com/mod@v1.0.0/a.go": strings.Repeat("a", 600),
+		"example.com/mod@v1.0.0/b.go": strings.Repeat("b", 600),
+	}
+
+	root := t.TempDir()
+	r := moduleZip(t, files)
+	if _, err := extract(root, syncer.NewPathLocks(), r, r.Size(), 1000); !errors.Is(err, ErrInvalidZip) {
+		t.Fatalf("expected ErrInvalidZip, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "src/example.com/mod")); !os.IsNotExist(err) {
+		t.Fatalf("expected nothing to be extracted, got %v", err)
+	}
+
+	r = moduleZip(t, files)
+	if _, err := extract(root, syncer.NewPathLocks(), r, r.Size(), 2000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
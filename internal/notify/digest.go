@@ -0,0 +1,203 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+	"go.uber.org/zap"
+)
+
+// DefaultDigestInterval is the time between digests when no interval is
+// configured.
+const DefaultDigestInterval = 24 * time.Hour
+
+// DigestOptions defines the options available for sending the email
+// digest.
+type DigestOptions struct {
+	// The address of the SMTP server as host:port.  Initially set in the
+	// config.
+	SMTPAddr string
+	// The user and password used to authenticate with the SMTP server.
+	// Authentication is skipped when the user is empty.  Initially set in
+	// the config.
+	SMTPUser     string
+	SMTPPassword string
+	// The sender and recipients of the digest.  Initially set in the
+	// config.
+	From string
+	To   []string
+	// The time between digests.  Defaults to DefaultDigestInterval.
+	// Initially set in the config.
+	Interval time.Duration
+	// The syncer that the recorded sync cycles are read from.
+	Syncer *syncer.Syncer
+	// The logger used by the digest service. Initially set in the config.
+	Logger *zap.Logger
+}
+
+// Digest is a service that periodically emails a summary of the
+// repositories that changed.
+type Digest struct {
+	// The DigestOptions that was passed into NewDigest.
+	options DigestOptions
+	// The logger used by the digest service.
+	logger *zap.Logger
+}
+
+// NewDigest returns an initialized Digest struct.
+func NewDigest(o DigestOptions) *Digest {
+	if o.Interval <= 0 {
+		o.Interval = DefaultDigestInterval
+	}
+
+	return &Digest{
+		options: o,
+		logger:  o.Logger,
+	}
+}
+
+// Start sends a digest every interval until the context is cancelled.  No
+// email is sent when nothing changed during the interval.
+func (d *Digest) Start(ctx context.Context) error {
+	ticker := time.NewTicker(d.options.Interval)
+	defer ticker.Stop()
+
+	since := time.Now()
+	for {
+		select {
+		case now := <-ticker.C:
+			if err := d.send(since, now); err != nil {
+				d.logger.Error("unable to send the digest", zap.Error(err))
+				continue
+			}
+			since = now
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// send emails the changes between the two times.
+func (d *Digest) send(since, until time.Time) error {
+	body := d.body(since, until)
+	if body == "" {
+		d.logger.Debug("no changes since the last digest")
+		return nil
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", d.options.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(d.options.To, ", "))
+	fmt.Fprintf(&msg, "Subject: gdoc digest for %s\r\n", until.Format("2006-01-02"))
+	fmt.Fprintf(&msg, "Date: %s\r\n", until.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if d.options.SMTPUser != "" {
+		host, _, err := net.SplitHostPort(d.options.SMTPAddr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", d.options.SMTPUser, d.options.SMTPPassword, host)
+	}
+
+	return smtp.SendMail(d.options.SMTPAddr, auth, d.options.From, d.options.To, msg.Bytes())
+}
+
+// body returns the text of the digest for the changes between the two
+// times.  An empty string is returned if nothing changed.
+func (d *Digest) body(since, until time.Time) string {
+	added := make(map[string]bool)
+	updated := make(map[string]int)
+	for _, c := range d.options.Syncer.History() {
+		for _, e := range c.Events {
+			if e.Time.Before(since) || !e.Time.Before(until) {
+				continue
+			}
+			key := e.Owner + "/" + e.Name
+			switch e.Outcome {
+			case "cloned":
+				added[key] = true
+			case "updated":
+				updated[key]++
+			}
+		}
+	}
+
+	var failing []string
+	for _, f := range d.options.Syncer.Failures() {
+		failing = append(failing, fmt.Sprintf("%s/%s (%d failures): %s", f.Owner, f.Name, f.Count, f.LastError))
+	}
+
+	if len(added) == 0 && len(updated) == 0 && len(failing) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Documentation changes from %s to %s.\n", since.Format(time.RFC1123), until.Format(time.RFC1123))
+
+	if len(added) > 0 {
+		b.WriteString("\nNew repositories:\n")
+		for _, k := range sortedSet(added) {
+			fmt.Fprintf(&b, "  %s\n", k)
+		}
+	}
+
+	if len(updated) > 0 {
+		b.WriteString("\nUpdated repositories:\n")
+		keys := make([]string, 0, len(updated))
+		for k := range updated {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&b, "  %s (%d updates)\n", k, updated[k])
+		}
+	}
+
+	if len(failing) > 0 {
+		b.WriteString("\nFailing repositories:\n")
+		for _, f := range failing {
+			fmt.Fprintf(&b, "  %s\n", f)
+		}
+	}
+
+	return b.String()
+}
+
+// sortedSet returns the members of the set in order.
+func sortedSet(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,249 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+	"go.uber.org/zap"
+)
+
+// Severity is the importance of an event.  Sinks only receive the events
+// at or above their minimum severity.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityCritical
+)
+
+// String returns the name of the severity.
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityCritical:
+		return "critical"
+	default:
+		return "info"
+	}
+}
+
+// ParseSeverity returns the severity with the given name.
+func ParseSeverity(name string) (Severity, error) {
+	switch strings.ToLower(name) {
+	case "info":
+		return SeverityInfo, nil
+	case "warning":
+		return SeverityWarning, nil
+	case "critical":
+		return SeverityCritical, nil
+	default:
+		return SeverityInfo, fmt.Errorf("unknown severity: %s", name)
+	}
+}
+
+// Event is a notification sent to the sinks.
+type Event struct {
+	Severity Severity
+	// A key that identifies the condition, such as the repository that is
+	// failing.  Sinks that deduplicate alerts use it.
+	Key string
+	// A single line describing the event.
+	Summary string
+	// Additional details about the event.
+	Details map[string]string
+}
+
+// Sink delivers events to an external service.
+type Sink interface {
+	// Name returns the name of the sink used in the logs.
+	Name() string
+	// Send delivers a single event.
+	Send(ctx context.Context, e Event) error
+}
+
+// Route sends the events at or above a minimum severity to a sink.
+type Route struct {
+	Sink     Sink
+	Severity Severity
+}
+
+// NotifierOptions defines the options available for running the notifier.
+type NotifierOptions struct {
+	// The sinks that events are routed to.
+	Routes []Route
+	// The maximum time a single event may take to deliver.  Zero disables
+	// the timeout.  Initially set in the config.
+	Timeout time.Duration
+	// The syncer that signals the end of each sync cycle.
+	Syncer *syncer.Syncer
+	// The logger used by the notifier. Initially set in the config.
+	Logger *zap.Logger
+}
+
+// Notifier is a service that watches the sync cycles and routes events to
+// the configured sinks.
+type Notifier struct {
+	// The NotifierOptions that was passed into New.
+	options NotifierOptions
+	// The repositories that were on the dead letter list after the last
+	// cycle keyed by owner/name.
+	dead map[string]bool
+	// Whether the rejected credentials have been reported.
+	rejected bool
+	// The logger used by the notifier.
+	logger *zap.Logger
+	mu     sync.Mutex
+}
+
+// New returns an initialized Notifier struct.
+func New(o NotifierOptions) *Notifier {
+	return &Notifier{
+		options: o,
+		dead:    make(map[string]bool),
+		logger:  o.Logger,
+	}
+}
+
+// Start runs the notifier until the context is cancelled.  A warning is sent
+// when repositories fail during a cycle and a critical event when a
+// repository is moved to the dead letter list or Github rejects the
+// credentials.
+func (n *Notifier) Start(ctx context.Context) error {
+	synced := make(chan syncer.Message, 1)
+	n.options.Syncer.Bus().Subscribe(synced, syncer.EventSyncCompleted)
+	defer n.options.Syncer.Bus().Unsubscribe(synced)
+
+	// Repositories that were already dead when the service started have
+	// been reported before.
+	for _, f := range n.options.Syncer.Failures() {
+		if f.Dead {
+			n.dead[f.Owner+"/"+f.Name] = true
+		}
+	}
+
+	// The credentials may have been rejected by the initial sync.
+	n.credentials(ctx)
+
+	for {
+		select {
+		case m := <-synced:
+			n.cycle(ctx, *m.Summary)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// cycle sends the events of a completed sync cycle.
+func (n *Notifier) cycle(ctx context.Context, s syncer.Summary) {
+	n.credentials(ctx)
+
+	if s.Failed > 0 {
+		n.Notify(ctx, Event{
+			Severity: SeverityWarning,
+			Key:      "gdoc/sync",
+			Summary:  fmt.Sprintf("%d of %d repositories failed to sync", s.Failed, s.Checked),
+			Details: map[string]string{
+				"started":  s.Started.Format(time.RFC3339),
+				"duration": s.Finished.Sub(s.Started).String(),
+			},
+		})
+	}
+
+	dead := make(map[string]bool)
+	for _, f := range n.options.Syncer.Failures() {
+		if !f.Dead {
+			continue
+		}
+
+		key := f.Owner + "/" + f.Name
+		dead[key] = true
+		if n.dead[key] {
+			continue
+		}
+
+		n.Notify(ctx, Event{
+			Severity: SeverityCritical,
+			Key:      "gdoc/dead-letter/" + key,
+			Summary:  fmt.Sprintf("%s stopped syncing after %d consecutive failures", key, f.Count),
+			Details: map[string]string{
+				"repo":       key,
+				"last_error": f.LastError,
+			},
+		})
+	}
+	n.dead = dead
+}
+
+// credentials sends a critical event when Github starts rejecting the
+// credentials and an info event once they are accepted again.
+func (n *Notifier) credentials(ctx context.Context) {
+	c := n.options.Syncer.Credentials()
+	switch {
+	case !c.Valid && !n.rejected:
+		n.rejected = true
+		n.Notify(ctx, Event{
+			Severity: SeverityCritical,
+			Key:      "gdoc/credentials",
+			Summary:  "Github rejected the credentials, repositories are no longer synced",
+			Details: map[string]string{
+				"error": c.Error,
+			},
+		})
+	case c.Valid && n.rejected:
+		n.rejected = false
+		n.Notify(ctx, Event{
+			Severity: SeverityInfo,
+			Key:      "gdoc/credentials",
+			Summary:  "Github accepts the credentials again",
+		})
+	}
+}
+
+// Notify sends the event to every sink whose minimum severity it meets.
+// Delivery errors are logged.
+func (n *Notifier) Notify(ctx context.Context, e Event) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for _, r := range n.options.Routes {
+		if e.Severity < r.Severity {
+			continue
+		}
+
+		sctx, cancel := ctx, context.CancelFunc(func() {})
+		if n.options.Timeout > 0 {
+			sctx, cancel = context.WithTimeout(ctx, n.options.Timeout)
+		}
+		err := r.Sink.Send(sctx, e)
+		cancel()
+
+		if err != nil {
+			n.logger.Error("unable to send notification", zap.String("sink", r.Sink.Name()), zap.String("event", e.Summary), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/ctxswitch/gdoc/pkg/plugins"
+)
+
+// DefaultPagerDutyURL is the address of the PagerDuty Events API.
+const DefaultPagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+
+// Teams sends events to a Microsoft Teams incoming webhook.
+type Teams struct {
+	// The address of the incoming webhook.
+	URL string
+}
+
+// Name returns the name of the sink.
+func (t *Teams) Name() string {
+	return "teams"
+}
+
+// teamsColors are the theme colors of the message cards by severity.
+var teamsColors = map[Severity]string{
+	SeverityInfo:     "0078D7",
+	SeverityWarning:  "FFB900",
+	SeverityCritical: "D13438",
+}
+
+// Send posts the event as a message card.
+func (t *Teams) Send(ctx context.Context, e Event) error {
+	type fact struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	type section struct {
+		Facts []fact `json:"facts"`
+	}
+
+	facts := []fact{{Name: "severity", Value: e.Severity.String()}}
+	for _, k := range sortedKeys(e.Details) {
+		facts = append(facts, fact{Name: k, Value: e.Details[k]})
+	}
+
+	return post(ctx, t.URL, map[string]interface{}{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"summary":    e.Summary,
+		"title":      e.Summary,
+		"themeColor": teamsColors[e.Severity],
+		"sections":   []section{{Facts: facts}},
+	})
+}
+
+// PagerDuty triggers alerts through the PagerDuty Events API v2.
+type PagerDuty struct {
+	// The address of the Events API.  Defaults to DefaultPagerDutyURL.
+	URL string
+	// The integration key of the service the alerts are raised on.
+	RoutingKey string
+}
+
+// Name returns the name of the sink.
+func (p *PagerDuty) Name() string {
+	return "pagerduty"
+}
+
+// Send triggers an alert for the event.  The key of the event is used as
+// the dedup key so that a condition that is reported again updates the
+// open alert.
+func (p *PagerDuty) Send(ctx context.Context, e Event) error {
+	url := p.URL
+	if url == "" {
+		url = DefaultPagerDutyURL
+	}
+
+	return post(ctx, url, map[string]interface{}{
+		"routing_key":  p.RoutingKey,
+		"event_action": "trigger",
+		"dedup_key":    e.Key,
+		"payload": map[string]interface{}{
+			"summary":        e.Summary,
+			"source":         "gdoc",
+			"severity":       e.Severity.String(),
+			"custom_details": e.Details,
+		},
+	})
+}
+
+// post sends the value as a json document.
+func post(ctx context.Context, url string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("notification request failed: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// sortedKeys returns the keys of the map in order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Plugin sends events to a notifier registered by a plugin.
+type Plugin struct {
+	Notifier plugins.Notifier
+}
+
+// Name returns the name of the plugin's notifier.
+func (p *Plugin) Name() string {
+	return p.Notifier.Name()
+}
+
+// Send passes the event to the plugin's notifier.
+func (p *Plugin) Send(ctx context.Context, e Event) error {
+	return p.Notifier.Notify(ctx, plugins.Notification{
+		Severity: e.Severity.String(),
+		Key:      e.Key,
+		Summary:  e.Summary,
+		Details:  e.Details,
+	})
+}
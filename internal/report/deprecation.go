@@ -0,0 +1,177 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package report
+
+import (
+	"go/ast"
+	"go/doc"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ctxswitch/gdoc/pkg/docserver"
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+)
+
+// Deprecation is an identifier marked with a "Deprecated:" notice.
+type Deprecation struct {
+	Owner   string `json:"owner"`
+	Name    string `json:"name"`
+	Package string `json:"package"`
+	// The deprecated identifier, such as Func or Type.Method.  Empty if the
+	// whole package is deprecated.
+	Identifier string `json:"identifier"`
+	// The deprecation notice, which usually names the replacement.
+	Message string `json:"message"`
+}
+
+// DeprecationReport is the aggregated deprecation report for all
+// repositories.
+type DeprecationReport struct {
+	// The number of deprecated identifiers in each repository keyed by
+	// owner/name.
+	Counts map[string]int `json:"counts"`
+	// The total number of deprecated identifiers.
+	Total int `json:"total"`
+	// The deprecated identifiers.
+	Deprecations []Deprecation `json:"deprecations"`
+}
+
+// Deprecations builds the deprecation report from the doc comments of the
+// packages in each repository.  The report can be limited to a single
+// repository by passing only that repository.
+func Deprecations(repos []syncer.Repo) DeprecationReport {
+	report := DeprecationReport{
+		Counts:       make(map[string]int),
+		Deprecations: []Deprecation{},
+	}
+
+	for _, r := range repos {
+		mods := findGoMods(r.LocalPath)
+		_ = filepath.Walk(r.LocalPath, func(p string, info os.FileInfo, err error) error {
+			if err != nil || !info.IsDir() {
+				return nil
+			}
+
+			name := info.Name()
+			if p != r.LocalPath && (name == "vendor" || name == "testdata" || name[0] == '.' || name[0] == '_') {
+				return filepath.SkipDir
+			}
+
+			for _, d := range packageDeprecations(p, importPath(mods, p)) {
+				d.Owner, d.Name = r.Owner, r.Name
+				report.Deprecations = append(report.Deprecations, d)
+				report.Counts[r.Owner+"/"+r.Name]++
+			}
+			return nil
+		})
+	}
+
+	sort.SliceStable(report.Deprecations, func(i, j int) bool {
+		return report.Deprecations[i].Package < report.Deprecations[j].Package
+	})
+	report.Total = len(report.Deprecations)
+
+	return report
+}
+
+// importPath returns the import path of the directory using the module
+// that contains it.  The directory is returned if it is not part of a
+// module.
+func importPath(mods []goMod, dir string) string {
+	i := moduleFor(mods, dir)
+	if i < 0 {
+		return filepath.ToSlash(dir)
+	}
+
+	rel, _ := filepath.Rel(mods[i].Dir, dir)
+	return path.Join(mods[i].Module, filepath.ToSlash(rel))
+}
+
+// moduleFor returns the index of the innermost module that contains the
+// directory or -1 if it is not part of a module.
+func moduleFor(mods []goMod, dir string) int {
+	best := -1
+	for i, m := range mods {
+		if m.Module == "" || (dir != m.Dir && !strings.HasPrefix(dir, m.Dir+string(filepath.Separator))) {
+			continue
+		}
+		if best < 0 || len(m.Dir) > len(mods[best].Dir) {
+			best = i
+		}
+	}
+	return best
+}
+
+// packageDeprecations returns the deprecated identifiers of the package in
+// the directory.
+func packageDeprecations(dir, importPath string) []Deprecation {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		return nil
+	}
+
+	var out []Deprecation
+	add := func(ident, text string) {
+		if msg := docserver.Deprecation(text); msg != "" {
+			out = append(out, Deprecation{Package: importPath, Identifier: ident, Message: msg})
+		}
+	}
+
+	for _, pkg := range pkgs {
+		var files []*ast.File
+		for _, f := range pkg.Files {
+			files = append(files, f)
+		}
+
+		p, err := doc.NewFromFiles(fset, files, importPath)
+		if err != nil {
+			continue
+		}
+
+		add("", p.Doc)
+		for _, v := range append(p.Consts, p.Vars...) {
+			add(strings.Join(v.Names, ", "), v.Doc)
+		}
+		for _, f := range p.Funcs {
+			add(f.Name, f.Doc)
+		}
+		for _, t := range p.Types {
+			add(t.Name, t.Doc)
+			for _, v := range append(t.Consts, t.Vars...) {
+				add(strings.Join(v.Names, ", "), v.Doc)
+			}
+			for _, f := range t.Funcs {
+				add(f.Name, f.Doc)
+			}
+			for _, m := range t.Methods {
+				add(t.Name+"."+m.Name, m.Doc)
+			}
+		}
+	}
+
+	return out
+}
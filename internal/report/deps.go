@@ -0,0 +1,240 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ctxswitch/gdoc/internal/modules"
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+	"go.uber.org/zap"
+)
+
+// DefaultGoProxyURL is the address of the public Go module proxy.
+const DefaultGoProxyURL = "https://proxy.golang.org"
+
+// DependencyCheckerOptions defines the options available for running the
+// dependency checker.
+type DependencyCheckerOptions struct {
+	// The address of the module proxy used to look up the latest versions.
+	// Defaults to DefaultGoProxyURL.  Initially set in the config.
+	URL string
+	// The maximum time a single request to the module proxy may take.
+	// Zero disables the timeout.  Initially set in the config.
+	Timeout time.Duration
+	// The syncer that provides the repositories and signals the end of
+	// each sync cycle.
+	Syncer *syncer.Syncer
+	// The logger used by the dependency checker. Initially set in the
+	// config.
+	Logger *zap.Logger
+}
+
+// OutdatedDependency is a requirement with a newer version available.
+type OutdatedDependency struct {
+	Path     string `json:"path"`
+	Version  string `json:"version"`
+	Latest   string `json:"latest"`
+	Indirect bool   `json:"indirect"`
+}
+
+// ModuleDependencies are the outdated requirements of a single module.
+type ModuleDependencies struct {
+	Owner  string `json:"owner"`
+	Name   string `json:"name"`
+	Module string `json:"module"`
+	// The number of requirements of the module.
+	Total int `json:"total"`
+	// The requirements with a newer version available.
+	Outdated []OutdatedDependency `json:"outdated"`
+}
+
+// DependencyUsage summarizes an outdated requirement across all modules.
+type DependencyUsage struct {
+	Path   string `json:"path"`
+	Latest string `json:"latest"`
+	// The number of modules requiring an older version.
+	Behind int `json:"behind"`
+}
+
+// DependencyReport is the result of the last dependency check.
+type DependencyReport struct {
+	// The time the last check finished.  Zero if no check has completed.
+	Checked time.Time `json:"checked"`
+	// The outdated requirements of each module.
+	Modules []ModuleDependencies `json:"modules"`
+	// The outdated requirements across all modules, ordered by the number
+	// of modules that are behind.
+	Dependencies []DependencyUsage `json:"dependencies"`
+}
+
+// DependencyChecker compares the requirements of every synchronized module
+// with the latest versions available from the module proxy after each sync
+// cycle.
+type DependencyChecker struct {
+	options DependencyCheckerOptions
+	client  *http.Client
+	logger  *zap.Logger
+
+	report DependencyReport
+	mu     sync.RWMutex
+}
+
+// NewDependencyChecker returns an initialized DependencyChecker.
+func NewDependencyChecker(options DependencyCheckerOptions) *DependencyChecker {
+	if options.URL == "" {
+		options.URL = DefaultGoProxyURL
+	}
+
+	return &DependencyChecker{
+		options: options,
+		client:  &http.Client{Timeout: options.Timeout},
+		logger:  options.Logger,
+		report:  DependencyReport{Modules: []ModuleDependencies{}, Dependencies: []DependencyUsage{}},
+	}
+}
+
+// Start checks the synchronized repositories and checks them again each
+// time a sync cycle completes until the context is cancelled.
+func (d *DependencyChecker) Start(ctx context.Context) error {
+	synced := make(chan syncer.Message, 1)
+	d.options.Syncer.Bus().Subscribe(synced, syncer.EventSyncCompleted)
+	defer d.options.Syncer.Bus().Unsubscribe(synced)
+
+	d.check(ctx)
+	for {
+		select {
+		case <-synced:
+			d.check(ctx)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Report returns the result of the last check.
+func (d *DependencyChecker) Report() DependencyReport {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.report
+}
+
+// check looks up the latest version of each requirement once and records
+// the requirements that are behind.
+func (d *DependencyChecker) check(ctx context.Context) {
+	report := DependencyReport{Modules: []ModuleDependencies{}, Dependencies: []DependencyUsage{}}
+	latest := make(map[string]string)
+	usage := make(map[string]*DependencyUsage)
+
+	for _, r := range d.options.Syncer.Repos() {
+		for _, m := range findGoMods(r.LocalPath) {
+			md := ModuleDependencies{
+				Owner:    r.Owner,
+				Name:     r.Name,
+				Module:   m.Module,
+				Total:    len(m.Require),
+				Outdated: []OutdatedDependency{},
+			}
+
+			for _, req := range m.Require {
+				if ctx.Err() != nil {
+					return
+				}
+
+				v, ok := latest[req.Path]
+				if !ok {
+					var err error
+					v, err = d.latest(ctx, req.Path)
+					if err != nil {
+						d.logger.Debug("unable to look up the latest version", zap.String("module", req.Path), zap.Error(err))
+					}
+					latest[req.Path] = v
+				}
+
+				if v == "" || compareSemver(req.Version, v) >= 0 {
+					continue
+				}
+
+				md.Outdated = append(md.Outdated, OutdatedDependency{
+					Path:     req.Path,
+					Version:  req.Version,
+					Latest:   v,
+					Indirect: req.Indirect,
+				})
+
+				if usage[req.Path] == nil {
+					usage[req.Path] = &DependencyUsage{Path: req.Path, Latest: v}
+				}
+				usage[req.Path].Behind++
+			}
+
+			report.Modules = append(report.Modules, md)
+		}
+	}
+
+	for _, u := range usage {
+		report.Dependencies = append(report.Dependencies, *u)
+	}
+	sort.Slice(report.Dependencies, func(i, j int) bool {
+		if report.Dependencies[i].Behind != report.Dependencies[j].Behind {
+			return report.Dependencies[i].Behind > report.Dependencies[j].Behind
+		}
+		return report.Dependencies[i].Path < report.Dependencies[j].Path
+	})
+	report.Checked = time.Now()
+
+	d.mu.Lock()
+	d.report = report
+	d.mu.Unlock()
+}
+
+// latest asks the module proxy for the latest version of a module.
+func (d *DependencyChecker) latest(ctx context.Context, path string) (string, error) {
+	url := fmt.Sprintf("%s/%s/@latest", strings.TrimSuffix(d.options.URL, "/"), modules.EscapePath(path))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("module proxy request failed: %s", resp.Status)
+	}
+
+	var info struct {
+		Version string
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return "", err
+	}
+
+	return info.Version, nil
+}
@@ -0,0 +1,141 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package report
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Requirement is a single module requirement from a go.mod file.
+type Requirement struct {
+	Path     string `json:"path"`
+	Version  string `json:"version"`
+	Indirect bool   `json:"indirect"`
+}
+
+// goMod contains the directives of a go.mod file that are used by the
+// reports.
+type goMod struct {
+	// The directory containing the go.mod file.
+	Dir       string
+	Module    string
+	Go        string
+	Toolchain string
+	Require   []Requirement
+}
+
+// findGoMods returns the parsed go.mod files in the directory tree.  Vendor,
+// testdata and hidden directories are skipped.
+func findGoMods(root string) []goMod {
+	var mods []goMod
+	_ = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if info.IsDir() {
+			name := info.Name()
+			if path != root && (name == "vendor" || name == "testdata" || name[0] == '.' || name[0] == '_') {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.Name() != "go.mod" {
+			return nil
+		}
+
+		if m, err := parseGoMod(path); err == nil {
+			mods = append(mods, m)
+		}
+		return nil
+	})
+
+	return mods
+}
+
+// parseGoMod reads the module, go, toolchain and require directives from a
+// go.mod file.
+func parseGoMod(path string) (goMod, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return goMod{}, err
+	}
+	defer f.Close()
+
+	m := goMod{Dir: filepath.Dir(path)}
+	inRequire := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		indirect := strings.Contains(line, "// indirect")
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if inRequire {
+			if fields[0] == ")" {
+				inRequire = false
+			} else if len(fields) >= 2 {
+				m.Require = append(m.Require, Requirement{Path: unquote(fields[0]), Version: fields[1], Indirect: indirect})
+			}
+			continue
+		}
+
+		switch fields[0] {
+		case "module":
+			if len(fields) >= 2 {
+				m.Module = unquote(fields[1])
+			}
+		case "go":
+			if len(fields) >= 2 {
+				m.Go = fields[1]
+			}
+		case "toolchain":
+			if len(fields) >= 2 {
+				m.Toolchain = fields[1]
+			}
+		case "require":
+			if len(fields) >= 2 && fields[1] == "(" {
+				inRequire = true
+			} else if len(fields) >= 3 {
+				m.Require = append(m.Require, Requirement{Path: unquote(fields[1]), Version: fields[2], Indirect: indirect})
+			}
+		}
+	}
+
+	return m, scanner.Err()
+}
+
+// unquote removes the quotes from a quoted module path.
+func unquote(s string) string {
+	if u, err := strconv.Unquote(s); err == nil {
+		return u
+	}
+	return s
+}
@@ -0,0 +1,148 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package report
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+)
+
+// GoVersion describes the Go version used by a single module.
+type GoVersion struct {
+	Owner  string `json:"owner"`
+	Name   string `json:"name"`
+	Module string `json:"module"`
+	// The version from the go directive.
+	Go string `json:"go"`
+	// The toolchain from the toolchain directive, if present.
+	Toolchain string `json:"toolchain,omitempty"`
+	// True if the go directive is older than the minimum version.
+	Outdated bool `json:"outdated"`
+}
+
+// GoVersionReport is the aggregated Go version report for all modules.
+type GoVersionReport struct {
+	// The minimum version that modules are compared against.
+	Minimum string `json:"minimum"`
+	// The number of modules using each Go version.
+	Counts map[string]int `json:"counts"`
+	// The number of modules with a Go version older than the minimum.
+	Outdated int `json:"outdated"`
+	// The Go version of each module.
+	Modules []GoVersion `json:"modules"`
+}
+
+// GoVersions builds the Go version report from the go.mod files found in
+// each repository.  Modules with a go directive older than minimum are
+// flagged as outdated.  If minimum is empty, the oldest release that is
+// still supported relative to the Go version gdoc was built with is used.
+func GoVersions(repos []syncer.Repo, minimum string) GoVersionReport {
+	if minimum == "" {
+		minimum = supportedGoVersion(runtime.Version())
+	}
+
+	report := GoVersionReport{
+		Minimum: minimum,
+		Counts:  make(map[string]int),
+		Modules: make([]GoVersion, 0, len(repos)),
+	}
+
+	for _, r := range repos {
+		for _, m := range findGoMods(r.LocalPath) {
+			v := GoVersion{
+				Owner:     r.Owner,
+				Name:      r.Name,
+				Module:    m.Module,
+				Go:        m.Go,
+				Toolchain: m.Toolchain,
+				Outdated:  m.Go != "" && compareGoVersions(m.Go, minimum) < 0,
+			}
+
+			report.Counts[m.Go]++
+			if v.Outdated {
+				report.Outdated++
+			}
+			report.Modules = append(report.Modules, v)
+		}
+	}
+
+	return report
+}
+
+// supportedGoVersion returns the oldest supported release for a Go version
+// string such as go1.21.3.  Each major Go release is supported until there
+// are two newer major releases.
+func supportedGoVersion(version string) string {
+	parts := goVersionParts(version)
+	if len(parts) < 2 || parts[1] == 0 {
+		return ""
+	}
+
+	return "1." + strconv.Itoa(parts[1]-1)
+}
+
+// compareGoVersions compares two Go versions such as 1.20 and 1.21.3.  It
+// returns -1 if a is older than b, 1 if a is newer and 0 if they are equal.
+func compareGoVersions(a, b string) int {
+	pa, pb := goVersionParts(a), goVersionParts(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// goVersionParts splits a Go version into its numeric parts.  The go
+// prefix and any pre-release suffix such as rc1 are ignored.
+func goVersionParts(version string) []int {
+	version = strings.TrimPrefix(version, "go")
+	var parts []int
+	for _, p := range strings.Split(version, ".") {
+		end := 0
+		for end < len(p) && p[end] >= '0' && p[end] <= '9' {
+			end++
+		}
+		n, err := strconv.Atoi(p[:end])
+		if err != nil {
+			break
+		}
+		parts = append(parts, n)
+		if end < len(p) {
+			break
+		}
+	}
+
+	return parts
+}
@@ -0,0 +1,95 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package report
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+)
+
+// InventoryModule is a Go module found in a synchronized repository.
+type InventoryModule struct {
+	// The module path from the go.mod file.
+	Module string `json:"module"`
+	Owner  string `json:"owner"`
+	Name   string `json:"name"`
+	// The address of the repository on the source host.
+	Repository string `json:"repository"`
+	// The commit the repository was synchronized to.
+	Commit string `json:"commit"`
+	// The directory of the module relative to the repository root.  Empty
+	// for the root module.
+	Subdirectory string `json:"subdirectory,omitempty"`
+	// The go directive of the module.
+	GoVersion string `json:"go_version,omitempty"`
+	// The import paths of the packages in the module.
+	Packages []string `json:"packages"`
+}
+
+// Inventory returns the modules of the repositories along with the import
+// paths of their packages, ordered by module path.
+func Inventory(repos []syncer.Repo) []InventoryModule {
+	inventory := []InventoryModule{}
+	for _, r := range repos {
+		mods := findGoMods(r.LocalPath)
+		start := len(inventory)
+		for _, m := range mods {
+			sub, _ := filepath.Rel(r.LocalPath, m.Dir)
+			if sub == "." {
+				sub = ""
+			}
+			inventory = append(inventory, InventoryModule{
+				Module:       m.Module,
+				Owner:        r.Owner,
+				Name:         r.Name,
+				Repository:   r.HTMLURL,
+				Commit:       r.CommitSHA,
+				Subdirectory: filepath.ToSlash(sub),
+				GoVersion:    m.Go,
+				Packages:     []string{},
+			})
+		}
+
+		_ = filepath.Walk(r.LocalPath, func(p string, info os.FileInfo, err error) error {
+			if err != nil || !info.IsDir() {
+				return nil
+			}
+
+			name := info.Name()
+			if p != r.LocalPath && (name == "vendor" || name == "testdata" || name[0] == '.' || name[0] == '_') {
+				return filepath.SkipDir
+			}
+
+			if i := moduleFor(mods, p); i >= 0 && hasGoFiles(p) {
+				m := &inventory[start+i]
+				m.Packages = append(m.Packages, importPath(mods, p))
+			}
+			return nil
+		})
+	}
+
+	sort.SliceStable(inventory, func(i, j int) bool {
+		return inventory[i].Module < inventory[j].Module
+	})
+
+	return inventory
+}
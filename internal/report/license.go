@@ -0,0 +1,200 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package report
+
+import (
+	"encoding/csv"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+)
+
+const (
+	// LicenseSourceAPI is used when the license was reported by Github.
+	LicenseSourceAPI = "api"
+	// LicenseSourceFile is used when the license was detected from a
+	// license file in the repository.
+	LicenseSourceFile = "file"
+)
+
+// noAssertion is the SPDX identifier Github uses when it was unable to
+// identify the license.
+const noAssertion = "NOASSERTION"
+
+// licenseFiles are the names of the files that are checked for a license
+// in the root of the repository.
+var licenseFiles = []string{"LICENSE", "LICENSE.md", "LICENSE.txt", "COPYING", "COPYING.md", "COPYING.txt"}
+
+// licenseSignatures identifies common licenses by phrases in their text.
+// All of the phrases must be present for the license to match.  More
+// specific licenses are listed before the ones they could be mistaken for.
+var licenseSignatures = []struct {
+	id      string
+	phrases []string
+}{
+	{"Apache-2.0", []string{"apache license", "version 2.0"}},
+	{"MPL-2.0", []string{"mozilla public license", "2.0"}},
+	{"AGPL-3.0", []string{"gnu affero general public license", "version 3"}},
+	{"LGPL-3.0", []string{"gnu lesser general public license", "version 3"}},
+	{"LGPL-2.1", []string{"gnu lesser general public license", "version 2.1"}},
+	{"GPL-3.0", []string{"gnu general public license", "version 3"}},
+	{"GPL-2.0", []string{"gnu general public license", "version 2"}},
+	{"BSD-3-Clause", []string{"redistribution and use in source and binary forms", "neither the name"}},
+	{"BSD-2-Clause", []string{"redistribution and use in source and binary forms"}},
+	{"MIT", []string{"permission is hereby granted, free of charge"}},
+	{"ISC", []string{"permission to use, copy, modify, and/or distribute this software for any purpose"}},
+	{"Unlicense", []string{"this is free and unencumbered software released into the public domain"}},
+}
+
+// License describes the license of a single repository.
+type License struct {
+	Owner string `json:"owner"`
+	Name  string `json:"name"`
+	// The SPDX identifier of the license.  Empty if no license could be
+	// found.
+	License string `json:"license"`
+	// Where the license was found.  Either LicenseSourceAPI or
+	// LicenseSourceFile.
+	Source string `json:"source"`
+	// True if no license could be found.
+	Missing bool `json:"missing"`
+	// True if the license is not in the list of allowed licenses.
+	Disallowed bool `json:"disallowed"`
+}
+
+// LicenseReport is the aggregated license report for all repositories.
+type LicenseReport struct {
+	// The number of repositories using each license.
+	Counts map[string]int `json:"counts"`
+	// The number of repositories without a license.
+	Missing int `json:"missing"`
+	// The number of repositories with a license that is not allowed.
+	Disallowed int `json:"disallowed"`
+	// The licenses of each repository.
+	Repositories []License `json:"repositories"`
+}
+
+// Licenses builds the license report.  The license reported by Github is
+// used when it is known, otherwise the license file in the root of the
+// repository is inspected.  If allowed is not empty, any license that is not
+// in the list is flagged as disallowed.
+func Licenses(repos []syncer.Repo, allowed []string) LicenseReport {
+	report := LicenseReport{
+		Counts:       make(map[string]int),
+		Repositories: make([]License, 0, len(repos)),
+	}
+
+	for _, r := range repos {
+		l := License{
+			Owner: r.Owner,
+			Name:  r.Name,
+		}
+
+		switch {
+		case r.License != "" && r.License != noAssertion:
+			l.License = r.License
+			l.Source = LicenseSourceAPI
+		default:
+			if id := detectLicense(r.LocalPath); id != "" {
+				l.License = id
+				l.Source = LicenseSourceFile
+			}
+		}
+
+		if l.License == "" {
+			l.Missing = true
+			report.Missing++
+		} else {
+			report.Counts[l.License]++
+			if len(allowed) > 0 && !contains(allowed, l.License) {
+				l.Disallowed = true
+				report.Disallowed++
+			}
+		}
+
+		report.Repositories = append(report.Repositories, l)
+	}
+
+	return report
+}
+
+// WriteCSV writes the license of each repository as CSV.
+func (lr LicenseReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"owner", "name", "license", "source", "missing", "disallowed"})
+	for _, l := range lr.Repositories {
+		_ = cw.Write([]string{
+			l.Owner,
+			l.Name,
+			l.License,
+			l.Source,
+			strconv.FormatBool(l.Missing),
+			strconv.FormatBool(l.Disallowed),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// detectLicense reads the license file in the directory and returns the
+// SPDX identifier of the license.  An empty string is returned if there is
+// no license file and "NOASSERTION" if the license is not recognized.
+func detectLicense(dir string) string {
+	for _, name := range licenseFiles {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+
+		text := strings.ToLower(strings.Join(strings.Fields(string(data)), " "))
+		for _, sig := range licenseSignatures {
+			if containsAll(text, sig.phrases) {
+				return sig.id
+			}
+		}
+
+		return noAssertion
+	}
+
+	return ""
+}
+
+// containsAll returns true if the text contains all of the phrases.
+func containsAll(text string, phrases []string) bool {
+	for _, p := range phrases {
+		if !strings.Contains(text, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// contains returns true if the list contains the value, ignoring case.
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if strings.EqualFold(strings.TrimSpace(v), value) {
+			return true
+		}
+	}
+	return false
+}
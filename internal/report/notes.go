@@ -0,0 +1,79 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package report
+
+import (
+	"path/filepath"
+	"regexp"
+
+	"github.com/ctxswitch/gdoc/pkg/docserver"
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+)
+
+// RepoNote is a note found in a synchronized repository.
+type RepoNote struct {
+	Owner string `json:"owner"`
+	Name  string `json:"name"`
+	docserver.Note
+	// The file containing the note relative to the repository root.
+	Path string `json:"path"`
+}
+
+// NotesReport lists the notes, such as BUG or TODO comments, found in the
+// packages of the repositories.
+type NotesReport struct {
+	// The number of notes of each marker.
+	Counts map[string]int `json:"counts"`
+	Total  int            `json:"total"`
+	Notes  []RepoNote     `json:"notes"`
+}
+
+// Notes builds the notes report from the packages of the repositories.
+// Only the notes whose marker matches the pattern are included.
+func Notes(repos []syncer.Repo, marker *regexp.Regexp) NotesReport {
+	report := NotesReport{
+		Counts: make(map[string]int),
+		Notes:  []RepoNote{},
+	}
+
+	local := make(map[string]string)
+	for _, r := range repos {
+		local[r.Owner+"/"+r.Name] = r.LocalPath
+	}
+
+	for _, p := range Packages(repos) {
+		pd, err := docserver.ReadPackage(p.Dir, p.ImportPath)
+		if err != nil {
+			continue
+		}
+
+		for _, n := range pd.Notes {
+			if !marker.MatchString(n.Marker) {
+				continue
+			}
+
+			rel, _ := filepath.Rel(local[p.Owner+"/"+p.Name], filepath.Join(p.Dir, n.File))
+			report.Notes = append(report.Notes, RepoNote{Owner: p.Owner, Name: p.Name, Note: n, Path: filepath.ToSlash(rel)})
+			report.Counts[n.Marker]++
+		}
+	}
+	report.Total = len(report.Notes)
+
+	return report
+}
@@ -0,0 +1,85 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package report
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+)
+
+// Package is a Go package found in a synchronized repository.
+type Package struct {
+	Owner      string `json:"owner"`
+	Name       string `json:"name"`
+	ImportPath string `json:"import_path"`
+	// The directory containing the package.
+	Dir string `json:"-"`
+}
+
+// Packages returns the packages in the repositories ordered by import
+// path.  Vendored packages, test data and directories starting with a dot
+// or underscore are skipped.
+func Packages(repos []syncer.Repo) []Package {
+	var pkgs []Package
+	for _, r := range repos {
+		mods := findGoMods(r.LocalPath)
+		_ = filepath.Walk(r.LocalPath, func(p string, info os.FileInfo, err error) error {
+			if err != nil || !info.IsDir() {
+				return nil
+			}
+
+			name := info.Name()
+			if p != r.LocalPath && (name == "vendor" || name == "testdata" || name[0] == '.' || name[0] == '_') {
+				return filepath.SkipDir
+			}
+
+			if hasGoFiles(p) {
+				pkgs = append(pkgs, Package{Owner: r.Owner, Name: r.Name, ImportPath: importPath(mods, p), Dir: p})
+			}
+			return nil
+		})
+	}
+
+	sort.Slice(pkgs, func(i, j int) bool {
+		return pkgs[i].ImportPath < pkgs[j].ImportPath
+	})
+
+	return pkgs
+}
+
+// hasGoFiles returns true if the directory contains Go files other than
+// tests.
+func hasGoFiles(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() && strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package report
+
+import (
+	"sort"
+	"time"
+
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+)
+
+// cycloneDXVersion is the version of the CycloneDX specification the SBOMs
+// are generated for.
+const cycloneDXVersion = "1.4"
+
+// SBOM is a CycloneDX software bill of materials.
+type SBOM struct {
+	BOMFormat   string          `json:"bomFormat"`
+	SpecVersion string          `json:"specVersion"`
+	Version     int             `json:"version"`
+	Metadata    SBOMMetadata    `json:"metadata"`
+	Components  []SBOMComponent `json:"components"`
+}
+
+// SBOMMetadata describes the repository that the SBOM was generated for.
+type SBOMMetadata struct {
+	Timestamp time.Time     `json:"timestamp"`
+	Component SBOMComponent `json:"component"`
+}
+
+// SBOMComponent is a single component of an SBOM.
+type SBOMComponent struct {
+	BOMRef  string `json:"bom-ref,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	PURL    string `json:"purl,omitempty"`
+	// The scope is excluded for indirect requirements.
+	Scope string `json:"scope,omitempty"`
+}
+
+// NewSBOM generates a CycloneDX SBOM for a repository from the go.mod files
+// in its checkout.  Each module in the repository is listed as an
+// application component followed by the modules they require.
+func NewSBOM(r syncer.Repo) SBOM {
+	sbom := SBOM{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: cycloneDXVersion,
+		Version:     1,
+		Metadata: SBOMMetadata{
+			Timestamp: time.Now().UTC(),
+			Component: SBOMComponent{
+				Type:    "application",
+				Name:    r.Owner + "/" + r.Name,
+				Version: r.CommitSHA,
+			},
+		},
+		Components: []SBOMComponent{},
+	}
+
+	seen := make(map[string]bool)
+	add := func(c SBOMComponent) {
+		if seen[c.BOMRef] {
+			return
+		}
+		seen[c.BOMRef] = true
+		sbom.Components = append(sbom.Components, c)
+	}
+
+	for _, m := range findGoMods(r.LocalPath) {
+		purl := "pkg:golang/" + m.Module
+		add(SBOMComponent{
+			BOMRef: purl,
+			Type:   "application",
+			Name:   m.Module,
+			PURL:   purl,
+		})
+
+		for _, req := range m.Require {
+			purl := "pkg:golang/" + req.Path + "@" + req.Version
+			c := SBOMComponent{
+				BOMRef:  purl,
+				Type:    "library",
+				Name:    req.Path,
+				Version: req.Version,
+				PURL:    purl,
+				Scope:   "required",
+			}
+			if req.Indirect {
+				c.Scope = ""
+			}
+			add(c)
+		}
+	}
+
+	sort.SliceStable(sbom.Components, func(i, j int) bool {
+		a, b := sbom.Components[i], sbom.Components[j]
+		if a.Type != b.Type {
+			return a.Type == "application"
+		}
+		return a.BOMRef < b.BOMRef
+	})
+
+	return sbom
+}
@@ -0,0 +1,113 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package report
+
+import (
+	"strconv"
+	"strings"
+)
+
+// compareSemver compares two module versions such as v1.2.3 and
+// v1.3.0-rc.1.  It returns -1 if a is older than b, 1 if a is newer and 0 if
+// they are equal.  Build metadata is ignored and pre-release versions,
+// including pseudo-versions, are older than the release they precede.
+func compareSemver(a, b string) int {
+	acore, apre := splitSemver(a)
+	bcore, bpre := splitSemver(b)
+
+	for i := 0; i < 3; i++ {
+		switch {
+		case acore[i] < bcore[i]:
+			return -1
+		case acore[i] > bcore[i]:
+			return 1
+		}
+	}
+
+	switch {
+	case apre == bpre:
+		return 0
+	case apre == "":
+		return 1
+	case bpre == "":
+		return -1
+	}
+
+	return comparePrerelease(apre, bpre)
+}
+
+// splitSemver returns the major, minor and patch numbers and the pre-release
+// of a version.
+func splitSemver(v string) ([3]int, string) {
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.Index(v, "+"); i >= 0 {
+		v = v[:i]
+	}
+
+	var pre string
+	if i := strings.Index(v, "-"); i >= 0 {
+		v, pre = v[:i], v[i+1:]
+	}
+
+	var core [3]int
+	for i, p := range strings.SplitN(v, ".", 3) {
+		core[i], _ = strconv.Atoi(p)
+	}
+
+	return core, pre
+}
+
+// comparePrerelease compares the dot separated identifiers of two
+// pre-releases.  Numeric identifiers are compared numerically and are older
+// than alphanumeric ones.
+func comparePrerelease(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aerr := strconv.Atoi(as[i])
+		bn, berr := strconv.Atoi(bs[i])
+
+		switch {
+		case aerr == nil && berr == nil:
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+		case aerr == nil:
+			return -1
+		case berr == nil:
+			return 1
+		case as[i] != bs[i]:
+			if as[i] < bs[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,270 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package report
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+	"go.uber.org/zap"
+)
+
+// DefaultOSVURL is the address of the public OSV API.
+const DefaultOSVURL = "https://api.osv.dev"
+
+// osvBatchSize is the maximum number of queries sent in a single batch
+// request.  The OSV API accepts up to 1000.
+const osvBatchSize = 1000
+
+// VulnScannerOptions defines the options available for running the
+// vulnerability scanner.
+type VulnScannerOptions struct {
+	// The address of the OSV API.  Defaults to DefaultOSVURL.  Initially
+	// set in the config.
+	URL string
+	// The maximum time a single request to the OSV API may take.  Zero
+	// disables the timeout.  Initially set in the config.
+	Timeout time.Duration
+	// The syncer that provides the repositories and signals the end of
+	// each sync cycle.
+	Syncer *syncer.Syncer
+	// The logger used by the vulnerability scanner. Initially set in the
+	// config.
+	Logger *zap.Logger
+}
+
+// Vulnerability is a dependency of a module that is affected by one or more
+// known vulnerabilities.
+type Vulnerability struct {
+	// The affected module path.
+	Package string `json:"package"`
+	// The version required by the module.
+	Version string `json:"version"`
+	// The OSV identifiers of the vulnerabilities.
+	IDs []string `json:"ids"`
+}
+
+// VulnFindings are the vulnerabilities found in the dependencies of a
+// single module.
+type VulnFindings struct {
+	Owner           string          `json:"owner"`
+	Name            string          `json:"name"`
+	Module          string          `json:"module"`
+	Vulnerabilities []Vulnerability `json:"vulnerabilities"`
+}
+
+// VulnReport is the result of the last vulnerability scan.
+type VulnReport struct {
+	// The time the last scan finished.  Zero if no scan has completed.
+	Scanned time.Time `json:"scanned"`
+	// The number of modules with at least one vulnerable dependency.
+	Affected int `json:"affected"`
+	// The findings for each module with vulnerable dependencies.
+	Modules []VulnFindings `json:"modules"`
+}
+
+// VulnScanner checks the dependencies of every synchronized module against
+// the OSV database after each sync cycle.
+type VulnScanner struct {
+	options VulnScannerOptions
+	client  *http.Client
+	logger  *zap.Logger
+
+	report VulnReport
+	mu     sync.RWMutex
+}
+
+// NewVulnScanner returns an initialized VulnScanner.
+func NewVulnScanner(options VulnScannerOptions) *VulnScanner {
+	if options.URL == "" {
+		options.URL = DefaultOSVURL
+	}
+
+	return &VulnScanner{
+		options: options,
+		client:  &http.Client{Timeout: options.Timeout},
+		logger:  options.Logger,
+		report:  VulnReport{Modules: []VulnFindings{}},
+	}
+}
+
+// Start scans the synchronized repositories and rescans them each time a
+// sync cycle completes until the context is cancelled.
+func (v *VulnScanner) Start(ctx context.Context) error {
+	synced := make(chan syncer.Message, 1)
+	v.options.Syncer.Bus().Subscribe(synced, syncer.EventSyncCompleted)
+	defer v.options.Syncer.Bus().Unsubscribe(synced)
+
+	v.scan(ctx)
+	for {
+		select {
+		case <-synced:
+			v.scan(ctx)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Report returns the result of the last scan.
+func (v *VulnScanner) Report() VulnReport {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.report
+}
+
+// dependency identifies the module that a requirement belongs to.
+type dependency struct {
+	module int
+	req    Requirement
+}
+
+// scan queries the OSV database for every requirement of every module and
+// records the modules with vulnerable dependencies.
+func (v *VulnScanner) scan(ctx context.Context) {
+	var modules []VulnFindings
+	var deps []dependency
+	for _, r := range v.options.Syncer.Repos() {
+		for _, m := range findGoMods(r.LocalPath) {
+			modules = append(modules, VulnFindings{Owner: r.Owner, Name: r.Name, Module: m.Module})
+			for _, req := range m.Require {
+				deps = append(deps, dependency{module: len(modules) - 1, req: req})
+			}
+		}
+	}
+
+	for start := 0; start < len(deps); start += osvBatchSize {
+		end := start + osvBatchSize
+		if end > len(deps) {
+			end = len(deps)
+		}
+
+		ids, err := v.query(ctx, deps[start:end])
+		if err != nil {
+			v.logger.Error("vulnerability scan failed", zap.Error(err))
+			return
+		}
+
+		for i, d := range deps[start:end] {
+			if len(ids[i]) == 0 {
+				continue
+			}
+			m := &modules[d.module]
+			m.Vulnerabilities = append(m.Vulnerabilities, Vulnerability{
+				Package: d.req.Path,
+				Version: d.req.Version,
+				IDs:     ids[i],
+			})
+		}
+	}
+
+	report := VulnReport{Scanned: time.Now(), Modules: []VulnFindings{}}
+	for _, m := range modules {
+		if len(m.Vulnerabilities) == 0 {
+			continue
+		}
+		v.logger.Warn("vulnerable dependencies found",
+			zap.String("owner", m.Owner),
+			zap.String("name", m.Name),
+			zap.String("module", m.Module),
+			zap.Int("count", len(m.Vulnerabilities)),
+		)
+		report.Modules = append(report.Modules, m)
+	}
+	report.Affected = len(report.Modules)
+
+	v.mu.Lock()
+	v.report = report
+	v.mu.Unlock()
+}
+
+// osvQuery is a single query of an OSV batch request.
+type osvQuery struct {
+	Package struct {
+		Name      string `json:"name"`
+		Ecosystem string `json:"ecosystem"`
+	} `json:"package"`
+	Version string `json:"version"`
+}
+
+// osvBatchResponse is the response to an OSV batch request.  The results
+// are in the same order as the queries.
+type osvBatchResponse struct {
+	Results []struct {
+		Vulns []struct {
+			ID string `json:"id"`
+		} `json:"vulns"`
+	} `json:"results"`
+}
+
+// query sends a batch request for the dependencies and returns the
+// vulnerability identifiers for each of them.
+func (v *VulnScanner) query(ctx context.Context, deps []dependency) ([][]string, error) {
+	queries := make([]osvQuery, len(deps))
+	for i, d := range deps {
+		queries[i].Package.Name = d.req.Path
+		queries[i].Package.Ecosystem = "Go"
+		// OSV uses semantic versions without the v prefix for Go modules.
+		queries[i].Version = strings.TrimPrefix(d.req.Version, "v")
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"queries": queries})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(v.options.URL, "/")+"/v1/querybatch", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("osv query failed: %s", resp.Status)
+	}
+
+	var br osvBatchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&br); err != nil {
+		return nil, err
+	}
+
+	ids := make([][]string, len(deps))
+	for i := 0; i < len(br.Results) && i < len(deps); i++ {
+		for _, vuln := range br.Results[i].Vulns {
+			ids[i] = append(ids[i], vuln.ID)
+		}
+		sort.Strings(ids[i])
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,363 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package search
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"go/doc"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ctxswitch/gdoc/internal/report"
+	"github.com/ctxswitch/gdoc/pkg/docserver"
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultModel is the embedding model used when no model is
+	// configured.
+	DefaultModel = "text-embedding-3-small"
+	// DefaultSemanticWeight is the share of the score given to semantic
+	// similarity when no weight is configured.  The rest is given to the
+	// keyword match.
+	DefaultSemanticWeight = 0.7
+)
+
+// IndexOptions defines the options available for running the semantic
+// search index.
+type IndexOptions struct {
+	// The address of an OpenAI compatible API that embeddings are
+	// requested from.  Initially set in the config.
+	URL string
+	// The embedding model.  Defaults to DefaultModel.  Initially set in
+	// the config.
+	Model string
+	// The bearer token sent to the API.  Initially set in the config.
+	Token string
+	// The maximum time a single request to the embeddings API may take.
+	// Zero disables the timeout.  Initially set in the config.
+	Timeout time.Duration
+	// The share of the score given to semantic similarity between 0 and 1.
+	// Defaults to DefaultSemanticWeight.  Initially set in the config.
+	SemanticWeight float64
+	// The file the embeddings are stored in so that unchanged chunks are
+	// not embedded again after a restart.  Empty keeps the embeddings in
+	// memory only.
+	Path string
+	// The syncer that provides the repositories and signals the end of
+	// each sync cycle.
+	Syncer *syncer.Syncer
+	// The repositories that are not indexed as owner/name patterns.
+	// Their documentation is never sent to the embeddings API.
+	// Initially set in the config.
+	Exclude []string
+	// The logger used by the search index. Initially set in the config.
+	Logger *zap.Logger
+}
+
+// Result is a documentation chunk matching a search.
+type Result struct {
+	ImportPath string `json:"import_path"`
+	// The name of the declaration.  Empty for the package documentation.
+	Symbol string `json:"symbol,omitempty"`
+	// One of package, const, var, func, type or method.
+	Kind      string `json:"kind"`
+	Signature string `json:"signature,omitempty"`
+	Synopsis  string `json:"synopsis"`
+	// The combined keyword and semantic score between 0 and 1.
+	Score float64 `json:"score"`
+}
+
+// chunk is a unit of documentation that is embedded.
+type chunk struct {
+	Result
+	// The text that was embedded.
+	text string
+	// The hash of the text, used as the key of the embedding.
+	hash string
+}
+
+// segment holds the chunks of a single repository as of a commit.
+type segment struct {
+	commit string
+	chunks []chunk
+}
+
+// Index is a service that keeps the embeddings of the documentation of the
+// synchronized packages up to date and serves hybrid searches.
+type Index struct {
+	// The IndexOptions that was passed into NewIndex.
+	options  IndexOptions
+	embedder embedder
+	// The chunks of the last build.
+	chunks []chunk
+	// The chunks of each repository keyed by owner/name.  Only the
+	// segments of repositories whose commit changed are collected again.
+	segments map[string]segment
+	// The embeddings keyed by the hash of the text.
+	vectors map[string][]float32
+	// The logger used by the search index.
+	logger *zap.Logger
+	mu     sync.RWMutex
+}
+
+// NewIndex returns an initialized Index struct.  Stored embeddings are
+// loaded from the path.
+func NewIndex(o IndexOptions) *Index {
+	if o.Model == "" {
+		o.Model = DefaultModel
+	}
+	if o.SemanticWeight <= 0 || o.SemanticWeight > 1 {
+		o.SemanticWeight = DefaultSemanticWeight
+	}
+
+	idx := &Index{
+		options:  o,
+		embedder: embedder{url: o.URL, model: o.Model, token: o.Token, timeout: o.Timeout},
+		vectors:  make(map[string][]float32),
+		segments: make(map[string]segment),
+		logger:   o.Logger,
+	}
+
+	if data, err := os.ReadFile(o.Path); err == nil {
+		if err := json.Unmarshal(data, &idx.vectors); err != nil {
+			idx.logger.Warn("unable to read the stored embeddings", zap.Error(err))
+		}
+	}
+
+	return idx
+}
+
+// Start runs the search index until the context is cancelled.  The index
+// is rebuilt after every sync cycle.  Only the repositories whose commit
+// changed are read again and only chunks whose text changed are embedded
+// again.
+func (idx *Index) Start(ctx context.Context) error {
+	synced := make(chan syncer.Message, 1)
+	idx.options.Syncer.Bus().Subscribe(synced, syncer.EventSyncCompleted)
+	defer idx.options.Syncer.Bus().Unsubscribe(synced)
+
+	idx.build(ctx)
+	for {
+		select {
+		case <-synced:
+			idx.build(ctx)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// build chunks the documentation of the packages of every repository that
+// changed since the last build, embeds the new chunks and stores the
+// embeddings.
+func (idx *Index) build(ctx context.Context) {
+	segments := make(map[string]segment)
+	var chunks []chunk
+	var collected int
+	for _, r := range idx.options.Syncer.Repos() {
+		if syncer.MatchRepo(idx.options.Exclude, r.Owner, r.Name) {
+			continue
+		}
+		key := r.Owner + "/" + r.Name
+		s, ok := idx.segments[key]
+		if !ok || r.CommitSHA == "" || s.commit != r.CommitSHA {
+			s = segment{commit: r.CommitSHA, chunks: collect(report.Packages([]syncer.Repo{r}))}
+			collected++
+		}
+		segments[key] = s
+		chunks = append(chunks, s.chunks...)
+	}
+
+	idx.mu.RLock()
+	var missing []chunk
+	for _, c := range chunks {
+		if _, ok := idx.vectors[c.hash]; !ok {
+			missing = append(missing, c)
+		}
+	}
+	idx.mu.RUnlock()
+
+	vectors := make(map[string][]float32)
+	if len(missing) > 0 {
+		texts := make([]string, len(missing))
+		for i, c := range missing {
+			texts[i] = c.text
+		}
+
+		vecs, err := idx.embedder.embed(ctx, texts)
+		if err != nil {
+			// Keyword matching still works for the chunks that could not
+			// be embedded.
+			idx.logger.Error("unable to compute embeddings", zap.Error(err))
+		}
+		for i, v := range vecs {
+			vectors[missing[i].hash] = v
+		}
+	}
+
+	idx.mu.Lock()
+	// Keep only the embeddings of the current chunks.
+	for _, c := range chunks {
+		if v, ok := idx.vectors[c.hash]; ok {
+			vectors[c.hash] = v
+		}
+	}
+	idx.chunks = chunks
+	idx.segments = segments
+	idx.vectors = vectors
+	idx.mu.Unlock()
+
+	if err := idx.save(vectors); err != nil {
+		idx.logger.Error("unable to store the embeddings", zap.Error(err))
+	}
+	idx.logger.Info("search index built", zap.Int("chunks", len(chunks)), zap.Int("repositories", collected), zap.Int("embedded", len(missing)))
+}
+
+// save writes the embeddings to the path.
+func (idx *Index) save(vectors map[string][]float32) error {
+	if idx.options.Path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(vectors)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(idx.options.Path), 0755); err != nil {
+		return err
+	}
+
+	tmp := idx.options.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, idx.options.Path)
+}
+
+// Search returns the chunks that best match the query, highest score
+// first.  The score combines the share of the query terms found in the
+// chunk with the cosine similarity of the embeddings.  Chunks that match
+// neither are left out.
+func (idx *Index) Search(ctx context.Context, q string, limit int) ([]Result, error) {
+	terms := strings.Fields(strings.ToLower(q))
+	results := []Result{}
+	if len(terms) == 0 {
+		return results, nil
+	}
+
+	vecs, err := idx.embedder.embed(ctx, []string{q})
+	if err != nil {
+		return nil, err
+	}
+	query := vecs[0]
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	w := idx.options.SemanticWeight
+	for _, c := range idx.chunks {
+		text := strings.ToLower(c.text)
+		var matched int
+		for _, t := range terms {
+			if strings.Contains(text, t) {
+				matched++
+			}
+		}
+		keyword := float64(matched) / float64(len(terms))
+
+		var semantic float64
+		if v, ok := idx.vectors[c.hash]; ok {
+			semantic = math.Max(0, cosine(query, v))
+		}
+
+		r := c.Result
+		r.Score = w*semantic + (1-w)*keyword
+		if r.Score > 0 {
+			results = append(results, r)
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results, nil
+}
+
+// collect splits the documentation of the packages into chunks, one for the
+// package documentation and one for each exported declaration.
+func collect(pkgs []report.Package) []chunk {
+	var chunks []chunk
+	add := func(r Result, comment string) {
+		text := strings.Join([]string{r.ImportPath, r.Symbol, r.Signature, comment}, "\n")
+		sum := sha256.Sum256([]byte(text))
+		chunks = append(chunks, chunk{Result: r, text: text, hash: hex.EncodeToString(sum[:])})
+	}
+
+	for _, p := range pkgs {
+		pd, err := docserver.ReadPackage(p.Dir, p.ImportPath)
+		if err != nil {
+			continue
+		}
+
+		add(Result{ImportPath: pd.ImportPath, Kind: "package", Synopsis: pd.Synopsis}, pd.Doc)
+		for _, s := range pd.Symbols {
+			add(Result{
+				ImportPath: pd.ImportPath,
+				Symbol:     s.Name,
+				Kind:       s.Kind,
+				Signature:  s.Signature,
+				Synopsis:   doc.Synopsis(s.Doc),
+			}, s.Doc)
+		}
+	}
+
+	return chunks
+}
+
+// cosine returns the cosine similarity of two vectors.
+func cosine(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
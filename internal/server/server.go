@@ -0,0 +1,240 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// The address families that the TCP listeners are opened for.
+const (
+	// FamilyDual listens on IPv4 and IPv6.
+	FamilyDual = "dual"
+	// FamilyIPv4 only listens on IPv4.
+	FamilyIPv4 = "ipv4"
+	// FamilyIPv6 only listens on IPv6.
+	FamilyIPv6 = "ipv6"
+)
+
+// DefaultShutdownTimeout is how long active connections are given to finish
+// when no shutdown timeout is configured.
+const DefaultShutdownTimeout = 30 * time.Second
+
+// Options defines how an HTTP server listens and shuts down.
+type Options struct {
+	// The TCP address to listen on, such as ":6060".  Empty to only listen
+	// on the socket.
+	Addr string
+	// The network of the TCP address, either "tcp", "tcp4" or "tcp6".
+	// Defaults to "tcp", which listens on IPv4 and IPv6.
+	Network string
+	// The path of a unix domain socket to listen on in addition to the TCP
+	// address.  Empty to disable.
+	Socket string
+	// How long active requests are given to finish once the context is
+	// cancelled.  Defaults to DefaultShutdownTimeout.
+	ShutdownTimeout time.Duration
+	// The name of the systemd socket activation listener, set with
+	// FileDescriptorName= in the socket unit, that is used instead of
+	// the TCP address when the process is socket activated.
+	ActivationName string
+	// The timeouts of the connections.  Zero values leave the timeouts of
+	// the server unchanged.
+	Timeouts Timeouts
+	// The TLS configuration of the TCP address, or of the listener passed
+	// by systemd.  Nil to serve plain HTTP.  The unix domain socket is
+	// never encrypted since it is protected by its file permissions.
+	TLSConfig *tls.Config
+	// The logger used to report the shutdown.
+	Logger *zap.Logger
+}
+
+// Timeouts are the limits on the time spent on the connections of an HTTP
+// server.  Zero disables a timeout.
+type Timeouts struct {
+	// The time allowed to read a request, including its body.
+	Read time.Duration
+	// The time allowed from the end of reading the request headers to the
+	// end of writing the response.  It must be longer than the slowest
+	// response, so it is left disabled for servers that stream responses.
+	Write time.Duration
+	// The time a keep-alive connection is kept open between requests.
+	Idle time.Duration
+}
+
+// apply sets the timeouts on the server.
+func (t Timeouts) apply(srv *http.Server) {
+	if t.Read > 0 {
+		srv.ReadTimeout = t.Read
+	}
+	if t.Write > 0 {
+		srv.WriteTimeout = t.Write
+	}
+	if t.Idle > 0 {
+		srv.IdleTimeout = t.Idle
+	}
+}
+
+// Serve runs the server on each configured listener until the context is
+// cancelled.  The server then stops accepting connections and waits up to
+// the shutdown timeout for the active requests to finish before the
+// remaining connections are closed.  Serve does not return until the
+// connections have been drained.
+func Serve(ctx context.Context, srv *http.Server, o Options) error {
+	timeout := o.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+
+	o.Timeouts.apply(srv)
+
+	listeners, err := listen(o)
+	if err != nil {
+		return err
+	}
+
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			errs <- srv.Serve(l)
+		}(l)
+	}
+
+	select {
+	case <-ctx.Done():
+	case err := <-errs:
+		if err != http.ErrServerClosed {
+			_ = srv.Close()
+			return err
+		}
+	}
+
+	o.Logger.Info("draining connections", zap.String("addr", o.Addr), zap.String("socket", o.Socket), zap.Duration("timeout", timeout))
+	sctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(sctx); err != nil {
+		o.Logger.Warn("connections were not drained before the timeout", zap.String("addr", o.Addr), zap.Error(err))
+		_ = srv.Close()
+	}
+
+	return nil
+}
+
+// listen opens the TCP and unix domain socket listeners.  A socket left
+// behind by a previous run is removed before listening.  When systemd has
+// passed a listener with the activation name, it replaces the TCP address.
+func listen(o Options) ([]net.Listener, error) {
+	var listeners []net.Listener
+	activated, err := activationListener(o.ActivationName)
+	if err != nil {
+		return nil, err
+	}
+
+	if activated != nil {
+		listeners = append(listeners, secure(activated, o.TLSConfig))
+	} else if o.Addr != "" {
+		network := o.Network
+		if network == "" {
+			network = "tcp"
+		}
+		l, err := net.Listen(network, o.Addr)
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, secure(l, o.TLSConfig))
+	}
+
+	if o.Socket != "" {
+		if err := os.Remove(o.Socket); err != nil && !os.IsNotExist(err) {
+			closeAll(listeners)
+			return nil, err
+		}
+
+		l, err := net.Listen("unix", o.Socket)
+		if err != nil {
+			closeAll(listeners)
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+
+	return listeners, nil
+}
+
+// Network returns the network that the TCP listeners of the address family
+// are opened on.
+func Network(family string) string {
+	switch strings.ToLower(family) {
+	case FamilyIPv4:
+		return "tcp4"
+	case FamilyIPv6:
+		return "tcp6"
+	}
+	return "tcp"
+}
+
+// Loopback returns the loopback address of the family.  IPv4 is used for
+// dual stack listeners.
+func Loopback(family string) string {
+	if strings.ToLower(family) == FamilyIPv6 {
+		return "::1"
+	}
+	return "127.0.0.1"
+}
+
+// Address joins the host and port into a TCP address, adding the brackets
+// around IPv6 hosts.  An empty host listens on every address of the family.
+// It is spelled out as 0.0.0.0 or :: for a single family so that processes
+// that are passed the address, such as godoc, bind to that family.
+func Address(host string, port int, family string) string {
+	if host == "" {
+		switch strings.ToLower(family) {
+		case FamilyIPv4:
+			host = "0.0.0.0"
+		case FamilyIPv6:
+			host = "::"
+		}
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// secure wraps the listener with TLS when a configuration is given.
+func secure(l net.Listener, c *tls.Config) net.Listener {
+	if c == nil {
+		return l
+	}
+	return tls.NewListener(l, c)
+}
+
+// closeAll closes the listeners.
+func closeAll(listeners []net.Listener) {
+	for _, l := range listeners {
+		_ = l.Close()
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// statusRecorder records the status code written to a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status code and writes it to the response.
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// Flush sends the buffered data to the client if the response supports it.
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Slow logs the requests that take longer than the threshold to serve
+// along with their target, such as the package that was rendered.  The
+// target function returns an empty string for requests that are expected
+// to be long lived, which are not measured.  A threshold of zero disables
+// the logging.
+func Slow(next http.Handler, threshold time.Duration, logger *zap.Logger, target func(*http.Request) string) http.Handler {
+	if threshold <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := target(r)
+		if t == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		if d := time.Since(start); d > threshold {
+			logger.Warn("slow request", zap.String("method", r.Method), zap.String("target", t), zap.Int("status", rec.status), zap.Duration("duration", d))
+		}
+	})
+}
@@ -0,0 +1,537 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package stdlib
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+	"go.uber.org/zap"
+)
+
+// DefaultURL is the site that Go releases are downloaded from when no
+// download site is configured.
+const DefaultURL = "https://go.dev/dl/"
+
+// manifestFile is the location of the record of the installed standard
+// library relative to the root.
+const manifestFile = ".gdoc/stdlib.json"
+
+// releasesDir is the directory relative to the root where the standard
+// libraries of additional releases are installed side by side.
+const releasesDir = ".gdoc/stdlib"
+
+// stagingDir is the directory relative to the root where the standard
+// library is unpacked before it is moved into place.
+const stagingDir = ".gdoc/staging/stdlib"
+
+// Options defines the options available for installing the standard
+// library.
+type Options struct {
+	// The workspace that the standard library is installed into.
+	// Initially set in the config.
+	Root string
+	// The Go release whose standard library is installed, such as
+	// go1.21.5.  Initially set in the config.
+	Version string
+	// The site that Go releases are downloaded from.  Defaults to
+	// DefaultURL.  Initially set in the config.
+	URL string
+	// The maximum time the download may take.  Zero disables the timeout.
+	// Initially set in the config.
+	Timeout time.Duration
+	// Only use the releases that are already installed.  Initially set in
+	// the config.
+	Offline bool
+	// The locks of the workspace paths shared with the other services
+	// that modify the workspace.  Defaults to a new PathLocks.
+	Locks *syncer.PathLocks
+	// The logger used to report the installation.  Initially set in the
+	// config.
+	Logger *zap.Logger
+}
+
+// manifest records the installed release and the directories below src
+// that belong to its standard library.
+type manifest struct {
+	Version string   `json:"version"`
+	Dirs    []string `json:"dirs"`
+}
+
+// release is a Go release listed by the download site.
+type release struct {
+	Version string `json:"version"`
+	Files   []struct {
+		Filename string `json:"filename"`
+		Kind     string `json:"kind"`
+		SHA256   string `json:"sha256"`
+	} `json:"files"`
+}
+
+// Install downloads the source distribution of the Go release and installs
+// its standard library into the src directory of the root, replacing the
+// packages of the previously installed or bundled release.  The archive
+// is verified against the checksum published by the download site and
+// unpacked into a staging directory before the workspace is touched.  It
+// returns false if the release is already installed and an error in
+// offline mode if it is not.
+func Install(ctx context.Context, o Options) (bool, error) {
+	if o.URL == "" {
+		o.URL = DefaultURL
+	}
+	if o.Locks == nil {
+		o.Locks = syncer.NewPathLocks()
+	}
+	version := Normalize(o.Version)
+
+	installed, err := readManifest(o.Root)
+	if err != nil {
+		return false, err
+	}
+	if installed.Version == version {
+		return false, nil
+	}
+	if o.Offline {
+		return false, fmt.Errorf("go release %s is not installed and offline mode is enabled", version)
+	}
+
+	o.Logger.Info("downloading the standard library", zap.String("version", version))
+	staged, err := fetch(ctx, o, version)
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(staged)
+
+	if err := place(o, staged, installed, version); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Releases installs the standard libraries of the Go releases side by side
+// below the .gdoc/stdlib directory of the root, so they can be documented
+// along with the one in the src directory.  Releases that are already
+// installed are kept and the ones that are no longer listed are removed.
+// In offline mode only the installed releases are returned.  A release
+// that can not be installed is logged and left out.  The roots of the
+// installed releases are returned keyed by release.
+func Releases(ctx context.Context, o Options, versions []string) map[string]string {
+	if o.URL == "" {
+		o.URL = DefaultURL
+	}
+	if o.Locks == nil {
+		o.Locks = syncer.NewPathLocks()
+	}
+
+	roots := make(map[string]string)
+	for _, v := range versions {
+		version := Normalize(v)
+		dir := Dir(o.Root, version)
+		if _, err := os.Stat(filepath.Join(dir, "src")); err == nil {
+			roots[version] = dir
+			continue
+		}
+		if o.Offline {
+			o.Logger.Warn("standard library is not installed and offline mode is enabled", zap.String("version", version))
+			continue
+		}
+
+		o.Logger.Info("downloading the standard library", zap.String("version", version))
+		if err := installRelease(ctx, o, version, dir); err != nil {
+			o.Logger.Error("unable to install the standard library", zap.String("version", version), zap.Error(err))
+			continue
+		}
+		roots[version] = dir
+	}
+
+	entries, err := os.ReadDir(filepath.Join(o.Root, filepath.FromSlash(releasesDir)))
+	if err != nil {
+		return roots
+	}
+	for _, e := range entries {
+		if _, ok := roots[e.Name()]; ok {
+			continue
+		}
+		dir := Dir(o.Root, e.Name())
+		unlock := o.Locks.Lock(dir)
+		err := os.RemoveAll(dir)
+		unlock()
+		if err != nil {
+			o.Logger.Error("unable to remove the standard library", zap.String("version", e.Name()), zap.Error(err))
+		}
+	}
+
+	return roots
+}
+
+// installRelease installs the standard library of a single release into
+// the directory.
+func installRelease(ctx context.Context, o Options, version, dir string) error {
+	staged, err := fetch(ctx, o, version)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staged)
+
+	defer o.Locks.Lock(dir)()
+
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return os.Rename(filepath.Join(staged, "src"), filepath.Join(dir, "src"))
+}
+
+// Dir returns the directory that the standard library of the release is
+// installed in when it is installed side by side.
+func Dir(root, version string) string {
+	return filepath.Join(root, filepath.FromSlash(releasesDir), Normalize(version))
+}
+
+// Version returns the release of the standard library in the src
+// directory of the root.  The release is read from the record of the
+// installed standard library or the VERSION file of a Go installation.
+// It returns an empty string if the release is unknown.
+func Version(root string) string {
+	if m, err := readManifest(root); err == nil && m.Version != "" {
+		return m.Version
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, "VERSION"))
+	if err != nil {
+		return ""
+	}
+	version := strings.TrimSpace(strings.SplitN(string(data), "\n", 2)[0])
+	if !strings.HasPrefix(version, "go") {
+		return ""
+	}
+	return version
+}
+
+// Normalize adds the go prefix to the release version if it is missing.
+func Normalize(version string) string {
+	if version != "" && !strings.HasPrefix(version, "go") {
+		return "go" + version
+	}
+	return version
+}
+
+// fetch downloads the source archive of the release and unpacks its src
+// directory into the staging directory.  The staged directory is returned
+// and must be removed by the caller.
+func fetch(ctx context.Context, o Options, version string) (string, error) {
+	client := &http.Client{Timeout: o.Timeout}
+	file, sum, err := lookup(ctx, client, o.URL, version)
+	if err != nil {
+		return "", err
+	}
+
+	o.Logger.Debug("downloading the go release", zap.String("version", version), zap.String("file", file))
+	archive, err := download(ctx, client, strings.TrimSuffix(o.URL, "/")+"/"+file, sum)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(archive)
+
+	staged := filepath.Join(o.Root, filepath.FromSlash(stagingDir), version)
+	if err := os.RemoveAll(staged); err != nil {
+		return "", err
+	}
+	if err := extract(archive, staged); err != nil {
+		os.RemoveAll(staged)
+		return "", err
+	}
+
+	return staged, nil
+}
+
+// lookup returns the name and checksum of the source archive of the
+// release.
+func lookup(ctx context.Context, client *http.Client, url, version string) (string, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(url, "/")+"/?mode=json&include=all", nil)
+	if err != nil {
+		return "", "", err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("unable to list the go releases: %s", resp.Status)
+	}
+
+	var releases []release
+	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+		return "", "", err
+	}
+
+	for _, r := range releases {
+		if r.Version != version {
+			continue
+		}
+		for _, f := range r.Files {
+			if f.Kind == "source" {
+				return f.Filename, f.SHA256, nil
+			}
+		}
+		return "", "", fmt.Errorf("go release %s has no source archive", version)
+	}
+
+	return "", "", fmt.Errorf("go release %s not found", version)
+}
+
+// download saves the archive to a temporary file and verifies its
+// checksum.  The name of the file is returned.
+func download(ctx context.Context, client *http.Client, url, sum string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to download %s: %s", url, resp.Status)
+	}
+
+	f, err := os.CreateTemp("", "gdoc-stdlib-*.tar.gz")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), resp.Body); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	if got := hex.EncodeToString(h.Sum(nil)); got != sum {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("checksum mismatch for %s: expected %s, got %s", url, sum, got)
+	}
+
+	return f.Name(), nil
+}
+
+// extract unpacks the src directory of the archive into the directory.
+// Test data is left out since it is never documented.
+func extract(archive, dir string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := strings.TrimPrefix(hdr.Name, "go/")
+		if hdr.Typeflag != tar.TypeReg || !strings.HasPrefix(name, "src/") || strings.Contains(name, "/testdata/") {
+			continue
+		}
+		if path.Clean("/" + name)[1:] != name {
+			return fmt.Errorf("unexpected file %s in the archive", hdr.Name)
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, tr); err != nil {
+			out.Close()
+			return err
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+	}
+}
+
+// place swaps the standard library in the src directory of the root for
+// the staged one while the workspace is locked and records the release.
+// Only the directories recorded for the previous release, or those of a
+// bundled release, are replaced.  A directory of the workspace that has
+// the name of a standard library directory fails the installation before
+// anything is moved.  The replaced directories are moved aside and moved
+// back if any step fails, so the previous release is kept until the new
+// one is complete.
+func place(o Options, staged string, previous manifest, version string) error {
+	entries, err := os.ReadDir(filepath.Join(staged, "src"))
+	if err != nil {
+		return err
+	}
+
+	var dirs []string
+	for _, e := range entries {
+		if e.IsDir() {
+			dirs = append(dirs, e.Name())
+		}
+	}
+	sort.Strings(dirs)
+
+	defer o.Locks.LockWorkspace()()
+
+	src := filepath.Join(o.Root, "src")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		return err
+	}
+
+	owned := make(map[string]bool)
+	for _, d := range previous.Dirs {
+		if d != "." && d != ".." && d == filepath.Base(d) {
+			owned[d] = true
+		}
+	}
+	bundled := previous.Version == "" && Version(o.Root) != ""
+	for _, d := range dirs {
+		if owned[d] || bundled {
+			continue
+		}
+		_, err := os.Lstat(filepath.Join(src, d))
+		if err == nil {
+			return fmt.Errorf("src/%s is not part of the installed standard library", d)
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	aside := staged + ".previous"
+	if err := os.RemoveAll(aside); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(aside, 0755); err != nil {
+		return err
+	}
+	defer os.RemoveAll(aside)
+
+	// The moves are undone in reverse order if the release can not be
+	// placed completely.
+	var moves [][2]string
+	move := func(from, to string) error {
+		if err := os.Rename(from, to); err != nil {
+			return err
+		}
+		moves = append(moves, [2]string{from, to})
+		return nil
+	}
+	rollback := func(err error) error {
+		for i := len(moves) - 1; i >= 0; i-- {
+			if rerr := os.Rename(moves[i][1], moves[i][0]); rerr != nil {
+				o.Logger.Error("unable to restore the standard library", zap.String("path", moves[i][0]), zap.Error(rerr))
+			}
+		}
+		return err
+	}
+
+	replaced := make(map[string]bool)
+	for _, d := range append(dirs, previous.Dirs...) {
+		if replaced[d] || !(owned[d] || bundled) {
+			continue
+		}
+		replaced[d] = true
+		if _, err := os.Lstat(filepath.Join(src, d)); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err := move(filepath.Join(src, d), filepath.Join(aside, d)); err != nil {
+			return rollback(err)
+		}
+	}
+	for _, d := range dirs {
+		if err := move(filepath.Join(staged, "src", d), filepath.Join(src, d)); err != nil {
+			return rollback(err)
+		}
+	}
+
+	if err := writeManifest(o.Root, manifest{Version: version, Dirs: dirs}); err != nil {
+		return rollback(err)
+	}
+	return nil
+}
+
+// readManifest reads the record of the installed standard library.  An
+// empty record is returned if none has been installed.
+func readManifest(root string) (manifest, error) {
+	var m manifest
+	data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(manifestFile)))
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return m, err
+	}
+	return m, json.Unmarshal(data, &m)
+}
+
+// writeManifest records the installed standard library.
+func writeManifest(root string, m manifest) error {
+	name := filepath.Join(root, filepath.FromSlash(manifestFile))
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, data, 0644)
+}
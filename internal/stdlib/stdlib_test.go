@@ -0,0 +1,137 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package stdlib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+	"go.uber.org/zap"
+)
+
+// write creates the files below the directory with their names as content.
+func write(t *testing.T, dir string, files ...string) {
+	t.Helper()
+
+	for _, f := range files {
+		name := filepath.Join(dir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// options returns the options for a workspace in a temporary directory.
+func options(t *testing.T) Options {
+	return Options{Root: t.TempDir(), Locks: syncer.NewPathLocks(), Logger: zap.NewNop()}
+}
+
+func TestPlace(t *testing.T) {
+	o := options(t)
+	write(t, filepath.Join(o.Root, "src"), "fmt/old.go", "old/old.go", "github.com/org/repo/repo.go", "tools/tools.go")
+	staged := filepath.Join(o.Root, ".gdoc/staging/stdlib/go1.21.5")
+	write(t, staged, "src/fmt/new.go", "src/net/new.go")
+
+	previous := manifest{Version: "go1.20", Dirs: []string{"fmt", "old"}}
+	if err := place(o, staged, previous, "go1.21.5"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, f := range []string{"fmt/new.go", "net/new.go", "github.com/org/repo/repo.go", "tools/tools.go"} {
+		if _, err := os.Stat(filepath.Join(o.Root, "src", f)); err != nil {
+			t.Errorf("expected src/%s to exist, got %v", f, err)
+		}
+	}
+	for _, f := range []string{"fmt/old.go", "old"} {
+		if _, err := os.Stat(filepath.Join(o.Root, "src", f)); !os.IsNotExist(err) {
+			t.Errorf("expected src/%s to be removed, got %v", f, err)
+		}
+	}
+	if m, err := readManifest(o.Root); err != nil || m.Version != "go1.21.5" || len(m.Dirs) != 2 {
+		t.Errorf("expected the release to be recorded, got %+v, %v", m, err)
+	}
+}
+
+func TestPlaceKeepsWorkspaceDirs(t *testing.T) {
+	o := options(t)
+	write(t, filepath.Join(o.Root, "src"), "fmt/old.go", "internal/workspace.go")
+	staged := filepath.Join(o.Root, ".gdoc/staging/stdlib/go1.21.5")
+	write(t, staged, "src/fmt/new.go", "src/internal/new.go")
+
+	previous := manifest{Version: "go1.20", Dirs: []string{"fmt"}}
+	if err := place(o, staged, previous, "go1.21.5"); err == nil {
+		t.Fatal("expected an error for a workspace directory")
+	}
+
+	for _, f := range []string{"fmt/old.go", "internal/workspace.go"} {
+		if _, err := os.Stat(filepath.Join(o.Root, "src", f)); err != nil {
+			t.Errorf("expected src/%s to be kept, got %v", f, err)
+		}
+	}
+}
+
+func TestPlaceReplacesBundledRelease(t *testing.T) {
+	o := options(t)
+	if err := os.WriteFile(filepath.Join(o.Root, "VERSION"), []byte("go1.20\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	write(t, filepath.Join(o.Root, "src"), "internal/old.go")
+	staged := filepath.Join(o.Root, ".gdoc/staging/stdlib/go1.21.5")
+	write(t, staged, "src/internal/new.go")
+
+	if err := place(o, staged, manifest{}, "go1.21.5"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(o.Root, "src/internal/new.go")); err != nil {
+		t.Errorf("expected the bundled release to be replaced, got %v", err)
+	}
+}
+
+func TestPlaceRestoresPreviousRelease(t *testing.T) {
+	o := options(t)
+	write(t, filepath.Join(o.Root, "src"), "fmt/old.go", "old/old.go")
+	staged := filepath.Join(o.Root, ".gdoc/staging/stdlib/go1.21.5")
+	write(t, staged, "src/fmt/new.go", "src/net/new.go")
+
+	// The manifest can not be written over a directory.
+	if err := os.MkdirAll(filepath.Join(o.Root, filepath.FromSlash(manifestFile)), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := manifest{Version: "go1.20", Dirs: []string{"fmt", "old"}}
+	if err := place(o, staged, previous, "go1.21.5"); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	for _, f := range []string{"fmt/old.go", "old/old.go"} {
+		if _, err := os.Stat(filepath.Join(o.Root, "src", f)); err != nil {
+			t.Errorf("expected src/%s to be restored, got %v", f, err)
+		}
+	}
+	for _, f := range []string{"fmt/new.go", "net"} {
+		if _, err := os.Stat(filepath.Join(o.Root, "src", f)); !os.IsNotExist(err) {
+			t.Errorf("expected src/%s to be left out, got %v", f, err)
+		}
+	}
+}
@@ -8,7 +8,7 @@
 // "License"); you may not use this file except in compliance
 // with the License.  You may obtain a copy of the License at
 //
-//   http://www.apache.org/licenses/LICENSE-2.0
+//	http://www.apache.org/licenses/LICENSE-2.0
 //
 // Unless required by applicable law or agreed to in writing,
 // software distributed under the License is distributed on an
@@ -20,44 +20,549 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"sync"
 	"syscall"
 
+	"github.com/ctxswitch/gdoc/internal/api"
+	"github.com/ctxswitch/gdoc/internal/backup"
 	"github.com/ctxswitch/gdoc/internal/config"
-	"github.com/ctxswitch/gdoc/internal/godoc"
+	"github.com/ctxswitch/gdoc/internal/local"
 	"github.com/ctxswitch/gdoc/internal/logger"
-	"github.com/ctxswitch/gdoc/internal/syncer"
+	"github.com/ctxswitch/gdoc/internal/modules"
+	"github.com/ctxswitch/gdoc/internal/notify"
+	"github.com/ctxswitch/gdoc/internal/report"
+	"github.com/ctxswitch/gdoc/internal/search"
+	"github.com/ctxswitch/gdoc/internal/server"
+	"github.com/ctxswitch/gdoc/internal/stdlib"
+	"github.com/ctxswitch/gdoc/pkg/docserver"
+	"github.com/ctxswitch/gdoc/pkg/plugins"
+	"github.com/ctxswitch/gdoc/pkg/syncer"
 	"go.uber.org/zap"
 )
 
+// Version and Build are set at build time through the linker flags.
+var (
+	Version = "dev"
+	Build   = ""
+)
+
+// userAgent returns the User-Agent that identifies the instance on Github
+// API and git requests.
+func userAgent(instance string) string {
+	ua := "gdoc/" + Version
+	if instance != "" {
+		ua += " (" + instance + ")"
+	}
+	return ua
+}
+
+// repoBranches splits the "|" separated branches of each repository.
+func repoBranches(m map[string]string) map[string][]string {
+	out := make(map[string][]string, len(m))
+	for repo, branches := range m {
+		out[repo] = strings.Split(branches, "|")
+	}
+	return out
+}
+
+// syncLock returns the lock shared with the other instances that
+// synchronize the same storage, or nil if none is configured.
+func syncLock(cfg *config.Config, logger *zap.Logger) (syncer.Locker, error) {
+	switch strings.ToLower(cfg.SyncLock) {
+	case "file":
+		path := cfg.SyncLockPath
+		if path == "" {
+			path = filepath.Join(cfg.GodocRoot, ".gdoc", "sync.lock")
+		}
+		return syncer.NewFileLock(path), nil
+	case "redis":
+		return syncer.NewRedisLock(syncer.RedisLockOptions{
+			URL:    cfg.SyncLockRedisURL,
+			Key:    cfg.SyncLockKey,
+			TTL:    cfg.SyncLockTTL,
+			Logger: logger,
+		})
+	}
+	return nil, nil
+}
+
 func main() {
 	cfg := config.New()
+
+	if len(os.Args) > 1 {
+		if err := command(cfg, os.Args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	logger := logger.New(cfg.LogLevel)
 
-	logger.Debug("Using configuration", zap.Any("config", cfg))
+	logger.Info("starting gdoc", zap.String("version", Version), zap.String("build", Build), zap.String("instance", cfg.InstanceName))
+	logger.Debug("Using configuration", zap.Any("config", cfg.Settings()))
+	for _, w := range cfg.Warnings {
+		logger.Warn("configuration problem", zap.String("warning", w))
+	}
 
 	var wg sync.WaitGroup
 
-	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
+	var hooks []syncer.Hook
+	if cfg.HooksFile != "" {
+		var err error
+		if hooks, err = syncer.LoadHooks(cfg.HooksFile); err != nil {
+			logger.Fatal("unable to load hooks", zap.Error(err))
+		}
+	}
+
+	var gitHeaders map[string]http.Header
+	if cfg.GitHeadersFile != "" {
+		var err error
+		if gitHeaders, err = syncer.LoadGitHeaders(cfg.GitHeadersFile); err != nil {
+			logger.Fatal("unable to load git headers", zap.Error(err))
+		}
+	}
+
+	var gitCookies http.CookieJar
+	if cfg.GitCookieFile != "" {
+		var err error
+		if gitCookies, err = syncer.LoadGitCookies(cfg.GitCookieFile); err != nil {
+			logger.Fatal("unable to load git cookies", zap.Error(err))
+		}
+	}
+
+	registry, err := plugins.Load(cfg.Plugins, logger)
+	if err != nil {
+		logger.Fatal("unable to load plugins", zap.Error(err))
+	}
+
+	for subject, role := range cfg.APIRoles {
+		if !api.ValidRole(role) {
+			logger.Fatal("invalid api role", zap.String("subject", subject), zap.String("role", role))
+		}
+	}
+	if cfg.APIClientCA != "" && cfg.APITLSCert == "" {
+		logger.Fatal("API_CLIENT_CA requires API_TLS_CERT and API_TLS_KEY")
+	}
+	if len(cfg.APIRoles) > 0 && len(registry.Authenticators()) == 0 && cfg.APIClientCA == "" {
+		logger.Warn("api roles only apply to callers identified by an authenticator or a client certificate, but neither is configured")
+	}
+
+	var syncPolicy, quarantinePolicy *syncer.Policy
+	if cfg.SyncPolicy != "" {
+		if syncPolicy, err = syncer.ParsePolicy(cfg.SyncPolicy); err != nil {
+			logger.Fatal("invalid sync policy", zap.Error(err))
+		}
+	}
+	if cfg.QuarantinePolicy != "" {
+		if quarantinePolicy, err = syncer.ParsePolicy(cfg.QuarantinePolicy); err != nil {
+			logger.Fatal("invalid quarantine policy", zap.Error(err))
+		}
+	}
+
+	lock, err := syncLock(cfg, logger)
+	if err != nil {
+		logger.Fatal("invalid sync lock", zap.Error(err))
+	}
+
+	if cfg.RestoreOnStart && cfg.BackupDir != "" {
+		name, err := backup.Restore(cfg.GodocRoot, cfg.BackupDir)
+		if err != nil {
+			logger.Fatal("unable to restore the workspace", zap.Error(err))
+		}
+		if name != "" {
+			logger.Info("workspace restored", zap.String("file", name))
+		}
+	}
+
 	gsync := syncer.New(ctx, syncer.SyncerOptions{
-		GithubToken:        cfg.GithubToken,
-		GithubTokenUser:    cfg.GithubTokenUser,
-		GithubUser:         cfg.GithubUser,
-		GithubTopic:        cfg.GithubTopic,
-		GithubPollInterval: cfg.GithubPollInterval,
-		GodocRoot:          cfg.GodocRoot,
-		Logger:             logger,
+		GithubToken:            cfg.GithubToken,
+		GithubTokenUser:        cfg.GithubTokenUser,
+		GithubUser:             cfg.GithubUser,
+		GithubTopic:            cfg.GithubTopic,
+		GithubDiscovery:        cfg.GithubDiscovery,
+		GithubSearchQuery:      cfg.GithubSearchQuery,
+		GithubTrace:            cfg.GithubTrace,
+		GithubBreakerThreshold: cfg.GithubBreakerThreshold,
+		GithubBreakerCooldown:  cfg.GithubBreakerCooldown,
+		GithubPollInterval:     cfg.GithubPollInterval,
+		SyncMode:               cfg.SyncMode,
+		AtomicUpdates:          cfg.AtomicUpdates,
+		StagingDir:             cfg.StagingDir,
+		Lazy:                   cfg.LazySync,
+		Offline:                cfg.Offline,
+		Branches:               cfg.Branches,
+		RepoBranches:           repoBranches(cfg.RepoBranches),
+		SeedDir:                cfg.SeedDir,
+		SeedMode:               cfg.SeedMode,
+		SyncPolicy:             syncPolicy,
+		QuarantinePolicy:       quarantinePolicy,
+		CloneTimeout:           cfg.CloneTimeout,
+		PullTimeout:            cfg.PullTimeout,
+		APITimeout:             cfg.APITimeout,
+		GodocRoot:              cfg.GodocRoot,
+		PathTemplate:           cfg.PathTemplate,
+		UserAgent:              userAgent(cfg.InstanceName),
+		GitHeaders:             gitHeaders,
+		GitCookies:             gitCookies,
+		GitNoTags:              cfg.GitNoTags,
+		GitSingleBranch:        cfg.GitSingleBranch,
+		GitObjectCacheSize:     cfg.GitObjectCacheSize << 20,
+		StatePath:              cfg.StatePath,
+		HistorySize:            cfg.HistorySize,
+		RetryBackoff:           cfg.RetryBackoff,
+		RetryMaxBackoff:        cfg.RetryMaxBackoff,
+		DeadLetterAfter:        cfg.DeadLetterAfter,
+		Hooks:                  hooks,
+		HookEnvAllow:           cfg.HookEnvAllow,
+		Provider:               registry.Provider(),
+		Lock:                   lock,
+		Logger:                 logger,
 	})
 
-	godoc := godoc.New(godoc.GodocOptions{
-		GodocRoot:          cfg.GodocRoot,
-		GodocPort:          cfg.GodocPort,
-		GodocIndexInterval: cfg.GodocIndexInterval,
-		Logger:             logger,
+	if cfg.StdlibVersion != "" {
+		installed, err := stdlib.Install(ctx, stdlib.Options{
+			Root:    cfg.GodocRoot,
+			Version: cfg.StdlibVersion,
+			URL:     cfg.StdlibDownloadURL,
+			Timeout: cfg.CloneTimeout,
+			Offline: cfg.Offline,
+			Locks:   gsync.Locks(),
+			Logger:  logger,
+		})
+		if err != nil {
+			logger.Error("unable to install the standard library", zap.String("version", cfg.StdlibVersion), zap.Error(err))
+		} else if installed {
+			logger.Info("standard library installed", zap.String("version", stdlib.Normalize(cfg.StdlibVersion)))
+		}
+	}
+
+	var stdlibReleases []docserver.StdlibRelease
+	roots := stdlib.Releases(ctx, stdlib.Options{
+		Root:    cfg.GodocRoot,
+		URL:     cfg.StdlibDownloadURL,
+		Timeout: cfg.CloneTimeout,
+		Offline: cfg.Offline,
+		Locks:   gsync.Locks(),
+		Logger:  logger,
+	}, cfg.StdlibVersions)
+	for _, v := range cfg.StdlibVersions {
+		if root, ok := roots[stdlib.Normalize(v)]; ok {
+			stdlibReleases = append(stdlibReleases, docserver.StdlibRelease{Version: stdlib.Normalize(v), Root: root})
+		}
+	}
+
+	var fetcher docserver.RepositoryFetcher
+	if cfg.LazySync {
+		fetcher = gsync
+	}
+
+	limits := docserver.Limits{
+		MaxProcs:  cfg.GodocMaxProcs,
+		GCPercent: cfg.GodocGCPercent,
+		Memory:    cfg.GodocMemoryLimit << 20,
+		CPU:       cfg.GodocCPULimit,
+		Cgroup:    cfg.GodocCgroup,
+	}
+
+	var inheritEnv []string
+	if !cfg.GodocInheritEnv {
+		inheritEnv = append([]string{}, cfg.GodocEnvAllow...)
+	}
+
+	headers := docserver.SecurityHeaders{
+		ContentSecurityPolicy:   cfg.ContentSecurityPolicy,
+		FrameOptions:            cfg.FrameOptions,
+		StrictTransportSecurity: cfg.HSTS,
+		ReferrerPolicy:          cfg.ReferrerPolicy,
+	}
+
+	docs, err := docserver.NewBackend(cfg.DocBackend, docserver.GodocOptions{
+		GodocRoot:            cfg.GodocRoot,
+		GodocPort:            cfg.GodocPort,
+		BindAddress:          cfg.BindAddress,
+		AddressFamily:        cfg.AddressFamily,
+		GodocIndexInterval:   cfg.GodocIndexInterval,
+		OverrideDir:          cfg.WebOverrideDir,
+		DefaultLocale:        cfg.DefaultLocale,
+		ExcludeDirs:          cfg.ExcludeDirs,
+		ExcludeGenerated:     cfg.ExcludeGenerated,
+		NotesPattern:         cfg.NotesPattern,
+		MermaidURL:           cfg.MermaidURL,
+		PlantUMLServer:       cfg.PlantUMLServer,
+		MaxAssetSize:         cfg.AssetMaxSize << 20,
+		Headers:              headers,
+		NoIndexRepos:         cfg.NoIndexRepos,
+		Internal:             cfg.InternalPackages,
+		InternalRepos:        cfg.InternalPackagesRepos,
+		ShutdownTimeout:      cfg.ShutdownTimeout,
+		Timeouts:             docserver.Timeouts{Read: cfg.HTTPReadTimeout, Write: cfg.DocsWriteTimeout, Idle: cfg.HTTPIdleTimeout},
+		SlowRequestThreshold: cfg.SlowRequestThreshold,
+		Socket:               cfg.GodocSocket,
+		Limits:               limits,
+		Env:                  cfg.GodocEnv,
+		InheritEnv:           inheritEnv,
+		StdlibVersion:        stdlib.Version(cfg.GodocRoot),
+		StdlibReleases:       stdlibReleases,
+		Repositories:         gsync,
+		Workspace:            gsync.Locks(),
+		Fetcher:              fetcher,
+		Logger:               logger,
 	})
+	if err != nil {
+		logger.Fatal("unable to create the documentation backend", zap.Error(err))
+	}
+
+	var vulns *report.VulnScanner
+	if cfg.VulnScan {
+		vulns = report.NewVulnScanner(report.VulnScannerOptions{
+			URL:     cfg.OSVURL,
+			Timeout: cfg.APITimeout,
+			Syncer:  gsync,
+			Logger:  logger,
+		})
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer cancel()
+			logger.Info("starting the vulnerability scanner")
+			err := vulns.Start(ctx)
+			logger.Error("vulnerability scanner exited", zap.Error(err))
+		}()
+	}
+
+	var deps *report.DependencyChecker
+	if cfg.DependencyCheck {
+		deps = report.NewDependencyChecker(report.DependencyCheckerOptions{
+			URL:     cfg.GoProxyURL,
+			Timeout: cfg.APITimeout,
+			Syncer:  gsync,
+			Logger:  logger,
+		})
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer cancel()
+			logger.Info("starting the dependency checker")
+			err := deps.Start(ctx)
+			logger.Error("dependency checker exited", zap.Error(err))
+		}()
+	}
+
+	var index *search.Index
+	if cfg.SearchEmbeddingsURL != "" {
+		index = search.NewIndex(search.IndexOptions{
+			URL:            cfg.SearchEmbeddingsURL,
+			Model:          cfg.SearchEmbeddingsModel,
+			Token:          cfg.SearchEmbeddingsToken,
+			Timeout:        cfg.APITimeout,
+			SemanticWeight: cfg.SearchSemanticWeight,
+			Path:           filepath.Join(cfg.GodocRoot, ".gdoc", "embeddings.json"),
+			Syncer:         gsync,
+			Exclude:        cfg.NoIndexRepos,
+			Logger:         logger,
+		})
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer cancel()
+			logger.Info("starting the search index")
+			err := index.Start(ctx)
+			logger.Error("search index exited", zap.Error(err))
+		}()
+	}
+
+	var routes []notify.Route
+	if cfg.TeamsWebhookURL != "" {
+		severity, err := notify.ParseSeverity(cfg.TeamsSeverity)
+		if err != nil {
+			logger.Fatal("invalid teams severity", zap.Error(err))
+		}
+		routes = append(routes, notify.Route{Sink: &notify.Teams{URL: cfg.TeamsWebhookURL}, Severity: severity})
+	}
+	if cfg.PagerDutyRoutingKey != "" {
+		severity, err := notify.ParseSeverity(cfg.PagerDutySeverity)
+		if err != nil {
+			logger.Fatal("invalid pagerduty severity", zap.Error(err))
+		}
+		routes = append(routes, notify.Route{Sink: &notify.PagerDuty{URL: cfg.PagerDutyURL, RoutingKey: cfg.PagerDutyRoutingKey}, Severity: severity})
+	}
+
+	if notifiers := registry.Notifiers(); len(notifiers) > 0 {
+		severity, err := notify.ParseSeverity(cfg.PluginSeverity)
+		if err != nil {
+			logger.Fatal("invalid plugin severity", zap.Error(err))
+		}
+		for _, n := range notifiers {
+			routes = append(routes, notify.Route{Sink: &notify.Plugin{Notifier: n}, Severity: severity})
+		}
+	}
+
+	var notifier *notify.Notifier
+	if len(routes) > 0 {
+		notifier = notify.New(notify.NotifierOptions{
+			Routes:  routes,
+			Timeout: cfg.APITimeout,
+			Syncer:  gsync,
+			Logger:  logger,
+		})
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer cancel()
+			logger.Info("starting the notifier")
+			err := notifier.Start(ctx)
+			logger.Error("notifier exited", zap.Error(err))
+		}()
+	}
+
+	if cfg.DigestSMTPAddr != "" {
+		digest := notify.NewDigest(notify.DigestOptions{
+			SMTPAddr:     cfg.DigestSMTPAddr,
+			SMTPUser:     cfg.DigestSMTPUser,
+			SMTPPassword: cfg.DigestSMTPPassword,
+			From:         cfg.DigestFrom,
+			To:           cfg.DigestTo,
+			Interval:     cfg.DigestInterval,
+			Syncer:       gsync,
+			Logger:       logger,
+		})
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer cancel()
+			logger.Info("starting the email digest")
+			err := digest.Start(ctx)
+			logger.Error("email digest exited", zap.Error(err))
+		}()
+	}
+
+	if len(cfg.LocalSources) > 0 {
+		watcher := local.New(local.WatcherOptions{
+			Root:     cfg.GodocRoot,
+			Sources:  cfg.LocalSources,
+			Interval: cfg.LocalPollInterval,
+			Locks:    gsync.Locks(),
+			Logger:   logger,
+		})
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer cancel()
+			logger.Info("starting the local source watcher")
+			err := watcher.Start(ctx)
+			logger.Error("local source watcher exited", zap.Error(err))
+		}()
+	}
+
+	if len(cfg.ProxyModules) > 0 {
+		proxy := modules.NewProxy(modules.ProxyOptions{
+			Root:     cfg.GodocRoot,
+			URL:      cfg.GoProxyURL,
+			Modules:  cfg.ProxyModules,
+			Interval: cfg.ProxyInterval,
+			Timeout:  cfg.CloneTimeout,
+			Locks:    gsync.Locks(),
+			Logger:   logger,
+		})
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer cancel()
+			logger.Info("starting the module proxy source")
+			err := proxy.Start(ctx)
+			logger.Error("module proxy source exited", zap.Error(err))
+		}()
+	}
+
+	if cfg.BackupDir != "" {
+		backups := backup.New(backup.BackupOptions{
+			Root:     cfg.GodocRoot,
+			Dir:      cfg.BackupDir,
+			Interval: cfg.BackupInterval,
+			Keep:     cfg.BackupKeep,
+			Syncer:   gsync,
+			Logger:   logger,
+		})
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer cancel()
+			logger.Info("starting the backup service")
+			err := backups.Start(ctx)
+			logger.Error("backup service exited", zap.Error(err))
+		}()
+	}
+
+	api := api.New(api.APIOptions{
+		APIPort:              cfg.APIPort,
+		BindAddress:          cfg.BindAddress,
+		AddressFamily:        cfg.AddressFamily,
+		AllowedLicenses:      cfg.AllowedLicenses,
+		MinimumGoVersion:     cfg.MinimumGoVersion,
+		ShutdownTimeout:      cfg.ShutdownTimeout,
+		APISocket:            cfg.APISocket,
+		TLSCert:              cfg.APITLSCert,
+		TLSKey:               cfg.APITLSKey,
+		ClientCA:             cfg.APIClientCA,
+		MaxBodySize:          cfg.APIMaxBodySize << 10,
+		Timeouts:             server.Timeouts{Read: cfg.HTTPReadTimeout, Idle: cfg.HTTPIdleTimeout},
+		SlowRequestThreshold: cfg.SlowRequestThreshold,
+		Headers:              headers,
+		InstanceName:         cfg.InstanceName,
+		Version:              Version,
+		Peers:                cfg.ClusterPeers,
+		NotesPattern:         cfg.NotesPattern,
+		NoIndexRepos:         cfg.NoIndexRepos,
+		SlackSigningSecret:   cfg.SlackSigningSecret,
+		GodocRoot:            cfg.GodocRoot,
+		ModuleUploads:        cfg.ModuleUploads,
+		Authenticators:       registry.Authenticators(),
+		Roles:                cfg.APIRoles,
+		AllowAnonymous:       cfg.APIAllowAnonymous,
+		CookieSameSite:       cfg.CookieSameSite,
+		CookieSecure:         cfg.CookieSecure,
+		Config:               cfg,
+		Syncer:               gsync,
+		Vulns:                vulns,
+		Dependencies:         deps,
+		Search:               index,
+		Logger:               logger,
+	})
+
+	if processors := registry.Processors(); len(processors) > 0 {
+		dispatcher := plugins.NewDispatcher(plugins.DispatcherOptions{
+			Processors: processors,
+			Bus:        gsync.Bus(),
+			Logger:     logger,
+		})
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer cancel()
+			logger.Info("starting the plugin processors")
+			err := dispatcher.Start(ctx)
+			logger.Error("plugin processors exited", zap.Error(err))
+		}()
+	}
 
 	wg.Add(1)
 	go func() {
@@ -72,10 +577,42 @@ func main() {
 	go func() {
 		defer wg.Done()
 		defer cancel()
-		logger.Info("starting the godoc service")
-		err := godoc.Start(ctx)
-		logger.Error("godoc exited", zap.Error(err))
+		logger.Info("starting the documentation service", zap.String("backend", cfg.DocBackend))
+		err := docs.Start(ctx)
+		logger.Error("documentation service exited", zap.Error(err))
+		if notifier != nil && ctx.Err() == nil {
+			notifier.Notify(context.Background(), notify.Event{
+				Severity: notify.SeverityCritical,
+				Key:      "gdoc/docs",
+				Summary:  "the documentation service exited",
+				Details:  map[string]string{"error": fmt.Sprint(err), "instance": cfg.InstanceName},
+			})
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer cancel()
+		logger.Info("starting the management api service")
+		err := api.Start(ctx)
+		logger.Error("management api exited", zap.Error(err))
 	}()
 
+	if err := server.Notify("READY=1"); err != nil {
+		logger.Warn("unable to notify systemd", zap.Error(err))
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := server.Watchdog(ctx); err != nil {
+			logger.Warn("unable to ping the systemd watchdog", zap.Error(err))
+		}
+	}()
+
+	<-ctx.Done()
+	_ = server.Notify("STOPPING=1")
+
 	wg.Wait()
 }
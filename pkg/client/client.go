@@ -0,0 +1,487 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+// Package client is a Go client for the gdoc management API.  The
+// endpoints and types follow the OpenAPI specification served by gdoc at
+// /api/openapi.json.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ctxswitch/gdoc/internal/server"
+	"github.com/ctxswitch/gdoc/pkg/docserver"
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+)
+
+// ClientOptions defines the options available for creating a client.
+type ClientOptions struct {
+	// The address of the management API, such as http://localhost:6061.
+	BaseURL string
+	// The HTTP client used for requests.  Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// The API token sent with every request.  Optional.
+	Token string
+	// The PEM encoded certificate and private key presented to a
+	// management API that requires client certificates.  Ignored when
+	// HTTPClient is set.  Optional.
+	CertFile string
+	KeyFile  string
+	// The PEM encoded CA certificates that the certificate of the
+	// management API is verified with instead of the system roots.
+	// Ignored when HTTPClient is set.  Optional.
+	CAFile string
+}
+
+// Client calls the gdoc management API.
+type Client struct {
+	// The ClientOptions that was passed into New.
+	options ClientOptions
+	// The parsed BaseURL.
+	base *url.URL
+}
+
+// Error is returned when the API responds with an unexpected status.
+type Error struct {
+	StatusCode int
+	// The body of the response.
+	Message string
+}
+
+// Error returns the status and message of the response.
+func (e *Error) Error() string {
+	return fmt.Sprintf("gdoc: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Status is the status of the services.
+type Status struct {
+	// The summary of the last completed sync cycle.
+	Sync syncer.Summary `json:"sync"`
+	// Whether Github accepts the configured credentials.
+	Credentials syncer.Credentials `json:"credentials"`
+	// The time that the next sync cycle is scheduled for.
+	NextSync *time.Time `json:"next_sync,omitempty"`
+	// Whether the repositories on disk are served without synchronizing.
+	Offline bool `json:"offline,omitempty"`
+}
+
+// Health is the health of the service.
+type Health struct {
+	// Either "ok" or "degraded".
+	Status string `json:"status"`
+	// The problems that degrade the service.
+	Problems []string `json:"problems,omitempty"`
+}
+
+// PackageResult is a package returned from a package search.
+type PackageResult struct {
+	Owner      string `json:"owner"`
+	Name       string `json:"name"`
+	ImportPath string `json:"import_path"`
+	Synopsis   string `json:"synopsis"`
+}
+
+// SearchResult is a documentation chunk returned from a semantic search.
+type SearchResult struct {
+	ImportPath string  `json:"import_path"`
+	Symbol     string  `json:"symbol,omitempty"`
+	Kind       string  `json:"kind"`
+	Signature  string  `json:"signature,omitempty"`
+	Synopsis   string  `json:"synopsis"`
+	Score      float64 `json:"score"`
+}
+
+// Owners are the code owners of a path in a repository.
+type Owners struct {
+	Repo   string   `json:"repo"`
+	Path   string   `json:"path"`
+	Owners []string `json:"owners"`
+}
+
+// Instance describes a single gdoc instance of a cluster.
+type Instance struct {
+	Name         string    `json:"name"`
+	Address      string    `json:"address,omitempty"`
+	Version      string    `json:"version"`
+	Repositories int       `json:"repositories"`
+	LastSync     time.Time `json:"last_sync"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// Cluster is the status of every instance of a cluster.
+type Cluster struct {
+	Instances []Instance `json:"instances"`
+}
+
+// InventoryModule is a Go module found in a synchronized repository.
+type InventoryModule struct {
+	Module       string   `json:"module"`
+	Owner        string   `json:"owner"`
+	Name         string   `json:"name"`
+	Repository   string   `json:"repository"`
+	Commit       string   `json:"commit"`
+	Subdirectory string   `json:"subdirectory,omitempty"`
+	GoVersion    string   `json:"go_version,omitempty"`
+	Packages     []string `json:"packages"`
+}
+
+// InventoryPage is a page of the module inventory.
+type InventoryPage struct {
+	Modules  []InventoryModule `json:"modules"`
+	Total    int               `json:"total"`
+	Page     int               `json:"page"`
+	PerPage  int               `json:"per_page"`
+	NextPage int               `json:"next_page"`
+}
+
+// Module is a module version that has been extracted into the workspace.
+type Module struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	Dir     string `json:"dir"`
+}
+
+// Setting is the effective value of a single configuration variable.
+type Setting struct {
+	Name    string      `json:"name"`
+	Value   interface{} `json:"value"`
+	Default string      `json:"default"`
+	Source  string      `json:"source"`
+	Secret  bool        `json:"secret,omitempty"`
+}
+
+// CreatedToken is a newly created API token along with its value, which
+// can not be retrieved again.
+type CreatedToken struct {
+	syncer.Token
+	Value string `json:"token"`
+}
+
+// Configuration is the effective configuration of an instance.
+type Configuration struct {
+	Settings []Setting `json:"settings"`
+	Warnings []string  `json:"warnings"`
+}
+
+// New returns an initialized Client struct.
+func New(o ClientOptions) (*Client, error) {
+	base, err := url.Parse(strings.TrimSuffix(o.BaseURL, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if o.HTTPClient == nil && (o.CertFile != "" || o.CAFile != "") {
+		c, err := server.ClientTLSConfig(o.CertFile, o.KeyFile, o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = c
+		o.HTTPClient = &http.Client{Transport: transport}
+	}
+	if o.HTTPClient == nil {
+		o.HTTPClient = http.DefaultClient
+	}
+
+	return &Client{options: o, base: base}, nil
+}
+
+// Status returns the summary of the last completed sync cycle.
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	var s Status
+	return &s, c.get(ctx, "/api/status", nil, &s)
+}
+
+// Health returns whether the service is healthy.  A degraded service is
+// returned without an error.
+func (c *Client) Health(ctx context.Context) (*Health, error) {
+	var h Health
+	err := c.get(ctx, "/api/health", nil, &h)
+
+	var e *Error
+	if errors.As(err, &e) && e.StatusCode == http.StatusServiceUnavailable {
+		return &h, json.Unmarshal([]byte(e.Message), &h)
+	}
+	return &h, err
+}
+
+// Repos returns the synchronized repositories.
+func (c *Client) Repos(ctx context.Context) ([]syncer.Repo, error) {
+	var repos []syncer.Repo
+	return repos, c.get(ctx, "/api/repos", nil, &repos)
+}
+
+// RepoHistory returns the timeline of a repository, newest first.
+func (c *Client) RepoHistory(ctx context.Context, owner, name string) ([]syncer.Event, error) {
+	var events []syncer.Event
+	return events, c.get(ctx, repoPath(owner, name, "history"), nil, &events)
+}
+
+// Resync pulls the latest commit of a repository right away.
+func (c *Client) Resync(ctx context.Context, owner, name string) error {
+	return c.post(ctx, repoPath(owner, name, "resync"), nil)
+}
+
+// Reclone removes the local copy of a repository and clones it again.
+func (c *Client) Reclone(ctx context.Context, owner, name string) error {
+	return c.post(ctx, repoPath(owner, name, "reclone"), nil)
+}
+
+// Pause stops syncing a repository until it is resumed.
+func (c *Client) Pause(ctx context.Context, owner, name, reason string) error {
+	var q url.Values
+	if reason != "" {
+		q = url.Values{"reason": {reason}}
+	}
+	return c.post(ctx, repoPath(owner, name, "pause"), q)
+}
+
+// Resume resumes syncing a paused repository.
+func (c *Client) Resume(ctx context.Context, owner, name string) error {
+	return c.post(ctx, repoPath(owner, name, "resume"), nil)
+}
+
+// History returns the recorded sync cycles, newest first.
+func (c *Client) History(ctx context.Context) ([]syncer.Cycle, error) {
+	var cycles []syncer.Cycle
+	return cycles, c.get(ctx, "/api/history", nil, &cycles)
+}
+
+// Failures returns the repositories that are failing.
+func (c *Client) Failures(ctx context.Context) ([]syncer.Failure, error) {
+	var failures []syncer.Failure
+	return failures, c.get(ctx, "/api/failures", nil, &failures)
+}
+
+// Paused returns the paused repositories.
+func (c *Client) Paused(ctx context.Context) ([]syncer.Pause, error) {
+	var paused []syncer.Pause
+	return paused, c.get(ctx, "/api/paused", nil, &paused)
+}
+
+// SearchRepos returns the repositories matching every term of the query.
+func (c *Client) SearchRepos(ctx context.Context, query string) ([]syncer.Repo, error) {
+	var repos []syncer.Repo
+	return repos, c.get(ctx, "/api/search", url.Values{"q": {query}}, &repos)
+}
+
+// SearchDocs returns the documentation that best matches the query.  It
+// fails with a 404 error when semantic search is disabled.
+func (c *Client) SearchDocs(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	q := url.Values{"q": {query}}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+
+	var results []SearchResult
+	return results, c.get(ctx, "/api/search/docs", q, &results)
+}
+
+// SearchPackages returns the packages whose import path contains every term
+// of the query.
+func (c *Client) SearchPackages(ctx context.Context, query string) ([]PackageResult, error) {
+	var results []PackageResult
+	return results, c.get(ctx, "/api/docs", url.Values{"q": {query}}, &results)
+}
+
+// Package returns the documentation of a package.
+func (c *Client) Package(ctx context.Context, importPath string) (*docserver.PackageDoc, error) {
+	var pd docserver.PackageDoc
+	return &pd, c.get(ctx, "/api/docs/"+importPath, nil, &pd)
+}
+
+// Symbol returns the documentation of a single declaration of a package.
+// Methods are named Type.Method.
+func (c *Client) Symbol(ctx context.Context, importPath, symbol string) (*docserver.Symbol, error) {
+	var s docserver.Symbol
+	return &s, c.get(ctx, "/api/docs/"+importPath, url.Values{"symbol": {symbol}}, &s)
+}
+
+// Owners returns the code owners of a path in the repository given as
+// owner/name.
+func (c *Client) Owners(ctx context.Context, repo, path string) (*Owners, error) {
+	var o Owners
+	return &o, c.get(ctx, "/api/owners", url.Values{"repo": {repo}, "path": {path}}, &o)
+}
+
+// Inventory returns a page of the module inventory.  Pages start at 1 and
+// a size of zero uses the default size of the API.
+func (c *Client) Inventory(ctx context.Context, page, perPage int) (*InventoryPage, error) {
+	q := url.Values{"page": {strconv.Itoa(page)}}
+	if perPage > 0 {
+		q.Set("per_page", strconv.Itoa(perPage))
+	}
+
+	var p InventoryPage
+	return &p, c.get(ctx, "/api/inventory", q, &p)
+}
+
+// UploadModule posts a module zip to be extracted into the workspace.
+func (c *Client) UploadModule(ctx context.Context, zip io.Reader) (*Module, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/api/modules", nil, zip)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var m Module
+	return &m, json.NewDecoder(resp.Body).Decode(&m)
+}
+
+// Download returns an archive of the repository at the ref, which is the
+// default branch, one of the additional branches or a commit.  The format
+// is either "zip" for a module zip or "tar.gz" for a tarball.  The caller
+// closes the archive.
+func (c *Client) Download(ctx context.Context, owner, name, ref, format string) (io.ReadCloser, error) {
+	p := "/download/" + url.PathEscape(owner) + "/" + url.PathEscape(name) + "@" + url.PathEscape(ref) + "." + format
+	resp, err := c.do(ctx, http.MethodGet, p, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Cluster returns the status of the instance and each of its peers.
+func (c *Client) Cluster(ctx context.Context) (*Cluster, error) {
+	var cl Cluster
+	return &cl, c.get(ctx, "/api/cluster", nil, &cl)
+}
+
+// Config returns the effective configuration of the instance with its
+// secrets redacted.
+func (c *Client) Config(ctx context.Context) (*Configuration, error) {
+	var cfg Configuration
+	return &cfg, c.get(ctx, "/api/config", nil, &cfg)
+}
+
+// GithubTrace returns true if the calls made to the Github API are being
+// logged.
+func (c *Client) GithubTrace(ctx context.Context) (bool, error) {
+	var t struct {
+		Enabled bool `json:"enabled"`
+	}
+	err := c.get(ctx, "/api/trace/github", nil, &t)
+	return t.Enabled, err
+}
+
+// SetGithubTrace enables or disables logging the calls made to the Github
+// API.
+func (c *Client) SetGithubTrace(ctx context.Context, enabled bool) error {
+	return c.post(ctx, "/api/trace/github", url.Values{"enabled": {strconv.FormatBool(enabled)}})
+}
+
+// Tokens returns the API tokens without their values.
+func (c *Client) Tokens(ctx context.Context) ([]syncer.Token, error) {
+	var tokens []syncer.Token
+	return tokens, c.get(ctx, "/api/tokens", nil, &tokens)
+}
+
+// CreateToken creates an API token with the viewer, operator or admin
+// role.  A zero ttl creates a token that does not expire.
+func (c *Client) CreateToken(ctx context.Context, name, role string, ttl time.Duration) (*CreatedToken, error) {
+	q := url.Values{"name": {name}, "role": {role}}
+	if ttl > 0 {
+		q.Set("ttl", ttl.String())
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, "/api/tokens", q, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var t CreatedToken
+	return &t, json.NewDecoder(resp.Body).Decode(&t)
+}
+
+// RevokeToken revokes the API token with the id.
+func (c *Client) RevokeToken(ctx context.Context, id string) error {
+	return c.post(ctx, "/api/tokens/"+url.PathEscape(id)+"/revoke", nil)
+}
+
+// Report decodes one of the reports below /api/reports, such as licenses
+// or go-versions, into v.
+func (c *Client) Report(ctx context.Context, name string, v interface{}) error {
+	return c.get(ctx, "/api/reports/"+name, nil, v)
+}
+
+// get requests the path and decodes the json response into v.
+func (c *Client) get(ctx context.Context, path string, q url.Values, v interface{}) error {
+	resp, err := c.do(ctx, http.MethodGet, path, q, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// post posts to the path and discards the response.
+func (c *Client) post(ctx context.Context, path string, q url.Values) error {
+	resp, err := c.do(ctx, http.MethodPost, path, q, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// do sends the request with the optional zip body and returns an Error if
+// the response status is not successful.
+func (c *Client) do(ctx context.Context, method, path string, q url.Values, body io.Reader) (*http.Response, error) {
+	u := *c.base
+	u.Path += path
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.options.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.options.Token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/zip")
+	}
+
+	resp, err := c.options.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+
+	return resp, nil
+}
+
+// repoPath returns the path of an action on a repository.
+func repoPath(owner, name, action string) string {
+	return "/api/repos/" + url.PathEscape(owner) + "/" + url.PathEscape(name) + "/" + action
+}
@@ -0,0 +1,86 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package docserver
+
+import (
+	"net/http"
+
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+)
+
+// HistoryLister returns the recorded sync cycles, newest first.  It is
+// implemented by syncer.Syncer.  When the repository lister also implements
+// it, the html backend shows the sync activity.
+type HistoryLister interface {
+	History() []syncer.Cycle
+}
+
+// FailureLister returns the repositories that are failing.  It is
+// implemented by syncer.Syncer.  When the repository lister also implements
+// it, the activity page shows the repositories that are backing off and the
+// ones on the dead letter list.
+type FailureLister interface {
+	Failures() []syncer.Failure
+}
+
+// activityPage is the data passed to the activity template.
+type activityPage struct {
+	page
+	// The repository the activity is limited to as owner/name.  Empty for
+	// the activity of all repositories.
+	Repo     string
+	Failures []syncer.Failure
+	Events   []syncer.Event
+}
+
+// activity renders the sync events of all repositories, or of a single
+// repository when the repo query parameter is set to owner/name, newest
+// first.
+func (h *HTML) activity(w http.ResponseWriter, r *http.Request) {
+	hl, ok := h.options.Repositories.(HistoryLister)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	data := activityPage{
+		page: h.newPage(r, ""),
+		Repo: r.URL.Query().Get("repo"),
+	}
+	data.Title = h.catalog.translate(data.Locale, "activity")
+
+	if fl, ok := h.options.Repositories.(FailureLister); ok {
+		for _, f := range fl.Failures() {
+			if data.Repo == "" || data.Repo == f.Owner+"/"+f.Name {
+				data.Failures = append(data.Failures, f)
+			}
+		}
+	}
+
+	for _, c := range hl.History() {
+		for i := len(c.Events) - 1; i >= 0; i-- {
+			e := c.Events[i]
+			if data.Repo == "" || data.Repo == e.Owner+"/"+e.Name {
+				data.Events = append(data.Events, e)
+			}
+		}
+	}
+
+	h.render(w, "activity", data)
+}
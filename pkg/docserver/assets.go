@@ -0,0 +1,88 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package docserver
+
+import (
+	"embed"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// embedded contains the templates and static assets that are shipped with
+// the binary.
+//
+//go:embed web
+var embedded embed.FS
+
+// overlayFS serves files from the override directory when they exist and
+// falls back to the embedded assets otherwise.
+type overlayFS struct {
+	override fs.FS
+	base     fs.FS
+}
+
+// Open opens the named file from the override directory or the embedded
+// assets.
+func (o overlayFS) Open(name string) (fs.File, error) {
+	if o.override != nil {
+		if f, err := o.override.Open(name); err == nil {
+			return f, nil
+		}
+	}
+
+	return o.base.Open(name)
+}
+
+// assets returns the web assets.  Files in the override directory take
+// precedence over the embedded files.
+func assets(override string) fs.FS {
+	base, _ := fs.Sub(embedded, "web")
+	if override == "" {
+		return base
+	}
+
+	return overlayFS{
+		override: os.DirFS(override),
+		base:     base,
+	}
+}
+
+// templates parses the embedded templates followed by any templates in the
+// override directory.  Templates in the override directory replace the
+// embedded templates that they redefine.
+func templates(override string, funcs template.FuncMap) (*template.Template, error) {
+	base, _ := fs.Sub(embedded, "web")
+	t, err := template.New("html").Funcs(funcs).ParseFS(base, "templates/*.html")
+	if err != nil {
+		return nil, err
+	}
+
+	if override == "" {
+		return t, nil
+	}
+
+	matches, err := filepath.Glob(filepath.Join(override, "templates", "*.html"))
+	if err != nil || len(matches) == 0 {
+		return t, err
+	}
+
+	return t.ParseFiles(matches...)
+}
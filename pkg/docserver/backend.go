@@ -0,0 +1,56 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package docserver
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	// BackendGodoc serves documentation with the external godoc command.
+	BackendGodoc = "godoc"
+	// BackendPkgsite serves documentation with the external pkgsite
+	// command.
+	BackendPkgsite = "pkgsite"
+	// BackendHTML serves documentation with the built-in renderer and does
+	// not require any external commands.
+	BackendHTML = "html"
+)
+
+// Backend serves the documentation for the synchronized workspace.
+type Backend interface {
+	// Start runs the documentation server until the context is cancelled
+	// or the server fails.
+	Start(ctx context.Context) error
+}
+
+// NewBackend returns an initialized backend for the given name.
+func NewBackend(name string, g GodocOptions) (Backend, error) {
+	switch name {
+	case BackendGodoc, "":
+		return New(g), nil
+	case BackendPkgsite:
+		return NewPkgsite(g), nil
+	case BackendHTML:
+		return NewHTML(g), nil
+	}
+
+	return nil, fmt.Errorf("unknown documentation backend: %s", name)
+}
@@ -0,0 +1,130 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package docserver
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// codeOwnersFiles are the locations that Github reads the CODEOWNERS file
+// from, in order of precedence.
+var codeOwnersFiles = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// codeOwnersRule is a single pattern of a CODEOWNERS file.
+type codeOwnersRule struct {
+	pattern *regexp.Regexp
+	owners  []string
+}
+
+// CodeOwners are the parsed rules of a CODEOWNERS file.
+type CodeOwners []codeOwnersRule
+
+// LoadCodeOwners reads the CODEOWNERS file of the repository checked out in
+// dir.  It returns nil if the repository does not have one.
+func LoadCodeOwners(dir string) (CodeOwners, error) {
+	for _, name := range codeOwnersFiles {
+		f, err := os.Open(filepath.Join(dir, filepath.FromSlash(name)))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		var rules CodeOwners
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if i := strings.Index(line, "#"); i >= 0 {
+				line = line[:i]
+			}
+
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+
+			re, err := regexp.Compile(codeOwnersPattern(fields[0]))
+			if err != nil {
+				continue
+			}
+			rules = append(rules, codeOwnersRule{pattern: re, owners: fields[1:]})
+		}
+
+		return rules, scanner.Err()
+	}
+
+	return nil, nil
+}
+
+// Owners returns the owners of the slash separated path relative to the
+// repository root.  As with Github, the last matching rule wins and a rule
+// without owners leaves the path unowned.
+func (c CodeOwners) Owners(p string) []string {
+	p = strings.Trim(p, "/")
+	for i := len(c) - 1; i >= 0; i-- {
+		if c[i].pattern.MatchString(p) {
+			return c[i].owners
+		}
+	}
+
+	return nil
+}
+
+// codeOwnersPattern converts a CODEOWNERS pattern to a regular expression.
+// Patterns follow the gitignore rules: a pattern is anchored to the root if
+// it starts with or contains a slash and otherwise matches at any depth.  A
+// pattern matching a directory also matches everything below it.
+func codeOwnersPattern(pattern string) string {
+	trimmed := strings.TrimSuffix(pattern, "/")
+	anchored := strings.Contains(trimmed, "/")
+	trimmed = strings.TrimPrefix(trimmed, "/")
+
+	var b strings.Builder
+	if anchored {
+		b.WriteString("^")
+	} else {
+		b.WriteString("^(.*/)?")
+	}
+
+	for i := 0; i < len(trimmed); i++ {
+		switch {
+		case strings.HasPrefix(trimmed[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(trimmed[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case trimmed[i] == '*':
+			b.WriteString("[^/]*")
+		case trimmed[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(trimmed[i : i+1]))
+		}
+	}
+
+	b.WriteString("(/.*)?$")
+	return b.String()
+}
@@ -0,0 +1,190 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package docserver
+
+import (
+	"go/ast"
+	"go/token"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Command is the usage of a command found in the source of a main package.
+// Commands are read statically from cobra.Command literals, the commands
+// are never run.
+type Command struct {
+	// The one line usage, such as "serve [flags]".
+	Use     string `json:"use"`
+	Short   string `json:"short,omitempty"`
+	Long    string `json:"long,omitempty"`
+	Example string `json:"example,omitempty"`
+}
+
+// Flag is a command line flag defined with the flag or pflag packages, or
+// on the flag set of a cobra command.
+type Flag struct {
+	Name      string `json:"name"`
+	Shorthand string `json:"shorthand,omitempty"`
+	// The default value as source code.
+	Default string `json:"default"`
+	Usage   string `json:"usage"`
+}
+
+// Usage is the command line documentation of a main package.
+type Usage struct {
+	Commands []Command `json:"commands,omitempty"`
+	Flags    []Flag    `json:"flags,omitempty"`
+}
+
+// flagFunc matches the names of the functions that define flags.  The Var
+// variants take the destination first and the P variants take a shorthand
+// after the name.
+var flagFunc = regexp.MustCompile(`^(?:Bool|Count|Duration|Float32|Float64|Int|Int8|Int16|Int32|Int64|Uint|Uint8|Uint16|Uint32|Uint64|String|StringArray|StringSlice|StringToString|IntSlice|BoolSlice|DurationSlice)(Var)?(P)?$`)
+
+// commandUsage returns the commands and flags defined in the files of a
+// main package.  Nil is returned if none are found.
+func commandUsage(fset *token.FileSet, files []*ast.File) *Usage {
+	u := &Usage{}
+	for _, f := range files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.CompositeLit:
+				if c, ok := cobraCommand(n); ok {
+					u.Commands = append(u.Commands, c)
+				}
+			case *ast.CallExpr:
+				if fl, ok := flagCall(fset, n); ok {
+					u.Flags = append(u.Flags, fl)
+				}
+			}
+			return true
+		})
+	}
+
+	if len(u.Commands) == 0 && len(u.Flags) == 0 {
+		return nil
+	}
+	return u
+}
+
+// cobraCommand returns the usage of a cobra.Command literal.
+func cobraCommand(lit *ast.CompositeLit) (Command, bool) {
+	sel, ok := lit.Type.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Command" {
+		return Command{}, false
+	}
+	if x, ok := sel.X.(*ast.Ident); !ok || x.Name != "cobra" {
+		return Command{}, false
+	}
+
+	var c Command
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		key, ok := kv.Key.(*ast.Ident)
+		if !ok {
+			continue
+		}
+
+		value, ok := stringLit(kv.Value)
+		if !ok {
+			continue
+		}
+		switch key.Name {
+		case "Use":
+			c.Use = value
+		case "Short":
+			c.Short = value
+		case "Long":
+			c.Long = strings.TrimSpace(value)
+		case "Example":
+			c.Example = strings.Trim(value, "\n")
+		}
+	}
+
+	return c, c.Use != ""
+}
+
+// flagCall returns the flag defined by a call such as flag.String or
+// cmd.Flags().BoolP.
+func flagCall(fset *token.FileSet, call *ast.CallExpr) (Flag, bool) {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return Flag{}, false
+	}
+	m := flagFunc.FindStringSubmatch(sel.Sel.Name)
+	if m == nil || !flagReceiver(sel.X) {
+		return Flag{}, false
+	}
+
+	args := call.Args
+	if m[1] != "" {
+		// Drop the destination of the Var variants.
+		if len(args) == 0 {
+			return Flag{}, false
+		}
+		args = args[1:]
+	}
+
+	var fl Flag
+	if m[2] != "" {
+		if len(args) != 4 {
+			return Flag{}, false
+		}
+		fl.Shorthand, _ = stringLit(args[1])
+		args = append(args[:1:1], args[2:]...)
+	}
+	if len(args) != 3 {
+		return Flag{}, false
+	}
+
+	if fl.Name, ok = stringLit(args[0]); !ok {
+		return Flag{}, false
+	}
+	fl.Default = decl(fset, args[1])
+	fl.Usage, _ = stringLit(args[2])
+
+	return fl, true
+}
+
+// flagReceiver returns true if the expression is the flag or pflag package
+// or the flag set of a cobra command.
+func flagReceiver(x ast.Expr) bool {
+	switch x := x.(type) {
+	case *ast.Ident:
+		return x.Name == "flag" || x.Name == "pflag"
+	case *ast.CallExpr:
+		sel, ok := x.Fun.(*ast.SelectorExpr)
+		return ok && (sel.Sel.Name == "Flags" || sel.Sel.Name == "PersistentFlags" || sel.Sel.Name == "LocalFlags")
+	}
+	return false
+}
+
+// stringLit returns the value of a string literal.
+func stringLit(x ast.Expr) (string, bool) {
+	lit, ok := x.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	s, err := strconv.Unquote(lit.Value)
+	return s, err == nil
+}
@@ -0,0 +1,41 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package docserver
+
+import (
+	"strings"
+)
+
+// deprecatedPrefix starts the paragraph of a doc comment that marks an
+// identifier as deprecated.
+const deprecatedPrefix = "Deprecated: "
+
+// Deprecation returns the deprecation notice of a doc comment, which is the
+// paragraph starting with "Deprecated: ".  It returns an empty string if
+// the identifier is not deprecated.
+func Deprecation(text string) string {
+	for _, para := range strings.Split(text, "\n\n") {
+		para = strings.TrimSpace(para)
+		if strings.HasPrefix(para, deprecatedPrefix) {
+			return strings.Join(strings.Fields(strings.TrimPrefix(para, deprecatedPrefix)), " ")
+		}
+	}
+
+	return ""
+}
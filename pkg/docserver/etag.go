@@ -0,0 +1,59 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package docserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// etag returns a strong entity tag built from the parts that determine the
+// content of a page.  The time the server started is included so that
+// changes to the templates or options take effect after a restart.
+func (h *HTML) etag(parts ...string) string {
+	sum := sha256.New()
+	sum.Write([]byte(h.started.String()))
+	for _, p := range parts {
+		sum.Write([]byte{0})
+		sum.Write([]byte(p))
+	}
+
+	return `"` + hex.EncodeToString(sum.Sum(nil)[:16]) + `"`
+}
+
+// notModified sets the entity tag of the response and returns true after
+// writing a 304 response if the client already has the current version of
+// the page.  The content depends on the negotiated locale, so caches are
+// told to vary on the Accept-Language header.
+func notModified(w http.ResponseWriter, r *http.Request, tag string) bool {
+	w.Header().Set("ETag", tag)
+	w.Header().Add("Vary", "Accept-Language")
+
+	for _, t := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		t = strings.TrimSpace(t)
+		if t == tag || t == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,107 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package docserver
+
+import (
+	"go/ast"
+	"regexp"
+	"strings"
+)
+
+const (
+	// InternalShow documents internal packages.
+	InternalShow = "show"
+	// InternalHide leaves internal packages out of the documentation.
+	InternalHide = "hide"
+)
+
+// DefaultExcludeDirs are the directories that are left out of the
+// documentation when no directories are configured.
+var DefaultExcludeDirs = []string{"vendor", "testdata"}
+
+// generatedPattern matches the comment that marks a file as generated as
+// described by https://golang.org/s/generatedcode.
+var generatedPattern = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// excluded returns true if any element of the slash separated path is a
+// directory that is hidden from the documentation.  Hidden directories and
+// directories starting with an underscore are always excluded.
+func (h *HTML) excluded(p string) bool {
+	for _, name := range strings.Split(p, "/") {
+		if name == "" {
+			continue
+		}
+		if name[0] == '.' || name[0] == '_' {
+			return true
+		}
+		if name == "internal" && h.internalVisibility(p) == InternalHide {
+			return true
+		}
+		for _, dir := range h.excludeDirs() {
+			if name == dir {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// excludeDirs returns the configured directory exclusions or the defaults.
+func (h *HTML) excludeDirs() []string {
+	if h.options.ExcludeDirs == nil {
+		return DefaultExcludeDirs
+	}
+	return h.options.ExcludeDirs
+}
+
+// internalVisibility returns the internal package policy for the package
+// path.  A policy set for the repository containing the package takes
+// precedence over the global policy.
+func (h *HTML) internalVisibility(p string) string {
+	if len(h.options.InternalRepos) > 0 {
+		if r, ok := h.repository(p); ok {
+			if v, ok := h.options.InternalRepos[r.Owner+"/"+r.Name]; ok {
+				return v
+			}
+		}
+	}
+
+	if h.options.Internal == "" {
+		return InternalShow
+	}
+	return h.options.Internal
+}
+
+// isGenerated returns true if the file has a generated code comment before
+// the package clause.
+func isGenerated(f *ast.File) bool {
+	for _, g := range f.Comments {
+		if g.Pos() >= f.Package {
+			break
+		}
+		for _, c := range g.List {
+			if generatedPattern.MatchString(c.Text) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
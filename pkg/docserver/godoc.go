@@ -0,0 +1,234 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package docserver
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ctxswitch/gdoc/internal/server"
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+	"go.uber.org/zap"
+)
+
+// RepositoryLister returns the repositories that have been synchronized.
+// It is implemented by syncer.Syncer.
+type RepositoryLister interface {
+	Repos() []syncer.Repo
+}
+
+// RepositoryFetcher clones a repository that has been discovered but not
+// cloned yet.  It is implemented by syncer.Syncer.
+type RepositoryFetcher interface {
+	Fetch(ctx context.Context, owner, name string) error
+}
+
+// WorkspaceGeneration reports the changes to the workspace.  It is
+// implemented by syncer.PathLocks.
+type WorkspaceGeneration interface {
+	Generation() uint64
+}
+
+// Timeouts are the limits on the time spent on the connections to the html
+// backend.  Zero disables a timeout.
+type Timeouts struct {
+	// The time allowed to read a request, including its body.
+	Read time.Duration
+	// The time allowed from the end of reading the request headers to the
+	// end of writing the response.
+	Write time.Duration
+	// The time a keep-alive connection is kept open between requests.
+	Idle time.Duration
+}
+
+// GodocOptions defines the options available for running the godoc
+// service.
+type GodocOptions struct {
+	// The GOROOT value that will be passed to godoc.  Initially set
+	// in the config.
+	GodocRoot string
+	// The port that godoc will run on. Initially set in the config.
+	GodocPort int
+	// The address that godoc listens on.  Empty to listen on every
+	// address.  Initially set in the config.
+	BindAddress string
+	// The address families that godoc listens on, either
+	// server.FamilyDual, server.FamilyIPv4 or server.FamilyIPv6.
+	// Initially set in the config.
+	AddressFamily string
+	// The indexing interval for godoc.  0 for default (5m), negative
+	// to only index once at startup.
+	GodocIndexInterval string
+	// A directory containing templates and static files that replace the
+	// embedded web assets of the html backend.  Initially set in the config.
+	OverrideDir string
+	// The locale used by the html backend when none of the languages
+	// requested by the browser are available.  Initially set in the config.
+	DefaultLocale string
+	// The directory names that are left out of the html backend.  Defaults
+	// to DefaultExcludeDirs.  Initially set in the config.
+	ExcludeDirs []string
+	// Leave files marked with a "Code generated ... DO NOT EDIT." comment
+	// out of the html backend.  Initially set in the config.
+	ExcludeGenerated bool
+	// Whether internal packages are documented by the html backend.  Either
+	// InternalShow or InternalHide.  Defaults to InternalShow.  Initially
+	// set in the config.
+	Internal string
+	// The internal package policy of individual repositories keyed by
+	// owner/name, overriding Internal.  Initially set in the config.
+	InternalRepos map[string]string
+	// The markers of the notes, such as BUG or TODO, that are collected as
+	// a regular expression.  Defaults to DefaultNotesPattern.  Initially
+	// set in the config.
+	NotesPattern string
+	// The URL of the mermaid script loaded by package pages of the html
+	// backend that have mermaid diagrams.  Empty to show the diagram
+	// sources instead.  Initially set in the config.
+	MermaidURL string
+	// The URL of the PlantUML server that renders the PlantUML diagrams on
+	// package pages of the html backend.  Empty to show the diagram
+	// sources instead.  Initially set in the config.
+	PlantUMLServer string
+	// The repositories whose pages are kept out of search engines as
+	// owner/name patterns, such as ctxswitch/gdoc or ctxswitch/*.
+	// Initially set in the config.
+	NoIndexRepos []string
+	// The largest image, in bytes, that the html backend serves from the
+	// synchronized repositories.  Defaults to DefaultMaxAssetSize.
+	// Initially set in the config.
+	MaxAssetSize int64
+	// The security headers sent with the responses of the html backend.
+	// Initially set in the config.
+	Headers SecurityHeaders
+	// How long active requests to the html backend are given to finish
+	// when the service is stopped.  Defaults to 30 seconds.  Initially
+	// set in the config.
+	ShutdownTimeout time.Duration
+	// The timeouts of the connections to the html backend.  Initially set
+	// in the config.
+	Timeouts Timeouts
+	// The time after which requests to the html backend are logged as
+	// slow.  Zero disables the logging.  Initially set in the config.
+	SlowRequestThreshold time.Duration
+	// The path of a unix domain socket that the html backend listens on in
+	// addition to the port.  Initially set in the config.
+	Socket string
+	// The release of the standard library in the GodocRoot, shown in the
+	// version selector of the html backend.  Initially set in the config.
+	StdlibVersion string
+	// The additional releases of the standard library documented by the
+	// html backend, in the order they are shown in the version selector.
+	// Initially set in the config.
+	StdlibReleases []StdlibRelease
+	// The repositories shown on the landing page of the html backend.
+	// Optional.
+	Repositories RepositoryLister
+	// Reports the changes that the syncer, the module sources and the
+	// local source watcher make to the workspace.  The package index of
+	// the html backend is only cached by clients while it is set.
+	// Optional.
+	Workspace WorkspaceGeneration
+	// Clones repositories the first time their documentation is requested
+	// from the html backend when lazy sync is enabled.  Optional.
+	Fetcher RepositoryFetcher
+	// The resource limits applied to the godoc or pkgsite command when
+	// the default runner is used.  Initially set in the config.
+	Limits Limits
+	// The variables, in the form key=value, added to the environment of
+	// the godoc or pkgsite command when the default runner is used.
+	// Initially set in the config.
+	Env []string
+	// The names of the variables the godoc or pkgsite command inherits
+	// when the default runner is used.  Nil inherits the whole
+	// environment.  Initially set in the config.
+	InheritEnv []string
+	// The runner used to execute godoc.  Defaults to ExecRunner.
+	Runner CommandRunner
+	// The logger used by the godoc service. Initially set in the
+	// config.
+	Logger *zap.Logger
+}
+
+type Godoc struct {
+	// The GodocOptions that was passed into New.
+	options GodocOptions
+	// The runner used to execute godoc.
+	runner CommandRunner
+	// The logger used by the godoc service.
+	logger *zap.Logger
+}
+
+// New returns an initialized Godoc struct
+func New(g GodocOptions) *Godoc {
+	runner := g.Runner
+	if runner == nil {
+		runner = g.execRunner()
+	}
+
+	return &Godoc{
+		options: g,
+		runner:  runner,
+		logger:  g.Logger,
+	}
+}
+
+// execRunner returns the default runner for the options.
+func (g GodocOptions) execRunner() ExecRunner {
+	return ExecRunner{
+		Limits:  g.Limits,
+		Env:     g.Env,
+		Inherit: g.InheritEnv,
+	}
+}
+
+// notesFlag returns the pattern passed to the -notes flag of godoc.
+func notesFlag(pattern string) string {
+	if pattern == "" {
+		return DefaultNotesPattern
+	}
+	return pattern
+}
+
+// Start runs the godoc service.  The path of the godoc executable is looked
+// up and the argument string created.  The godoc service is started and any
+// errors returned to the caller.
+func (g *Godoc) Start(ctx context.Context) error {
+	godoc, err := g.runner.LookPath("godoc")
+	if err != nil {
+		g.logger.Error("unable to find godoc in the path")
+		return err
+	}
+
+	arg := []string{
+		"-http=" + g.options.address(),
+		fmt.Sprintf("-goroot=%s", g.options.GodocRoot),
+		"-index",
+		fmt.Sprintf("-index_interval=%s", g.options.GodocIndexInterval),
+		fmt.Sprintf("-notes=%s", notesFlag(g.options.NotesPattern)),
+	}
+	// Godoc is required to be in the path.
+	return g.runner.Run(ctx, godoc, arg...)
+}
+
+// address returns the TCP address that the documentation is served on.
+func (o GodocOptions) address() string {
+	return server.Address(o.BindAddress, o.GodocPort, o.AddressFamily)
+}
@@ -0,0 +1,96 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package docserver
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// fakeRunner is a CommandRunner that records the commands it is asked to
+// run instead of running them.
+type fakeRunner struct {
+	// The paths of the executables that can be found.
+	paths map[string]string
+	// The error returned by Run.
+	err error
+	// The name and arguments of the commands that were run.
+	name string
+	args []string
+}
+
+// LookPath returns the path of the executable if it is known.
+func (r *fakeRunner) LookPath(file string) (string, error) {
+	if p, ok := r.paths[file]; ok {
+		return p, nil
+	}
+	return "", errors.New("executable file not found in $PATH")
+}
+
+// Run records the command.
+func (r *fakeRunner) Run(ctx context.Context, name string, arg ...string) error {
+	r.name = name
+	r.args = arg
+	return r.err
+}
+
+func TestGodocStart(t *testing.T) {
+	runner := &fakeRunner{paths: map[string]string{"godoc": "/usr/local/bin/godoc"}}
+	g := New(GodocOptions{
+		GodocPort:          6060,
+		GodocRoot:          "/var/lib/gdoc",
+		GodocIndexInterval: "5m",
+		Runner:             runner,
+		Logger:             zap.NewNop(),
+	})
+
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if runner.name != "/usr/local/bin/godoc" {
+		t.Fatalf("expected godoc to be run from its path, got %q", runner.name)
+	}
+
+	want := []string{
+		"-http=:6060",
+		"-goroot=/var/lib/gdoc",
+		"-index",
+		"-index_interval=5m",
+		"-notes=" + DefaultNotesPattern,
+	}
+	if !reflect.DeepEqual(runner.args, want) {
+		t.Fatalf("expected arguments %q, got %q", want, runner.args)
+	}
+}
+
+func TestGodocStartWithoutGodoc(t *testing.T) {
+	runner := &fakeRunner{}
+	g := New(GodocOptions{Runner: runner, Logger: zap.NewNop()})
+
+	if err := g.Start(context.Background()); err == nil {
+		t.Fatal("expected an error when godoc is not in the path")
+	}
+	if runner.name != "" {
+		t.Fatalf("expected nothing to be run, got %q", runner.name)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package docserver
+
+import "net/http"
+
+// DefaultContentSecurityPolicy allows the pages of the html backend to load
+// their own scripts and styles, the default mermaid script and images from
+// any https origin, such as the badges of package READMEs and a PlantUML
+// server, and keeps them from being framed.
+const DefaultContentSecurityPolicy = "default-src 'self'; script-src 'self' https://cdn.jsdelivr.net; style-src 'self' 'unsafe-inline'; img-src 'self' data: https:; frame-ancestors 'none'; base-uri 'self'; form-action 'self'"
+
+// SecurityHeaders are the security headers sent with every response.
+// Headers with an empty value are left out.
+type SecurityHeaders struct {
+	// The Content-Security-Policy header.
+	ContentSecurityPolicy string
+	// The X-Frame-Options header, for browsers that do not support the
+	// frame-ancestors directive.
+	FrameOptions string
+	// The Strict-Transport-Security header.  Browsers ignore it unless the
+	// page was served over https, such as by a reverse proxy.
+	StrictTransportSecurity string
+	// The Referrer-Policy header.
+	ReferrerPolicy string
+}
+
+// Handler sets the headers on every response before passing the request to
+// the handler, which can replace them for individual responses.  The
+// X-Content-Type-Options header is always set to nosniff.
+func (s SecurityHeaders) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		set := func(key, value string) {
+			if value != "" {
+				h.Set(key, value)
+			}
+		}
+		set("Content-Security-Policy", s.ContentSecurityPolicy)
+		set("X-Frame-Options", s.FrameOptions)
+		set("Strict-Transport-Security", s.StrictTransportSecurity)
+		set("Referrer-Policy", s.ReferrerPolicy)
+		h.Set("X-Content-Type-Options", "nosniff")
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,793 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package docserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"go/ast"
+	"go/build"
+	"go/doc"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"html/template"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ctxswitch/gdoc/internal/server"
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// HTML is a backend that renders documentation with the go/doc package.  It
+// does not require any external commands and reads the packages from the
+// workspace on every request, so it always reflects the latest sync.
+type HTML struct {
+	// The GodocOptions that was passed into NewHTML.
+	options GodocOptions
+	// The parsed page templates.
+	templates *template.Template
+	// The static assets.
+	static http.Handler
+	// The translated messages.
+	catalog *catalog
+	// The logger used by the html service.
+	logger *zap.Logger
+	// The time the html service was created, used in entity tags.
+	started time.Time
+	// The markers of the notes that are shown.
+	notesPattern *regexp.Regexp
+}
+
+// NewHTML returns an initialized HTML struct.  If the templates or message
+// catalogs in the override directory can not be parsed, the embedded ones
+// are used.
+func NewHTML(g GodocOptions) *HTML {
+	h := &HTML{
+		options: g,
+		static:  http.FileServer(http.FS(assets(g.OverrideDir))),
+		logger:  g.Logger,
+		started: time.Now(),
+	}
+
+	c, err := loadCatalog(assets(g.OverrideDir), g.DefaultLocale)
+	if err != nil {
+		h.logger.Error("unable to load override message catalogs, using the embedded catalogs", zap.Error(err))
+		c, _ = loadCatalog(assets(""), g.DefaultLocale)
+	}
+	h.catalog = c
+	h.notesPattern = h.compileNotesPattern()
+
+	funcs := template.FuncMap{
+		"t": h.catalog.translate,
+	}
+
+	t, err := templates(g.OverrideDir, funcs)
+	if err != nil {
+		h.logger.Error("unable to parse override templates, using the embedded templates", zap.Error(err))
+		t, _ = templates("", funcs)
+	}
+	h.templates = t
+
+	return h
+}
+
+// Start runs the html service until the context is cancelled.  The service
+// also listens on the unix domain socket if one is configured.  Every
+// response carries the configured security headers.  HTTP/2 is
+// served over cleartext connections for clients and reverse proxies that
+// support it.  Once the context is cancelled, active requests are given the
+// shutdown timeout to finish.
+func (h *HTML) Start(ctx context.Context) error {
+	srv := &http.Server{
+		Handler: h2c.NewHandler(server.Slow(h.options.Headers.Handler(h), h.options.SlowRequestThreshold, h.logger, target), &http2.Server{}),
+	}
+
+	return server.Serve(ctx, srv, server.Options{
+		Addr:            h.options.address(),
+		Network:         server.Network(h.options.AddressFamily),
+		Socket:          h.options.Socket,
+		ActivationName:  "docs",
+		ShutdownTimeout: h.options.ShutdownTimeout,
+		Timeouts:        server.Timeouts(h.options.Timeouts),
+		Logger:          h.logger,
+	})
+}
+
+// target returns the package or file that the request renders, or the path
+// of the other pages.
+func target(r *http.Request) string {
+	for _, prefix := range []string{"/pkg/", "/raw/"} {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/")
+		}
+	}
+	return r.URL.Path
+}
+
+// ServeHTTP renders the package index at the root, the documentation of
+// a package below /pkg/, the sync activity at /activity, the notes at
+// /notes, the static assets below /static/, the images of the source tree
+// below /raw/ and the crawler rules at /robots.txt.
+func (h *HTML) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/":
+		h.index(w, r)
+	case r.URL.Path == "/activity":
+		h.activity(w, r)
+	case r.URL.Path == "/notes":
+		h.notes(w, r)
+	case r.URL.Path == "/robots.txt":
+		h.robots(w, r)
+	case strings.HasPrefix(r.URL.Path, "/static/"):
+		h.static.ServeHTTP(w, r)
+	case strings.HasPrefix(r.URL.Path, "/raw/"):
+		h.raw(w, r, strings.TrimPrefix(r.URL.Path, "/raw/"))
+	case strings.HasPrefix(r.URL.Path, "/pkg/"):
+		h.pkg(w, r, strings.Trim(strings.TrimPrefix(r.URL.Path, "/pkg/"), "/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// page contains the data shared by all pages.
+type page struct {
+	Title string
+	// The negotiated locale that the page is rendered in.
+	Locale string
+	// Set when the page belongs to a repository that is kept out of
+	// search engines.  Overridden templates can use it to leave out
+	// analytics.
+	NoIndex bool
+}
+
+// newPage returns the shared page data for the request.
+func (h *HTML) newPage(r *http.Request, title string) page {
+	return page{
+		Title:  title,
+		Locale: h.catalog.negotiate(r.Header.Get("Accept-Language")),
+	}
+}
+
+// packageSummary is a single entry in the package index.
+type packageSummary struct {
+	ImportPath string
+	Name       string
+	Synopsis   string
+}
+
+// index renders the list of all packages in the workspace.  The entity tag
+// is built from the generation of the workspace and the state of the
+// synchronized repositories, so the page is only rendered again after a
+// sync, an uploaded, proxied or local module or a pause has changed it.
+func (h *HTML) index(w http.ResponseWriter, r *http.Request) {
+	if h.options.Workspace != nil {
+		parts := []string{h.newPage(r, "").Locale, strconv.FormatUint(h.options.Workspace.Generation(), 10)}
+		if h.options.Repositories != nil {
+			for _, repo := range h.options.Repositories.Repos() {
+				parts = append(parts, repo.Owner, repo.Name, repo.CommitSHA, strconv.FormatBool(repo.Paused))
+			}
+		}
+		if notModified(w, r, h.etag(parts...)) {
+			return
+		}
+	}
+
+	var pkgs []packageSummary
+	root := h.src()
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		if !info.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, p)
+		if p != root && h.excluded(filepath.ToSlash(rel)) {
+			return filepath.SkipDir
+		}
+
+		if s, ok := h.summary(p); ok {
+			s.ImportPath = filepath.ToSlash(rel)
+			pkgs = append(pkgs, s)
+		}
+		return nil
+	})
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	sort.Slice(pkgs, func(i, j int) bool {
+		return pkgs[i].ImportPath < pkgs[j].ImportPath
+	})
+
+	data := indexPage{
+		page:         h.newPage(r, ""),
+		Repositories: h.repositories(),
+		Packages:     pkgs,
+	}
+	data.Title = h.catalog.translate(data.Locale, "packages")
+	h.render(w, "index", data)
+}
+
+// repositories returns the synchronized repositories along with their
+// import paths.
+func (h *HTML) repositories() []repository {
+	if h.options.Repositories == nil {
+		return nil
+	}
+
+	var repos []repository
+	for _, r := range h.options.Repositories.Repos() {
+		repo := repository{Repo: r}
+		if rel, err := filepath.Rel(h.src(), r.LocalPath); err == nil && !strings.HasPrefix(rel, "..") {
+			repo.ImportPath = filepath.ToSlash(rel)
+		}
+		repo.Owners = h.owners(repo, "")
+		repos = append(repos, repo)
+	}
+
+	return repos
+}
+
+// repository returns the synchronized repository that contains the package
+// with the import path.
+func (h *HTML) repository(importPath string) (repository, bool) {
+	for _, r := range h.repositories() {
+		if r.ImportPath != "" && (importPath == r.ImportPath || strings.HasPrefix(importPath, r.ImportPath+"/")) {
+			return r, true
+		}
+	}
+
+	return repository{}, false
+}
+
+// owners returns the code owners of a path relative to the root of the
+// repository.
+func (h *HTML) owners(r repository, rel string) []string {
+	co, err := LoadCodeOwners(r.LocalPath)
+	if err != nil {
+		h.logger.Debug("unable to read the code owners", zap.String("repo", r.Owner+"/"+r.Name), zap.Error(err))
+		return nil
+	}
+	return co.Owners(rel)
+}
+
+// summary reads only the package clauses and comments of the files in the
+// directory to build the index entry.  It returns false if the directory
+// does not contain a package.
+func (h *HTML) summary(dir string) (packageSummary, bool) {
+	fset := token.NewFileSet()
+	files, err := h.parseDir(fset, dir, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil || len(files) == 0 {
+		return packageSummary{}, false
+	}
+
+	s := packageSummary{Name: files[0].Name.Name}
+	for _, f := range files {
+		if f.Doc != nil {
+			s.Synopsis = doc.Synopsis(f.Doc.Text())
+			break
+		}
+	}
+
+	return s, true
+}
+
+// value is a rendered constant or variable declaration.
+type value struct {
+	Decl string
+	Doc  template.HTML
+	// The deprecation notice.  Empty if the declaration is not deprecated.
+	Deprecated string
+	// The link to the declaration on the source host.  Empty if unknown.
+	Source string
+	// The locale the declaration is rendered in.
+	Locale string
+}
+
+// function is a rendered function or method declaration.
+type function struct {
+	Name string
+	Decl string
+	Doc  template.HTML
+	// The deprecation notice.  Empty if the function is not deprecated.
+	Deprecated string
+	// The link to the function on the source host.  Empty if unknown.
+	Source string
+	// The locale the function is rendered in.
+	Locale string
+}
+
+// typ is a rendered type declaration along with its associated
+// declarations.
+type typ struct {
+	Name string
+	Decl string
+	Doc  template.HTML
+	// The deprecation notice.  Empty if the type is not deprecated.
+	Deprecated string
+	// The link to the type on the source host.  Empty if unknown.
+	Source  string
+	Consts  []value
+	Vars    []value
+	Funcs   []function
+	Methods []function
+}
+
+// repository is a synchronized repository shown on the landing page.
+type repository struct {
+	syncer.Repo
+	// The import path of the repository root.  Empty if the repository
+	// is not in the package tree.
+	ImportPath string
+	// The code owners of the repository root.
+	Owners []string
+}
+
+// indexPage is the data passed to the index template.
+type indexPage struct {
+	page
+	Repositories []repository
+	Packages     []packageSummary
+}
+
+// packagePage is the data passed to the package template.
+type packagePage struct {
+	page
+	ImportPath string
+	Name       string
+	Doc        template.HTML
+	// The rendered README.md or doc.md of the package directory.  Empty if
+	// the directory has none.
+	Readme template.HTML
+	// The URL of the mermaid script, set when the readme has mermaid
+	// diagrams.
+	Mermaid string
+	// The deprecation notice of the package.  Empty if the package is not
+	// deprecated.
+	Deprecated string
+	// Either StabilityStable, StabilityUnstable or StabilityExperimental.
+	// Empty if unknown.
+	Stability string
+	// The newest release of the repository.  Only set on the default
+	// branch.
+	Version string
+	// When the package directory last changed.  Nil if unknown or the page
+	// is not rendered from the default branch.
+	Modified *time.Time
+	// The code owners of the package directory.
+	Owners []string
+	// The link to the package directory on the source host.  Empty if
+	// unknown.
+	Source string
+	// The link to the documentation of the package pinned to the commit.
+	Permalink string
+	Consts    []value
+	Vars      []value
+	Funcs     []function
+	Types     []typ
+	// The notes of the package whose marker matches the notes pattern.
+	Notes []Note
+	// The command line usage of a main package.  Nil if none was found.
+	Usage *Usage
+	// The branches the package can be viewed on.  Empty if only the
+	// default branch is checked out.
+	Branches []branchLink
+	// The releases a standard library package can be viewed in.  Empty
+	// if no additional releases are documented.
+	Versions []branchLink
+}
+
+// branchLink links to the documentation of a package on one of the
+// branches of its repository.
+type branchLink struct {
+	Name    string
+	URL     string
+	Current bool
+}
+
+// branchLinks returns the links to the package on the default branch and
+// the additional branches of the repository.  ref is the branch the page
+// is rendered from and is empty for the default branch.
+func branchLinks(repo repository, importPath, ref string) []branchLink {
+	if len(repo.Branches) == 0 {
+		return nil
+	}
+
+	links := []branchLink{{
+		Name:    repo.DefaultBranch,
+		URL:     "/pkg/" + importPath,
+		Current: ref == "",
+	}}
+	for _, b := range repo.Branches {
+		links = append(links, branchLink{
+			Name:    b.Name,
+			URL:     "/pkg/" + importPath + "@" + b.Name,
+			Current: ref == b.Name,
+		})
+	}
+	return links
+}
+
+// pkg renders the documentation of a single package.  A path of the form
+// importpath@sha renders the package as it was at that commit of its
+// repository and importpath@branch renders it from the checkout of an
+// additional branch.  A standard library package is rendered from one of
+// the additional releases with importpath@version.  A path of the form
+// importpath@date redirects to the commit that was synchronized at that
+// time.
+func (h *HTML) pkg(w http.ResponseWriter, r *http.Request, importPath string) {
+	importPath, sha := splitCommit(importPath)
+	clean := path.Clean("/" + importPath)[1:]
+	if clean == "" || clean != importPath || h.excluded(clean) {
+		http.NotFound(w, r)
+		return
+	}
+
+	repo, ok := h.repository(clean)
+	rel := strings.Trim(strings.TrimPrefix(clean, repo.ImportPath), "/")
+	noIndex := ok && h.noIndex(repo)
+	if noIndex {
+		w.Header().Set("X-Robots-Tag", noIndexTag)
+	}
+
+	// Repositories that have only been discovered are cloned on their
+	// first request.
+	if ok && h.options.Fetcher != nil {
+		if _, err := os.Stat(repo.LocalPath); os.IsNotExist(err) {
+			h.logger.Info("fetching requested repository", zap.String("repo", repo.Owner+"/"+repo.Name))
+			err := h.options.Fetcher.Fetch(r.Context(), repo.Owner, repo.Name)
+			if errors.Is(err, syncer.ErrPaused) {
+				http.NotFound(w, r)
+				return
+			}
+			// Another instance holds the sync lock and will clone the
+			// repository into the shared workspace.
+			if errors.Is(err, syncer.ErrLocked) {
+				http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+				return
+			}
+			if err != nil {
+				h.error(w, err)
+				return
+			}
+			if repo, ok = h.repository(clean); !ok {
+				http.NotFound(w, r)
+				return
+			}
+		}
+	}
+
+	// A path of the form importpath@date redirects to the permalink of the
+	// commit so that the page is cached along with the other permalinks.
+	if t, isDate := parseDate(sha); ok && isDate {
+		commit, err := h.commitAt(repo, t)
+		if err != nil {
+			h.logger.Debug("unable to find commit", zap.String("repo", repo.Owner+"/"+repo.Name), zap.Time("time", t), zap.Error(err))
+			http.NotFound(w, r)
+			return
+		}
+
+		target := "/pkg/" + clean + "@" + commit
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, target, http.StatusFound)
+		return
+	}
+
+	// A path of the form importpath@branch renders the package from the
+	// checkout of one of the additional branches of its repository.
+	var branch *syncer.Branch
+	if ok && sha != "" {
+		for i := range repo.Branches {
+			if repo.Branches[i].Name == sha {
+				branch = &repo.Branches[i]
+			}
+		}
+	}
+
+	// A path of the form importpath@version renders a standard library
+	// package from one of the additional releases.
+	var release *StdlibRelease
+	if !ok && sha != "" && isStdlib(clean) {
+		if r, found := h.stdlibRelease(sha); found {
+			release = &r
+		}
+	}
+	if release != nil && notModified(w, r, h.etag(h.newPage(r, "").Locale, clean, sha)) {
+		return
+	}
+
+	// Pages of packages in a synchronized repository only change when the
+	// commit they are rendered from changes.
+	if ok && (sha != "" || repo.CommitSHA != "") {
+		rev := sha
+		switch {
+		case branch != nil:
+			rev = branch.CommitSHA
+		case rev == "":
+			// A release can be tagged without a new commit.
+			rev = repo.CommitSHA + repo.Version
+		}
+		if notModified(w, r, h.etag(h.newPage(r, "").Locale, clean, rev)) {
+			return
+		}
+	}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	var err error
+	var dir string
+	switch {
+	case sha == "":
+		dir = filepath.Join(h.src(), filepath.FromSlash(clean))
+		files, err = h.parseDir(fset, dir, parser.ParseComments)
+	case branch != nil:
+		dir = filepath.Join(branch.LocalPath, filepath.FromSlash(rel))
+		files, err = h.parseDir(fset, dir, parser.ParseComments)
+		repo.CommitSHA = branch.CommitSHA
+		repo.LocalPath = branch.LocalPath
+	case release != nil:
+		dir = filepath.Join(release.Root, "src", filepath.FromSlash(clean))
+		files, err = h.parseDir(fset, dir, parser.ParseComments)
+	case ok && commitPattern.MatchString(sha):
+		files, repo.CommitSHA, err = h.parseCommit(fset, repo, rel, sha)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil || len(files) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	// The usage is read before doc.NewFromFiles removes the function
+	// bodies that flags are usually defined in.
+	var usage *Usage
+	if files[0].Name.Name == "main" {
+		usage = commandUsage(fset, files)
+	}
+
+	p, err := doc.NewFromFiles(fset, files, clean)
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	pg := h.newPage(r, clean)
+	pg.NoIndex = noIndex
+	rd := renderer{fset: fset, locale: pg.Locale}
+	if ok {
+		rd.repo = &repo
+	}
+
+	data := packagePage{
+		page:       pg,
+		ImportPath: clean,
+		Name:       p.Name,
+		Doc:        comment(p.Doc),
+		Deprecated: Deprecation(p.Doc),
+		Stability:  Stability(p.Doc, rel, ""),
+		Consts:     rd.values(p.Consts),
+		Vars:       rd.values(p.Vars),
+		Funcs:      rd.functions(p.Funcs),
+		Notes:      packageNotes(fset, p, clean, h.notesPattern),
+		Usage:      usage,
+	}
+
+	if !ok && isStdlib(clean) {
+		data.Versions = h.versionLinks(clean, sha)
+	}
+
+	var mermaid bool
+	data.Readme, mermaid = h.readme(rd.repo, clean, dir, rel, sha)
+	if mermaid {
+		data.Mermaid = h.options.MermaidURL
+	}
+
+	if ok {
+		data.Owners = h.owners(repo, rel)
+		data.Source = sourceURL(repo.Repo, "tree", rel, 0)
+		for i, n := range data.Notes {
+			data.Notes[i].Source = sourceURL(repo.Repo, "blob", path.Join(rel, n.File), n.Line)
+		}
+		if repo.CommitSHA != "" && branch == nil {
+			data.Permalink = "/pkg/" + clean + "@" + repo.CommitSHA
+		}
+		data.Branches = branchLinks(repo, clean, sha)
+		if sha == "" {
+			data.Version = repo.Version
+			data.Stability = Stability(p.Doc, rel, repo.Version)
+			key := rel
+			if key == "" {
+				key = "."
+			}
+			if t, ok := repo.Modified[key]; ok {
+				data.Modified = &t
+			}
+		}
+	}
+
+	for _, t := range p.Types {
+		data.Types = append(data.Types, typ{
+			Name:       t.Name,
+			Decl:       decl(fset, t.Decl),
+			Doc:        comment(t.Doc),
+			Deprecated: Deprecation(t.Doc),
+			Source:     rd.source(t.Decl.Pos()),
+			Consts:     rd.values(t.Consts),
+			Vars:       rd.values(t.Vars),
+			Funcs:      rd.functions(t.Funcs),
+			Methods:    rd.functions(t.Methods),
+		})
+	}
+
+	if sha != "" && branch == nil {
+		// The content of a commit never changes.
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+
+	h.render(w, "package", data)
+}
+
+// src returns the directory that packages are served from.
+func (h *HTML) src() string {
+	return filepath.Join(h.options.GodocRoot, "src")
+}
+
+// render executes the named template and writes it to the response.
+func (h *HTML) render(w http.ResponseWriter, name string, data interface{}) {
+	var buf bytes.Buffer
+	if err := h.templates.ExecuteTemplate(&buf, name, data); err != nil {
+		h.error(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = buf.WriteTo(w)
+}
+
+// error logs the error and writes a generic error response.
+func (h *HTML) error(w http.ResponseWriter, err error) {
+	h.logger.Error("unable to render documentation", zap.Error(err))
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+// parseDir parses the non-test go files in the directory that match the
+// build constraints of the host.  Generated files are left out when they are
+// excluded in the options.
+func (h *HTML) parseDir(fset *token.FileSet, dir string, mode parser.Mode) ([]*ast.File, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*ast.File
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		if ok, err := build.Default.MatchFile(dir, name); err != nil || !ok {
+			continue
+		}
+
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, mode)
+		if err != nil {
+			return nil, err
+		}
+		if h.options.ExcludeGenerated && isGenerated(f) {
+			continue
+		}
+		files = append(files, f)
+	}
+
+	return files, nil
+}
+
+// renderer holds the state shared by the declarations of a package page.
+type renderer struct {
+	fset *token.FileSet
+	// The locale the page is rendered in.
+	locale string
+	// The repository containing the package.  Nil if the package is not
+	// part of a synchronized repository.
+	repo *repository
+}
+
+// values renders constant and variable declarations.
+func (rd renderer) values(vs []*doc.Value) []value {
+	var out []value
+	for _, v := range vs {
+		out = append(out, value{
+			Decl:       decl(rd.fset, v.Decl),
+			Doc:        comment(v.Doc),
+			Deprecated: Deprecation(v.Doc),
+			Source:     rd.source(v.Decl.Pos()),
+			Locale:     rd.locale,
+		})
+	}
+	return out
+}
+
+// functions renders function and method declarations.
+func (rd renderer) functions(fs []*doc.Func) []function {
+	var out []function
+	for _, f := range fs {
+		out = append(out, function{
+			Name:       f.Name,
+			Decl:       decl(rd.fset, f.Decl),
+			Doc:        comment(f.Doc),
+			Deprecated: Deprecation(f.Doc),
+			Source:     rd.source(f.Decl.Pos()),
+			Locale:     rd.locale,
+		})
+	}
+	return out
+}
+
+// source returns the link to the line of the position on the source host.
+func (rd renderer) source(pos token.Pos) string {
+	if rd.repo == nil {
+		return ""
+	}
+
+	position := rd.fset.Position(pos)
+	rel, err := filepath.Rel(rd.repo.LocalPath, position.Filename)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+
+	return sourceURL(rd.repo.Repo, "blob", filepath.ToSlash(rel), position.Line)
+}
+
+// decl prints a declaration as source code.
+func decl(fset *token.FileSet, node interface{}) string {
+	var buf bytes.Buffer
+	cfg := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+	if err := cfg.Fprint(&buf, fset, node); err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+// comment renders a doc comment as HTML.
+func comment(text string) template.HTML {
+	var buf bytes.Buffer
+	doc.ToHTML(&buf, text, nil)
+	return template.HTML(buf.String())
+}
@@ -0,0 +1,83 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package docserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// fakeWorkspace is a WorkspaceGeneration whose generation is set by the
+// test.
+type fakeWorkspace uint64
+
+func (f *fakeWorkspace) Generation() uint64 {
+	return uint64(*f)
+}
+
+func TestIndexNotModifiedUntilWorkspaceChanges(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "src", "example.com", "a"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "src", "example.com", "a", "a.go"), []byte("package a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var workspace fakeWorkspace
+	h := NewHTML(GodocOptions{GodocRoot: root, Workspace: &workspace, Logger: zap.NewNop()})
+
+	rec := httptest.NewRecorder()
+	h.index(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	tag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || tag == "" {
+		t.Fatalf("expected the index with an entity tag, got %d %q", rec.Code, tag)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("If-None-Match", tag)
+	rec = httptest.NewRecorder()
+	h.index(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Fatalf("expected 304 for an unchanged workspace, got %d", rec.Code)
+	}
+
+	// An uploaded module changes the workspace without a sync.
+	workspace++
+	rec = httptest.NewRecorder()
+	h.index(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 after the workspace changed, got %d", rec.Code)
+	}
+}
+
+func TestIndexWithoutWorkspaceIsNotCached(t *testing.T) {
+	h := NewHTML(GodocOptions{GodocRoot: t.TempDir(), Logger: zap.NewNop()})
+
+	rec := httptest.NewRecorder()
+	h.index(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if tag := rec.Header().Get("ETag"); tag != "" {
+		t.Fatalf("expected no entity tag, got %q", tag)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package docserver
+
+import (
+	"encoding/json"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultLocale is used when no default locale has been configured.
+const defaultLocale = "en"
+
+// catalog holds the translated messages for each locale.
+type catalog struct {
+	messages map[string]map[string]string
+	fallback string
+}
+
+// loadCatalog reads the message catalogs from the locales directory of the
+// web assets.  Each catalog is a json object of message keys to translated
+// messages and is named after its locale, such as de.json.
+func loadCatalog(fsys fs.FS, fallback string) (*catalog, error) {
+	if fallback == "" {
+		fallback = defaultLocale
+	}
+
+	c := &catalog{
+		messages: make(map[string]map[string]string),
+		fallback: strings.ToLower(fallback),
+	}
+
+	matches, err := fs.Glob(fsys, "locales/*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range matches {
+		data, err := fs.ReadFile(fsys, m)
+		if err != nil {
+			return nil, err
+		}
+
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return nil, err
+		}
+
+		c.messages[strings.ToLower(strings.TrimSuffix(path.Base(m), ".json"))] = messages
+	}
+
+	return c, nil
+}
+
+// translate returns the message for the key in the locale.  Messages that
+// are missing from the locale are looked up in the fallback locale and the
+// key itself is returned if the message does not exist at all.
+func (c *catalog) translate(locale, key string) string {
+	if msg, ok := c.messages[locale][key]; ok {
+		return msg
+	}
+
+	if msg, ok := c.messages[c.fallback][key]; ok {
+		return msg
+	}
+
+	return key
+}
+
+// negotiate picks the best available locale for an Accept-Language header.
+// Languages are tried in order of their quality values, first as the full
+// tag and then as the base language.
+func (c *catalog) negotiate(header string) string {
+	type language struct {
+		tag     string
+		quality float64
+	}
+
+	var languages []language
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		q := 1.0
+		for _, f := range fields[1:] {
+			f = strings.TrimSpace(f)
+			if strings.HasPrefix(f, "q=") {
+				if v, err := strconv.ParseFloat(f[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		languages = append(languages, language{tag, q})
+	}
+
+	sort.SliceStable(languages, func(i, j int) bool {
+		return languages[i].quality > languages[j].quality
+	})
+
+	for _, l := range languages {
+		if _, ok := c.messages[l.tag]; ok {
+			return l.tag
+		}
+		if base := strings.SplitN(l.tag, "-", 2)[0]; base != l.tag {
+			if _, ok := c.messages[base]; ok {
+				return base
+			}
+		}
+	}
+
+	return c.fallback
+}
@@ -0,0 +1,67 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package docserver
+
+import (
+	"errors"
+	"strconv"
+)
+
+// ErrOutOfMemory is returned when a command was killed because it ran out
+// of memory.
+var ErrOutOfMemory = errors.New("killed after running out of memory")
+
+// Limits are the resource limits applied to the godoc and pkgsite
+// commands.  The Go runtime of the command is tuned through its
+// environment on every platform.  On Linux the command can additionally be
+// moved into a cgroup that enforces hard limits.
+type Limits struct {
+	// The number of CPUs the command uses at the same time, passed as
+	// GOMAXPROCS.  Zero leaves it unset.
+	MaxProcs int
+	// The garbage collection target percentage, passed as GOGC.  Zero
+	// leaves it unset.
+	GCPercent int
+	// The memory limit in bytes.  Passed as GOMEMLIMIT, a soft limit that
+	// the garbage collector works towards, and written to memory.max of
+	// the cgroup.  Zero leaves it unset.
+	Memory int64
+	// The number of CPUs the command may use, written to cpu.max of the
+	// cgroup.  Zero leaves it unset.
+	CPU float64
+	// The path of a cgroup v2 directory, delegated to gdoc, that the
+	// command is moved into.  Only used on Linux.
+	Cgroup string
+}
+
+// env returns the environment variables that tune the Go runtime of the
+// command.
+func (l Limits) env() []string {
+	var env []string
+	if l.MaxProcs > 0 {
+		env = append(env, "GOMAXPROCS="+strconv.Itoa(l.MaxProcs))
+	}
+	if l.GCPercent > 0 {
+		env = append(env, "GOGC="+strconv.Itoa(l.GCPercent))
+	}
+	if l.Memory > 0 {
+		env = append(env, "GOMEMLIMIT="+strconv.FormatInt(l.Memory, 10))
+	}
+	return env
+}
@@ -0,0 +1,100 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package docserver
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// cpuPeriod is the period in microseconds that the cpu.max quota of the
+// cgroup is given for.
+const cpuPeriod = 100000
+
+// apply writes the limits to the cgroup and moves the process into it.
+func (l Limits) apply(pid int) error {
+	if l.Cgroup == "" {
+		return nil
+	}
+
+	if l.Memory > 0 {
+		if err := writeCgroup(l.Cgroup, "memory.max", strconv.FormatInt(l.Memory, 10)); err != nil {
+			return err
+		}
+	}
+	if l.CPU > 0 {
+		quota := fmt.Sprintf("%d %d", int64(l.CPU*cpuPeriod), cpuPeriod)
+		if err := writeCgroup(l.Cgroup, "cpu.max", quota); err != nil {
+			return err
+		}
+	}
+
+	return writeCgroup(l.Cgroup, "cgroup.procs", strconv.Itoa(pid))
+}
+
+// oomKills returns the number of processes in the cgroup that have been
+// killed by the OOM killer.  Zero is returned if no cgroup is set.
+func (l Limits) oomKills() int {
+	if l.Cgroup == "" {
+		return 0
+	}
+
+	f, err := os.Open(filepath.Join(l.Cgroup, "memory.events"))
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if fields := strings.Fields(s.Text()); len(fields) == 2 && fields[0] == "oom_kill" {
+			n, _ := strconv.Atoi(fields[1])
+			return n
+		}
+	}
+	return 0
+}
+
+// outOfMemory returns true if the command was killed by the OOM killer.
+// Without a cgroup, a command that was killed with SIGKILL is assumed to
+// have run out of memory since gdoc only sends it SIGTERM.
+func (l Limits) outOfMemory(err error, before int) bool {
+	if l.Cgroup != "" {
+		return l.oomKills() > before
+	}
+
+	var exit *exec.ExitError
+	if !errors.As(err, &exit) {
+		return false
+	}
+	status, ok := exit.Sys().(syscall.WaitStatus)
+	return ok && status.Signaled() && status.Signal() == syscall.SIGKILL
+}
+
+// writeCgroup writes the value to the control file of the cgroup.
+func writeCgroup(cgroup, file, value string) error {
+	return os.WriteFile(filepath.Join(cgroup, file), []byte(value), 0644)
+}
@@ -0,0 +1,39 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !linux
+// +build !linux
+
+package docserver
+
+// apply does nothing since cgroups are only available on Linux.
+func (l Limits) apply(pid int) error {
+	return nil
+}
+
+// oomKills always returns zero since cgroups are only available on Linux.
+func (l Limits) oomKills() int {
+	return 0
+}
+
+// outOfMemory always returns false since out of memory kills can only be
+// detected on Linux.
+func (l Limits) outOfMemory(err error, before int) bool {
+	return false
+}
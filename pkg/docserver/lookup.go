@@ -0,0 +1,166 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package docserver
+
+import (
+	"errors"
+	"go/ast"
+	"go/build"
+	"go/doc"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNoPackage is returned when a directory does not contain a Go package.
+var ErrNoPackage = errors.New("no go package found")
+
+// Symbol is the documentation of a single exported declaration.
+type Symbol struct {
+	// The name of the declaration.  Methods are named Type.Method and
+	// grouped constants or variables are joined with commas.
+	Name string `json:"name"`
+	// One of const, var, func, type or method.
+	Kind string `json:"kind"`
+	// The declaration as source code.
+	Signature string `json:"signature"`
+	Doc       string `json:"doc,omitempty"`
+	// The deprecation notice.  Empty if the declaration is not deprecated.
+	Deprecated string `json:"deprecated,omitempty"`
+}
+
+// PackageDoc is the plain text documentation of a package.
+type PackageDoc struct {
+	ImportPath string   `json:"import_path"`
+	Name       string   `json:"name"`
+	Synopsis   string   `json:"synopsis"`
+	Doc        string   `json:"doc"`
+	Symbols    []Symbol `json:"symbols"`
+	// The notes of every marker found in the package.
+	Notes []Note `json:"notes,omitempty"`
+	// The command line usage of a main package.
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+// Symbol returns the symbol with the given name.
+func (p *PackageDoc) Symbol(name string) (Symbol, bool) {
+	for _, s := range p.Symbols {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Symbol{}, false
+}
+
+// ReadPackage parses the package in the directory and returns its exported
+// declarations.  Test files and files excluded by build constraints are
+// ignored.
+func ReadPackage(dir, importPath string) (*PackageDoc, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		if ok, err := build.Default.MatchFile(dir, name); err != nil || !ok {
+			continue
+		}
+
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	if len(files) == 0 {
+		return nil, ErrNoPackage
+	}
+
+	// The usage is read before doc.NewFromFiles removes the function
+	// bodies that flags are usually defined in.
+	var usage *Usage
+	if files[0].Name.Name == "main" {
+		usage = commandUsage(fset, files)
+	}
+
+	p, err := doc.NewFromFiles(fset, files, importPath)
+	if err != nil {
+		return nil, err
+	}
+
+	pd := &PackageDoc{
+		ImportPath: importPath,
+		Name:       p.Name,
+		Synopsis:   doc.Synopsis(p.Doc),
+		Doc:        p.Doc,
+		Symbols:    []Symbol{},
+		Notes:      packageNotes(fset, p, importPath, nil),
+		Usage:      usage,
+	}
+
+	values := func(kind string, vs []*doc.Value) {
+		for _, v := range vs {
+			pd.Symbols = append(pd.Symbols, Symbol{
+				Name:       strings.Join(v.Names, ", "),
+				Kind:       kind,
+				Signature:  decl(fset, v.Decl),
+				Doc:        v.Doc,
+				Deprecated: Deprecation(v.Doc),
+			})
+		}
+	}
+	funcs := func(kind, prefix string, fs []*doc.Func) {
+		for _, f := range fs {
+			pd.Symbols = append(pd.Symbols, Symbol{
+				Name:       prefix + f.Name,
+				Kind:       kind,
+				Signature:  decl(fset, f.Decl),
+				Doc:        f.Doc,
+				Deprecated: Deprecation(f.Doc),
+			})
+		}
+	}
+
+	values("const", p.Consts)
+	values("var", p.Vars)
+	funcs("func", "", p.Funcs)
+	for _, t := range p.Types {
+		pd.Symbols = append(pd.Symbols, Symbol{
+			Name:       t.Name,
+			Kind:       "type",
+			Signature:  decl(fset, t.Decl),
+			Doc:        t.Doc,
+			Deprecated: Deprecation(t.Doc),
+		})
+		values("const", t.Consts)
+		values("var", t.Vars)
+		funcs("func", "", t.Funcs)
+		funcs("method", t.Name+".", t.Methods)
+	}
+
+	return pd, nil
+}
@@ -0,0 +1,423 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package docserver
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"html/template"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// The patterns of the markdown blocks.
+var (
+	headingPattern = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	fencePattern   = regexp.MustCompile("^\\s{0,3}(```+|~~~+)\\s*([^\\s`]*)")
+	rulePattern    = regexp.MustCompile(`^\s{0,3}((\*\s*){3,}|(-\s*){3,}|(_\s*){3,})$`)
+	bulletPattern  = regexp.MustCompile(`^\s{0,3}([-*+])\s+(.*)$`)
+	orderedPattern = regexp.MustCompile(`^\s{0,3}(\d{1,9})[.)]\s+(.*)$`)
+	quotePattern   = regexp.MustCompile(`^\s{0,3}>\s?(.*)$`)
+	delimPattern   = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+)
+
+// markdownRenderer renders the subset of CommonMark and GitHub flavored
+// markdown commonly found in READMEs: headings, paragraphs, lists, block
+// quotes, code blocks, tables, rules, emphasis, code spans, links and
+// images.  Raw HTML is escaped rather than passed through.  Mermaid code
+// blocks are left for the mermaid script to render in the browser and
+// PlantUML code blocks are rendered by a PlantUML server.
+type markdownRenderer struct {
+	// Resolves the relative targets of links and images.  Returns an
+	// empty string to drop the target.  Nil drops relative targets.
+	resolve func(ref string, image bool) string
+	// The URL of the PlantUML server.  Empty to render PlantUML code
+	// blocks as code.
+	plantUML string
+	// Set when a mermaid code block was rendered.
+	mermaid bool
+}
+
+// render renders the markdown source as HTML.  Headings are shifted by two
+// levels so that they nest below the headings of the page.
+func (m *markdownRenderer) render(src string) template.HTML {
+	var b strings.Builder
+	m.blocks(&b, strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n"))
+	return template.HTML(b.String())
+}
+
+// blocks renders the lines as a sequence of blocks.
+func (m *markdownRenderer) blocks(b *strings.Builder, lines []string) {
+	var para []string
+	flush := func() {
+		if len(para) > 0 {
+			fmt.Fprintf(b, "<p>%s</p>\n", m.inline(strings.Join(para, "\n")))
+			para = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.TrimSpace(line) == "":
+			flush()
+		case fencePattern.MatchString(line):
+			flush()
+			f := fencePattern.FindStringSubmatch(line)
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), f[1]); i++ {
+				code = append(code, lines[i])
+			}
+			m.code(b, code, f[2])
+		case len(para) == 0 && strings.HasPrefix(line, "    "):
+			var code []string
+			for ; i < len(lines) && (strings.HasPrefix(lines[i], "    ") || strings.TrimSpace(lines[i]) == ""); i++ {
+				code = append(code, strings.TrimPrefix(lines[i], "    "))
+			}
+			i--
+			for len(code) > 0 && strings.TrimSpace(code[len(code)-1]) == "" {
+				code = code[:len(code)-1]
+			}
+			m.code(b, code, "")
+		case headingPattern.MatchString(line):
+			flush()
+			h := headingPattern.FindStringSubmatch(line)
+			level := len(h[1]) + 2
+			if level > 6 {
+				level = 6
+			}
+			fmt.Fprintf(b, "<h%d>%s</h%d>\n", level, m.inline(h[2]), level)
+		case rulePattern.MatchString(line):
+			flush()
+			b.WriteString("<hr>\n")
+		case quotePattern.MatchString(line):
+			flush()
+			var quote []string
+			for ; i < len(lines) && quotePattern.MatchString(lines[i]); i++ {
+				quote = append(quote, quotePattern.FindStringSubmatch(lines[i])[1])
+			}
+			i--
+			b.WriteString("<blockquote>\n")
+			m.blocks(b, quote)
+			b.WriteString("</blockquote>\n")
+		case bulletPattern.MatchString(line), orderedPattern.MatchString(line):
+			flush()
+			i = m.list(b, lines, i) - 1
+		case len(para) == 0 && strings.Contains(line, "|") && i+1 < len(lines) && delimPattern.MatchString(lines[i+1]) && strings.Contains(lines[i+1], "-"):
+			var rows []string
+			for i += 2; i < len(lines) && strings.Contains(lines[i], "|") && strings.TrimSpace(lines[i]) != ""; i++ {
+				rows = append(rows, lines[i])
+			}
+			m.table(b, line, rows)
+			i--
+		default:
+			para = append(para, strings.TrimSpace(line))
+		}
+	}
+	flush()
+}
+
+// code renders a code block.
+func (m *markdownRenderer) code(b *strings.Builder, lines []string, lang string) {
+	src := strings.Join(lines, "\n")
+	switch strings.ToLower(lang) {
+	case "mermaid":
+		m.mermaid = true
+		fmt.Fprintf(b, "<pre class=\"mermaid\">%s</pre>\n", html.EscapeString(src))
+		return
+	case "plantuml", "puml":
+		if m.plantUML != "" {
+			fmt.Fprintf(b, "<img class=\"diagram\" src=\"%s/svg/%s\" alt=\"PlantUML\">\n", html.EscapeString(strings.TrimSuffix(m.plantUML, "/")), plantUMLEncode(src))
+			return
+		}
+	}
+
+	b.WriteString("<pre><code")
+	if lang != "" {
+		fmt.Fprintf(b, ` class="language-%s"`, html.EscapeString(lang))
+	}
+	b.WriteString(">")
+	b.WriteString(html.EscapeString(src))
+	b.WriteString("</code></pre>\n")
+}
+
+// plantUMLEncoding is the base64 alphabet used by PlantUML servers.
+var plantUMLEncoding = base64.NewEncoding("0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz-_").WithPadding(base64.NoPadding)
+
+// plantUMLEncode encodes the diagram source for the URL of a PlantUML
+// server: deflated and then base64 encoded with the PlantUML alphabet.
+func plantUMLEncode(src string) string {
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.BestCompression)
+	w.Write([]byte(src))
+	w.Close()
+	// PlantUML pads incomplete groups of three bytes with zeros.
+	for buf.Len()%3 != 0 {
+		buf.WriteByte(0)
+	}
+	return plantUMLEncoding.EncodeToString(buf.Bytes())
+}
+
+// list renders the list starting at the line and returns the index of the
+// first line after it.  Lines indented below an item belong to it and are
+// rendered as nested blocks.
+func (m *markdownRenderer) list(b *strings.Builder, lines []string, i int) int {
+	pattern, tag := bulletPattern, "ul"
+	if orderedPattern.MatchString(lines[i]) {
+		pattern, tag = orderedPattern, "ol"
+	}
+
+	fmt.Fprintf(b, "<%s>\n", tag)
+	for i < len(lines) && pattern.MatchString(lines[i]) {
+		body := []string{pattern.FindStringSubmatch(lines[i])[2]}
+		for i++; i < len(lines); i++ {
+			line := lines[i]
+			if strings.TrimSpace(line) == "" {
+				// A blank line only continues the item if the next
+				// line is indented.
+				if i+1 < len(lines) && strings.HasPrefix(lines[i+1], "  ") {
+					body = append(body, "")
+					continue
+				}
+				break
+			}
+			if !strings.HasPrefix(line, "  ") && (pattern.MatchString(line) || bulletPattern.MatchString(line) || orderedPattern.MatchString(line)) {
+				break
+			}
+			body = append(body, dedent(line))
+		}
+
+		b.WriteString("<li>")
+		if simple(body) {
+			b.WriteString(m.inline(strings.Join(body, "\n")))
+		} else {
+			b.WriteString("\n")
+			m.blocks(b, body)
+		}
+		b.WriteString("</li>\n")
+
+		if i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+			i++
+		}
+	}
+	fmt.Fprintf(b, "</%s>\n", tag)
+	return i
+}
+
+// simple returns true if the item body is a single paragraph of text.
+func simple(body []string) bool {
+	for _, line := range body {
+		if strings.TrimSpace(line) == "" || bulletPattern.MatchString(line) || orderedPattern.MatchString(line) || fencePattern.MatchString(line) {
+			return false
+		}
+	}
+	return true
+}
+
+// dedent removes up to four leading spaces of a nested line.
+func dedent(line string) string {
+	for i := 0; i < 4 && strings.HasPrefix(line, " "); i++ {
+		line = line[1:]
+	}
+	return line
+}
+
+// table renders a table from its header and body rows.
+func (m *markdownRenderer) table(b *strings.Builder, header string, rows []string) {
+	b.WriteString("<table>\n<thead><tr>")
+	for _, c := range cells(header) {
+		fmt.Fprintf(b, "<th>%s</th>", m.inline(c))
+	}
+	b.WriteString("</tr></thead>\n<tbody>\n")
+	for _, r := range rows {
+		b.WriteString("<tr>")
+		for _, c := range cells(r) {
+			fmt.Fprintf(b, "<td>%s</td>", m.inline(c))
+		}
+		b.WriteString("</tr>\n")
+	}
+	b.WriteString("</tbody>\n</table>\n")
+}
+
+// cells splits a table row into its cells.
+func cells(row string) []string {
+	row = strings.TrimSpace(row)
+	row = strings.TrimPrefix(strings.TrimSuffix(row, "|"), "|")
+	parts := strings.Split(row, "|")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	return parts
+}
+
+// inline renders the inline elements of the text.
+func (m *markdownRenderer) inline(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte("\\`*_{}[]()#+-.!|~<>", s[i+1]) >= 0:
+			b.WriteString(html.EscapeString(s[i+1 : i+2]))
+			i += 2
+			continue
+		case c == '`':
+			n := run(s[i:], '`')
+			fence := s[i : i+n]
+			if end := strings.Index(s[i+n:], fence); end >= 0 {
+				code := strings.TrimSpace(s[i+n : i+n+end])
+				fmt.Fprintf(&b, "<code>%s</code>", html.EscapeString(code))
+				i += n + end + n
+				continue
+			}
+			b.WriteString(fence)
+			i += n
+			continue
+		case c == '!' && strings.HasPrefix(s[i+1:], "["):
+			if text, target, n, ok := linkAt(s[i+1:]); ok {
+				if src := m.target(target, true); src != "" {
+					fmt.Fprintf(&b, `<img src="%s" alt="%s">`, html.EscapeString(src), html.EscapeString(text))
+				} else {
+					b.WriteString(html.EscapeString(text))
+				}
+				i += 1 + n
+				continue
+			}
+		case c == '[':
+			if text, target, n, ok := linkAt(s[i:]); ok {
+				if href := m.target(target, false); href != "" {
+					fmt.Fprintf(&b, `<a href="%s">%s</a>`, html.EscapeString(href), m.inline(text))
+				} else {
+					b.WriteString(m.inline(text))
+				}
+				i += n
+				continue
+			}
+		case c == '<':
+			if end := strings.IndexByte(s[i:], '>'); end > 0 {
+				if u := s[i+1 : i+end]; strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://") {
+					fmt.Fprintf(&b, `<a href="%s">%s</a>`, html.EscapeString(u), html.EscapeString(u))
+					i += end + 1
+					continue
+				}
+			}
+		case c == '*' || c == '_' || c == '~':
+			n := run(s[i:], c)
+			if n > 2 {
+				n = 2
+			}
+			// Underscores inside words, such as snake_case, are text.
+			if c == '_' && i > 0 && isWord(s[i-1]) {
+				break
+			}
+			if c == '~' && n != 2 {
+				break
+			}
+			delim := s[i : i+n]
+			if end := strings.Index(s[i+n:], delim); end > 0 && s[i+n] != ' ' {
+				tag := map[int]string{1: "em", 2: "strong"}[n]
+				if c == '~' {
+					tag = "del"
+				}
+				fmt.Fprintf(&b, "<%s>%s</%s>", tag, m.inline(s[i+n:i+n+end]), tag)
+				i += n + end + n
+				continue
+			}
+		case c == '\n':
+			b.WriteString("\n")
+			i++
+			continue
+		}
+		b.WriteString(html.EscapeString(s[i : i+1]))
+		i++
+	}
+	return b.String()
+}
+
+// target returns the URL of a link or image.  Only http, https and mailto
+// URLs and fragments are kept as is.  Relative targets are resolved and
+// other schemes, such as javascript, are dropped.
+func (m *markdownRenderer) target(ref string, image bool) string {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	switch {
+	case u.Scheme == "http" || u.Scheme == "https" || (u.Scheme == "mailto" && !image):
+		return ref
+	case u.Scheme != "" || u.Host != "":
+		return ""
+	case strings.HasPrefix(ref, "#") && !image:
+		return ref
+	case m.resolve != nil:
+		return m.resolve(ref, image)
+	default:
+		return ""
+	}
+}
+
+// linkAt parses a link of the form [text](target "title") at the start of
+// the string and returns its text, target and length.
+func linkAt(s string) (string, string, int, bool) {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth > 0 {
+				continue
+			}
+			if i+1 >= len(s) || s[i+1] != '(' {
+				return "", "", 0, false
+			}
+			end := strings.IndexByte(s[i+2:], ')')
+			if end < 0 {
+				return "", "", 0, false
+			}
+			target := strings.TrimSpace(s[i+2 : i+2+end])
+			if sp := strings.IndexAny(target, " \t"); sp >= 0 {
+				// Drop the title.
+				target = target[:sp]
+			}
+			target = strings.TrimSuffix(strings.TrimPrefix(target, "<"), ">")
+			return s[1:i], target, i + 3 + end, true
+		}
+	}
+	return "", "", 0, false
+}
+
+// run returns the number of times the byte repeats at the start of s.
+func run(s string, c byte) int {
+	n := 0
+	for n < len(s) && s[n] == c {
+		n++
+	}
+	return n
+}
+
+// isWord returns true if the byte is a letter or digit.
+func isWord(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
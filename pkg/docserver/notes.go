@@ -0,0 +1,164 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package docserver
+
+import (
+	"go/doc"
+	"go/token"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// DefaultNotesPattern matches the markers of the notes that are collected
+// when no pattern is configured.
+const DefaultNotesPattern = "BUG|TODO|NOTE"
+
+// Note is a marked comment, such as "BUG(uid): body", found in the source
+// of a package.  Only comments of that form are recognized, as with the
+// -notes flag of godoc.
+type Note struct {
+	Package string `json:"package"`
+	Marker  string `json:"marker"`
+	// The user id or other identifier given in the parentheses.
+	UID  string `json:"uid"`
+	Body string `json:"body"`
+	// The file containing the note relative to the package directory.
+	File string `json:"file"`
+	Line int    `json:"line"`
+	// The link to the note on the source host.  Empty if unknown.
+	Source string `json:"source,omitempty"`
+}
+
+// NotesPattern compiles a pattern that matches whole note markers.  An
+// empty pattern uses DefaultNotesPattern.
+func NotesPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		pattern = DefaultNotesPattern
+	}
+	return regexp.Compile("^(?:" + pattern + ")$")
+}
+
+// packageNotes returns the notes of the package whose marker matches the
+// pattern ordered by marker and position.  All notes are returned if the
+// pattern is nil.
+func packageNotes(fset *token.FileSet, p *doc.Package, importPath string, marker *regexp.Regexp) []Note {
+	markers := make([]string, 0, len(p.Notes))
+	for m := range p.Notes {
+		if marker == nil || marker.MatchString(m) {
+			markers = append(markers, m)
+		}
+	}
+	sort.Strings(markers)
+
+	var notes []Note
+	for _, m := range markers {
+		for _, n := range p.Notes[m] {
+			pos := fset.Position(n.Pos)
+			notes = append(notes, Note{
+				Package: importPath,
+				Marker:  m,
+				UID:     n.UID,
+				Body:    strings.TrimSpace(n.Body),
+				File:    filepath.Base(pos.Filename),
+				Line:    pos.Line,
+			})
+		}
+	}
+	return notes
+}
+
+// notesPage is the data passed to the notes template.
+type notesPage struct {
+	page
+	// The repository the notes are limited to as owner/name.  Empty for
+	// the notes of all repositories.
+	Repo  string
+	Notes []Note
+}
+
+// notes renders the notes of the packages in every synchronized
+// repository, or of a single repository when the repo query parameter is
+// set to owner/name.
+func (h *HTML) notes(w http.ResponseWriter, r *http.Request) {
+	if h.options.Repositories == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	data := notesPage{
+		page: h.newPage(r, ""),
+		Repo: r.URL.Query().Get("repo"),
+	}
+	data.Title = h.catalog.translate(data.Locale, "notes")
+
+	for _, repo := range h.repositories() {
+		if repo.ImportPath == "" || (data.Repo != "" && data.Repo != repo.Owner+"/"+repo.Name) {
+			continue
+		}
+
+		_ = filepath.Walk(repo.LocalPath, func(p string, info os.FileInfo, err error) error {
+			if err != nil || !info.IsDir() {
+				return nil
+			}
+
+			rel, _ := filepath.Rel(repo.LocalPath, p)
+			rel = filepath.ToSlash(rel)
+			if rel == "." {
+				rel = ""
+			}
+			importPath := path.Join(repo.ImportPath, rel)
+			if p != repo.LocalPath && (skipDir(info.Name()) || h.excluded(importPath)) {
+				return filepath.SkipDir
+			}
+
+			pd, err := ReadPackage(p, importPath)
+			if err != nil {
+				return nil
+			}
+			for _, n := range pd.Notes {
+				if !h.notesPattern.MatchString(n.Marker) {
+					continue
+				}
+				n.Source = sourceURL(repo.Repo, "blob", path.Join(rel, n.File), n.Line)
+				data.Notes = append(data.Notes, n)
+			}
+			return nil
+		})
+	}
+
+	h.render(w, "notes", data)
+}
+
+// compileNotesPattern returns the configured notes pattern.  The default
+// pattern is used if the configured one is invalid.
+func (h *HTML) compileNotesPattern() *regexp.Regexp {
+	re, err := NotesPattern(h.options.NotesPattern)
+	if err != nil {
+		h.logger.Error("invalid notes pattern, using the default", zap.Error(err))
+		re, _ = NotesPattern("")
+	}
+	return re
+}
@@ -0,0 +1,121 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package docserver
+
+import (
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// commitPattern matches the abbreviated or full commit shas accepted in
+// permalinks.  Other revisions such as branch names are rejected because
+// the content they refer to changes.
+var commitPattern = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// splitCommit splits a permalink of the form importpath@sha into the
+// import path and the commit sha.  The sha is empty if the path is not a
+// permalink.
+func splitCommit(p string) (string, string) {
+	i := strings.LastIndex(p, "@")
+	if i < 0 {
+		return p, ""
+	}
+	return p[:i], p[i+1:]
+}
+
+// parseCommit parses the non-test go files of the package directory, given
+// relative to the repository root, as they were at the commit.  The full
+// sha of the commit is returned with the files.  The file names are set to
+// their location in the checkout so that positions map to the repository.
+func (h *HTML) parseCommit(fset *token.FileSet, r repository, rel, sha string) ([]*ast.File, string, error) {
+	repo, err := git.PlainOpen(r.LocalPath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	hash, err := repo.ResolveRevision(plumbing.Revision(sha))
+	if err != nil {
+		return nil, "", err
+	}
+
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, "", err
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, "", err
+	}
+	if rel != "" {
+		if tree, err = tree.Tree(rel); err != nil {
+			return nil, "", err
+		}
+	}
+
+	dir := filepath.Join(r.LocalPath, filepath.FromSlash(rel))
+	contents := make(map[string]string)
+	for _, e := range tree.Entries {
+		if !e.Mode.IsFile() || !strings.HasSuffix(e.Name, ".go") || strings.HasSuffix(e.Name, "_test.go") {
+			continue
+		}
+
+		f, err := tree.TreeEntryFile(&e)
+		if err != nil {
+			return nil, "", err
+		}
+		if contents[filepath.Join(dir, e.Name)], err = f.Contents(); err != nil {
+			return nil, "", err
+		}
+	}
+
+	// Match the build constraints against the committed contents rather
+	// than the files in the checkout.
+	ctxt := build.Default
+	ctxt.OpenFile = func(name string) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(contents[name])), nil
+	}
+
+	var files []*ast.File
+	for name, src := range contents {
+		if ok, err := ctxt.MatchFile(dir, filepath.Base(name)); err != nil || !ok {
+			continue
+		}
+
+		f, err := parser.ParseFile(fset, name, src, parser.ParseComments)
+		if err != nil {
+			return nil, "", err
+		}
+		if h.options.ExcludeGenerated && isGenerated(f) {
+			continue
+		}
+		files = append(files, f)
+	}
+
+	return files, hash.String(), nil
+}
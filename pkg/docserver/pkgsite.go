@@ -0,0 +1,139 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package docserver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// defaultReloadInterval is how often pkgsite is restarted to pick up new
+// repositories when the index interval is zero.
+const defaultReloadInterval = 5 * time.Minute
+
+// Pkgsite is a backend that serves documentation with the pkgsite command.
+// Pkgsite loads the modules it serves at startup, so it is restarted at the
+// index interval to pick up repositories that have been added since.
+type Pkgsite struct {
+	// The GodocOptions that was passed into NewPkgsite.
+	options GodocOptions
+	// The runner used to execute pkgsite.
+	runner CommandRunner
+	// The logger used by the pkgsite service.
+	logger *zap.Logger
+}
+
+// NewPkgsite returns an initialized Pkgsite struct
+func NewPkgsite(g GodocOptions) *Pkgsite {
+	runner := g.Runner
+	if runner == nil {
+		runner = g.execRunner()
+	}
+
+	return &Pkgsite{
+		options: g,
+		runner:  runner,
+		logger:  g.Logger,
+	}
+}
+
+// Start runs the pkgsite service.  Each time the service is started, the
+// workspace is scanned for modules which are passed to pkgsite.  A negative
+// index interval starts pkgsite only once.
+func (p *Pkgsite) Start(ctx context.Context) error {
+	pkgsite, err := p.runner.LookPath("pkgsite")
+	if err != nil {
+		p.logger.Error("unable to find pkgsite in the path")
+		return err
+	}
+
+	interval, err := time.ParseDuration(p.options.GodocIndexInterval)
+	if err != nil {
+		return err
+	}
+	if interval == 0 {
+		interval = defaultReloadInterval
+	}
+
+	for {
+		modules, err := p.modules()
+		if err != nil {
+			return err
+		}
+
+		arg := append([]string{"-http=" + p.options.address()}, modules...)
+		if interval < 0 {
+			return p.runner.Run(ctx, pkgsite, arg...)
+		}
+
+		p.logger.Debug("starting pkgsite", zap.Int("modules", len(modules)))
+		rctx, cancel := context.WithTimeout(ctx, interval)
+		err = p.runner.Run(rctx, pkgsite, arg...)
+		cancel()
+
+		if ctx.Err() != nil {
+			return nil
+		}
+		if rctx.Err() == nil {
+			// Pkgsite exited on its own before it was reloaded.
+			return err
+		}
+	}
+}
+
+// modules returns the directories in the workspace that contain a go.mod
+// file.  Directories below a module are not searched.
+func (p *Pkgsite) modules() ([]string, error) {
+	var modules []string
+	root := filepath.Join(p.options.GodocRoot, "src")
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		if !info.IsDir() {
+			return nil
+		}
+
+		if skipDir(info.Name()) && path != root {
+			return filepath.SkipDir
+		}
+
+		if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+			modules = append(modules, path)
+			return filepath.SkipDir
+		}
+
+		return nil
+	})
+
+	return modules, err
+}
+
+// skipDir returns true for directories that the go tool ignores.
+func skipDir(name string) bool {
+	return name == "testdata" || name == "vendor" || name[0] == '.' || name[0] == '_'
+}
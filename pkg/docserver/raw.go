@@ -0,0 +1,203 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package docserver
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"go.uber.org/zap"
+)
+
+// DefaultMaxAssetSize is the largest asset served from the synchronized
+// repositories when no limit is configured.
+const DefaultMaxAssetSize = 5 << 20
+
+// assetTypes are the content types of the files served from the
+// synchronized repositories by their extension.  Other files are not
+// served.
+var assetTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".svg":  "image/svg+xml",
+	".webp": "image/webp",
+	".ico":  "image/x-icon",
+}
+
+// assetPolicy is the content security policy of the assets.  SVG images
+// can contain scripts, which are kept from running when an image is opened
+// directly.
+const assetPolicy = "default-src 'none'; style-src 'unsafe-inline'; sandbox"
+
+// errAssetTooLarge is returned for assets larger than the limit.
+var errAssetTooLarge = errors.New("asset too large")
+
+// raw serves an image from the synchronized source tree, such as the
+// images referenced by package readmes.  The rev query parameter serves the
+// file from one of the additional branches or from a commit of its
+// repository instead.
+func (h *HTML) raw(w http.ResponseWriter, r *http.Request, p string) {
+	clean := path.Clean("/" + p)[1:]
+	ctype, known := assetTypes[strings.ToLower(path.Ext(clean))]
+	if clean == "" || clean != p || !known || gitDir(clean) {
+		http.NotFound(w, r)
+		return
+	}
+
+	rev := r.URL.Query().Get("rev")
+	var err error
+	w.Header().Set("Content-Type", ctype)
+	w.Header().Set("Content-Security-Policy", assetPolicy)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if repo, ok := h.repository(clean); ok && h.noIndex(repo) {
+		w.Header().Set("X-Robots-Tag", noIndexTag)
+	}
+	if rev == "" {
+		err = h.serveFile(w, r, h.src(), clean)
+	} else {
+		err = h.serveRevision(w, r, clean, rev)
+	}
+	if err != nil {
+		w.Header().Del("Content-Type")
+		h.logger.Debug("unable to serve asset", zap.String("path", clean), zap.String("rev", rev), zap.Error(err))
+		http.NotFound(w, r)
+	}
+}
+
+// serveRevision serves the file from the checkout of a branch or from a
+// commit of its repository.
+func (h *HTML) serveRevision(w http.ResponseWriter, r *http.Request, clean, rev string) error {
+	repo, ok := h.repository(clean)
+	if !ok {
+		return os.ErrNotExist
+	}
+	rel := strings.Trim(strings.TrimPrefix(clean, repo.ImportPath), "/")
+
+	for _, b := range repo.Branches {
+		if b.Name == rev {
+			return h.serveFile(w, r, b.LocalPath, rel)
+		}
+	}
+	if !commitPattern.MatchString(rev) {
+		return os.ErrNotExist
+	}
+
+	data, err := commitAsset(repo.LocalPath, rev, rel, h.maxAssetSize())
+	if err != nil {
+		return err
+	}
+
+	// The content of a commit never changes.
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	http.ServeContent(w, r, clean, time.Time{}, strings.NewReader(data))
+	return nil
+}
+
+// serveFile serves the file, given as a slash separated path relative to
+// the root directory.  Symbolic links are followed as long as they stay
+// within the root.
+func (h *HTML) serveFile(w http.ResponseWriter, r *http.Request, root, name string) error {
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	file, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(name)))
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(file, root+string(filepath.Separator)) {
+		return os.ErrNotExist
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	switch {
+	case err != nil:
+		return err
+	case !info.Mode().IsRegular():
+		return os.ErrNotExist
+	case info.Size() > h.maxAssetSize():
+		return errAssetTooLarge
+	}
+
+	http.ServeContent(w, r, name, info.ModTime(), f)
+	return nil
+}
+
+// commitAsset returns the contents of the file, given relative to the
+// repository root, as it was at the commit.
+func commitAsset(localPath, sha, rel string, limit int64) (string, error) {
+	repo, err := git.PlainOpen(localPath)
+	if err != nil {
+		return "", err
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(sha))
+	if err != nil {
+		return "", err
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := commit.File(rel)
+	switch {
+	case err != nil:
+		return "", err
+	case f.Mode != filemode.Regular && f.Mode != filemode.Executable:
+		return "", os.ErrNotExist
+	case f.Size > limit:
+		return "", errAssetTooLarge
+	}
+	return f.Contents()
+}
+
+// maxAssetSize returns the configured asset size limit or the default.
+func (h *HTML) maxAssetSize() int64 {
+	if h.options.MaxAssetSize <= 0 {
+		return DefaultMaxAssetSize
+	}
+	return h.options.MaxAssetSize
+}
+
+// gitDir returns true if any element of the slash separated path is a git
+// directory.
+func gitDir(p string) bool {
+	for _, name := range strings.Split(p, "/") {
+		if name == ".git" {
+			return true
+		}
+	}
+	return false
+}
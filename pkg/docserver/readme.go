@@ -0,0 +1,141 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package docserver
+
+import (
+	"html/template"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// readmeNames are the files rendered at the top of a package page, in the
+// order they are looked for.
+var readmeNames = []string{"README.md", "readme.md", "Readme.md", "doc.md"}
+
+// maxReadmeSize is the largest readme that is rendered.
+const maxReadmeSize = 1 << 20
+
+// readme renders the readme of the package at the import path.  The readme
+// is read from dir, or from the commit sha when dir is empty.  sha is the
+// revision the page is rendered from.  Links relative to the readme point
+// at the source host and images are served from the source tree.  Reports
+// whether the readme has mermaid diagrams.
+func (h *HTML) readme(repo *repository, importPath, dir, rel, sha string) (template.HTML, bool) {
+	var src string
+	var found bool
+	if dir != "" {
+		src, found = readReadme(dir)
+	} else if repo != nil {
+		src, found = commitReadme(repo.LocalPath, sha, rel)
+	}
+	if !found {
+		return "", false
+	}
+
+	m := markdownRenderer{
+		resolve: func(ref string, image bool) string {
+			// Targets starting with a slash are relative to the root of
+			// the repository.
+			target := path.Join(rel, ref)
+			if strings.HasPrefix(ref, "/") {
+				target = path.Clean(ref)[1:]
+			}
+			if strings.HasPrefix(target, "../") || target == ".." {
+				return ""
+			}
+
+			if !image {
+				if repo == nil {
+					return ""
+				}
+				return sourceURL(repo.Repo, "blob", target, 0)
+			}
+
+			u, err := url.Parse(target)
+			if err != nil {
+				return ""
+			}
+			root := strings.TrimSuffix(importPath, rel)
+			if repo != nil {
+				root = repo.ImportPath
+			} else if strings.HasPrefix(ref, "/") {
+				return ""
+			}
+			asset := "/raw/" + path.Join(root, u.Path)
+			if sha != "" {
+				asset += "?rev=" + url.QueryEscape(sha)
+			}
+			return asset
+		},
+		plantUML: h.options.PlantUMLServer,
+	}
+	out := m.render(src)
+	return out, m.mermaid
+}
+
+// readReadme returns the contents of the first readme in the directory.
+func readReadme(dir string) (string, bool) {
+	for _, name := range readmeNames {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(f, maxReadmeSize))
+		f.Close()
+		if err == nil {
+			return string(data), true
+		}
+	}
+	return "", false
+}
+
+// commitReadme returns the contents of the first readme in the directory,
+// given relative to the repository root, as it was at the commit.
+func commitReadme(localPath, sha, rel string) (string, bool) {
+	repo, err := git.PlainOpen(localPath)
+	if err != nil {
+		return "", false
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(sha))
+	if err != nil {
+		return "", false
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return "", false
+	}
+
+	for _, name := range readmeNames {
+		f, err := commit.File(path.Join(rel, name))
+		if err != nil || f.Size > maxReadmeSize {
+			continue
+		}
+		if src, err := f.Contents(); err == nil {
+			return src, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,58 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package docserver
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+)
+
+// noIndexTag is the X-Robots-Tag sent with the pages and images of the
+// repositories that are kept out of search engines.
+const noIndexTag = "noindex, nofollow, noarchive"
+
+// noIndex returns true if the repository is kept out of search engines.
+func (h *HTML) noIndex(r repository) bool {
+	return syncer.MatchRepo(h.options.NoIndexRepos, r.Owner, r.Name)
+}
+
+// robots writes a robots.txt that keeps crawlers away from the pages and
+// images of the repositories that are kept out of search engines.
+func (h *HTML) robots(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+	b.WriteString("User-agent: *\n")
+
+	disallowed := false
+	for _, repo := range h.repositories() {
+		if repo.ImportPath == "" || !h.noIndex(repo) {
+			continue
+		}
+		b.WriteString("Disallow: /pkg/" + repo.ImportPath + "\n")
+		b.WriteString("Disallow: /raw/" + repo.ImportPath + "\n")
+		disallowed = true
+	}
+	if !disallowed {
+		b.WriteString("Disallow:\n")
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
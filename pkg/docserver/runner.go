@@ -0,0 +1,130 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package docserver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// terminateGracePeriod is how long a command is given to exit after it has
+// been asked to terminate before it is killed.
+const terminateGracePeriod = 10 * time.Second
+
+// CommandRunner locates and runs the external commands used by the godoc
+// service.
+type CommandRunner interface {
+	// LookPath searches for an executable named file in the directories
+	// named by the PATH environment variable.
+	LookPath(file string) (string, error)
+	// Run starts the named program with the given arguments and waits for
+	// it to exit.  The program is killed if the context is cancelled.
+	Run(ctx context.Context, name string, arg ...string) error
+}
+
+// ExecRunner is a CommandRunner backed by the os/exec package.
+type ExecRunner struct {
+	// The resource limits applied to the commands.
+	Limits Limits
+	// The variables, in the form key=value, added to the environment of
+	// the commands.
+	Env []string
+	// Only the variables named here are inherited from the environment of
+	// gdoc.  Nil inherits the whole environment.
+	Inherit []string
+}
+
+// environ returns the environment of a command.  Variables set in Env and
+// through the limits replace inherited ones since later values win.
+func (e ExecRunner) environ() []string {
+	env := os.Environ()
+	if e.Inherit != nil {
+		allowed := make(map[string]bool, len(e.Inherit))
+		for _, name := range e.Inherit {
+			allowed[name] = true
+		}
+
+		env = nil
+		for _, kv := range os.Environ() {
+			if allowed[strings.SplitN(kv, "=", 2)[0]] {
+				env = append(env, kv)
+			}
+		}
+	}
+
+	env = append(env, e.Env...)
+	return append(env, e.Limits.env()...)
+}
+
+// LookPath searches for an executable using exec.LookPath.
+func (ExecRunner) LookPath(file string) (string, error) {
+	return exec.LookPath(file)
+}
+
+// Run starts the program and waits for it to exit.  When the context is
+// cancelled the program is asked to terminate in the way that is native to
+// the platform and is killed if it has not exited within the grace period.
+// The program runs with the resource limits and ErrOutOfMemory is returned
+// if it was killed for running out of memory.
+func (e ExecRunner) Run(ctx context.Context, name string, arg ...string) error {
+	cmd := exec.Command(name, arg...)
+	cmd.Env = e.environ()
+
+	oomKills := e.Limits.oomKills()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if err := e.Limits.apply(cmd.Process.Pid); err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return fmt.Errorf("unable to apply resource limits: %w", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		if e.Limits.outOfMemory(err, oomKills) {
+			return fmt.Errorf("%s %w: %v", filepath.Base(name), ErrOutOfMemory, err)
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	if err := terminate(cmd); err != nil {
+		_ = cmd.Process.Kill()
+	}
+
+	select {
+	case <-done:
+	case <-time.After(terminateGracePeriod):
+		_ = cmd.Process.Kill()
+		<-done
+	}
+
+	return ctx.Err()
+}
@@ -0,0 +1,59 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package docserver
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+)
+
+// sourceURL returns the link to a file or directory of the repository on
+// its source host at the synchronized commit.  kind is either "blob" for
+// files or "tree" for directories and a line greater than zero links to
+// that line of a file.  An empty string is returned if the repository does
+// not have a web address or has not been synchronized.
+func sourceURL(r syncer.Repo, kind string, p string, line int) string {
+	base := r.HTMLURL
+	if base == "" {
+		base = strings.TrimSuffix(r.CloneURL, ".git")
+	}
+
+	u, err := url.Parse(base)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || r.CommitSHA == "" {
+		return ""
+	}
+
+	// Gitlab places the file views below a /-/ path segment.
+	if strings.Contains(u.Host, "gitlab") {
+		kind = "-/" + kind
+	}
+
+	link := fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(base, "/"), kind, r.CommitSHA)
+	if p != "" {
+		link += "/" + p
+	}
+	if line > 0 {
+		link += fmt.Sprintf("#L%d", line)
+	}
+
+	return link
+}
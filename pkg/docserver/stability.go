@@ -0,0 +1,67 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package docserver
+
+import (
+	"regexp"
+	"strings"
+)
+
+// The stability levels of a package.
+const (
+	// StabilityStable is a package of a module released at v1 or later.
+	StabilityStable = "stable"
+	// StabilityUnstable is a package of a module that has only been
+	// released at v0.
+	StabilityUnstable = "unstable"
+	// StabilityExperimental is a package whose doc comment marks it as
+	// experimental.
+	StabilityExperimental = "experimental"
+)
+
+// experimentalPrefix starts the paragraph of a package doc comment that
+// marks the package as experimental.
+const experimentalPrefix = "Experimental: "
+
+// majorPattern matches the major version subdirectory of a v2 or later
+// module.
+var majorPattern = regexp.MustCompile(`^v([2-9]|[1-9][0-9]+)$`)
+
+// Stability returns the stability of a package from its doc comment, its
+// path relative to the repository root and the newest release of the
+// repository.  It returns an empty string if the repository has not been
+// released.
+func Stability(doc, rel, version string) string {
+	for _, para := range strings.Split(doc, "\n\n") {
+		if strings.HasPrefix(strings.TrimSpace(para), experimentalPrefix) {
+			return StabilityExperimental
+		}
+	}
+
+	switch {
+	case majorPattern.MatchString(strings.SplitN(rel, "/", 2)[0]):
+		return StabilityStable
+	case version == "":
+		return ""
+	case strings.HasPrefix(version, "v0."):
+		return StabilityUnstable
+	default:
+		return StabilityStable
+	}
+}
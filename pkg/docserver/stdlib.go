@@ -0,0 +1,92 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package docserver
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// StdlibRelease is a release of the standard library that is documented
+// by the html backend alongside the one in the GodocRoot.
+type StdlibRelease struct {
+	// The release, such as go1.21.5.
+	Version string
+	// The directory containing the src directory of the release.
+	Root string
+}
+
+// isStdlib returns true if the import path belongs to the standard library,
+// whose first path element never contains a dot.
+func isStdlib(importPath string) bool {
+	first := strings.SplitN(importPath, "/", 2)[0]
+	return first != "" && !strings.Contains(first, ".")
+}
+
+// stdlibRelease returns the additional release of the standard library
+// with the version.
+func (h *HTML) stdlibRelease(version string) (StdlibRelease, bool) {
+	for _, r := range h.options.StdlibReleases {
+		if r.Version == version {
+			return r, true
+		}
+	}
+	return StdlibRelease{}, false
+}
+
+// versionLinks returns the links to the standard library package in the
+// releases that contain it.  version is the release the page is rendered
+// from and is empty for the release in the GodocRoot.  No links are
+// returned unless additional releases are configured.
+func (h *HTML) versionLinks(importPath, version string) []branchLink {
+	if len(h.options.StdlibReleases) == 0 {
+		return nil
+	}
+
+	var links []branchLink
+	if exists(filepath.Join(h.src(), filepath.FromSlash(importPath))) {
+		name := h.options.StdlibVersion
+		if name == "" {
+			name = "GOROOT"
+		}
+		links = append(links, branchLink{
+			Name:    name,
+			URL:     "/pkg/" + importPath,
+			Current: version == "",
+		})
+	}
+	for _, r := range h.options.StdlibReleases {
+		if !exists(filepath.Join(r.Root, "src", filepath.FromSlash(importPath))) {
+			continue
+		}
+		links = append(links, branchLink{
+			Name:    r.Version,
+			URL:     "/pkg/" + importPath + "@" + r.Version,
+			Current: version == r.Version,
+		})
+	}
+	return links
+}
+
+// exists returns true if the directory exists.
+func exists(dir string) bool {
+	info, err := os.Stat(dir)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,96 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package docserver
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// errNoCommit is returned when no commit of the repository is known at
+// the requested time.
+var errNoCommit = errors.New("no commit at the requested time")
+
+// parseDate parses the dates accepted in place of a commit, either a day
+// such as 2022-03-01 or an RFC 3339 time.  A day refers to the end of that
+// day in UTC.
+func parseDate(s string) (time.Time, bool) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t.Add(24*time.Hour - time.Nanosecond), true
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// commitAt returns the commit the repository was synchronized to at the
+// time.  The sync history is used when it is available since it records
+// what was being served.  Otherwise, or if the history does not go back
+// far enough, the commit log of the local copy is searched.  Local copies
+// are shallow, so the log only reaches back to the first commit that was
+// synchronized unless the repository was seeded from a full checkout.
+func (h *HTML) commitAt(r repository, t time.Time) (string, error) {
+	if hl, ok := h.options.Repositories.(HistoryLister); ok {
+		for _, c := range hl.History() {
+			for i := len(c.Events) - 1; i >= 0; i-- {
+				e := c.Events[i]
+				if e.Owner != r.Owner || e.Name != r.Name || e.CommitSHA == "" || e.Time.After(t) {
+					continue
+				}
+				if e.Outcome == "cloned" || e.Outcome == "updated" || e.Outcome == "up-to-date" {
+					return e.CommitSHA, nil
+				}
+			}
+		}
+	}
+
+	return logAt(r.LocalPath, t)
+}
+
+// logAt returns the newest commit of the checked out branch that was
+// committed at or before the time.  The search stops at the boundary of a
+// shallow clone.
+func logAt(dir string, t time.Time) (string, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return "", err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return "", err
+	}
+
+	commit, err := repo.CommitObject(head.Hash())
+	for err == nil {
+		if !commit.Committer.When.After(t) {
+			return commit.Hash.String(), nil
+		}
+		commit, err = commit.Parents().Next()
+	}
+	if errors.Is(err, plumbing.ErrObjectNotFound) || errors.Is(err, io.EOF) {
+		return "", errNoCommit
+	}
+	return "", err
+}
@@ -0,0 +1 @@
+mermaid.initialize({startOnLoad: true});
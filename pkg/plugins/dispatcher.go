@@ -0,0 +1,90 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package plugins
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+	"go.uber.org/zap"
+)
+
+// DispatcherOptions defines the options available for running the
+// dispatcher.
+type DispatcherOptions struct {
+	// The processors that messages are passed to.
+	Processors []Processor
+	// The bus that the syncer publishes messages on.
+	Bus *syncer.Bus
+	// The logger used by the dispatcher. Initially set in the config.
+	Logger *zap.Logger
+}
+
+// Dispatcher is a service that passes the messages published by the
+// syncer to the processors.
+type Dispatcher struct {
+	// The DispatcherOptions that was passed into NewDispatcher.
+	options DispatcherOptions
+	// The logger used by the dispatcher.
+	logger *zap.Logger
+}
+
+// NewDispatcher returns an initialized Dispatcher struct.
+func NewDispatcher(o DispatcherOptions) *Dispatcher {
+	return &Dispatcher{
+		options: o,
+		logger:  o.Logger,
+	}
+}
+
+// Start runs the dispatcher until the context is cancelled.  Each processor
+// receives messages on its own channel so a slow processor only drops its
+// own messages.
+func (d *Dispatcher) Start(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for _, p := range d.options.Processors {
+		messages := make(chan syncer.Message, 16)
+		d.options.Bus.Subscribe(messages)
+		defer d.options.Bus.Unsubscribe(messages)
+
+		wg.Add(1)
+		go func(p Processor) {
+			defer wg.Done()
+			d.run(ctx, p, messages)
+		}(p)
+	}
+
+	wg.Wait()
+	return nil
+}
+
+// run passes messages to the processor until the context is cancelled.
+func (d *Dispatcher) run(ctx context.Context, p Processor, messages <-chan syncer.Message) {
+	for {
+		select {
+		case m := <-messages:
+			if err := p.Process(ctx, m); err != nil {
+				d.logger.Error("processor failed", zap.String("processor", p.Name()), zap.String("type", string(m.Type)), zap.Error(err))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+// Package plugins loads Go plugins that extend gdoc with additional
+// repository providers, notifiers, post-sync processors and authentication
+// backends.
+//
+// A plugin is a main package built with -buildmode=plugin against the same
+// version of gdoc and Go toolchain that loads it.  It exports a Register
+// function that adds its extensions to the registry:
+//
+//	func Register(r *plugins.Registry) error {
+//		r.RegisterNotifier(&chat{url: os.Getenv("CHAT_URL")})
+//		return nil
+//	}
+package plugins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"plugin"
+
+	"github.com/ctxswitch/gdoc/pkg/syncer"
+	"go.uber.org/zap"
+)
+
+// RegisterSymbol is the name of the function that plugins export.
+const RegisterSymbol = "Register"
+
+// ErrProviderRegistered is returned when a second repository provider is
+// registered.
+var ErrProviderRegistered = errors.New("a repository provider has already been registered")
+
+// Notification is an event sent to the notifiers.
+type Notification struct {
+	// The severity of the event: info, warning or critical.
+	Severity string
+	// A key that identifies the condition, such as the repository that is
+	// failing.
+	Key string
+	// A single line describing the event.
+	Summary string
+	// Additional details about the event.
+	Details map[string]string
+}
+
+// Notifier delivers notifications to an external service.
+type Notifier interface {
+	// Name returns the name of the notifier used in the logs.
+	Name() string
+	// Notify delivers a single notification.
+	Notify(ctx context.Context, n Notification) error
+}
+
+// Processor acts on the messages that the syncer publishes, such as
+// repository updates and completed sync cycles.
+type Processor interface {
+	// Name returns the name of the processor used in the logs.
+	Name() string
+	// Process handles a single message.  Messages are passed to each
+	// processor one at a time.
+	Process(ctx context.Context, m syncer.Message) error
+}
+
+// Authenticator identifies the callers of the management API.
+type Authenticator interface {
+	// Name returns the name of the authenticator used in the logs.
+	Name() string
+	// Authenticate returns the name of the caller.  An empty name and nil
+	// error means that the request does not carry credentials that the
+	// authenticator handles.  An error means that the credentials were
+	// rejected.
+	Authenticate(r *http.Request) (string, error)
+}
+
+// GroupAuthenticator is an Authenticator that also reports the groups of
+// the caller, such as the groups or roles claim of an OIDC token, so that
+// roles can be given to groups instead of individual users.
+type GroupAuthenticator interface {
+	Authenticator
+	// AuthenticateGroups is Authenticate that also returns the groups of
+	// the caller.
+	AuthenticateGroups(r *http.Request) (string, []string, error)
+}
+
+// Registry collects the extensions registered by the plugins.
+type Registry struct {
+	provider       syncer.RepositoryProvider
+	notifiers      []Notifier
+	processors     []Processor
+	authenticators []Authenticator
+	logger         *zap.Logger
+}
+
+// Load opens the plugins at the given paths and calls their Register
+// functions.
+func Load(paths []string, logger *zap.Logger) (*Registry, error) {
+	r := &Registry{logger: logger}
+	for _, path := range paths {
+		p, err := plugin.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open plugin %s: %w", path, err)
+		}
+
+		sym, err := p.Lookup(RegisterSymbol)
+		if err != nil {
+			return nil, fmt.Errorf("plugin %s: %w", path, err)
+		}
+
+		register, ok := sym.(func(*Registry) error)
+		if !ok {
+			return nil, fmt.Errorf("plugin %s: %s must be a func(*plugins.Registry) error", path, RegisterSymbol)
+		}
+
+		if err := register(r); err != nil {
+			return nil, fmt.Errorf("unable to register plugin %s: %w", path, err)
+		}
+		logger.Info("loaded plugin", zap.String("path", path))
+	}
+	return r, nil
+}
+
+// Logger returns the logger that plugins should use.
+func (r *Registry) Logger() *zap.Logger {
+	return r.logger
+}
+
+// RegisterProvider replaces the Github provider with a provider that
+// discovers repositories elsewhere.  Only one provider may be registered.
+func (r *Registry) RegisterProvider(p syncer.RepositoryProvider) error {
+	if r.provider != nil {
+		return ErrProviderRegistered
+	}
+	r.provider = p
+	return nil
+}
+
+// RegisterNotifier adds a notifier that receives the events of the sync
+// cycles.
+func (r *Registry) RegisterNotifier(n Notifier) {
+	r.notifiers = append(r.notifiers, n)
+}
+
+// RegisterProcessor adds a processor that receives the messages published
+// by the syncer.
+func (r *Registry) RegisterProcessor(p Processor) {
+	r.processors = append(r.processors, p)
+}
+
+// RegisterAuthenticator adds an authenticator for the management API.
+func (r *Registry) RegisterAuthenticator(a Authenticator) {
+	r.authenticators = append(r.authenticators, a)
+}
+
+// Provider returns the registered provider or nil if no provider has been
+// registered.
+func (r *Registry) Provider() syncer.RepositoryProvider {
+	return r.provider
+}
+
+// Notifiers returns the registered notifiers.
+func (r *Registry) Notifiers() []Notifier {
+	return r.notifiers
+}
+
+// Processors returns the registered processors.
+func (r *Registry) Processors() []Processor {
+	return r.processors
+}
+
+// Authenticators returns the registered authenticators.
+func (r *Registry) Authenticators() []Authenticator {
+	return r.authenticators
+}
@@ -0,0 +1,134 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"context"
+	"net/url"
+	"path/filepath"
+
+	"go.uber.org/zap"
+)
+
+// branchesDir is the directory relative to GodocRoot where the additional
+// branches of the repositories are checked out.  It starts with a dot so
+// godoc does not index the checkouts as duplicates of the default branch.
+const branchesDir = ".gdoc/branches"
+
+// Branch is a branch of a repository that is checked out next to its
+// default branch.
+type Branch struct {
+	Name      string `json:"name"`
+	CommitSHA string `json:"commit_sha"`
+	LocalPath string `json:"local_path"`
+}
+
+// branches returns the names of the additional branches that are checked
+// out for the repository.  The default branch is never included.
+func (rs *Syncer) branches(r *Repo) []string {
+	names, ok := rs.options.RepoBranches[r.Owner+"/"+r.Name]
+	if !ok {
+		names = rs.options.Branches
+	}
+
+	var out []string
+	for _, n := range names {
+		if n != "" && n != r.DefaultBranch {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// syncBranches brings the checkouts of the additional branches of the
+// repository up to date and sets them on the repository.  It returns true
+// if any of the branches has been cloned or updated.
+func (rs *Syncer) syncBranches(ctx context.Context, r *Repo) (bool, error) {
+	names := rs.branches(r)
+	if len(names) == 0 {
+		r.Branches = nil
+		return false, nil
+	}
+
+	previous := make(map[string]Branch)
+	rs.mu.RLock()
+	if stored, ok := rs.repos[r.Name+"/"+r.Owner]; ok {
+		for _, b := range stored.Branches {
+			previous[b.Name] = b
+		}
+	}
+	rs.mu.RUnlock()
+
+	changed := false
+	r.Branches = make([]Branch, 0, len(names))
+	for _, name := range names {
+		b := Branch{
+			Name:      name,
+			LocalPath: filepath.Join(rs.options.GodocRoot, branchesDir, r.Owner, r.Name, url.PathEscape(name)),
+		}
+
+		actx, cancel := withTimeout(ctx, rs.options.APITimeout)
+		sha, err := rs.git.RemoteCommit(actx, r, name)
+		cancel()
+		if err != nil {
+			return false, wrap("commit", r, err, nil)
+		}
+		b.CommitSHA = sha
+
+		if p, ok := previous[name]; ok && p.CommitSHA == sha && !missing(b.LocalPath) && rs.intact(&Repo{LocalPath: b.LocalPath}, sha) {
+			r.Branches = append(r.Branches, b)
+			continue
+		}
+
+		if err := rs.checkout(ctx, r, b); err != nil {
+			return false, err
+		}
+		changed = true
+		r.Branches = append(r.Branches, b)
+	}
+
+	return changed, nil
+}
+
+// checkout clones the branch of the repository into its local path, or
+// pulls it if it has been cloned before.
+func (rs *Syncer) checkout(ctx context.Context, r *Repo, b Branch) error {
+	br := *r
+	br.Ref = b.Name
+	br.LocalPath = b.LocalPath
+	defer rs.locks.Lock(b.LocalPath)()
+
+	if err := rs.repair(&br); err != nil {
+		return err
+	}
+
+	if missing(br.LocalPath) {
+		rs.logger.Info("cloning branch", zap.Any("repo", r), zap.String("branch", b.Name))
+		staged, err := rs.clone(ctx, &br, url.PathEscape(b.Name)+"@"+b.CommitSHA)
+		if err != nil {
+			return err
+		}
+		return place(staged, b.LocalPath)
+	}
+
+	rs.logger.Info("pulling branch", zap.Any("repo", r), zap.String("branch", b.Name))
+	ctx, cancel := withTimeout(ctx, rs.options.PullTimeout)
+	defer cancel()
+	return wrap("pull", r, ignoreUpToDate(rs.pull(ctx, &br)), nil)
+}
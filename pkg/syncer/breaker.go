@@ -0,0 +1,189 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// The states of the circuit breaker around the Github API.
+const (
+	// BreakerClosed lets every request through.
+	BreakerClosed = "closed"
+	// BreakerOpen fails every request without sending it.
+	BreakerOpen = "open"
+	// BreakerHalfOpen lets a single probe request through to find out
+	// whether the API has recovered.
+	BreakerHalfOpen = "half-open"
+)
+
+// DefaultBreakerCooldown is how long the circuit breaker waits before
+// probing the API again when no cooldown is configured.
+const DefaultBreakerCooldown = time.Minute
+
+// breakerMaxCooldown is how many times the initial cooldown the breaker
+// stays open at most after failed probes.
+const breakerMaxCooldown = 32
+
+// breakerState is the state of the breaker published through expvar.
+var breakerState = new(expvar.String)
+
+func init() {
+	breakerState.Set(BreakerClosed)
+	metrics.Set("github_breaker_state", breakerState)
+}
+
+// newBreakerTransport returns a closed breaker that opens after the number
+// of consecutive failures.
+func newBreakerTransport(next http.RoundTripper, threshold int, cooldown time.Duration, logger *zap.Logger) *breakerTransport {
+	return &breakerTransport{
+		next:      next,
+		threshold: threshold,
+		cooldown:  cooldown,
+		logger:    logger,
+		state:     BreakerClosed,
+		wait:      cooldown,
+	}
+}
+
+// breakerTransport stops sending requests to the Github API after a number
+// of consecutive failures, such as while Github is down or after the token
+// was revoked, so that every sync cycle does not hammer the API.  Once the
+// cooldown has passed a single probe request is let through: the breaker
+// closes if it succeeds and stays open for twice as long if it fails.
+type breakerTransport struct {
+	next http.RoundTripper
+	// The consecutive failures after which the breaker opens.
+	threshold int
+	// How long the breaker stays open after it first opens.
+	cooldown time.Duration
+	logger   *zap.Logger
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	// How long the breaker stays open the next time it opens.
+	wait time.Duration
+	// When the breaker was last opened.
+	opened time.Time
+}
+
+// RoundTrip executes the request unless the breaker is open and records
+// whether it failed.
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.allow() {
+		metrics.Add("github_breaker_rejected", 1)
+		return nil, ErrBreakerOpen
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil && errors.Is(req.Context().Err(), context.Canceled) {
+		t.abandon()
+		return resp, err
+	}
+
+	t.record(failed(resp, err))
+	return resp, err
+}
+
+// abandon reopens the breaker when the probe was cancelled, such as when
+// the service is stopped, so that the next request becomes the probe.
+func (t *breakerTransport) abandon() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.state == BreakerHalfOpen {
+		t.set(BreakerOpen)
+	}
+}
+
+// allow returns true if a request may be sent.  The first request after the
+// cooldown moves the breaker to half-open and becomes the probe.
+func (t *breakerTransport) allow() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch t.state {
+	case BreakerOpen:
+		if time.Since(t.opened) < t.wait {
+			return false
+		}
+		t.set(BreakerHalfOpen)
+		return true
+	case BreakerHalfOpen:
+		return false
+	default:
+		return true
+	}
+}
+
+// record updates the breaker with the result of a request.
+func (t *breakerTransport) record(failure bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !failure {
+		if t.state != BreakerClosed {
+			t.logger.Info("github api recovered, closing the circuit breaker")
+		}
+		t.failures = 0
+		t.wait = t.cooldown
+		t.set(BreakerClosed)
+		return
+	}
+
+	t.failures++
+	switch {
+	case t.state == BreakerHalfOpen:
+		if t.wait *= 2; t.wait > t.cooldown*breakerMaxCooldown {
+			t.wait = t.cooldown * breakerMaxCooldown
+		}
+	case t.failures < t.threshold:
+		return
+	}
+
+	t.opened = time.Now()
+	t.set(BreakerOpen)
+	metrics.Add("github_breaker_opened", 1)
+	t.logger.Warn("github api failing, opening the circuit breaker", zap.Int("failures", t.failures), zap.Duration("cooldown", t.wait))
+}
+
+// set changes the state of the breaker.  The lock must be held.
+func (t *breakerTransport) set(state string) {
+	t.state = state
+	breakerState.Set(state)
+}
+
+// failed returns true if the request failed in a way that is expected to
+// repeat on the next request: the API could not be reached, returned a
+// server error or rejected the credentials.  Rate limits are left to the
+// rate limit handling.
+func failed(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusUnauthorized
+}
@@ -0,0 +1,112 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType is the kind of a message published on the bus.
+type EventType string
+
+const (
+	// EventRepoUpdated is published when a repository has been cloned or
+	// updated.
+	EventRepoUpdated EventType = "repo_updated"
+	// EventRepoRemoved is published when a repository is no longer
+	// returned by the provider and is no longer synchronized.  Its local
+	// copy is left in place.
+	EventRepoRemoved EventType = "repo_removed"
+	// EventSyncCompleted is published when a sync cycle has completed.
+	EventSyncCompleted EventType = "sync_completed"
+)
+
+// Message is published on the bus when something happens in the syncer.
+type Message struct {
+	Type EventType `json:"type"`
+	Time time.Time `json:"time"`
+	// The repository that was updated or removed.  Nil for other types.
+	Repo *Repo `json:"repo,omitempty"`
+	// The summary of the completed cycle.  Nil for other types.
+	Summary *Summary `json:"summary,omitempty"`
+}
+
+// Bus delivers the messages published by the syncer to the services that
+// act on them, such as the indexers and notifiers.
+type Bus struct {
+	// The types each channel is subscribed to.  An empty list subscribes
+	// to every type.
+	subscribers map[chan<- Message][]EventType
+	mu          sync.RWMutex
+}
+
+// NewBus returns an initialized Bus struct.
+func NewBus() *Bus {
+	return &Bus{
+		subscribers: make(map[chan<- Message][]EventType),
+	}
+}
+
+// Subscribe registers a channel that receives the messages of the given
+// types, or of every type if none are given.  Messages are dropped if the
+// channel is not ready to receive, so a buffered channel should be used by
+// subscribers that do slow work.
+func (b *Bus) Subscribe(ch chan<- Message, types ...EventType) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[ch] = types
+}
+
+// Unsubscribe stops sending messages to the channel.
+func (b *Bus) Unsubscribe(ch chan<- Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subscribers, ch)
+}
+
+// Publish sends the message to every channel subscribed to its type
+// without blocking.
+func (b *Bus) Publish(m Message) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for ch, types := range b.subscribers {
+		if !subscribed(types, m.Type) {
+			continue
+		}
+		select {
+		case ch <- m:
+		default:
+		}
+	}
+}
+
+// subscribed returns true if the type is in the list or the list is empty.
+func subscribed(types []EventType, t EventType) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, s := range types {
+		if s == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Credentials describes whether Github accepts the configured credentials.
+type Credentials struct {
+	// False once Github has rejected the credentials.
+	Valid bool `json:"valid"`
+	// The error returned when the credentials were rejected.
+	Error string `json:"error,omitempty"`
+	// The time the credentials were first rejected.
+	Since *time.Time `json:"since,omitempty"`
+}
+
+// authProbe tracks the authentication failures of a sync cycle.  While the
+// credentials are invalid, the first repository that fails to
+// authenticate serves as the probe and the remaining repositories are
+// deferred instead of failing one after the other with the same error.
+type authProbe struct {
+	// Whether the credentials were invalid when the cycle started.
+	invalid bool
+	// The repositories that were attempted during the cycle.
+	tried int
+	// The repositories whose credentials were rejected.
+	failed int
+	// The last rejection.
+	err error
+}
+
+// deferred returns true if the remaining repositories of the cycle should
+// not be attempted.
+func (p *authProbe) deferred() bool {
+	return p.invalid && p.failed > 0
+}
+
+// record counts the outcome of a repository.  Repositories that were not
+// attempted, because they are paused, backing off or not requested yet,
+// are not counted.
+func (p *authProbe) record(o outcome, r *Repo, err error) {
+	switch {
+	case o == outcomePaused || o == outcomeDeferred:
+		return
+	case o == outcomeSkipped && r.CommitSHA == "":
+		return
+	}
+
+	p.tried++
+	if o == outcomeFailed && errors.Is(err, ErrAuth) {
+		p.failed++
+		p.err = err
+	}
+}
+
+// rejected returns true if every repository attempted during the cycle
+// failed to authenticate.  When no repository was attempted, the search
+// that listed them is taken as proof that the credentials are accepted.
+func (p *authProbe) rejected() bool {
+	return p.tried > 0 && p.failed == p.tried
+}
+
+// Credentials returns whether Github accepts the configured credentials.
+func (rs *Syncer) Credentials() Credentials {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	return rs.credentials
+}
+
+// credentialsRejected marks the credentials as invalid.  The transition is
+// logged once.
+func (rs *Syncer) credentialsRejected(err error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if rs.credentials.Valid {
+		now := rs.clock.Now()
+		rs.credentials.Since = &now
+		rs.logger.Error("github rejected the credentials, repositories are no longer attempted until they are accepted again", zap.Error(err))
+	}
+	rs.credentials.Valid = false
+	rs.credentials.Error = err.Error()
+}
+
+// credentialsAccepted marks the credentials as valid again.  The
+// repositories that failed because the credentials were rejected are
+// attempted again during the next cycle instead of waiting for their
+// backoff.
+func (rs *Syncer) credentialsAccepted() {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if rs.credentials.Valid {
+		return
+	}
+
+	rs.logger.Info("github accepted the credentials again")
+	rs.credentials = Credentials{Valid: true}
+	for key, f := range rs.state.Failures {
+		if f.Class == "auth" && !f.Dead {
+			delete(rs.state.Failures, key)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/google/go-github/v42/github"
+)
+
+// The classes of the errors returned by the syncer.  Use errors.Is to
+// check the class of an error.
+var (
+	// ErrRepoNotFound is returned when a repository has not been
+	// synchronized.
+	ErrRepoNotFound = errors.New("repository not found")
+	// ErrAuth is the class of errors caused by missing or rejected
+	// credentials.
+	ErrAuth = errors.New("authentication failed")
+	// ErrRateLimited is the class of errors caused by exceeding the
+	// Github API rate limits.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrCloneFailed is the class of other errors that occurred while
+	// cloning a repository.
+	ErrCloneFailed = errors.New("clone failed")
+	// ErrBreakerOpen is returned instead of calling the Github API while
+	// the circuit breaker is open after repeated failures.
+	ErrBreakerOpen = errors.New("github api circuit breaker is open")
+	// ErrLocked is returned when the sync lock is held by another
+	// instance.
+	ErrLocked = errors.New("sync lock is held by another instance")
+	// ErrOffline is returned when a repository is updated while offline
+	// mode is enabled.
+	ErrOffline = errors.New("offline mode is enabled")
+	// ErrPaused is returned when a paused or quarantined repository is
+	// requested to be cloned.
+	ErrPaused = errors.New("repository is paused")
+	// ErrTraceUnsupported is returned when tracing is toggled on a
+	// provider that can not log its calls.
+	ErrTraceUnsupported = errors.New("provider does not support tracing")
+)
+
+// Error is an error of an operation on a repository.  It matches its class
+// with errors.Is and unwraps to the underlying error.
+type Error struct {
+	// The operation that failed, such as commit, clone or pull.
+	Op    string
+	Owner string
+	Name  string
+	// The class of the error.  Nil if the error has not been classified.
+	Class error
+	Err   error
+}
+
+// Error returns the operation, repository and underlying error.
+func (e *Error) Error() string {
+	if e.Class != nil {
+		return fmt.Sprintf("%s %s/%s: %v: %v", e.Op, e.Owner, e.Name, e.Class, e.Err)
+	}
+	return fmt.Sprintf("%s %s/%s: %v", e.Op, e.Owner, e.Name, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the target is the class of the error.
+func (e *Error) Is(target error) bool {
+	return e.Class != nil && target == e.Class
+}
+
+// wrap returns the error of the operation on the repository with its class
+// set.  Errors that do not fall into one of the classes are given the
+// fallback class, which may be nil.
+func wrap(op string, r *Repo, err error, fallback error) error {
+	if err == nil {
+		return nil
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+
+	return &Error{
+		Op:    op,
+		Owner: r.Owner,
+		Name:  r.Name,
+		Class: classify(err, fallback),
+		Err:   err,
+	}
+}
+
+// classify returns the class of the error.
+func classify(err error, fallback error) error {
+	var rate *github.RateLimitError
+	var abuse *github.AbuseRateLimitError
+	var resp *github.ErrorResponse
+	switch {
+	case errors.As(err, &rate), errors.As(err, &abuse):
+		return ErrRateLimited
+	case errors.Is(err, transport.ErrAuthenticationRequired), errors.Is(err, transport.ErrAuthorizationFailed):
+		return ErrAuth
+	case errors.As(err, &resp) && resp.Response != nil && resp.Response.StatusCode == http.StatusUnauthorized:
+		return ErrAuth
+	}
+	return fallback
+}
+
+// className returns the name of the class of the error as used in the
+// failures.  Empty if the error has not been classified.
+func className(err error) string {
+	switch {
+	case errors.Is(err, ErrAuth):
+		return "auth"
+	case errors.Is(err, ErrRateLimited):
+		return "rate_limited"
+	case errors.Is(err, ErrCloneFailed):
+		return "clone_failed"
+	}
+	return ""
+}
@@ -0,0 +1,265 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+// fakeClock is a Clock whose time only moves when it is advanced.  Its
+// tickers only fire when they are ticked.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+// newFakeClock returns a clock set to a fixed time.
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+// Now returns the current time of the clock.
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTicker returns a ticker that fires when tick is called.
+func (c *fakeClock) NewTicker(d time.Duration) Ticker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTicker{c: make(chan time.Time, 1)}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+// advance moves the clock forward.
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// tick fires the newest ticker that has not been stopped.  It returns
+// false if there is none.
+func (c *fakeClock) tick() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := len(c.tickers) - 1; i >= 0; i-- {
+		t := c.tickers[i]
+		if !t.stopped() {
+			t.c <- c.now
+			return true
+		}
+	}
+	return false
+}
+
+// fakeTicker is a Ticker driven by a fakeClock.
+type fakeTicker struct {
+	mu   sync.Mutex
+	c    chan time.Time
+	stop bool
+}
+
+// C returns the channel that the ticks are delivered on.
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.c
+}
+
+// Stop turns off the ticker.
+func (t *fakeTicker) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stop = true
+}
+
+// stopped returns true once the ticker has been stopped.
+func (t *fakeTicker) stopped() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stop
+}
+
+// fakeProvider is a RepositoryProvider that returns a fixed set of
+// repositories and commits.
+type fakeProvider struct {
+	mu    sync.Mutex
+	repos []Repo
+	// The commit of each repository keyed by owner/name.
+	commits map[string]string
+	// The error returned by Repositories.
+	err error
+	// The errors returned by the next calls to Commit.  Each error is only
+	// returned once.
+	commitErrs []error
+}
+
+// Repositories calls fn with a copy of every repository.
+func (p *fakeProvider) Repositories(ctx context.Context, fn func(*Repo) error) error {
+	p.mu.Lock()
+	repos := append([]Repo(nil), p.repos...)
+	err := p.err
+	p.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	for i := range repos {
+		if err := fn(&repos[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Commit returns the commit of the repository.
+func (p *fakeProvider) Commit(ctx context.Context, r *Repo) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.commitErrs) > 0 {
+		err := p.commitErrs[0]
+		p.commitErrs = p.commitErrs[1:]
+		return "", err
+	}
+	return p.commits[r.Owner+"/"+r.Name], nil
+}
+
+// setCommit changes the commit of the repository.
+func (p *fakeProvider) setCommit(owner, name, sha string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.commits[owner+"/"+name] = sha
+}
+
+// fakeGit is a GitClient that creates empty local copies and records the
+// operations that were performed.
+type fakeGit struct {
+	mu     sync.Mutex
+	clones int
+	pulls  int
+	resets int
+	// The errors returned by the next calls to Clone and Pull.  Each error
+	// is only returned once.
+	cloneErrs []error
+	pullErrs  []error
+	// Called after every pull.  Optional.
+	afterPull func()
+}
+
+// Clone creates the local path of the repository.
+func (g *fakeGit) Clone(ctx context.Context, r *Repo) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.clones++
+	if len(g.cloneErrs) > 0 {
+		err := g.cloneErrs[0]
+		g.cloneErrs = g.cloneErrs[1:]
+		return err
+	}
+	return os.MkdirAll(r.LocalPath, 0755)
+}
+
+// Pull records the pull.
+func (g *fakeGit) Pull(ctx context.Context, r *Repo) error {
+	if g.afterPull != nil {
+		defer g.afterPull()
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.pulls++
+	if len(g.pullErrs) > 0 {
+		err := g.pullErrs[0]
+		g.pullErrs = g.pullErrs[1:]
+		return err
+	}
+	return nil
+}
+
+// Reset records the reset.
+func (g *fakeGit) Reset(ctx context.Context, r *Repo) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.resets++
+	return nil
+}
+
+// RemoteCommit is not used by the tests, which look up commits through
+// the provider.
+func (g *fakeGit) RemoteCommit(ctx context.Context, r *Repo, branch string) (string, error) {
+	return "", nil
+}
+
+// counts returns the number of clones and pulls.
+func (g *fakeGit) counts() (int, int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.clones, g.pulls
+}
+
+// fakeLock is a Locker that can be held by another instance or lost as soon
+// as it is acquired.
+type fakeLock struct {
+	mu   sync.Mutex
+	held bool
+	// Acquire returns false while the lock is held by another instance.
+	contended bool
+	// Acquire calls lost once the lock is taken.
+	lose bool
+	// The function called when the lock is lost.
+	lost func()
+}
+
+// Acquire takes the lock unless it is contended.
+func (l *fakeLock) Acquire(ctx context.Context, lost func()) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.contended {
+		return false, nil
+	}
+	l.held = true
+	l.lost = lost
+	if l.lose {
+		lost()
+	}
+	return true, nil
+}
+
+// expire loses the lock while it is held.
+func (l *fakeLock) expire() {
+	l.mu.Lock()
+	lost := l.lost
+	l.mu.Unlock()
+	if lost != nil {
+		lost()
+	}
+}
+
+// Release gives up the lock.
+func (l *fakeLock) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.held = false
+	return nil
+}
@@ -0,0 +1,384 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/osfs"
+	git "github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// GitClient performs the git operations needed to keep the local copies of
+// the repositories up to date.
+type GitClient interface {
+	// Clone clones the repository into its local path.
+	Clone(ctx context.Context, r *Repo) error
+	// Pull pulls the latest changes into the local copy of the repository.
+	Pull(ctx context.Context, r *Repo) error
+	// Reset fetches the branch of the repository and hard resets the local
+	// copy to it, discarding any local history.  It is used when the
+	// history of the remote branch has been rewritten.
+	Reset(ctx context.Context, r *Repo) error
+	// RemoteCommit returns the commit sha of a branch by listing the
+	// references of the remote repository.
+	RemoteCommit(ctx context.Context, r *Repo, branch string) (string, error)
+}
+
+// SetGitUserAgent sets the User-Agent sent on the git HTTP requests made by
+// go-git.  The git/1.0 product is kept at the start of the header since some
+// servers rely on it to identify git clients.  go-git only supports a single
+// HTTP transport for the process, so this applies to every GoGitClient.
+func SetGitUserAgent(userAgent string) {
+	ConfigureGitHTTP(GitHTTPOptions{UserAgent: userAgent})
+}
+
+// largestClone is the size of the largest clone published through expvar.
+var largestClone = new(expvar.Int)
+
+func init() {
+	metrics.Set("clone_bytes_largest", largestClone)
+}
+
+// GoGitOptions defines the options available for the go-git client.
+type GoGitOptions struct {
+	// The username and token used for HTTP basic authentication.  If the
+	// token is empty, the repositories are accessed anonymously.
+	Username string
+	Token    string
+	// Leave the tags out of clones.
+	NoTags bool
+	// Only clone the default branch instead of every branch.
+	SingleBranch bool
+	// The size in bytes of the cache of the objects read from the
+	// packfiles of a repository.  Zero uses the go-git default of 96MiB.
+	ObjectCacheSize int64
+}
+
+// GoGitClient is a GitClient that uses go-git and token based
+// authentication.
+type GoGitClient struct {
+	options GoGitOptions
+	auth    transport.AuthMethod
+}
+
+// NewGoGitClient returns a git client that authenticates with the username
+// and token using HTTP basic authentication.  If the token is empty, the
+// repositories are accessed anonymously.
+func NewGoGitClient(username string, token string) *GoGitClient {
+	return NewGoGitClientWithOptions(GoGitOptions{
+		Username: username,
+		Token:    token,
+	})
+}
+
+// NewGoGitClientWithOptions returns a git client configured with the
+// options.
+func NewGoGitClientWithOptions(options GoGitOptions) *GoGitClient {
+	g := &GoGitClient{options: options}
+	if options.Token != "" {
+		g.auth = &http.BasicAuth{
+			Username: options.Username,
+			Password: options.Token,
+		}
+	}
+	return g
+}
+
+// storage returns the storage of the repository at the path with the
+// configured object cache.
+func (g *GoGitClient) storage(path string) (*filesystem.Storage, billy.Filesystem) {
+	size := cache.DefaultMaxSize
+	if g.options.ObjectCacheSize > 0 {
+		size = cache.FileSize(g.options.ObjectCacheSize)
+	}
+
+	wt := osfs.New(path)
+	return filesystem.NewStorage(osfs.New(filepath.Join(path, git.GitDirName)), cache.NewObjectLRU(size)), wt
+}
+
+// open opens the local copy of the repository.
+func (g *GoGitClient) open(path string) (*git.Repository, error) {
+	s, wt := g.storage(path)
+	return git.Open(s, wt)
+}
+
+// Clone performs a git clone of the repository.  The size of the packfiles
+// that were received is added to the clone_bytes metric.
+func (g *GoGitClient) Clone(ctx context.Context, r *Repo) error {
+	opts := &git.CloneOptions{
+		Auth:     g.auth,
+		URL:      r.CloneURL,
+		Progress: nil,
+	}
+	if r.Ref != "" {
+		opts.ReferenceName = plumbing.NewBranchReferenceName(r.Ref)
+		opts.SingleBranch = true
+	} else if g.options.SingleBranch {
+		if r.DefaultBranch != "" {
+			opts.ReferenceName = plumbing.NewBranchReferenceName(r.DefaultBranch)
+		}
+		opts.SingleBranch = true
+	}
+	if g.options.NoTags {
+		opts.Tags = git.NoTags
+	}
+
+	if err := os.MkdirAll(r.LocalPath, 0755); err != nil {
+		return err
+	}
+
+	s, wt := g.storage(r.LocalPath)
+	if _, err := git.CloneContext(ctx, s, wt, opts); err != nil {
+		return err
+	}
+
+	size := packSize(r.LocalPath)
+	metrics.Add("clone_bytes", size)
+	if size > largestClone.Value() {
+		largestClone.Set(size)
+	}
+	return nil
+}
+
+// packSize returns the total size of the packfiles of the repository at the
+// path, which is the size of the packs that were received when it was
+// cloned.
+func packSize(path string) int64 {
+	files, _ := filepath.Glob(filepath.Join(path, git.GitDirName, "objects", "pack", "*.pack"))
+
+	var size int64
+	for _, f := range files {
+		if fi, err := os.Stat(f); err == nil {
+			size += fi.Size()
+		}
+	}
+	return size
+}
+
+// Pull performs a git pull of the repository.
+func (g *GoGitClient) Pull(ctx context.Context, r *Repo) error {
+	p, err := g.open(r.LocalPath)
+	if err != nil {
+		return err
+	}
+
+	w, err := p.Worktree()
+	if err != nil {
+		return err
+	}
+
+	opts := &git.PullOptions{
+		Auth:       g.auth,
+		RemoteName: "origin",
+		Depth:      1,
+	}
+	if r.Ref != "" {
+		opts.ReferenceName = plumbing.NewBranchReferenceName(r.Ref)
+	}
+
+	return w.PullContext(ctx, opts)
+}
+
+// Reset fetches the branch tracked by the local copy, or the default branch,
+// and hard resets the worktree to the fetched commit.
+func (g *GoGitClient) Reset(ctx context.Context, r *Repo) error {
+	branch := r.Ref
+	if branch == "" {
+		branch = r.DefaultBranch
+	}
+
+	p, err := g.open(r.LocalPath)
+	if err != nil {
+		return err
+	}
+
+	remote := plumbing.NewRemoteReferenceName("origin", branch)
+	err = p.FetchContext(ctx, &git.FetchOptions{
+		Auth:       g.auth,
+		RemoteName: "origin",
+		RefSpecs:   []gitconfig.RefSpec{gitconfig.RefSpec(fmt.Sprintf("+%s:%s", plumbing.NewBranchReferenceName(branch), remote))},
+		Depth:      1,
+		Force:      true,
+	})
+	if err := ignoreUpToDate(err); err != nil {
+		return err
+	}
+
+	ref, err := p.Reference(remote, true)
+	if err != nil {
+		return err
+	}
+
+	w, err := p.Worktree()
+	if err != nil {
+		return err
+	}
+
+	return w.Reset(&git.ResetOptions{
+		Commit: ref.Hash(),
+		Mode:   git.HardReset,
+	})
+}
+
+// RemoteCommit lists the references of the remote repository without
+// cloning it and returns the commit sha of the branch.
+func (g *GoGitClient) RemoteCommit(ctx context.Context, r *Repo, branch string) (string, error) {
+	remote := git.NewRemote(memory.NewStorage(), &gitconfig.RemoteConfig{
+		Name: "origin",
+		URLs: []string{r.CloneURL},
+	})
+
+	refs, err := remote.ListContext(ctx, &git.ListOptions{
+		Auth: g.auth,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	name := plumbing.NewBranchReferenceName(branch)
+	for _, ref := range refs {
+		if ref.Name() == name {
+			return ref.Hash().String(), nil
+		}
+	}
+
+	return "", fmt.Errorf("branch %s not found in %s", branch, r.CloneURL)
+}
+
+// RemoteTags lists the references of the remote repository without cloning
+// it and returns the names of its tags.
+func (g *GoGitClient) RemoteTags(ctx context.Context, r *Repo) ([]string, error) {
+	remote := git.NewRemote(memory.NewStorage(), &gitconfig.RemoteConfig{
+		Name: "origin",
+		URLs: []string{r.CloneURL},
+	})
+
+	refs, err := remote.ListContext(ctx, &git.ListOptions{
+		Auth: g.auth,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []string
+	for _, ref := range refs {
+		if ref.Name().IsTag() {
+			tags = append(tags, ref.Name().Short())
+		}
+	}
+	return tags, nil
+}
+
+// Verify returns an error if the local copy of the repository is not a
+// valid git repository, such as a stray directory or a clone whose git
+// directory is corrupted.  Every reference must point to an object that
+// exists, and a checked out commit must be readable.  An empty repository,
+// whose HEAD points to a branch without commits, is valid.
+func (g *GoGitClient) Verify(r *Repo) error {
+	repo, err := git.PlainOpen(r.LocalPath)
+	if err != nil {
+		return err
+	}
+
+	refs, err := repo.References()
+	if err != nil {
+		return err
+	}
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+		if _, err := repo.Object(plumbing.AnyObject, ref.Hash()); err != nil {
+			return fmt.Errorf("reference %s: %w", ref.Name(), err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	head, err := repo.Head()
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = repo.CommitObject(head.Hash())
+	return err
+}
+
+// Head returns the commit checked out in the local copy of the repository
+// after reading it, or an empty string for an empty repository.  Unlike
+// Verify, the other references are not walked.
+func (g *GoGitClient) Head(r *Repo) (string, error) {
+	repo, err := git.PlainOpen(r.LocalPath)
+	if err != nil {
+		return "", err
+	}
+
+	head, err := repo.Head()
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if _, err := repo.CommitObject(head.Hash()); err != nil {
+		return "", err
+	}
+	return head.Hash().String(), nil
+}
+
+// upToDate returns true if the error is the one go-git returns when a
+// pull or fetch finds nothing new.  It signals success rather than a
+// failure.
+func upToDate(err error) bool {
+	return errors.Is(err, git.NoErrAlreadyUpToDate)
+}
+
+// ignoreUpToDate drops the error go-git returns when a pull finds nothing
+// new to fetch.
+func ignoreUpToDate(err error) error {
+	if upToDate(err) {
+		return nil
+	}
+	return err
+}
+
+// rewritten returns true if a pull failed because the history of the
+// remote branch no longer contains the local commit, such as after a force
+// push.
+func rewritten(err error) bool {
+	return errors.Is(err, git.ErrNonFastForwardUpdate)
+}
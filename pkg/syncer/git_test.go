@@ -0,0 +1,132 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// commitFile initializes a repository at the path with a single commit.
+func commitFile(t *testing.T, path string) *git.Repository {
+	t.Helper()
+
+	repo, err := git.PlainInit(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(path, "go.mod"), []byte("module example.com/m\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wt.Add("go.mod"); err != nil {
+		t.Fatal(err)
+	}
+	sig := &object.Signature{Name: "gdoc", Email: "gdoc@example.com", When: time.Now()}
+	if _, err := wt.Commit("initial", &git.CommitOptions{Author: sig}); err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func TestVerify(t *testing.T) {
+	g := &GoGitClient{}
+
+	empty := t.TempDir()
+	if _, err := git.PlainInit(empty, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Verify(&Repo{LocalPath: empty}); err != nil {
+		t.Errorf("expected an empty repository to be valid, got %v", err)
+	}
+
+	committed := t.TempDir()
+	commitFile(t, committed)
+	if err := g.Verify(&Repo{LocalPath: committed}); err != nil {
+		t.Errorf("expected a repository with a commit to be valid, got %v", err)
+	}
+
+	stray := t.TempDir()
+	if err := g.Verify(&Repo{LocalPath: stray}); err == nil {
+		t.Error("expected a directory without a repository to be invalid")
+	}
+
+	dangling := t.TempDir()
+	repo := commitFile(t, dangling)
+	missing := plumbing.NewHash("0123456789abcdef0123456789abcdef01234567")
+	if err := repo.Storer.SetReference(plumbing.NewHashReference("refs/heads/gone", missing)); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Verify(&Repo{LocalPath: dangling}); err == nil {
+		t.Error("expected a reference to a missing object to be invalid")
+	}
+
+	corrupt := t.TempDir()
+	repo = commitFile(t, corrupt)
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := head.Hash().String()
+	if err := os.Remove(filepath.Join(corrupt, ".git", "objects", h[:2], h[2:])); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Verify(&Repo{LocalPath: corrupt}); err == nil {
+		t.Error("expected a repository without its head commit to be invalid")
+	}
+}
+
+func TestHead(t *testing.T) {
+	g := &GoGitClient{}
+
+	committed := t.TempDir()
+	repo := commitFile(t, committed)
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := g.Head(&Repo{LocalPath: committed}); err != nil || got != head.Hash().String() {
+		t.Errorf("expected %s, got %q, %v", head.Hash(), got, err)
+	}
+
+	empty := t.TempDir()
+	if _, err := git.PlainInit(empty, false); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := g.Head(&Repo{LocalPath: empty}); err != nil || got != "" {
+		t.Errorf("expected no commit for an empty repository, got %q, %v", got, err)
+	}
+
+	h := head.Hash().String()
+	if err := os.Remove(filepath.Join(committed, ".git", "objects", h[:2], h[2:])); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Head(&Repo{LocalPath: committed}); err == nil {
+		t.Error("expected an error for a repository without its head commit")
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	nethttp "net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// GitHTTPOptions defines the options of the HTTP client used for git
+// requests.
+type GitHTTPOptions struct {
+	// The User-Agent sent after the git/1.0 product.  Empty to send
+	// the go-git default.
+	UserAgent string
+	// The headers added to the requests keyed by the host they are sent
+	// to.  The headers of the "*" host are sent to every host.
+	Headers map[string]nethttp.Header
+	// The cookies sent with the requests and updated from the responses.
+	Cookies nethttp.CookieJar
+}
+
+// ConfigureGitHTTP sets the HTTP client used for the git requests made by
+// go-git.  go-git only supports a single HTTP transport for the process, so
+// this applies to every GoGitClient.
+func ConfigureGitHTTP(options GitHTTPOptions) {
+	var next nethttp.RoundTripper = nethttp.DefaultTransport
+	if len(options.Headers) > 0 {
+		next = &headerTransport{headers: options.Headers, next: next}
+	}
+	if options.UserAgent != "" {
+		next = &userAgentTransport{userAgent: "git/1.0 " + options.UserAgent, next: next}
+	}
+
+	t := http.NewClient(&nethttp.Client{
+		Transport: next,
+		Jar:       options.Cookies,
+	})
+	client.InstallProtocol("http", t)
+	client.InstallProtocol("https", t)
+}
+
+// headerTransport adds the headers configured for the host of every
+// request.
+type headerTransport struct {
+	headers map[string]nethttp.Header
+	next    nethttp.RoundTripper
+}
+
+// RoundTrip adds the headers to a copy of the request and executes it.
+func (t *headerTransport) RoundTrip(req *nethttp.Request) (*nethttp.Response, error) {
+	req = req.Clone(req.Context())
+	for _, host := range []string{"*", strings.ToLower(req.URL.Hostname()), strings.ToLower(req.URL.Host)} {
+		for name, values := range t.headers[host] {
+			req.Header[name] = values
+		}
+	}
+	return t.next.RoundTrip(req)
+}
+
+// LoadGitHeaders reads the headers added to git requests from a json file.
+// The file maps each host, or "*" for every host, to the headers that are
+// sent to it.
+func LoadGitHeaders(name string) (map[string]nethttp.Header, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries map[string]map[string]string
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	headers := make(map[string]nethttp.Header, len(entries))
+	for host, values := range entries {
+		h := make(nethttp.Header, len(values))
+		for name, value := range values {
+			h.Set(name, value)
+		}
+		headers[strings.ToLower(host)] = h
+	}
+
+	return headers, nil
+}
+
+// LoadGitCookies reads the cookies sent with git requests from a file in
+// the Netscape format used by curl and the http.cookieFile setting of git.
+// Expired cookies are left out.
+func LoadGitCookies(name string) (nethttp.CookieJar, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		httpOnly := strings.HasPrefix(line, "#HttpOnly_")
+		if httpOnly {
+			line = strings.TrimPrefix(line, "#HttpOnly_")
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("%s:%d: expected 7 tab separated fields", name, n)
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid expiry: %v", name, n, err)
+		}
+
+		c := &nethttp.Cookie{
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			HttpOnly: httpOnly,
+			Name:     fields[5],
+			Value:    fields[6],
+		}
+		if expires > 0 {
+			c.Expires = time.Unix(expires, 0)
+		}
+
+		// Cookies that are sent to the subdomains keep their domain,
+		// the others are only sent to the host they were set for.
+		host := strings.TrimPrefix(fields[0], ".")
+		if strings.EqualFold(fields[1], "TRUE") {
+			c.Domain = host
+		}
+
+		scheme := "http"
+		if c.Secure {
+			scheme = "https"
+		}
+		jar.SetCookies(&url.URL{Scheme: scheme, Host: host, Path: c.Path}, []*nethttp.Cookie{c})
+	}
+
+	return jar, s.Err()
+}
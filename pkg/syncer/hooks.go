@@ -0,0 +1,257 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// HookStagePre runs the hook before a repository is updated.
+	HookStagePre = "pre"
+	// HookStagePost runs the hook after a repository has been updated.
+	HookStagePost = "post"
+)
+
+const (
+	// HookFailureIgnore logs a failed hook and carries on with the update.
+	HookFailureIgnore = "ignore"
+	// HookFailureAbort marks the update as failed when the hook fails.  A
+	// failed pre hook prevents the repository from being updated.
+	HookFailureAbort = "abort"
+)
+
+// DefaultHookEnv is the environment that hook commands inherit when no
+// allowed variables are configured.  Hooks run inside the repositories, so
+// secrets such as the Github token are never passed on by default.
+var DefaultHookEnv = []string{"PATH", "HOME", "TMPDIR", "GOPATH", "GOCACHE", "GOMODCACHE", "GOFLAGS"}
+
+// defaultHookTimeout is used for hooks that do not set a timeout.
+const defaultHookTimeout = 5 * time.Minute
+
+// Hook is a command or HTTP call that is run before or after a repository is
+// updated.
+type Hook struct {
+	// The repositories the hook applies to as owner/name patterns, such as
+	// ctxswitch/gdoc or ctxswitch/*.  Empty applies to every repository.
+	Repos []string
+	// When the hook runs.  Either HookStagePre or HookStagePost.
+	Stage string
+	// The command and its arguments.  The command runs in the local path of
+	// the repository if it exists.
+	Command []string
+	// The URL that the repository is posted to as a json document.  Used
+	// when no command is set.
+	URL string
+	// Additional environment variables passed to the command, on top of
+	// the allowed variables of the gdoc environment.  For URL hooks they
+	// are sent as request headers instead.
+	Env map[string]string
+	// The maximum time the hook may take.  Defaults to five minutes.
+	Timeout time.Duration
+	// What happens when the hook fails.  Either HookFailureIgnore or
+	// HookFailureAbort.  Defaults to HookFailureIgnore.
+	FailurePolicy string
+}
+
+// LoadHooks reads the hooks from a json file.  The file contains a list of
+// hooks using snake_case keys with the timeout as a duration string.
+func LoadHooks(name string) ([]Hook, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []struct {
+		Repos         []string          `json:"repos"`
+		Stage         string            `json:"stage"`
+		Command       []string          `json:"command"`
+		URL           string            `json:"url"`
+		Env           map[string]string `json:"env"`
+		Timeout       string            `json:"timeout"`
+		FailurePolicy string            `json:"failure_policy"`
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	hooks := make([]Hook, 0, len(entries))
+	for i, e := range entries {
+		h := Hook{
+			Repos:         e.Repos,
+			Stage:         e.Stage,
+			Command:       e.Command,
+			URL:           e.URL,
+			Env:           e.Env,
+			Timeout:       defaultHookTimeout,
+			FailurePolicy: e.FailurePolicy,
+		}
+
+		if e.Timeout != "" {
+			if h.Timeout, err = time.ParseDuration(e.Timeout); err != nil {
+				return nil, fmt.Errorf("hook %d: %w", i, err)
+			}
+		}
+
+		if h.FailurePolicy == "" {
+			h.FailurePolicy = HookFailureIgnore
+		}
+
+		switch {
+		case h.Stage != HookStagePre && h.Stage != HookStagePost:
+			return nil, fmt.Errorf("hook %d: unknown stage %q", i, h.Stage)
+		case h.FailurePolicy != HookFailureIgnore && h.FailurePolicy != HookFailureAbort:
+			return nil, fmt.Errorf("hook %d: unknown failure policy %q", i, h.FailurePolicy)
+		case len(h.Command) == 0 && h.URL == "":
+			return nil, fmt.Errorf("hook %d: either a command or url is required", i)
+		}
+
+		hooks = append(hooks, h)
+	}
+
+	return hooks, nil
+}
+
+// matches returns true if the hook applies to the repository.
+func (h Hook) matches(r *Repo) bool {
+	return len(h.Repos) == 0 || MatchRepo(h.Repos, r.Owner, r.Name)
+}
+
+// runHooks runs the hooks for the stage that apply to the repository.  An
+// error is returned for the first failed hook with the abort policy.
+func (rs *Syncer) runHooks(ctx context.Context, stage string, r *Repo) error {
+	for _, h := range rs.options.Hooks {
+		if h.Stage != stage || !h.matches(r) {
+			continue
+		}
+
+		err := rs.runHook(ctx, h, r)
+		if err == nil {
+			continue
+		}
+
+		if h.FailurePolicy == HookFailureAbort {
+			return fmt.Errorf("%s hook failed: %w", stage, err)
+		}
+		rs.logger.Warn("hook failed", zap.String("stage", stage), zap.Any("repo", r), zap.Error(err))
+	}
+
+	return nil
+}
+
+// runHook runs a single hook with its timeout.
+func (rs *Syncer) runHook(ctx context.Context, h Hook, r *Repo) error {
+	ctx, cancel := withTimeout(ctx, h.Timeout)
+	defer cancel()
+
+	if len(h.Command) == 0 {
+		return postHook(ctx, h, r)
+	}
+
+	cmd := exec.CommandContext(ctx, h.Command[0], h.Command[1:]...)
+	cmd.Dir = rs.options.GodocRoot
+	if _, err := os.Stat(r.LocalPath); err == nil {
+		cmd.Dir = r.LocalPath
+	}
+
+	cmd.Env = append(rs.hookEnv(),
+		"GDOC_HOOK_STAGE="+h.Stage,
+		"GDOC_REPO_OWNER="+r.Owner,
+		"GDOC_REPO_NAME="+r.Name,
+		"GDOC_COMMIT_SHA="+r.CommitSHA,
+		"GDOC_LOCAL_PATH="+r.LocalPath,
+	)
+	for k, v := range h.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, bytes.TrimSpace(out))
+	}
+
+	rs.logger.Debug("hook completed", zap.String("stage", h.Stage), zap.Strings("command", h.Command), zap.ByteString("output", out))
+	return nil
+}
+
+// hookEnv returns the variables of the gdoc environment that hook commands
+// inherit: the allowed variables and the ones prefixed with GDOC_.
+func (rs *Syncer) hookEnv() []string {
+	names := rs.options.HookEnvAllow
+	if len(names) == 0 {
+		names = DefaultHookEnv
+	}
+
+	allowed := make(map[string]bool, len(names))
+	for _, name := range names {
+		allowed[name] = true
+	}
+
+	var env []string
+	for _, kv := range os.Environ() {
+		name := strings.SplitN(kv, "=", 2)[0]
+		if allowed[name] || strings.HasPrefix(name, "GDOC_") {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
+
+// postHook posts the stage and repository to the hook URL.  Any status
+// outside of the 2xx range is treated as a failure.
+func postHook(ctx context.Context, h Hook, r *Repo) error {
+	body, err := json.Marshal(struct {
+		Stage string `json:"stage"`
+		Repo  *Repo  `json:"repo"`
+	}{h.Stage, r})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range h.Env {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("hook request failed: %s", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"context"
+	"os"
+)
+
+// missing returns true if nothing has been cloned to the path yet.
+func missing(path string) bool {
+	_, err := os.Stat(path)
+	return os.IsNotExist(err)
+}
+
+// Fetch clones a repository that has been discovered but not cloned yet
+// because lazy sync is enabled.  It takes the sync lock, which is shared
+// with a sync cycle of this instance, so the clone does not wait for a
+// running cycle.  ErrLocked is returned when another instance holds the
+// lock.  Repositories that already have a local copy are left for the sync
+// cycle to update and paused repositories are not cloned.
+func (rs *Syncer) Fetch(ctx context.Context, owner, name string) (err error) {
+	if rs.options.Offline {
+		return ErrOffline
+	}
+
+	rs.mu.RLock()
+	stored, ok := rs.repos[name+"/"+owner]
+	var r Repo
+	if ok {
+		r = *stored
+	}
+	rs.mu.RUnlock()
+	if !ok {
+		return ErrRepoNotFound
+	}
+	if rs.quarantined(&r) || rs.paused(&r) {
+		return ErrPaused
+	}
+
+	ctx, unlock, err := rs.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if uerr := unlock(); uerr != nil {
+			err = uerr
+		}
+	}()
+
+	defer rs.locks.Lock(r.LocalPath)()
+
+	// Concurrent requests for the same repository wait for the path, so
+	// only the first one clones it.
+	if !missing(r.LocalPath) {
+		return nil
+	}
+
+	sha, err := rs.commit(ctx, &r)
+	if err != nil {
+		rs.fail(&r, err)
+		return err
+	}
+	r.CommitSHA = sha
+
+	return rs.apply(ctx, &r, "")
+}
@@ -0,0 +1,200 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Locker is a lock shared by the instances that synchronize the same
+// storage.  It is held for the length of every sync cycle and manual
+// update so that two instances never update the repositories at the same
+// time.
+type Locker interface {
+	// Acquire takes the lock without waiting.  It returns false if the
+	// lock is held by another instance.  Locks that can expire call lost
+	// if the lock is lost before it is released.
+	Acquire(ctx context.Context, lost func()) (bool, error)
+	// Release gives up the lock.
+	Release(ctx context.Context) error
+}
+
+// FileLock is a Locker backed by an advisory lock on a file.  It guards
+// instances that share a local or network filesystem that supports
+// flock(2).
+type FileLock struct {
+	path string
+	file *os.File
+	mu   sync.Mutex
+}
+
+// NewFileLock returns a lock on the file at the path.  The file is created
+// when the lock is first acquired.
+func NewFileLock(path string) *FileLock {
+	return &FileLock{path: path}
+}
+
+// Acquire takes the lock on the file without waiting.  The lock is held
+// until the file is closed, so it is never lost.
+func (l *FileLock) Acquire(ctx context.Context, lost func()) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file != nil {
+		return false, errors.New("lock is already held")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return false, err
+	}
+
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return false, err
+	}
+
+	ok, err := tryLock(f)
+	if err != nil || !ok {
+		f.Close()
+		return false, err
+	}
+
+	l.file = f
+	return true, nil
+}
+
+// Release unlocks and closes the file.
+func (l *FileLock) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := unlock(l.file)
+	if cerr := l.file.Close(); err == nil {
+		err = cerr
+	}
+	l.file = nil
+	return err
+}
+
+// heldLock is the sync lock while this instance holds it.  It is shared by
+// the sync cycle or manual update and the repositories fetched during it.
+type heldLock struct {
+	// The number of callers holding the lock.
+	refs int
+	// Closed when the lock is lost.
+	lost chan struct{}
+}
+
+// lock acquires the sync lock if one is configured.  ErrLocked is returned
+// when another instance holds it.  Callers in this instance share the lock,
+// which is released once the last of them is done.  The returned context
+// is cancelled if the lock is lost while it is held, and the returned
+// function releases the lock and returns ErrLocked if it was lost.
+func (rs *Syncer) lock(ctx context.Context) (context.Context, func() error, error) {
+	if rs.options.Lock == nil {
+		return ctx, func() error { return nil }, nil
+	}
+
+	rs.lockMu.Lock()
+	defer rs.lockMu.Unlock()
+
+	h := rs.held
+	if h == nil {
+		h = &heldLock{lost: make(chan struct{})}
+		var once sync.Once
+		ok, err := rs.options.Lock.Acquire(ctx, func() {
+			once.Do(func() {
+				metrics.Add("lock_lost", 1)
+				close(h.lost)
+			})
+		})
+		if err != nil {
+			metrics.Add("lock_errors", 1)
+			return nil, nil, fmt.Errorf("unable to acquire the sync lock: %w", err)
+		}
+		if !ok {
+			metrics.Add("lock_contended", 1)
+			return nil, nil, ErrLocked
+		}
+		rs.held = h
+	} else if h.isLost() {
+		return nil, nil, ErrLocked
+	}
+	h.refs++
+
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-h.lost:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() error {
+		cancel()
+		rs.lockMu.Lock()
+		h.refs--
+		if h.refs == 0 {
+			rs.held = nil
+			rs.unlock()
+		}
+		rs.lockMu.Unlock()
+		if h.isLost() {
+			return ErrLocked
+		}
+		return nil
+	}, nil
+}
+
+// isLost returns true if the lock was lost while it was held.
+func (h *heldLock) isLost() bool {
+	select {
+	case <-h.lost:
+		return true
+	default:
+		return false
+	}
+}
+
+// unlock releases the sync lock if one is configured.  The lock is released
+// even if the cycle was cancelled.
+func (rs *Syncer) unlock() {
+	if rs.options.Lock == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := rs.options.Lock.Release(ctx); err != nil {
+		rs.logger.Error("unable to release the sync lock", zap.Error(err))
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package syncer
+
+import (
+	"errors"
+	"os"
+)
+
+// errLockUnsupported is returned when file locks are not available on the
+// platform.
+var errLockUnsupported = errors.New("file locks are not supported on this platform")
+
+// tryLock returns an error since file locks are not supported.
+func tryLock(f *os.File) (bool, error) {
+	return false, errLockUnsupported
+}
+
+// unlock returns an error since file locks are not supported.
+func unlock(f *os.File) error {
+	return errLockUnsupported
+}
@@ -0,0 +1,127 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"context"
+	"os"
+
+	"go.uber.org/zap"
+)
+
+// Resync pulls the latest commit of a repository without waiting for the
+// next sync cycle.  The repository is attempted even if it is backing off
+// or is on the dead letter list, and its failures are cleared when it
+// succeeds.
+func (rs *Syncer) Resync(ctx context.Context, owner, name string) error {
+	return rs.manual(ctx, owner, name, false)
+}
+
+// Reclone removes the local copy of a repository and clones it again.  It
+// is used to recover a repository whose working tree has been corrupted.
+func (rs *Syncer) Reclone(ctx context.Context, owner, name string) error {
+	return rs.manual(ctx, owner, name, true)
+}
+
+// manual updates a single repository outside of the sync cycle.  The sync
+// cycle is held off while the repository is updated and the next cycle is
+// rescheduled once it has finished.
+func (rs *Syncer) manual(ctx context.Context, owner, name string, reclone bool) (err error) {
+	if rs.options.Offline {
+		return ErrOffline
+	}
+
+	rs.running.Lock()
+	defer rs.running.Unlock()
+	defer rs.begin()()
+	defer func() {
+		select {
+		case rs.reschedule <- struct{}{}:
+		default:
+		}
+	}()
+
+	ctx, unlock, err := rs.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// A lost lock cancels the update, which is reported as ErrLocked
+		// rather than as the cancellation.
+		if uerr := unlock(); uerr != nil {
+			err = uerr
+		}
+	}()
+
+	rs.mu.RLock()
+	stored, ok := rs.repos[name+"/"+owner]
+	var r Repo
+	if ok {
+		r = *stored
+	}
+	rs.mu.RUnlock()
+	if !ok {
+		return ErrRepoNotFound
+	}
+
+	sha, err := rs.commit(ctx, &r)
+	if err != nil {
+		rs.fail(&r, err)
+		return err
+	}
+	previous := r.CommitSHA
+	r.CommitSHA = sha
+
+	defer rs.locks.Lock(r.LocalPath)()
+
+	// Atomic updates always stage a fresh clone, so the local copy is
+	// only removed when the repository is updated in place.
+	if reclone && !rs.options.AtomicUpdates {
+		rs.logger.Info("removing repository before cloning", zap.Any("repo", r))
+		if err := os.RemoveAll(r.LocalPath); err != nil {
+			rs.fail(&r, err)
+			return err
+		}
+	}
+
+	return rs.apply(ctx, &r, previous)
+}
+
+// apply pulls a repository outside of the sync cycle, runs its hooks and
+// publishes the update.  The path of the repository must be locked.
+func (rs *Syncer) apply(ctx context.Context, r *Repo, previous string) error {
+	if err := rs.runHooks(ctx, HookStagePre, r); err != nil {
+		rs.fail(r, err)
+		return err
+	}
+	if _, err := rs.get(ctx, r); err != nil {
+		rs.fail(r, err)
+		return err
+	}
+	rs.annotate(ctx, r, previous)
+	if err := rs.runHooks(ctx, HookStagePost, r); err != nil {
+		rs.fail(r, err)
+		return err
+	}
+
+	rs.update(r)
+	rs.succeed(r)
+	rs.published(EventRepoUpdated, r)
+	return nil
+}
@@ -0,0 +1,92 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// StateVersion is the version of the state file written by this release.
+// It is increased along with a new migration whenever the layout of the
+// state changes.
+const StateVersion = 1
+
+// ErrStateVersion is returned when the state file was written by a newer
+// release than the one that is running.
+var ErrStateVersion = errors.New("state was written by a newer release")
+
+// migration upgrades the raw document of the state file by a single
+// version.
+type migration func(doc map[string]json.RawMessage) error
+
+// migrations upgrade the state file one version at a time.  The migration
+// at index i upgrades version i to version i+1.  Files written before the
+// version was recorded are version 0.
+var migrations = []migration{
+	// 1: The version is recorded in the state file.
+	func(doc map[string]json.RawMessage) error { return nil },
+}
+
+// decodeState upgrades the state document to the current version and
+// decodes it.  The version the document was written with is returned
+// along with the state.
+func decodeState(data []byte) (State, int, error) {
+	var s State
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return s, 0, err
+	}
+
+	version := 0
+	if v, ok := doc["version"]; ok {
+		if err := json.Unmarshal(v, &version); err != nil {
+			return s, 0, fmt.Errorf("invalid state version: %w", err)
+		}
+	}
+	if version > StateVersion {
+		return s, version, fmt.Errorf("%w: version %d is newer than %d", ErrStateVersion, version, StateVersion)
+	}
+
+	for v := version; v < StateVersion; v++ {
+		if err := migrations[v](doc); err != nil {
+			return s, version, fmt.Errorf("unable to migrate state to version %d: %w", v+1, err)
+		}
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return s, version, err
+	}
+	err = json.Unmarshal(data, &s)
+	s.Version = StateVersion
+	return s, version, err
+}
+
+// backupState copies the state file next to itself before it is migrated
+// so that an older release can be restored along with its state.
+func backupState(name string, version int) error {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	return writePrivate(fmt.Sprintf("%s.v%d.bak", name, version), data)
+}
@@ -0,0 +1,239 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"context"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"go.uber.org/zap"
+)
+
+// maxModifiedWalk is the number of commits searched for the last change
+// to each package.  It bounds the work done for repositories seeded from
+// a full checkout.
+const maxModifiedWalk = 1000
+
+// releasePattern matches the tags of releases, leaving out prereleases.
+var releasePattern = regexp.MustCompile(`^v(\d+)\.(\d+)\.(\d+)$`)
+
+// tagLister is implemented by git clients that can list the tags of the
+// remote repository.
+type tagLister interface {
+	RemoteTags(ctx context.Context, r *Repo) ([]string, error)
+}
+
+// synced returns the commit the repository was last synchronized to.
+func (rs *Syncer) synced(r *Repo) string {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	if stored, ok := rs.repos[r.Name+"/"+r.Owner]; ok {
+		return stored.CommitSHA
+	}
+	return ""
+}
+
+// annotate records the newest release and when each package last changed
+// after the repository has been updated from the previous commit.  Errors
+// are logged since the metadata is not needed to serve the documentation.
+func (rs *Syncer) annotate(ctx context.Context, r *Repo, previous string) {
+	var version string
+	if tl, ok := rs.git.(tagLister); ok {
+		ctx, cancel := withTimeout(ctx, rs.options.APITimeout)
+		tags, err := tl.RemoteTags(ctx, r)
+		cancel()
+		if err != nil {
+			rs.logger.Warn("unable to list tags", zap.Any("repo", r), zap.Error(err))
+		}
+		version = latestRelease(tags)
+	}
+
+	rs.mu.RLock()
+	known := r.Modified
+	rs.mu.RUnlock()
+
+	modified, err := packagesModified(r.LocalPath, previous, known)
+	if err != nil {
+		rs.logger.Warn("unable to find modified packages", zap.Any("repo", r), zap.Error(err))
+		modified = known
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	r.Version = version
+	r.Modified = modified
+}
+
+// latestRelease returns the newest release tag.
+func latestRelease(tags []string) string {
+	var latest string
+	var best [3]int
+	for _, t := range tags {
+		m := releasePattern.FindStringSubmatch(t)
+		if m == nil {
+			continue
+		}
+
+		var v [3]int
+		for i := range v {
+			v[i], _ = strconv.Atoi(m[i+1])
+		}
+		if latest == "" || v[0] > best[0] || v[0] == best[0] && (v[1] > best[1] || v[1] == best[1] && v[2] > best[2]) {
+			latest, best = t, v
+		}
+	}
+	return latest
+}
+
+// packagesModified returns the time of the commit each package directory
+// of the checked out commit last changed in.  The history of the local
+// copy is searched first.  Local copies are shallow, so packages that did
+// not change within it are compared to the previous commit instead: a
+// package that differs changed in the new commit and one that does not
+// keeps its known time.
+func packagesModified(dir, previous string, known map[string]time.Time) (map[string]time.Time, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	dirs, err := packageDirs(tree)
+	if err != nil {
+		return nil, err
+	}
+
+	modified := make(map[string]time.Time)
+	unresolved := make(map[string]string)
+	for _, d := range dirs {
+		unresolved[d] = packageHash(tree, d)
+	}
+
+	cur := commit
+	for i := 0; i < maxModifiedWalk && len(unresolved) > 0; i++ {
+		parent, err := cur.Parents().Next()
+		if err != nil {
+			// The start of the history or the boundary of a shallow
+			// clone.
+			break
+		}
+		ptree, err := parent.Tree()
+		if err != nil {
+			break
+		}
+		for d, h := range unresolved {
+			if ph := packageHash(ptree, d); ph != h {
+				modified[d] = cur.Committer.When
+				delete(unresolved, d)
+			} else {
+				unresolved[d] = ph
+			}
+		}
+		cur = parent
+	}
+
+	var prev *object.Tree
+	if previous != "" && previous != head.Hash().String() {
+		if c, err := repo.CommitObject(plumbing.NewHash(previous)); err == nil {
+			prev, _ = c.Tree()
+		}
+	}
+
+	for d := range unresolved {
+		switch {
+		case prev != nil && packageHash(prev, d) != packageHash(tree, d):
+			modified[d] = commit.Committer.When
+		case !known[d].IsZero():
+			modified[d] = known[d]
+		}
+	}
+	return modified, nil
+}
+
+// packageDirs returns the directories of the tree that contain non-test Go
+// files.  Directories that the go command ignores are left out.
+func packageDirs(tree *object.Tree) ([]string, error) {
+	seen := make(map[string]bool)
+	var dirs []string
+	err := tree.Files().ForEach(func(f *object.File) error {
+		if !strings.HasSuffix(f.Name, ".go") || strings.HasSuffix(f.Name, "_test.go") {
+			return nil
+		}
+
+		d := path.Dir(f.Name)
+		if seen[d] || ignoredDir(d) {
+			return nil
+		}
+		seen[d] = true
+		dirs = append(dirs, d)
+		return nil
+	})
+	return dirs, err
+}
+
+// ignoredDir returns true if an element of the path is ignored by the go
+// command.
+func ignoredDir(d string) bool {
+	for _, e := range strings.Split(d, "/") {
+		if e == "vendor" || e == "testdata" || (e != "." && (strings.HasPrefix(e, ".") || strings.HasPrefix(e, "_"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// packageHash identifies the files of the package directory in the tree
+// without its subdirectories, so a package is only modified when one of
+// its own files changes.  It is empty if the directory does not exist.
+func packageHash(tree *object.Tree, d string) string {
+	if d != "." {
+		var err error
+		if tree, err = tree.Tree(d); err != nil {
+			return ""
+		}
+	}
+
+	var b strings.Builder
+	for _, e := range tree.Entries {
+		if e.Mode.IsFile() {
+			b.WriteString(e.Name + ":" + e.Hash.String() + ";")
+		}
+	}
+	return b.String()
+}
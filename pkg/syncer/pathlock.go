@@ -0,0 +1,105 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// PathLocks serializes the services that modify the same directories of
+// the workspace, such as the syncer updating a repository, the module
+// proxy source extracting a module and the local source watcher copying a
+// directory.  Directories are locked by their path.  Readers of the whole
+// workspace, such as backups, lock the workspace to wait for the updates
+// in progress and hold off new ones.  Every unlock advances the generation
+// of the workspace, so readers can tell that it may have changed.
+type PathLocks struct {
+	// Incremented whenever a path or the workspace is unlocked.  Accessed
+	// atomically.
+	generation uint64
+	// Read locked while a path is locked and locked while the workspace
+	// is locked.
+	workspace sync.RWMutex
+	paths     map[string]*pathLock
+	mu        sync.Mutex
+}
+
+// pathLock is the lock of a single path along with the number of callers
+// that hold or wait for it.
+type pathLock struct {
+	sync.Mutex
+	refs int
+}
+
+// NewPathLocks returns an initialized PathLocks struct.
+func NewPathLocks() *PathLocks {
+	return &PathLocks{paths: make(map[string]*pathLock)}
+}
+
+// Lock waits for the path and the workspace and locks the path.  The
+// returned function unlocks it.  A single caller must not hold the lock of
+// more than one path at a time.
+func (l *PathLocks) Lock(path string) func() {
+	path = filepath.Clean(path)
+
+	l.workspace.RLock()
+
+	l.mu.Lock()
+	p, ok := l.paths[path]
+	if !ok {
+		p = &pathLock{}
+		l.paths[path] = p
+	}
+	p.refs++
+	l.mu.Unlock()
+
+	p.Lock()
+	return func() {
+		p.Unlock()
+
+		l.mu.Lock()
+		p.refs--
+		if p.refs == 0 {
+			delete(l.paths, path)
+		}
+		l.mu.Unlock()
+
+		atomic.AddUint64(&l.generation, 1)
+		l.workspace.RUnlock()
+	}
+}
+
+// LockWorkspace waits for every locked path to be unlocked and holds off
+// new locks until the returned function is called.
+func (l *PathLocks) LockWorkspace() func() {
+	l.workspace.Lock()
+	return func() {
+		atomic.AddUint64(&l.generation, 1)
+		l.workspace.Unlock()
+	}
+}
+
+// Generation returns the number of times a path or the workspace has been
+// unlocked.  It changes after every modification of the workspace made by
+// the services that share the locks.
+func (l *PathLocks) Generation() uint64 {
+	return atomic.LoadUint64(&l.generation)
+}
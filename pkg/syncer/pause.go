@@ -0,0 +1,107 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Pause records that a repository should no longer be synchronized.
+type Pause struct {
+	Owner string `json:"owner"`
+	Name  string `json:"name"`
+	// The reason given when the repository was paused.
+	Reason string    `json:"reason,omitempty"`
+	Since  time.Time `json:"since"`
+}
+
+// paused returns true if syncing of the repository has been paused.  The
+// lock must not be held.
+func (rs *Syncer) paused(r *Repo) bool {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	_, ok := rs.state.Paused[r.Owner+"/"+r.Name]
+	return ok
+}
+
+// Pause stops syncing a repository until it is resumed.  The local copy is
+// left in place so its documentation keeps being served.  The pause is
+// persisted so that it survives restarts.
+func (rs *Syncer) Pause(owner, name, reason string) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if _, ok := rs.repos[name+"/"+owner]; !ok {
+		return ErrRepoNotFound
+	}
+
+	if rs.state.Paused == nil {
+		rs.state.Paused = make(map[string]Pause)
+	}
+	rs.state.Paused[owner+"/"+name] = Pause{
+		Owner:  owner,
+		Name:   name,
+		Reason: reason,
+		Since:  rs.clock.Now(),
+	}
+
+	rs.logger.Info("repository paused", zap.String("repo", owner+"/"+name), zap.String("reason", reason))
+	return saveState(rs.statePath(), rs.state)
+}
+
+// Resume starts syncing a paused repository again during the next sync
+// cycle.
+func (rs *Syncer) Resume(owner, name string) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	key := owner + "/" + name
+	if _, ok := rs.state.Paused[key]; !ok {
+		return ErrRepoNotFound
+	}
+	delete(rs.state.Paused, key)
+
+	rs.logger.Info("repository resumed", zap.String("repo", key))
+	return saveState(rs.statePath(), rs.state)
+}
+
+// Paused returns the repositories whose syncing has been paused, ordered
+// by owner and name.
+func (rs *Syncer) Paused() []Pause {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	paused := make([]Pause, 0, len(rs.state.Paused))
+	for _, p := range rs.state.Paused {
+		paused = append(paused, p)
+	}
+
+	sort.Slice(paused, func(i, j int) bool {
+		if paused[i].Owner != paused[j].Owner {
+			return paused[i].Owner < paused[j].Owner
+		}
+		return paused[i].Name < paused[j].Name
+	})
+
+	return paused
+}
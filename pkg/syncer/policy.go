@@ -0,0 +1,552 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// QuarantineReason is the reason recorded on the pause of a repository
+// that was quarantined by the quarantine policy.
+const QuarantineReason = "quarantined by policy"
+
+// ErrPolicy is returned when a policy expression can not be evaluated.
+var ErrPolicy = errors.New("invalid policy")
+
+// Policy is a boolean expression that is evaluated against each discovered
+// repository.  The syntax is a subset of CEL:
+//
+//	repo.stars > 0 && !repo.archived && repo.name.startsWith("svc-")
+//
+// The repository is available as repo with the fields name, owner,
+// description, default_branch, html_url, license, stars, archived and
+// topics.  Strings support startsWith, endsWith, contains, matches and
+// size, and lists support contains and size.  Values are compared with
+// ==, !=, <, <=, > and >= and combined with &&, || and !.
+type Policy struct {
+	expr ast.Expr
+	src  string
+}
+
+// ParsePolicy parses the expression and checks that it evaluates to a
+// boolean.  Every node of the expression is checked, including those that
+// the logical operators would skip when it is evaluated.
+func ParsePolicy(src string) (*Policy, error) {
+	expr, err := parser.ParseExpr(src)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPolicy, err)
+	}
+
+	k, err := check(expr)
+	if err != nil {
+		return nil, err
+	}
+	if k != kindBool {
+		return nil, fmt.Errorf("%w: %s does not evaluate to a boolean", ErrPolicy, src)
+	}
+	return &Policy{expr: expr, src: src}, nil
+}
+
+// String returns the source of the expression.
+func (p *Policy) String() string {
+	return p.src
+}
+
+// Match evaluates the expression against the repository.
+func (p *Policy) Match(r *Repo) (bool, error) {
+	v, err := eval(p.expr, r)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("%w: %s does not evaluate to a boolean", ErrPolicy, p.src)
+	}
+	return b, nil
+}
+
+// kind is the type of a value in a policy expression.
+type kind int
+
+const (
+	kindBool kind = iota
+	kindInt
+	kindString
+	kindList
+)
+
+// String returns the name of the kind as used in error messages.
+func (k kind) String() string {
+	switch k {
+	case kindBool:
+		return "bool"
+	case kindInt:
+		return "int64"
+	case kindString:
+		return "string"
+	default:
+		return "[]string"
+	}
+}
+
+// fieldKinds are the kinds of the repository fields by their json name.
+var fieldKinds = map[string]kind{
+	"name":           kindString,
+	"owner":          kindString,
+	"description":    kindString,
+	"default_branch": kindString,
+	"html_url":       kindString,
+	"license":        kindString,
+	"stars":          kindInt,
+	"archived":       kindBool,
+	"topics":         kindList,
+}
+
+// check walks the expression and returns the kind that it evaluates to.
+// It rejects the identifiers, fields, methods and operators that eval does
+// not support and the operands that they do not apply to.
+func check(e ast.Expr) (kind, error) {
+	switch e := e.(type) {
+	case *ast.ParenExpr:
+		return check(e.X)
+	case *ast.Ident:
+		if e.Name == "true" || e.Name == "false" {
+			return kindBool, nil
+		}
+		return 0, fmt.Errorf("%w: unknown identifier %s", ErrPolicy, e.Name)
+	case *ast.BasicLit:
+		switch e.Kind {
+		case token.INT:
+			if _, err := strconv.ParseInt(e.Value, 0, 64); err != nil {
+				return 0, fmt.Errorf("%w: %v", ErrPolicy, err)
+			}
+			return kindInt, nil
+		case token.STRING:
+			if _, err := strconv.Unquote(e.Value); err != nil {
+				return 0, fmt.Errorf("%w: invalid string %s", ErrPolicy, e.Value)
+			}
+			return kindString, nil
+		}
+		return 0, fmt.Errorf("%w: unsupported literal %s", ErrPolicy, e.Value)
+	case *ast.SelectorExpr:
+		id, ok := e.X.(*ast.Ident)
+		if !ok || id.Name != "repo" {
+			return 0, fmt.Errorf("%w: fields can only be selected from repo", ErrPolicy)
+		}
+		k, ok := fieldKinds[e.Sel.Name]
+		if !ok {
+			return 0, fmt.Errorf("%w: unknown field repo.%s", ErrPolicy, e.Sel.Name)
+		}
+		return k, nil
+	case *ast.CallExpr:
+		return checkCall(e)
+	case *ast.UnaryExpr:
+		k, err := check(e.X)
+		if err != nil {
+			return 0, err
+		}
+		if (e.Op == token.NOT && k == kindBool) || (e.Op == token.SUB && k == kindInt) {
+			return k, nil
+		}
+		return 0, fmt.Errorf("%w: operator %s does not apply to %s", ErrPolicy, e.Op, k)
+	case *ast.BinaryExpr:
+		return checkBinary(e)
+	default:
+		return 0, fmt.Errorf("%w: unsupported expression", ErrPolicy)
+	}
+}
+
+// checkBinary checks both operands of the logical and comparison
+// operators.
+func checkBinary(e *ast.BinaryExpr) (kind, error) {
+	x, err := check(e.X)
+	if err != nil {
+		return 0, err
+	}
+	y, err := check(e.Y)
+	if err != nil {
+		return 0, err
+	}
+
+	switch e.Op {
+	case token.LAND, token.LOR:
+		if x != kindBool {
+			return 0, fmt.Errorf("%w: operator %s does not apply to %s", ErrPolicy, e.Op, x)
+		}
+		if y != kindBool {
+			return 0, fmt.Errorf("%w: operator %s does not apply to %s", ErrPolicy, e.Op, y)
+		}
+	case token.EQL, token.NEQ:
+		if x != y {
+			return 0, fmt.Errorf("%w: unable to compare %s and %s", ErrPolicy, x, y)
+		}
+		if x == kindList {
+			return 0, fmt.Errorf("%w: unable to compare lists", ErrPolicy)
+		}
+	case token.LSS, token.LEQ, token.GTR, token.GEQ:
+		if x != y || (x != kindInt && x != kindString) {
+			return 0, fmt.Errorf("%w: unable to order %s and %s", ErrPolicy, x, y)
+		}
+	default:
+		return 0, fmt.Errorf("%w: unsupported operator %s", ErrPolicy, e.Op)
+	}
+	return kindBool, nil
+}
+
+// checkCall checks the receiver and arguments of a method.  Patterns given
+// to matches as literals are compiled.
+func checkCall(e *ast.CallExpr) (kind, error) {
+	sel, ok := e.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return 0, fmt.Errorf("%w: only methods can be called", ErrPolicy)
+	}
+
+	recv, err := check(sel.X)
+	if err != nil {
+		return 0, err
+	}
+
+	method := sel.Sel.Name
+	if method == "size" {
+		if len(e.Args) != 0 {
+			return 0, fmt.Errorf("%w: size does not take arguments", ErrPolicy)
+		}
+		if recv != kindString && recv != kindList {
+			return 0, fmt.Errorf("%w: size does not apply to %s", ErrPolicy, recv)
+		}
+		return kindInt, nil
+	}
+
+	if len(e.Args) != 1 {
+		return 0, fmt.Errorf("%w: %s takes a single argument", ErrPolicy, method)
+	}
+	arg, err := check(e.Args[0])
+	if err != nil {
+		return 0, err
+	}
+	if arg != kindString {
+		return 0, fmt.Errorf("%w: the argument of %s must be a string", ErrPolicy, method)
+	}
+
+	switch {
+	case recv == kindString && (method == "startsWith" || method == "endsWith" || method == "contains"):
+	case recv == kindString && method == "matches":
+		if lit, ok := e.Args[0].(*ast.BasicLit); ok {
+			pattern, _ := strconv.Unquote(lit.Value)
+			if _, err := regexp.Compile(pattern); err != nil {
+				return 0, fmt.Errorf("%w: %v", ErrPolicy, err)
+			}
+		}
+	case recv == kindList && method == "contains":
+	default:
+		return 0, fmt.Errorf("%w: %s does not apply to %s", ErrPolicy, method, recv)
+	}
+	return kindBool, nil
+}
+
+// field returns the value of a repository field by its json name.
+func field(r *Repo, name string) (interface{}, error) {
+	switch name {
+	case "name":
+		return r.Name, nil
+	case "owner":
+		return r.Owner, nil
+	case "description":
+		return r.Description, nil
+	case "default_branch":
+		return r.DefaultBranch, nil
+	case "html_url":
+		return r.HTMLURL, nil
+	case "license":
+		return r.License, nil
+	case "stars":
+		return int64(r.Stars), nil
+	case "archived":
+		return r.Archived, nil
+	case "topics":
+		return r.Topics, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown field repo.%s", ErrPolicy, name)
+	}
+}
+
+// eval evaluates a node of the expression.  Values are either bool, int64,
+// string or []string.
+func eval(e ast.Expr, r *Repo) (interface{}, error) {
+	switch e := e.(type) {
+	case *ast.ParenExpr:
+		return eval(e.X, r)
+	case *ast.Ident:
+		switch e.Name {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return nil, fmt.Errorf("%w: unknown identifier %s", ErrPolicy, e.Name)
+	case *ast.BasicLit:
+		switch e.Kind {
+		case token.INT:
+			return strconv.ParseInt(e.Value, 0, 64)
+		case token.STRING:
+			return strconv.Unquote(e.Value)
+		}
+		return nil, fmt.Errorf("%w: unsupported literal %s", ErrPolicy, e.Value)
+	case *ast.SelectorExpr:
+		if id, ok := e.X.(*ast.Ident); ok && id.Name == "repo" {
+			return field(r, e.Sel.Name)
+		}
+		return nil, fmt.Errorf("%w: fields can only be selected from repo", ErrPolicy)
+	case *ast.CallExpr:
+		return call(e, r)
+	case *ast.UnaryExpr:
+		return unary(e, r)
+	case *ast.BinaryExpr:
+		return binary(e, r)
+	default:
+		return nil, fmt.Errorf("%w: unsupported expression", ErrPolicy)
+	}
+}
+
+// unary evaluates the ! and - operators.
+func unary(e *ast.UnaryExpr, r *Repo) (interface{}, error) {
+	v, err := eval(e.X, r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch x := v.(type) {
+	case bool:
+		if e.Op == token.NOT {
+			return !x, nil
+		}
+	case int64:
+		if e.Op == token.SUB {
+			return -x, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: operator %s does not apply to %T", ErrPolicy, e.Op, v)
+}
+
+// binary evaluates the logical and comparison operators.  The logical
+// operators short circuit.
+func binary(e *ast.BinaryExpr, r *Repo) (interface{}, error) {
+	x, err := eval(e.X, r)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.Op == token.LAND || e.Op == token.LOR {
+		b, ok := x.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%w: operator %s does not apply to %T", ErrPolicy, e.Op, x)
+		}
+		if b == (e.Op == token.LOR) {
+			return b, nil
+		}
+		y, err := eval(e.Y, r)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := y.(bool); !ok {
+			return nil, fmt.Errorf("%w: operator %s does not apply to %T", ErrPolicy, e.Op, y)
+		}
+		return y, nil
+	}
+
+	y, err := eval(e.Y, r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.Op {
+	case token.EQL, token.NEQ:
+		if fmt.Sprintf("%T", x) != fmt.Sprintf("%T", y) {
+			return nil, fmt.Errorf("%w: unable to compare %T and %T", ErrPolicy, x, y)
+		}
+		if _, ok := x.([]string); ok {
+			return nil, fmt.Errorf("%w: unable to compare lists", ErrPolicy)
+		}
+		return (x == y) == (e.Op == token.EQL), nil
+	case token.LSS, token.LEQ, token.GTR, token.GEQ:
+		c, err := compare(x, y)
+		if err != nil {
+			return nil, err
+		}
+		switch e.Op {
+		case token.LSS:
+			return c < 0, nil
+		case token.LEQ:
+			return c <= 0, nil
+		case token.GTR:
+			return c > 0, nil
+		default:
+			return c >= 0, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: unsupported operator %s", ErrPolicy, e.Op)
+}
+
+// compare orders two integers or two strings.
+func compare(x, y interface{}) (int, error) {
+	switch a := x.(type) {
+	case int64:
+		if b, ok := y.(int64); ok {
+			switch {
+			case a < b:
+				return -1, nil
+			case a > b:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	case string:
+		if b, ok := y.(string); ok {
+			return strings.Compare(a, b), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: unable to order %T and %T", ErrPolicy, x, y)
+}
+
+// call evaluates the methods of strings and lists.
+func call(e *ast.CallExpr, r *Repo) (interface{}, error) {
+	sel, ok := e.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return nil, fmt.Errorf("%w: only methods can be called", ErrPolicy)
+	}
+
+	recv, err := eval(sel.X, r)
+	if err != nil {
+		return nil, err
+	}
+
+	method := sel.Sel.Name
+	if method == "size" {
+		if len(e.Args) != 0 {
+			return nil, fmt.Errorf("%w: size does not take arguments", ErrPolicy)
+		}
+		switch v := recv.(type) {
+		case string:
+			return int64(len(v)), nil
+		case []string:
+			return int64(len(v)), nil
+		}
+		return nil, fmt.Errorf("%w: size does not apply to %T", ErrPolicy, recv)
+	}
+
+	if len(e.Args) != 1 {
+		return nil, fmt.Errorf("%w: %s takes a single argument", ErrPolicy, method)
+	}
+	a, err := eval(e.Args[0], r)
+	if err != nil {
+		return nil, err
+	}
+	arg, ok := a.(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: the argument of %s must be a string", ErrPolicy, method)
+	}
+
+	switch v := recv.(type) {
+	case string:
+		switch method {
+		case "startsWith":
+			return strings.HasPrefix(v, arg), nil
+		case "endsWith":
+			return strings.HasSuffix(v, arg), nil
+		case "contains":
+			return strings.Contains(v, arg), nil
+		case "matches":
+			re, err := regexp.Compile(arg)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrPolicy, err)
+			}
+			return re.MatchString(v), nil
+		}
+	case []string:
+		if method == "contains" {
+			for _, s := range v {
+				if s == arg {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s does not apply to %T", ErrPolicy, method, recv)
+}
+
+// allowed returns true if the sync policy matches the repository.  A
+// repository that the policy can not be evaluated against is not
+// synchronized.
+func (rs *Syncer) allowed(r *Repo) bool {
+	if rs.options.SyncPolicy == nil {
+		return true
+	}
+
+	ok, err := rs.options.SyncPolicy.Match(r)
+	if err != nil {
+		rs.logger.Error("unable to evaluate the sync policy", zap.Any("repo", r), zap.Error(err))
+		return false
+	}
+	if !ok {
+		rs.logger.Debug("repository excluded by the sync policy", zap.Any("repo", r))
+	}
+	return ok
+}
+
+// quarantined pauses a newly discovered repository that the quarantine
+// policy matches.  The repository is registered without a commit so that
+// it can be resumed, after which the policy no longer applies to it.
+func (rs *Syncer) quarantined(r *Repo) bool {
+	if rs.options.QuarantinePolicy == nil {
+		return false
+	}
+
+	rs.mu.RLock()
+	_, known := rs.repos[r.Name+"/"+r.Owner]
+	rs.mu.RUnlock()
+	if known {
+		return false
+	}
+
+	ok, err := rs.options.QuarantinePolicy.Match(r)
+	if err != nil {
+		rs.logger.Error("unable to evaluate the quarantine policy", zap.Any("repo", r), zap.Error(err))
+		ok = true
+	}
+	if !ok {
+		return false
+	}
+
+	r.CommitSHA = ""
+	rs.update(r)
+	if err := rs.Pause(r.Owner, r.Name, QuarantineReason); err != nil {
+		rs.logger.Error("unable to save the quarantine", zap.Any("repo", r), zap.Error(err))
+	}
+	return true
+}
@@ -0,0 +1,111 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPolicyMatch(t *testing.T) {
+	r := &Repo{
+		Owner:    "ctxswitch",
+		Name:     "svc-gdoc",
+		License:  "Apache-2.0",
+		Stars:    3,
+		Archived: false,
+		Topics:   []string{"go", "docs"},
+	}
+
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		// && binds tighter than ||, so these differ only in grouping.
+		{`true || false && false`, true},
+		{`(true || false) && false`, false},
+		{`!repo.archived && repo.stars > 2 || repo.stars == 0`, true},
+		{`!(repo.archived || repo.stars > 2)`, false},
+		{`repo.stars > -1 && -repo.stars < 0`, true},
+		{`repo.stars >= 3 && repo.stars <= 3 && repo.stars != 4`, true},
+		{`repo.name.startsWith("svc-") && repo.name.endsWith("gdoc")`, true},
+		{`repo.name < "tool" && repo.owner >= "ctxswitch"`, true},
+		{`repo.topics.contains("docs") && repo.topics.size() == 2`, true},
+		{`repo.description.size() == 0`, true},
+		// Quoting.
+		{"repo.license == `Apache-2.0`", true},
+		{`repo.name.contains("\x2d")`, true},
+		{`repo.name.matches("^svc-[a-z]+$")`, true},
+		{`repo.name.matches("\\d")`, false},
+	}
+
+	for _, tt := range tests {
+		p, err := ParsePolicy(tt.src)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.src, err)
+			continue
+		}
+		got, err := p.Match(r)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: expected %t, got %t", tt.src, tt.want, got)
+		}
+	}
+}
+
+func TestParsePolicyErrors(t *testing.T) {
+	tests := []string{
+		// Syntax.
+		`repo.stars >`,
+		`repo.name == "unterminated`,
+		// Errors hidden behind short circuits when evaluated against an
+		// empty repository.
+		`false && repo.nope`,
+		`true || repo.stars == "3"`,
+		`false && repo.name.startsWith(1)`,
+		`true || unknown`,
+		`false && repo.name.matches("(")`,
+		// Types.
+		`repo.stars`,
+		`repo.name && true`,
+		`!repo.name`,
+		`-repo.archived`,
+		`repo.topics == repo.topics`,
+		`repo.archived < true`,
+		`repo.topics.startsWith("go")`,
+		`repo.stars.size() > 0`,
+		`repo.name.size(1) > 0`,
+		`repo.name.contains("a", "b")`,
+		// Unsupported expressions.
+		`repo.stars + 1 > 0`,
+		`other.name == ""`,
+		`len(repo.name) > 0`,
+		`repo.name[0] == "s"`,
+		`1.5 > 1`,
+	}
+
+	for _, src := range tests {
+		if _, err := ParsePolicy(src); !errors.Is(err, ErrPolicy) {
+			t.Errorf("%s: expected ErrPolicy, got %v", src, err)
+		}
+	}
+}
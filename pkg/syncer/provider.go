@@ -0,0 +1,306 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/go-github/v42/github"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+// RepositoryProvider discovers the repositories that will be synchronized
+// and looks up their latest commits.
+type RepositoryProvider interface {
+	// Repositories calls fn for each repository that has been discovered.
+	// Repositories are passed to fn as soon as they are available.  If fn
+	// returns an error, discovery stops and the error is returned.
+	Repositories(ctx context.Context, fn func(*Repo) error) error
+	// Commit returns the latest commit sha of the repository's default
+	// branch.
+	Commit(ctx context.Context, r *Repo) (string, error)
+}
+
+// tracer is implemented by providers that can log the calls they make to
+// a remote API.
+type tracer interface {
+	SetTrace(enabled bool)
+	Tracing() bool
+}
+
+// callCounter is implemented by providers that keep track of the number of
+// calls that they have made to a remote API.
+type callCounter interface {
+	Calls() int64
+}
+
+// GithubProviderOptions defines the options available for the Github
+// repository provider.
+type GithubProviderOptions struct {
+	// A personal access token with permissions to access and list the
+	// repositories.  Leave empty to use the API anonymously.
+	GithubToken string
+	// The Github user or organization that will be scraped.
+	GithubUser string
+	// The topic that will be used as a filter to identify repositories
+	// that will be synchronized.  Not used when Discovery is DiscoveryOrg.
+	GithubTopic string
+	// How repositories are discovered.  Either DiscoveryTopic or
+	// DiscoveryOrg.  Defaults to DiscoveryTopic.
+	Discovery string
+	// A raw search query used instead of the query built from the user
+	// and topic, such as "org:acme language:go archived:false".  Only used
+	// when Discovery is DiscoveryTopic.
+	SearchQuery string
+	// The maximum time a single API call may take before it is cancelled.
+	// Zero disables the timeout.
+	APITimeout time.Duration
+	// The User-Agent sent on API requests.  Defaults to the go-github
+	// User-Agent.
+	UserAgent string
+	// Log every API call.  Tracing can be toggled later with SetTrace.
+	Trace bool
+	// The consecutive failed API calls after which the circuit breaker
+	// stops calling the API.  Zero disables the circuit breaker.
+	BreakerThreshold int
+	// How long the circuit breaker waits before probing the API again
+	// after it opens.  Doubled after each failed probe.  Defaults to
+	// DefaultBreakerCooldown.
+	BreakerCooldown time.Duration
+	// The logger that API calls are traced to.  Defaults to a logger that
+	// discards everything.
+	Logger *zap.Logger
+}
+
+const (
+	// DiscoveryTopic searches for Go repositories owned by the user or
+	// organization that are tagged with the topic.
+	DiscoveryTopic = "topic"
+	// DiscoveryOrg lists every repository in the organization and keeps
+	// the ones that Github has detected Go as the primary language of.
+	DiscoveryOrg = "org"
+)
+
+// languageGo is the language name that Github uses for Go repositories.
+const languageGo = "Go"
+
+// GithubProvider is a RepositoryProvider that uses the Github search API
+// to discover repositories tagged with a topic.
+type GithubProvider struct {
+	options GithubProviderOptions
+	client  *github.Client
+	trace   *traceTransport
+	calls   int64
+}
+
+// NewGithubProvider returns a provider that authenticates to the Github
+// API using the personal access token.  If no token is set, the API is
+// used anonymously which only gives access to public repositories and is
+// subject to much lower rate limits.  The client is created once and reused
+// for every request so that connections are kept alive between sync cycles.
+// Failed requests are retried and requests are spread out as the rate limit
+// is approached.  Calls stop while the circuit breaker is open.
+func NewGithubProvider(options GithubProviderOptions) *GithubProvider {
+	var transport http.RoundTripper = http.DefaultTransport
+	if options.GithubToken != "" {
+		transport = &oauth2.Transport{
+			Source: oauth2.StaticTokenSource(
+				&oauth2.Token{AccessToken: options.GithubToken},
+			),
+		}
+	}
+
+	logger := options.Logger
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	// Tracing sits below the retries so that every attempt is logged,
+	// and above the token so that it never sees the credentials.
+	trace := &traceTransport{next: transport, logger: logger}
+	trace.set(options.Trace)
+
+	// The breaker sits above the retries so that a call is only counted
+	// as failed once its retries are exhausted.
+	transport = &retryTransport{
+		next: &rateLimitTransport{
+			next: trace,
+		},
+	}
+	if options.BreakerThreshold > 0 {
+		cooldown := options.BreakerCooldown
+		if cooldown <= 0 {
+			cooldown = DefaultBreakerCooldown
+		}
+		transport = newBreakerTransport(transport, options.BreakerThreshold, cooldown, logger)
+	}
+
+	client := &http.Client{Transport: transport}
+
+	gh := github.NewClient(client)
+	if options.UserAgent != "" {
+		gh.UserAgent = options.UserAgent
+	}
+
+	return &GithubProvider{
+		options: options,
+		client:  gh,
+		trace:   trace,
+	}
+}
+
+// SetTrace enables or disables logging every API call.
+func (p *GithubProvider) SetTrace(enabled bool) {
+	p.trace.set(enabled)
+}
+
+// Tracing returns true if API calls are being logged.
+func (p *GithubProvider) Tracing() bool {
+	return atomic.LoadInt32(&p.trace.enabled) == 1
+}
+
+// Calls returns the number of calls that have been made to the Github API.
+func (p *GithubProvider) Calls() int64 {
+	return atomic.LoadInt64(&p.calls)
+}
+
+// Repositories discovers the repositories using the configured discovery
+// method.  Each repository is passed to fn as soon as its page has been
+// returned.
+func (p *GithubProvider) Repositories(ctx context.Context, fn func(*Repo) error) error {
+	if p.options.Discovery == DiscoveryOrg {
+		return p.organization(ctx, fn)
+	}
+
+	return p.topic(ctx, fn)
+}
+
+// topic queries for repositories that have the configured topic set, or
+// that match the raw search query if one is configured.  The search
+// results are paged through.
+func (p *GithubProvider) topic(ctx context.Context, fn func(*Repo) error) error {
+	q := fmt.Sprintf("language:go user:%s topic:%s", p.options.GithubUser, p.options.GithubTopic)
+	if p.options.SearchQuery != "" {
+		q = p.options.SearchQuery
+	}
+
+	opts := &github.SearchOptions{
+		ListOptions: github.ListOptions{PerPage: searchPageSize},
+	}
+
+	for {
+		result, resp, err := p.search(ctx, q, opts)
+		if err != nil {
+			return err
+		}
+
+		for _, repo := range result.Repositories {
+			if err := fn(newRepo(repo)); err != nil {
+				return err
+			}
+		}
+
+		if resp.NextPage == 0 {
+			return nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// organization lists all of the repositories in the organization and keeps
+// those with Go as their primary language.  The list is paged through.
+func (p *GithubProvider) organization(ctx context.Context, fn func(*Repo) error) error {
+	opts := &github.RepositoryListByOrgOptions{
+		Type:        "all",
+		ListOptions: github.ListOptions{PerPage: searchPageSize},
+	}
+
+	for {
+		repos, resp, err := p.listByOrg(ctx, opts)
+		if err != nil {
+			return err
+		}
+
+		for _, repo := range repos {
+			if repo.GetLanguage() != languageGo {
+				continue
+			}
+
+			if err := fn(newRepo(repo)); err != nil {
+				return err
+			}
+		}
+
+		if resp.NextPage == 0 {
+			return nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// listByOrg requests a single page of the organization's repositories.
+func (p *GithubProvider) listByOrg(ctx context.Context, opts *github.RepositoryListByOrgOptions) ([]*github.Repository, *github.Response, error) {
+	atomic.AddInt64(&p.calls, 1)
+	ctx, cancel := withTimeout(ctx, p.options.APITimeout)
+	defer cancel()
+	return p.client.Repositories.ListByOrg(ctx, p.options.GithubUser, opts)
+}
+
+// search requests a single page of search results.
+func (p *GithubProvider) search(ctx context.Context, q string, opts *github.SearchOptions) (*github.RepositoriesSearchResult, *github.Response, error) {
+	atomic.AddInt64(&p.calls, 1)
+	ctx, cancel := withTimeout(ctx, p.options.APITimeout)
+	defer cancel()
+	return p.client.Search.Repositories(ctx, q, opts)
+}
+
+// Commit returns the latest commit sha of the default branch by getting
+// detailed information about the branch.
+func (p *GithubProvider) Commit(ctx context.Context, r *Repo) (string, error) {
+	atomic.AddInt64(&p.calls, 1)
+	ctx, cancel := withTimeout(ctx, p.options.APITimeout)
+	defer cancel()
+	b, _, err := p.client.Repositories.GetBranch(ctx, r.Owner, r.Name, r.DefaultBranch, true)
+	if err != nil {
+		return "", err
+	}
+
+	return *b.Commit.SHA, nil
+}
+
+// newRepo returns the Repo for a repository returned from the Github API.
+func newRepo(repo *github.Repository) *Repo {
+	return &Repo{
+		Owner:         repo.GetOwner().GetLogin(),
+		Name:          repo.GetName(),
+		CloneURL:      repo.GetCloneURL(),
+		HTMLURL:       repo.GetHTMLURL(),
+		DefaultBranch: repo.GetDefaultBranch(),
+		Description:   repo.GetDescription(),
+		Stars:         repo.GetStargazersCount(),
+		Topics:        repo.Topics,
+		License:       repo.GetLicense().GetSPDXID(),
+		Archived:      repo.GetArchived(),
+	}
+}
@@ -0,0 +1,298 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultRedisPort is the port of the redis server when the URL has none.
+const DefaultRedisPort = "6379"
+
+// DefaultRedisLockTTL is the expiry of the redis lock when no ttl is
+// configured.  The lock is renewed every third of the ttl while it is held.
+const DefaultRedisLockTTL = time.Minute
+
+// The scripts that renew and release the lock only if it is still held
+// with the value set when it was acquired.
+const (
+	redisRenewScript   = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`
+	redisReleaseScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+)
+
+// RedisLockOptions defines the options available for the redis lock.
+type RedisLockOptions struct {
+	// The address of the redis server as redis://[user:password@]host:port/db.
+	// Use rediss:// to connect with TLS.
+	URL string
+	// The key that the lock is stored in.
+	Key string
+	// The expiry of the lock.  An instance that stops without releasing
+	// the lock holds it for at most the ttl.
+	TTL    time.Duration
+	Logger *zap.Logger
+}
+
+// RedisLock is a Locker backed by a key in redis.  It guards instances that
+// do not share a filesystem that supports locks.
+type RedisLock struct {
+	options RedisLockOptions
+	url     *url.URL
+	logger  *zap.Logger
+
+	// The value of the key while the lock is held.
+	value string
+	// Closed to stop renewing the lock.
+	stop chan struct{}
+	done chan struct{}
+	mu   sync.Mutex
+}
+
+// NewRedisLock returns a lock on the key in the redis server.
+func NewRedisLock(options RedisLockOptions) (*RedisLock, error) {
+	u, err := url.Parse(options.URL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("unsupported redis scheme %q", u.Scheme)
+	}
+
+	if options.TTL <= 0 {
+		options.TTL = DefaultRedisLockTTL
+	}
+
+	return &RedisLock{
+		options: options,
+		url:     u,
+		logger:  options.Logger,
+	}, nil
+}
+
+// Acquire sets the key if it does not exist.  The key is renewed until the
+// lock is released, and lost is called if it expired or was taken by
+// another instance in between.
+func (l *RedisLock) Acquire(ctx context.Context, lost func()) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.stop != nil {
+		return false, errors.New("lock is already held")
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return false, err
+	}
+	value := hex.EncodeToString(b)
+
+	// The key expires at most a ttl after the command was sent.
+	acquired := time.Now()
+	reply, err := l.do(ctx, "SET", l.options.Key, value, "NX", "PX", strconv.FormatInt(l.options.TTL.Milliseconds(), 10))
+	if err != nil || reply == nil {
+		return false, err
+	}
+
+	l.value = value
+	l.stop = make(chan struct{})
+	l.done = make(chan struct{})
+	go l.renew(l.value, acquired, lost, l.stop, l.done)
+	return true, nil
+}
+
+// Release stops renewing the key and deletes it if it is still held.
+func (l *RedisLock) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.stop == nil {
+		return nil
+	}
+
+	close(l.stop)
+	<-l.done
+	l.stop = nil
+
+	_, err := l.do(ctx, "EVAL", redisReleaseScript, "1", l.options.Key, l.value)
+	return err
+}
+
+// renew extends the expiry of the key every third of the ttl.  The lock is
+// lost if the key expired or was taken by another instance in between, or
+// if a whole ttl has passed since the key was last set without a renewal
+// reaching the server, since it may have expired in the meantime.  lost is
+// then called so that the holder stops.
+func (l *RedisLock) renew(value string, renewed time.Time, lost func(), stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(l.options.TTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), l.options.TTL/3)
+			started := time.Now()
+			reply, err := l.do(ctx, "EVAL", redisRenewScript, "1", l.options.Key, value, strconv.FormatInt(l.options.TTL.Milliseconds(), 10))
+			cancel()
+			switch {
+			case err != nil && time.Since(renewed) >= l.options.TTL:
+				l.logger.Error("the sync lock could not be renewed before it expired, another instance may be synchronizing", zap.String("key", l.options.Key), zap.Error(err))
+				if lost != nil {
+					lost()
+				}
+				return
+			case err != nil:
+				l.logger.Error("unable to renew the sync lock", zap.Error(err))
+			case reply == int64(0):
+				l.logger.Error("the sync lock was lost, another instance may be synchronizing", zap.String("key", l.options.Key))
+				if lost != nil {
+					lost()
+				}
+				return
+			default:
+				renewed = started
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// do connects to the server, authenticates and selects the database, and
+// runs the command.  Commands are rare enough that connections are not
+// reused.
+func (l *RedisLock) do(ctx context.Context, args ...string) (interface{}, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", l.address())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if l.url.Scheme == "rediss" {
+		tc := tls.Client(conn, &tls.Config{ServerName: l.url.Hostname(), MinVersion: tls.VersionTLS12})
+		if err := tc.HandshakeContext(ctx); err != nil {
+			return nil, err
+		}
+		conn = tc
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(10 * time.Second)
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	var commands [][]string
+	if password, ok := l.url.User.Password(); ok {
+		if user := l.url.User.Username(); user != "" {
+			commands = append(commands, []string{"AUTH", user, password})
+		} else {
+			commands = append(commands, []string{"AUTH", password})
+		}
+	}
+	if db := strings.TrimPrefix(l.url.Path, "/"); db != "" {
+		commands = append(commands, []string{"SELECT", db})
+	}
+	commands = append(commands, args)
+
+	w := bufio.NewWriter(conn)
+	for _, c := range commands {
+		fmt.Fprintf(w, "*%d\r\n", len(c))
+		for _, a := range c {
+			fmt.Fprintf(w, "$%d\r\n%s\r\n", len(a), a)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	var reply interface{}
+	for range commands {
+		if reply, err = readReply(r); err != nil {
+			return nil, err
+		}
+	}
+	return reply, nil
+}
+
+// address returns the host and port of the redis server.
+func (l *RedisLock) address() string {
+	port := l.url.Port()
+	if port == "" {
+		port = DefaultRedisPort
+	}
+	return net.JoinHostPort(l.url.Hostname(), port)
+}
+
+// readReply reads a simple string, error, integer or bulk string reply.
+// Nil replies are returned as nil.
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, fmt.Errorf("redis: %s", line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return string(b[:n]), nil
+	}
+
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
@@ -0,0 +1,142 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestRedisLockAddress(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"redis://redis", "redis:6379"},
+		{"redis://:secret@redis/2", "redis:6379"},
+		{"rediss://redis:6380", "redis:6380"},
+		{"redis://[::1]", "[::1]:6379"},
+	}
+
+	for _, tt := range tests {
+		l, err := NewRedisLock(RedisLockOptions{URL: tt.url})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.url, err)
+		}
+		if got := l.address(); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.url, tt.want, got)
+		}
+	}
+}
+
+// fakeRedis is a redis server that sets keys but drops the connection of
+// every renewal, like a server that can not be reached.
+func fakeRedis(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					args, err := readCommand(r)
+					if err != nil {
+						return
+					}
+					if strings.ToUpper(args[0]) != "SET" {
+						return
+					}
+					if _, err := conn.Write([]byte("+OK\r\n")); err != nil {
+						return
+					}
+				}
+			}(conn)
+		}
+	}()
+
+	return "redis://" + ln.Addr().String()
+}
+
+// readCommand reads a command sent as an array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		if _, err := r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+	return args, nil
+}
+
+func TestRedisLockLostWhenRenewalFails(t *testing.T) {
+	ttl := 150 * time.Millisecond
+	l, err := NewRedisLock(RedisLockOptions{URL: fakeRedis(t), Key: "gdoc", TTL: ttl, Logger: zap.NewNop()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lost := make(chan time.Time, 1)
+	acquired := time.Now()
+	ok, err := l.Acquire(context.Background(), func() { lost <- time.Now() })
+	if err != nil || !ok {
+		t.Fatalf("expected the lock to be acquired, got %t, %v", ok, err)
+	}
+	defer l.Release(context.Background())
+
+	select {
+	case at := <-lost:
+		if at.Sub(acquired) < ttl {
+			t.Fatalf("expected the lock to be held until the ttl elapsed, lost after %s", at.Sub(acquired))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the lock to be lost once the ttl elapsed without a renewal")
+	}
+}
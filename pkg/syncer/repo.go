@@ -0,0 +1,53 @@
+package syncer
+
+import (
+	"path"
+	"time"
+)
+
+// Repo defines the attributes of a github repository that will be
+// required for the Syncer service.
+type Repo struct {
+	Owner         string `json:"owner"`
+	Name          string `json:"name"`
+	CloneURL      string `json:"clone_url"`
+	DefaultBranch string `json:"default_branch"`
+	CommitSHA     string `json:"commit_sha"`
+	LocalPath     string `json:"local_path"`
+
+	// The branches that are checked out next to the default branch.
+	Branches []Branch `json:"branches,omitempty"`
+	// The branch that LocalPath tracks when it is not the default branch.
+	// Only set on the copies used to update the branch checkouts.
+	Ref string `json:"-"`
+
+	// Metadata about the repository that is refreshed on every sync.
+	HTMLURL     string   `json:"html_url"`
+	Description string   `json:"description"`
+	Stars       int      `json:"stars"`
+	Topics      []string `json:"topics"`
+	License     string   `json:"license"`
+	Archived    bool     `json:"archived"`
+
+	// The newest release tag of the form vX.Y.Z.  Empty if the repository
+	// has not been released.
+	Version string `json:"version,omitempty"`
+	// The time of the commit each package directory last changed in, keyed
+	// by its path relative to the repository root.  The root is ".".
+	// Packages are left out until a change to them has been seen.
+	Modified map[string]time.Time `json:"modified,omitempty"`
+
+	// Set when syncing of the repository has been paused.
+	Paused bool `json:"paused"`
+}
+
+// MatchRepo returns true if owner/name matches one of the patterns, such as
+// ctxswitch/gdoc or ctxswitch/*, using the syntax of path.Match.
+func MatchRepo(patterns []string, owner, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, owner+"/"+name); ok {
+			return true
+		}
+	}
+	return false
+}
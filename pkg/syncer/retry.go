@@ -0,0 +1,182 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultRetryBackoff is the wait after the first failure of a
+	// repository when no backoff is configured.
+	DefaultRetryBackoff = 5 * time.Minute
+	// DefaultRetryMaxBackoff is the longest wait between attempts when no
+	// maximum is configured.
+	DefaultRetryMaxBackoff = 6 * time.Hour
+)
+
+// Failure tracks a repository that has failed to sync.
+type Failure struct {
+	Owner string `json:"owner"`
+	Name  string `json:"name"`
+	// The number of consecutive failures.
+	Count int `json:"count"`
+	// The error of the last failure.
+	LastError string `json:"last_error"`
+	// The class of the last failure.  Either "auth", "rate_limited",
+	// "clone_failed" or empty if the failure has not been classified.
+	Class string `json:"class,omitempty"`
+	// The time of the last failure.
+	LastFailure time.Time `json:"last_failure"`
+	// The repository is not attempted again before this time.
+	NextAttempt time.Time `json:"next_attempt"`
+	// True once the repository has been moved to the dead letter list.
+	// It is no longer attempted until the failure is cleared.
+	Dead bool `json:"dead"`
+}
+
+// deferred returns true if the repository should not be attempted during
+// this cycle because it is backing off or is on the dead letter list.
+// Repositories whose credentials were rejected are not held back while the
+// credentials are invalid, so that one of them probes the credentials on
+// every cycle.  The lock must not be held.
+func (rs *Syncer) deferred(r *Repo) bool {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	f, ok := rs.state.Failures[r.Owner+"/"+r.Name]
+	if !ok {
+		return false
+	}
+	probe := f.Class == "auth" && !rs.credentials.Valid
+	return f.Dead || (rs.clock.Now().Before(f.NextAttempt) && !probe)
+}
+
+// fail records a failed attempt and schedules the next one.  The wait is
+// doubled after each consecutive failure up to the maximum backoff and the
+// repository is moved to the dead letter list once it has failed the
+// configured number of times.  The stored commit is cleared so that the
+// next attempt updates the repository even if the remote has not changed.
+func (rs *Syncer) fail(r *Repo, err error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if rs.state.Failures == nil {
+		rs.state.Failures = make(map[string]*Failure)
+	}
+
+	key := r.Owner + "/" + r.Name
+	f, ok := rs.state.Failures[key]
+	if !ok {
+		f = &Failure{Owner: r.Owner, Name: r.Name}
+		rs.state.Failures[key] = f
+	}
+
+	now := rs.clock.Now()
+	f.Count++
+	f.LastError = err.Error()
+	f.Class = className(err)
+	f.LastFailure = now
+	f.NextAttempt = now.Add(rs.backoff(f.Count))
+
+	// Rate limits are lifted over time and rejected credentials are
+	// reported for the whole instance, so neither moves a repository to
+	// the dead letter list.
+	transient := errors.Is(err, ErrRateLimited) || (errors.Is(err, ErrAuth) && !rs.credentials.Valid)
+	if rs.options.DeadLetterAfter > 0 && f.Count >= rs.options.DeadLetterAfter && !f.Dead && !transient {
+		f.Dead = true
+		rs.logger.Warn("repository moved to the dead letter list", zap.String("repo", key), zap.Int("failures", f.Count))
+	}
+
+	if stored, ok := rs.repos[r.Name+"/"+r.Owner]; ok {
+		stored.CommitSHA = ""
+	}
+}
+
+// succeed clears the failures of a repository.
+func (rs *Syncer) succeed(r *Repo) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	delete(rs.state.Failures, r.Owner+"/"+r.Name)
+}
+
+// backoff returns the wait after the given number of consecutive failures.
+func (rs *Syncer) backoff(count int) time.Duration {
+	base := rs.options.RetryBackoff
+	if base <= 0 {
+		base = DefaultRetryBackoff
+	}
+	max := rs.options.RetryMaxBackoff
+	if max <= 0 {
+		max = DefaultRetryMaxBackoff
+	}
+
+	d := base
+	for i := 1; i < count && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// Failures returns the repositories that are failing, including the ones
+// on the dead letter list, ordered by owner and name.
+func (rs *Syncer) Failures() []Failure {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	failures := make([]Failure, 0, len(rs.state.Failures))
+	for _, f := range rs.state.Failures {
+		failures = append(failures, *f)
+	}
+
+	sort.Slice(failures, func(i, j int) bool {
+		if failures[i].Owner != failures[j].Owner {
+			return failures[i].Owner < failures[j].Owner
+		}
+		return failures[i].Name < failures[j].Name
+	})
+
+	return failures
+}
+
+// ClearFailure removes a repository from the retry queue and the dead
+// letter list so that it is attempted during the next cycle.  It returns
+// false if the repository was not failing.
+func (rs *Syncer) ClearFailure(owner, name string) bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	key := owner + "/" + name
+	if _, ok := rs.state.Failures[key]; !ok {
+		return false
+	}
+	delete(rs.state.Failures, key)
+
+	if err := saveState(rs.statePath(), rs.state); err != nil {
+		rs.logger.Error("unable to save state", zap.Error(err))
+	}
+	return true
+}
@@ -0,0 +1,131 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// SeedModeCopy copies the existing checkout into the workspace.
+	SeedModeCopy = "copy"
+	// SeedModeSymlink links the workspace path to the existing checkout.
+	// Later pulls update the existing checkout in place.
+	SeedModeSymlink = "symlink"
+)
+
+// seed populates the local path of a repository from an existing checkout
+// below the seed directory so that it does not need to be cloned.  The
+// checkout is looked up at the same path relative to the seed directory as
+// the local path is relative to GodocRoot, which matches the layout of an
+// existing GOPATH when the default path template is used.  It returns false
+// if there is nothing to seed from.
+func (rs *Syncer) seed(r *Repo) (bool, error) {
+	if rs.options.SeedDir == "" {
+		return false, nil
+	}
+
+	rel, err := filepath.Rel(rs.options.GodocRoot, r.LocalPath)
+	if err != nil {
+		return false, err
+	}
+
+	src := filepath.Join(rs.options.SeedDir, rel)
+	if fi, err := os.Stat(filepath.Join(src, ".git")); err != nil || !fi.IsDir() {
+		return false, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.LocalPath), 0755); err != nil {
+		return false, err
+	}
+
+	rs.logger.Info("seeding repository", zap.Any("repo", r), zap.String("source", src), zap.String("mode", rs.options.SeedMode))
+	switch rs.options.SeedMode {
+	case SeedModeSymlink:
+		abs, err := filepath.Abs(src)
+		if err != nil {
+			return false, err
+		}
+		return true, os.Symlink(abs, r.LocalPath)
+	case SeedModeCopy, "":
+		if err := copyDir(src, r.LocalPath); err != nil {
+			_ = os.RemoveAll(r.LocalPath)
+			return false, err
+		}
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown seed mode %q", rs.options.SeedMode)
+	}
+}
+
+// copyDir recursively copies the directory src to dst, keeping file modes
+// and symbolic links.
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case fi.IsDir():
+			return os.MkdirAll(target, fi.Mode().Perm()|0700)
+		case fi.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case fi.Mode().IsRegular():
+			return copyFile(path, target, fi.Mode().Perm())
+		default:
+			return nil
+		}
+	})
+}
+
+// copyFile copies the regular file src to dst with the given permissions.
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
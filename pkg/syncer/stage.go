@@ -0,0 +1,161 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"go.uber.org/zap"
+)
+
+// stagingDir is the directory relative to GodocRoot where repositories are
+// cloned before they are moved into place when no staging directory is
+// configured.  Godoc ignores directories that start with a dot, so staged
+// copies are never indexed.
+const stagingDir = ".gdoc/staging"
+
+// stagingPath returns the directory that repositories are cloned into
+// before they are moved into place.
+func (rs *Syncer) stagingPath() string {
+	if rs.options.StagingDir != "" {
+		return rs.options.StagingDir
+	}
+	return filepath.Join(rs.options.GodocRoot, filepath.FromSlash(stagingDir))
+}
+
+// clone clones the repository into the staging directory and returns the
+// path of the clone.  An interrupted or failed clone is only ever left in
+// the staging directory, where it is removed before the same commit is
+// cloned again, so it is never mistaken for a complete local copy.
+func (rs *Syncer) clone(ctx context.Context, r *Repo, id string) (string, error) {
+	staged := *r
+	staged.LocalPath = filepath.Join(rs.stagingPath(), r.Owner, r.Name+"@"+id)
+
+	// Remove anything left behind by an interrupted update.
+	if err := os.RemoveAll(staged.LocalPath); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(staged.LocalPath), 0755); err != nil {
+		return "", err
+	}
+
+	rs.logger.Debug("staging repository", zap.Any("repo", r), zap.String("path", staged.LocalPath))
+	ctx, cancel := withTimeout(ctx, rs.options.CloneTimeout)
+	defer cancel()
+	if err := rs.git.Clone(ctx, &staged); err != nil {
+		_ = os.RemoveAll(staged.LocalPath)
+		return "", wrap("clone", r, err, ErrCloneFailed)
+	}
+
+	return staged.LocalPath, nil
+}
+
+// verifier is implemented by git clients that can check that a local copy
+// is a valid git repository.
+type verifier interface {
+	Verify(r *Repo) error
+	Head(r *Repo) (string, error)
+}
+
+// intact returns false if the local copy of the repository exists but is
+// not a valid git repository.  A missing local copy is intact.  Walking
+// every reference of a large repository is slow, so it is only done when
+// the checked out commit is not the synced one, such as after a failed
+// update, which clears the synced commit, or a change made outside of the
+// syncer.  Otherwise resolving HEAD is enough.
+func (rs *Syncer) intact(r *Repo, synced string) bool {
+	v, ok := rs.git.(verifier)
+	if !ok || missing(r.LocalPath) {
+		return true
+	}
+	if synced != "" {
+		if head, err := v.Head(r); err == nil && head == synced {
+			return true
+		}
+	}
+	return v.Verify(r) == nil
+}
+
+// repair removes the local copy of the repository if it is not a valid git
+// repository so that it is cloned again instead of failing every pull.
+func (rs *Syncer) repair(r *Repo) error {
+	if rs.intact(r, "") {
+		return nil
+	}
+
+	rs.logger.Warn("local copy is not a valid git repository, removing it to clone again", zap.Any("repo", r), zap.String("path", r.LocalPath))
+	metrics.Add("repaired", 1)
+	return os.RemoveAll(r.LocalPath)
+}
+
+// place moves a staged clone to the path, which must not exist.
+func place(staged, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		_ = os.RemoveAll(staged)
+		return err
+	}
+	if err := os.Rename(staged, path); err != nil {
+		_ = os.RemoveAll(staged)
+		return err
+	}
+	return nil
+}
+
+// stage clones the repository into a staging directory and swaps it into
+// place once the clone has completed.  The doc server only ever sees the
+// previous copy or the new copy of the repository, never one that is being
+// updated.
+func (rs *Syncer) stage(ctx context.Context, r *Repo) (outcome, error) {
+	rs.logger.Info("staging repository", zap.Any("repo", r))
+	staged, err := rs.clone(ctx, r, r.CommitSHA)
+	if err != nil {
+		return outcomeFailed, err
+	}
+
+	if _, err := os.Stat(r.LocalPath); os.IsNotExist(err) {
+		return outcomeCloned, place(staged, r.LocalPath)
+	}
+
+	// After the exchange the staging path holds the previous copy.
+	if err := exchange(staged, r.LocalPath); err != nil {
+		_ = os.RemoveAll(staged)
+		return outcomeFailed, err
+	}
+
+	return outcomeUpdated, os.RemoveAll(staged)
+}
+
+// renameExchange swaps two paths using renames.  The new path is briefly
+// missing between the renames, so this is only used when an atomic exchange
+// is not available.
+func renameExchange(oldpath, newpath string) error {
+	tmp := newpath + ".gdoc-swap"
+	if err := os.Rename(newpath, tmp); err != nil {
+		return err
+	}
+
+	if err := os.Rename(oldpath, newpath); err != nil {
+		_ = os.Rename(tmp, newpath)
+		return err
+	}
+
+	return os.Rename(tmp, oldpath)
+}
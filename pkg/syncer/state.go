@@ -0,0 +1,279 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// stateFile is the location of the state file relative to the GodocRoot
+// when no state path is configured.  Godoc ignores directories that start
+// with a dot, so the state is never indexed.
+const stateFile = ".gdoc/state.json"
+
+// DefaultHistorySize is the number of sync cycles kept in the history when
+// no size is configured.
+const DefaultHistorySize = 50
+
+// State is the state of the syncer that is persisted between restarts.
+type State struct {
+	// The version of the layout of the state.  Older files are migrated
+	// when they are loaded.
+	Version int `json:"version"`
+	// The repositories that were tracked at the end of the last sync
+	// cycle along with the commit they were synchronized to.
+	Repos []Repo `json:"repos,omitempty"`
+	// The most recent sync cycles, oldest first.
+	History []Cycle `json:"history"`
+	// The repositories that are failing keyed by owner/name.
+	Failures map[string]*Failure `json:"failures,omitempty"`
+	// The repositories that have been paused keyed by owner/name.
+	Paused map[string]Pause `json:"paused,omitempty"`
+	// The API tokens keyed by their id.
+	Tokens map[string]Token `json:"tokens,omitempty"`
+}
+
+// Cycle is the record of a single sync cycle.
+type Cycle struct {
+	Summary
+	// The repositories that were cloned, updated or failed during the
+	// cycle.  Repositories that had not changed are left out.
+	Events []Event `json:"events"`
+}
+
+// Event is the outcome of a single repository during a sync cycle.
+type Event struct {
+	Time  time.Time `json:"time"`
+	Owner string    `json:"owner"`
+	Name  string    `json:"name"`
+	// Either "cloned", "updated", "up-to-date" or "failed".
+	Outcome   string `json:"outcome"`
+	CommitSHA string `json:"commit_sha"`
+	// The error of a failed update.
+	Error string `json:"error,omitempty"`
+}
+
+// loadState reads the state file.  An empty state is returned if the file
+// does not exist yet.  A file written by an older release is backed up and
+// migrated to the current version.  A file written by a newer release is
+// backed up before the error is returned, since it is replaced by the next
+// sync cycle.
+func loadState(name string) (State, error) {
+	var s State
+	data, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+
+	s, version, err := decodeState(data)
+	if errors.Is(err, ErrStateVersion) {
+		if berr := backupState(name, version); berr != nil {
+			return s, berr
+		}
+	}
+	if err != nil || version == StateVersion {
+		return s, err
+	}
+
+	if err := backupState(name, version); err != nil {
+		return s, fmt.Errorf("unable to back up state before migrating: %w", err)
+	}
+	return s, saveState(name, s)
+}
+
+// saveState writes the state file.  The state is written to a temporary
+// file first and renamed into place so that a crash never leaves a partial
+// file behind.  Only the owner can read the file since it holds the hashes
+// of the API tokens.
+func saveState(name string, s State) error {
+	s.Version = StateVersion
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+
+	tmp := name + ".tmp"
+	if err := writePrivate(tmp, data); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, name)
+}
+
+// writePrivate writes a file that only the owner can read.  The mode is
+// also applied when the file already exists.
+func writePrivate(name string, data []byte) error {
+	if err := os.WriteFile(name, data, 0600); err != nil {
+		return err
+	}
+	return os.Chmod(name, 0600)
+}
+
+// ExportState writes the state file to w as a JSON snapshot.  An empty
+// snapshot is written if the state file does not exist yet.
+func ExportState(name string, w io.Writer) error {
+	s, err := loadState(name)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// ImportState replaces the state file with a JSON snapshot that was
+// written by ExportState.  Snapshots of older releases are migrated to the
+// current version.  The service should be stopped while the state is
+// imported, otherwise the snapshot is overwritten after the next sync
+// cycle.
+func ImportState(name string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s, _, err := decodeState(data)
+	if err != nil {
+		return err
+	}
+	return saveState(name, s)
+}
+
+// StateRepos returns the repositories recorded in the state file.
+func StateRepos(name string) ([]Repo, error) {
+	s, err := loadState(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.Repos, nil
+}
+
+// ImportStateRepos replaces the repositories recorded in the state file
+// while the service is stopped.  The rest of the state, such as the API
+// tokens and the sync history, is kept.
+func ImportStateRepos(name string, repos []Repo) error {
+	s, err := loadState(name)
+	if err != nil {
+		return err
+	}
+	s.Repos = repos
+	return saveState(name, s)
+}
+
+// StatePath returns the state path or the default location below the root
+// when the state path is empty.
+func StatePath(root, name string) string {
+	if name != "" {
+		return name
+	}
+	return filepath.Join(root, filepath.FromSlash(stateFile))
+}
+
+// statePath returns the configured state path or the default location
+// below the GodocRoot.
+func (rs *Syncer) statePath() string {
+	return StatePath(rs.options.GodocRoot, rs.options.StatePath)
+}
+
+// restore adds the repositories recorded in the state so that they are only
+// updated again once their commit changes.  Repositories whose local copy is
+// missing, such as after the state was imported on a new host, are left out
+// so that they are cloned during the first cycle.
+func (rs *Syncer) restore() {
+	for i := range rs.state.Repos {
+		r := rs.state.Repos[i]
+		if _, err := os.Stat(r.LocalPath); err != nil {
+			continue
+		}
+		r.Paused = false
+		rs.repos[r.Name+"/"+r.Owner] = &r
+	}
+}
+
+// persist records the tracked repositories and the cycle in the history,
+// trims the history to the configured size and writes the state file.  The
+// lock must be held.
+func (rs *Syncer) persist(c Cycle) {
+	size := rs.options.HistorySize
+	if size <= 0 {
+		size = DefaultHistorySize
+	}
+
+	rs.state.Repos = make([]Repo, 0, len(rs.repos))
+	for _, r := range rs.repos {
+		rs.state.Repos = append(rs.state.Repos, *r)
+	}
+	sort.Slice(rs.state.Repos, func(i, j int) bool {
+		if rs.state.Repos[i].Owner != rs.state.Repos[j].Owner {
+			return rs.state.Repos[i].Owner < rs.state.Repos[j].Owner
+		}
+		return rs.state.Repos[i].Name < rs.state.Repos[j].Name
+	})
+
+	rs.state.History = append(rs.state.History, c)
+	if len(rs.state.History) > size {
+		rs.state.History = rs.state.History[len(rs.state.History)-size:]
+	}
+
+	if err := saveState(rs.statePath(), rs.state); err != nil {
+		rs.logger.Error("unable to save state", zap.Error(err))
+	}
+}
+
+// History returns the recorded sync cycles, newest first.
+func (rs *Syncer) History() []Cycle {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	history := make([]Cycle, len(rs.state.History))
+	for i, c := range rs.state.History {
+		history[len(history)-1-i] = c
+	}
+	return history
+}
+
+// RepoHistory returns the events of a single repository, newest first.
+func (rs *Syncer) RepoHistory(owner, name string) []Event {
+	var events []Event
+	for _, c := range rs.History() {
+		for i := len(c.Events) - 1; i >= 0; i-- {
+			if e := c.Events[i]; e.Owner == owner && e.Name == name {
+				events = append(events, e)
+			}
+		}
+	}
+	return events
+}
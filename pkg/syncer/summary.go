@@ -0,0 +1,161 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"expvar"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// metrics holds the cumulative sync counters.  They are published through
+// expvar and are available from the /debug/vars endpoint.
+var metrics = expvar.NewMap("syncer")
+
+// outcome describes what happened to a single repository during a sync
+// cycle.
+type outcome int
+
+const (
+	// outcomeSkipped is used when the repository has not changed.
+	outcomeSkipped outcome = iota
+	// outcomeCloned is used when the repository was cloned for the
+	// first time.
+	outcomeCloned
+	// outcomeUpdated is used when changes were pulled into an existing
+	// clone.
+	outcomeUpdated
+	// outcomeUpToDate is used when a pull found that the existing clone
+	// already had the latest changes.
+	outcomeUpToDate
+	// outcomeFailed is used when the repository could not be checked
+	// or updated.
+	outcomeFailed
+	// outcomeDeferred is used when the repository was not attempted
+	// because it is backing off after failures or is on the dead letter
+	// list.
+	outcomeDeferred
+	// outcomePaused is used when syncing of the repository has been
+	// paused.
+	outcomePaused
+)
+
+// String returns the name of the outcome as used in the history.
+func (o outcome) String() string {
+	switch o {
+	case outcomeCloned:
+		return "cloned"
+	case outcomeUpdated:
+		return "updated"
+	case outcomeUpToDate:
+		return "up-to-date"
+	case outcomeFailed:
+		return "failed"
+	case outcomeDeferred:
+		return "deferred"
+	case outcomePaused:
+		return "paused"
+	default:
+		return "skipped"
+	}
+}
+
+// Summary describes the results of a single sync cycle.
+type Summary struct {
+	// The time the cycle started.
+	Started time.Time `json:"started"`
+	// The time the cycle finished.
+	Finished time.Time `json:"finished"`
+	// The number of seconds the cycle took to complete.
+	Duration float64 `json:"duration_seconds"`
+	// The number of repositories that were returned by the search and
+	// checked for changes.
+	Checked int `json:"checked"`
+	// The number of existing repositories that were pulled.
+	Updated int `json:"updated"`
+	// The number of repositories that were cloned.
+	Cloned int `json:"cloned"`
+	// The number of existing repositories that were pulled but already
+	// had the latest changes.
+	UpToDate int `json:"up_to_date"`
+	// The number of repositories that could not be checked or updated.
+	Failed int `json:"failed"`
+	// The number of repositories that had not changed.
+	Skipped int `json:"skipped"`
+	// The number of failing repositories that were not attempted.
+	Deferred int `json:"deferred"`
+	// The number of paused repositories that were not attempted.
+	Paused int `json:"paused"`
+	// The number of calls made to the Github API.
+	APICalls int `json:"api_calls"`
+}
+
+// record adds the outcome of a single repository to the summary.
+func (s *Summary) record(o outcome) {
+	s.Checked++
+	switch o {
+	case outcomeSkipped:
+		s.Skipped++
+	case outcomeCloned:
+		s.Cloned++
+	case outcomeUpdated:
+		s.Updated++
+	case outcomeUpToDate:
+		s.UpToDate++
+	case outcomeFailed:
+		s.Failed++
+	case outcomeDeferred:
+		s.Deferred++
+	case outcomePaused:
+		s.Paused++
+	}
+}
+
+// finish marks the end of the cycle, logs the summary and updates the
+// metrics.
+func (s *Summary) finish(now time.Time, logger *zap.Logger) {
+	s.Finished = now
+	s.Duration = s.Finished.Sub(s.Started).Seconds()
+
+	logger.Info("sync completed",
+		zap.Int("checked", s.Checked),
+		zap.Int("updated", s.Updated),
+		zap.Int("cloned", s.Cloned),
+		zap.Int("up_to_date", s.UpToDate),
+		zap.Int("failed", s.Failed),
+		zap.Int("skipped", s.Skipped),
+		zap.Int("deferred", s.Deferred),
+		zap.Int("paused", s.Paused),
+		zap.Int("api_calls", s.APICalls),
+		zap.Float64("duration", s.Duration),
+	)
+
+	metrics.Add("cycles", 1)
+	metrics.Add("checked", int64(s.Checked))
+	metrics.Add("updated", int64(s.Updated))
+	metrics.Add("cloned", int64(s.Cloned))
+	metrics.Add("up_to_date", int64(s.UpToDate))
+	metrics.Add("failed", int64(s.Failed))
+	metrics.Add("skipped", int64(s.Skipped))
+	metrics.Add("deferred", int64(s.Deferred))
+	metrics.Add("paused", int64(s.Paused))
+	metrics.Add("api_calls", int64(s.APICalls))
+	metrics.AddFloat("duration_seconds", s.Duration)
+}
@@ -0,0 +1,879 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	nethttp "net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// SyncerOptions defines the options available for running the
+// Syncer service.
+type SyncerOptions struct {
+	// A personal access token with permissions to access and list the
+	// repositories.  Leave empty to only synchronize public repositories
+	// without authentication.  Initially set in the config.
+	GithubToken string
+	// The user who the token belongs to.  Defaults to the Github user.
+	// Initially set in the config.
+	GithubTokenUser string
+	// The Github user or organization that will be scraped.  Only single
+	// values are currently supported.  Initially set in the config.
+	GithubUser string
+	// The topic that will be used as a filter to identify repositories
+	// that will be synchronized.  Initially set in the config.
+	GithubTopic string
+	// How repositories are discovered.  Either DiscoveryTopic or
+	// DiscoveryOrg.  Initially set in the config.
+	GithubDiscovery string
+	// A raw Github search query that replaces the query built from the
+	// user and topic.  Initially set in the config.
+	GithubSearchQuery string
+	// Log every call made to the Github API.  Can be toggled later with
+	// SetTrace.  Initially set in the config.
+	GithubTrace bool
+	// The consecutive failed Github API calls after which the circuit
+	// breaker stops calling the API.  Zero disables the circuit breaker.
+	// Initially set in the config.
+	GithubBreakerThreshold int
+	// How long the circuit breaker waits before probing the Github API
+	// again.  Initially set in the config.
+	GithubBreakerCooldown time.Duration
+	// The interval to check for changes on Github.  Takes a duration string
+	// for the value.  The string is an unsigned decimal number(s), with
+	// optional fraction and a unit suffix, such as "300ms", "-1.5h" or
+	// "2h45m". Valid time units are "ns", "us" (or "µs"), "ms", "s", "m",
+	// "h".  Initially set in the config.
+	GithubPollInterval string
+	// The method used to detect changes to a repository.  "api" looks up
+	// the default branch through the Github API while "git" lists the
+	// remote references directly, avoiding the API call for each
+	// repository.  Initially set in the config.
+	SyncMode string
+	// Clone updates into a staging directory and swap them into place
+	// instead of pulling into the served directory.  Initially set in the
+	// config.
+	AtomicUpdates bool
+	// The directory that repositories are cloned into before they are
+	// moved into place.  It must be on the same filesystem as the
+	// GodocRoot.  Defaults to .gdoc/staging below the GodocRoot.
+	// Initially set in the config.
+	StagingDir string
+	// The maximum time a clone may take before it is cancelled.  Zero
+	// disables the timeout.  Initially set in the config.
+	CloneTimeout time.Duration
+	// The maximum time a pull may take before it is cancelled.  Zero
+	// disables the timeout.  Initially set in the config.
+	PullTimeout time.Duration
+	// The maximum time a single Github API call or remote reference
+	// listing may take before it is cancelled.  Zero disables the
+	// timeout.  Initially set in the config.
+	APITimeout time.Duration
+	// Changes the verbosity of the logging system.  Initially set in the config.
+	GodocRoot string
+	// The template used to build the local path of a repository relative
+	// to GodocRoot.  The template has access to the Host, Owner, Name and
+	// Ref of the repository.  Defaults to DefaultPathTemplate.  Initially
+	// set in the config.
+	PathTemplate string
+	// The User-Agent sent on Github API and git HTTP requests so that the
+	// traffic can be attributed to this instance.  Empty to use the
+	// defaults of the clients.  Initially set in the config.
+	UserAgent string
+	// The headers added to git HTTP requests keyed by the host they are
+	// sent to, or "*" for every host.  Initially loaded from the git
+	// headers file set in the config.
+	GitHeaders map[string]nethttp.Header
+	// The cookies sent with git HTTP requests.  Initially loaded from the
+	// git cookie file set in the config.
+	GitCookies nethttp.CookieJar
+	// Leave the tags out of clones.  Initially set in the config.
+	GitNoTags bool
+	// Only clone the default branch of repositories.  Initially set in
+	// the config.
+	GitSingleBranch bool
+	// The size in bytes of the go-git object cache of each repository.
+	// Zero uses the go-git default.  Initially set in the config.
+	GitObjectCacheSize int64
+	// The hooks that are run before and after a repository is updated.
+	// Initially loaded from the hooks file set in the config.
+	Hooks []Hook
+	// The names of the variables of the gdoc environment that hook
+	// commands inherit.  Defaults to DefaultHookEnv.  Initially set in the
+	// config.
+	HookEnvAllow []string
+	// The file the syncer state, such as the sync history, is persisted
+	// to.  Defaults to .gdoc/state.json below the GodocRoot.  Initially
+	// set in the config.
+	StatePath string
+	// The number of sync cycles kept in the history.  Defaults to
+	// DefaultHistorySize.  Initially set in the config.
+	HistorySize int
+	// The wait after the first failure of a repository.  The wait is
+	// doubled after each consecutive failure.  Defaults to
+	// DefaultRetryBackoff.  Initially set in the config.
+	RetryBackoff time.Duration
+	// The longest wait between attempts of a failing repository.
+	// Defaults to DefaultRetryMaxBackoff.  Initially set in the config.
+	RetryMaxBackoff time.Duration
+	// The number of consecutive failures after which a repository is
+	// moved to the dead letter list and no longer attempted.  Zero keeps
+	// retrying forever.  Initially set in the config.
+	DeadLetterAfter int
+	// Only discover repositories during the sync cycle and leave them to
+	// be cloned by Fetch the first time they are requested.  Repositories
+	// that have been cloned are kept up to date as usual.  Initially set
+	// in the config.
+	Lazy bool
+	// Serve the repositories restored from the state without contacting
+	// Github or the git servers.  No sync cycles are run and manual
+	// updates fail with ErrOffline.  Initially set in the config.
+	Offline bool
+	// The branches that are checked out next to the default branch of
+	// every repository.  Initially set in the config.
+	Branches []string
+	// The branches checked out for individual repositories keyed by
+	// owner/name.  Replaces Branches for those repositories.  Initially
+	// set in the config.
+	RepoBranches map[string][]string
+	// A directory holding existing checkouts, such as the GOPATH of a hand
+	// maintained godoc server, that repositories are seeded from instead
+	// of being cloned.  Initially set in the config.
+	SeedDir string
+	// How repositories are seeded from SeedDir.  Either SeedModeCopy or
+	// SeedModeSymlink.  Initially set in the config.
+	SeedMode string
+	// Repositories that the policy does not match are not synchronized.
+	// Nil synchronizes every discovered repository.  Initially parsed
+	// from the config.
+	SyncPolicy *Policy
+	// Newly discovered repositories that the policy matches are paused
+	// until they are resumed.  Initially parsed from the config.
+	QuarantinePolicy *Policy
+	// The provider used to discover repositories.  Defaults to a
+	// GithubProvider built from the Github options.
+	Provider RepositoryProvider
+	// The client used to perform git operations.  Defaults to a GoGitClient
+	// using the token for authentication.
+	Git GitClient
+	// The clock used for timing sync cycles.  Defaults to RealClock.
+	Clock Clock
+	// The lock shared with the other instances that synchronize the same
+	// storage.  Nil when the instance synchronizes on its own.
+	Lock Locker
+	// The locks of the workspace paths shared with the other services
+	// that modify the workspace.  Defaults to a new PathLocks.
+	Locks *PathLocks
+	// The logger used by the godoc service. Initially set in the
+	// config.
+	Logger *zap.Logger
+}
+
+const (
+	// SyncModeAPI uses the Github API to look up the latest commit sha of the
+	// default branch.
+	SyncModeAPI = "api"
+	// SyncModeGit uses the git protocol (the equivalent of git ls-remote) to
+	// look up the latest commit sha of the default branch.
+	SyncModeGit = "git"
+)
+
+// DefaultPathTemplate places repositories in the GOPATH layout that godoc
+// expects.
+const DefaultPathTemplate = "src/{{.Host}}/{{.Owner}}/{{.Name}}"
+
+// pathData is the data that is passed to the path template.
+type pathData struct {
+	Host  string
+	Owner string
+	Name  string
+	Ref   string
+}
+
+// searchPageSize is the number of repositories requested for each page of
+// search results.  100 is the maximum allowed by the Github API.
+const searchPageSize = 100
+
+// Syncer is a service that polls Github looking for repositories that have been
+// tagged with a specific topic as defined for GithubTopic.  The list of
+// repositories is returned and the latest commit sha is gathered.  If a repo
+// does not exist locally, it is cloned using the username and token and if the
+// repo exists and has been updated as seen by comparing the commit sha, the
+// changes are pulled in.
+type Syncer struct {
+	options  SyncerOptions
+	repos    map[string]*Repo
+	provider RepositoryProvider
+	git      GitClient
+	clock    Clock
+	path     *template.Template
+	logger   *zap.Logger
+
+	// The summary of the last completed sync cycle.
+	summary Summary
+	// The state that is persisted between restarts.
+	state State
+	// The bus that changes are published on.
+	bus *Bus
+	// The locks of the workspace paths.
+	locks *PathLocks
+	// Whether Github accepts the configured credentials.
+	credentials Credentials
+	// The time that the next sync cycle is scheduled for.
+	next time.Time
+	// Signals Start that a manual update has finished and that the next
+	// cycle should be rescheduled.
+	reschedule chan struct{}
+	// Set while a sync cycle or a manual update is running.
+	busy int32
+	// Held while a sync cycle or a manual update is running.
+	running sync.Mutex
+	// The sync lock while this instance holds it.
+	held   *heldLock
+	lockMu sync.Mutex
+	mu     sync.RWMutex
+}
+
+// New intializes a the github sync service and performs the initial
+// sync.
+func New(ctx context.Context, options SyncerOptions) *Syncer {
+	s := &Syncer{
+		options:     options,
+		repos:       make(map[string]*Repo),
+		provider:    options.Provider,
+		git:         options.Git,
+		clock:       options.Clock,
+		logger:      options.Logger,
+		bus:         NewBus(),
+		credentials: Credentials{Valid: true},
+		reschedule:  make(chan struct{}, 1),
+		locks:       options.Locks,
+	}
+
+	if options.GithubToken == "" && !options.Offline {
+		s.logger.Warn("no github token configured, only public repositories will be synchronized and lower rate limits apply")
+	}
+
+	if s.provider == nil {
+		s.provider = NewGithubProvider(GithubProviderOptions{
+			GithubToken:      options.GithubToken,
+			GithubUser:       options.GithubUser,
+			GithubTopic:      options.GithubTopic,
+			Discovery:        options.GithubDiscovery,
+			SearchQuery:      options.GithubSearchQuery,
+			APITimeout:       options.APITimeout,
+			UserAgent:        options.UserAgent,
+			Trace:            options.GithubTrace,
+			BreakerThreshold: options.GithubBreakerThreshold,
+			BreakerCooldown:  options.GithubBreakerCooldown,
+			Logger:           options.Logger,
+		})
+	}
+
+	if options.UserAgent != "" || len(options.GitHeaders) > 0 || options.GitCookies != nil {
+		ConfigureGitHTTP(GitHTTPOptions{
+			UserAgent: options.UserAgent,
+			Headers:   options.GitHeaders,
+			Cookies:   options.GitCookies,
+		})
+	}
+
+	if s.git == nil {
+		s.git = NewGoGitClientWithOptions(GoGitOptions{
+			Username:        options.GithubTokenUser,
+			Token:           options.GithubToken,
+			NoTags:          options.GitNoTags,
+			SingleBranch:    options.GitSingleBranch,
+			ObjectCacheSize: options.GitObjectCacheSize,
+		})
+	}
+
+	if s.clock == nil {
+		s.clock = RealClock{}
+	}
+
+	if s.locks == nil {
+		s.locks = NewPathLocks()
+	}
+
+	s.path = s.pathTemplate()
+
+	state, err := loadState(s.statePath())
+	if err != nil {
+		s.logger.Error("unable to load state, starting with an empty state", zap.Error(err))
+	}
+	s.state = state
+	s.restore()
+
+	if options.Offline {
+		s.logger.Info("offline mode is enabled, serving the repositories on disk", zap.Int("repos", len(s.repos)))
+		return s
+	}
+
+	// Perform the initial sync
+	s.sync(ctx)
+	return s
+}
+
+// Start runs the synchronization process.  The process is repeated at an interval
+// equal to the configured poll interval.  The ticker is restarted after every
+// cycle and manual update, so cycles that run longer than the interval don't
+// leave a stale tick behind that would start the next cycle immediately.  A
+// tick that arrives while a manual update is running is skipped.  In
+// offline mode no cycles are run and Start only waits for the context to
+// be cancelled.
+func (rs *Syncer) Start(ctx context.Context) error {
+	if rs.options.Offline {
+		<-ctx.Done()
+		return nil
+	}
+
+	// BUG(d) Negative values are not checked before the poll interval is passed
+	// to the ParseDuration function.
+	// BUG(d) Small values should not be allowed.  We need to set a minimun value
+	// of potentially 1 minute.  If not, we run the risk of exceeding limits which
+	// could cause the service to behave poorly.
+	d, err := time.ParseDuration(rs.options.GithubPollInterval)
+	if err != nil {
+		return err
+	}
+
+	ticker := rs.schedule(nil, d)
+	defer func() {
+		ticker.Stop()
+	}()
+
+	for {
+		select {
+		case <-ticker.C():
+			if atomic.LoadInt32(&rs.busy) != 0 {
+				rs.logger.Warn("sync is already running, skipping the scheduled cycle")
+				metrics.Add("skipped_ticks", 1)
+				continue
+			}
+			rs.sync(ctx)
+		case <-rs.reschedule:
+		case <-ctx.Done():
+			return nil
+		}
+
+		ticker = rs.schedule(ticker, d)
+	}
+}
+
+// schedule stops the current ticker, if any, and starts a new one so that
+// the next cycle runs d from now.
+func (rs *Syncer) schedule(ticker Ticker, d time.Duration) Ticker {
+	if ticker != nil {
+		ticker.Stop()
+	}
+
+	rs.mu.Lock()
+	rs.next = rs.clock.Now().Add(d)
+	rs.mu.Unlock()
+
+	return rs.clock.NewTicker(d)
+}
+
+// NextRun returns the time that the next sync cycle is scheduled for.  It is
+// the zero time until the syncer has been started.
+func (rs *Syncer) NextRun() time.Time {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	return rs.next
+}
+
+// begin marks a sync cycle or manual update as running.  The returned
+// function clears the mark.
+func (rs *Syncer) begin() func() {
+	atomic.StoreInt32(&rs.busy, 1)
+	return func() {
+		atomic.StoreInt32(&rs.busy, 0)
+	}
+}
+
+// pathTemplate parses the configured path template.  If the template is not
+// set or is invalid, the default template is used.
+func (rs *Syncer) pathTemplate() *template.Template {
+	if rs.options.PathTemplate != "" {
+		t, err := template.New("path").Option("missingkey=error").Parse(rs.options.PathTemplate)
+		if err == nil {
+			return t
+		}
+		rs.logger.Error("invalid path template, using the default", zap.Error(err))
+	}
+
+	return template.Must(template.New("path").Parse(DefaultPathTemplate))
+}
+
+// localPath renders the path template for the repository and returns the
+// absolute path of its local copy.
+func (rs *Syncer) localPath(r *Repo) (string, error) {
+	u, err := url.Parse(r.CloneURL)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	err = rs.path.Execute(&buf, pathData{
+		Host:  u.Hostname(),
+		Owner: r.Owner,
+		Name:  r.Name,
+		Ref:   r.DefaultBranch,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(rs.options.GodocRoot, filepath.FromSlash(buf.String())), nil
+}
+
+// Offline returns true if the syncer serves the repositories on disk
+// without contacting Github or the git servers.
+func (rs *Syncer) Offline() bool {
+	return rs.options.Offline
+}
+
+// Locks returns the locks of the workspace paths that the syncer takes
+// while it updates repositories.
+func (rs *Syncer) Locks() *PathLocks {
+	return rs.locks
+}
+
+// Summary returns the summary of the last completed sync cycle.
+func (rs *Syncer) Summary() Summary {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	return rs.summary
+}
+
+// Repos returns the repositories that have been synchronized, sorted by
+// owner and name.
+func (rs *Syncer) Repos() []Repo {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	repos := make([]Repo, 0, len(rs.repos))
+	for _, r := range rs.repos {
+		repo := *r
+		_, repo.Paused = rs.state.Paused[r.Owner+"/"+r.Name]
+		repos = append(repos, repo)
+	}
+
+	sort.Slice(repos, func(i, j int) bool {
+		if repos[i].Owner != repos[j].Owner {
+			return repos[i].Owner < repos[j].Owner
+		}
+		return repos[i].Name < repos[j].Name
+	})
+
+	return repos
+}
+
+// renamed returns true if the default branch of the repository differs
+// from the one it was last synchronized from.
+func (rs *Syncer) renamed(r *Repo) bool {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	stored, ok := rs.repos[r.Name+"/"+r.Owner]
+	return ok && stored.DefaultBranch != "" && r.DefaultBranch != "" && stored.DefaultBranch != r.DefaultBranch
+}
+
+// update checks to see if the repository has changed since the last
+// cycle.  The stored repository is always replaced so that its metadata
+// stays current.
+func (rs *Syncer) update(r *Repo) bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	name := r.Name + "/" + r.Owner
+	if prev, has := rs.repos[name]; has && r.Modified == nil {
+		// The metadata computed while updating is kept until the next
+		// update replaces it.
+		r.Version = prev.Version
+		r.Modified = prev.Modified
+	}
+	if _, has := rs.repos[name]; !has {
+		// We've not seen the repo before.  Add it and return true
+		// signifying that we've seen a change.
+		rs.repos[name] = r
+		return true
+	}
+
+	changed := r.CommitSHA != rs.repos[name].CommitSHA
+	rs.repos[name] = r
+	return changed
+}
+
+// sync asks the provider for the repositories that should be synchronized.
+// Each repository is processed as soon as the provider returns it, so a
+// cancelled context stops the cycle without waiting for the remaining
+// repositories.  A summary of the cycle is recorded once it has finished.
+func (rs *Syncer) sync(ctx context.Context) {
+	rs.running.Lock()
+	defer rs.running.Unlock()
+	defer rs.begin()()
+
+	ctx, unlock, err := rs.lock(ctx)
+	if err != nil {
+		rs.logger.Info("skipping the sync cycle", zap.Error(err))
+		return
+	}
+	defer func() {
+		if err := unlock(); err != nil {
+			rs.logger.Error("the sync lock was lost during the sync cycle", zap.Error(err))
+		}
+	}()
+
+	summary := &Summary{Started: rs.clock.Now()}
+	var events []Event
+	seen := make(map[string]bool)
+	probe := authProbe{invalid: !rs.Credentials().Valid}
+	calls := rs.calls()
+	defer func() {
+		summary.APICalls = int(rs.calls() - calls)
+		summary.finish(rs.clock.Now(), rs.logger)
+		rs.mu.Lock()
+		rs.summary = *summary
+		rs.persist(Cycle{Summary: *summary, Events: events})
+		rs.mu.Unlock()
+		s := *summary
+		rs.bus.Publish(Message{Type: EventSyncCompleted, Time: s.Finished, Summary: &s})
+	}()
+
+	err = rs.provider.Repositories(ctx, func(r *Repo) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if !rs.allowed(r) {
+			return nil
+		}
+
+		seen[r.Name+"/"+r.Owner] = true
+		if probe.deferred() {
+			summary.record(outcomeDeferred)
+			return nil
+		}
+
+		o, err := rs.process(ctx, r)
+		probe.record(o, r, err)
+		summary.record(o)
+		switch o {
+		case outcomeFailed:
+			rs.fail(r, err)
+		case outcomeCloned, outcomeUpdated:
+			rs.succeed(r)
+			rs.published(EventRepoUpdated, r)
+		case outcomeUpToDate:
+			rs.succeed(r)
+		}
+
+		if o != outcomeSkipped && o != outcomeDeferred && o != outcomePaused {
+			e := Event{
+				Time:      rs.clock.Now(),
+				Owner:     r.Owner,
+				Name:      r.Name,
+				Outcome:   o.String(),
+				CommitSHA: r.CommitSHA,
+			}
+			if err != nil {
+				e.Error = err.Error()
+			}
+			events = append(events, e)
+		}
+		return nil
+	})
+
+	switch {
+	case ctx.Err() != nil:
+		rs.logger.Info("sync cancelled", zap.Error(ctx.Err()))
+	case errors.Is(err, ErrBreakerOpen):
+		rs.logger.Warn("skipping the sync cycle while the github api circuit breaker is open")
+	case classify(err, nil) == ErrAuth:
+		rs.credentialsRejected(err)
+	case err != nil:
+		rs.logger.Error("search failed", zap.Error(err))
+	default:
+		if probe.rejected() {
+			rs.credentialsRejected(probe.err)
+		} else {
+			rs.credentialsAccepted()
+		}
+		rs.remove(seen)
+	}
+}
+
+// remove stops synchronizing the repositories that were not returned by
+// the provider during a complete cycle.  Their local copies are left in
+// place.
+func (rs *Syncer) remove(seen map[string]bool) {
+	rs.mu.Lock()
+	var removed []*Repo
+	for key, r := range rs.repos {
+		if !seen[key] {
+			delete(rs.repos, key)
+			removed = append(removed, r)
+		}
+	}
+	rs.mu.Unlock()
+
+	for _, r := range removed {
+		rs.logger.Info("repository is no longer synchronized", zap.Any("repo", r))
+		rs.published(EventRepoRemoved, r)
+	}
+}
+
+// published publishes a copy of the repository on the bus.
+func (rs *Syncer) published(t EventType, r *Repo) {
+	repo := *r
+	rs.bus.Publish(Message{Type: t, Time: rs.clock.Now(), Repo: &repo})
+}
+
+// Bus returns the bus that repository updates and removals and completed
+// sync cycles are published on.
+func (rs *Syncer) Bus() *Bus {
+	return rs.bus
+}
+
+// calls returns the number of API calls the provider has made if the
+// provider keeps track of them.
+func (rs *Syncer) calls() int64 {
+	if c, ok := rs.provider.(callCounter); ok {
+		return c.Calls()
+	}
+	return 0
+}
+
+// SetTrace enables or disables logging the calls the provider makes to
+// its remote API.  ErrTraceUnsupported is returned if the provider can not
+// log its calls.
+func (rs *Syncer) SetTrace(enabled bool) error {
+	t, ok := rs.provider.(tracer)
+	if !ok {
+		return ErrTraceUnsupported
+	}
+	t.SetTrace(enabled)
+	rs.logger.Info("api call tracing changed", zap.Bool("enabled", enabled))
+	return nil
+}
+
+// Tracing returns true if the calls the provider makes to its remote API
+// are being logged.
+func (rs *Syncer) Tracing() bool {
+	t, ok := rs.provider.(tracer)
+	return ok && t.Tracing()
+}
+
+// process gathers the latest commit sha for a repository returned from the
+// provider.  If there has been an update to the repository, the local repo
+// is updated.  The error that caused a failed outcome is returned with it.
+func (rs *Syncer) process(ctx context.Context, r *Repo) (outcome, error) {
+	path, err := rs.localPath(r)
+	if err != nil {
+		rs.logger.Error("unable to build local path", zap.Error(err))
+		return outcomeFailed, err
+	}
+	r.LocalPath = path
+
+	if rs.quarantined(r) || rs.paused(r) {
+		rs.logger.Debug("repository is paused", zap.Any("repo", r))
+		return outcomePaused, nil
+	}
+
+	if rs.deferred(r) {
+		rs.logger.Debug("repository is backing off after failures", zap.Any("repo", r))
+		return outcomeDeferred, nil
+	}
+
+	if rs.options.Lazy && missing(r.LocalPath) {
+		rs.logger.Debug("repository has not been requested yet", zap.Any("repo", r))
+		r.CommitSHA = ""
+		rs.update(r)
+		return outcomeSkipped, nil
+	}
+
+	sha, err := rs.commit(ctx, r)
+	if errors.Is(err, ErrBreakerOpen) {
+		rs.logger.Debug("github api circuit breaker is open", zap.Any("repo", r))
+		return outcomeDeferred, nil
+	}
+	if err != nil {
+		rs.logger.Error("unable to get commit", zap.Error(err))
+		return outcomeFailed, err
+	}
+
+	r.CommitSHA = sha
+	branched, err := rs.syncBranches(ctx, r)
+	if err != nil {
+		rs.logger.Error("unable to update branches", zap.Error(err))
+		return outcomeFailed, err
+	}
+
+	renamed := rs.renamed(r)
+	previous := rs.synced(r)
+	intact := rs.intact(r, previous)
+	if changed := rs.update(r); !changed && !renamed && intact {
+		if branched {
+			return outcomeUpdated, nil
+		}
+		rs.logger.Debug("repository has not changed", zap.Any("repo", r), zap.String("sha", sha))
+		return outcomeSkipped, nil
+	}
+
+	rs.logger.Info("processing repository update", zap.Any("repo", r), zap.String("sha", sha))
+	defer rs.locks.Lock(r.LocalPath)()
+	if err := rs.runHooks(ctx, HookStagePre, r); err != nil {
+		rs.logger.Error("unable to update repository", zap.Error(err))
+		return outcomeFailed, err
+	}
+
+	// The local copy still tracks the old default branch after a rename,
+	// so it is cloned again.  Atomic updates always clone.
+	if renamed && !rs.options.AtomicUpdates {
+		rs.logger.Info("default branch has been renamed, removing repository before cloning", zap.Any("repo", r))
+		if err := os.RemoveAll(r.LocalPath); err != nil {
+			rs.logger.Error("unable to update repository", zap.Error(err))
+			return outcomeFailed, err
+		}
+	}
+
+	o, err := rs.get(ctx, r)
+	if err != nil {
+		rs.logger.Error("unable to update repository", zap.Error(err))
+		return outcomeFailed, err
+	}
+	rs.annotate(ctx, r, previous)
+
+	if err := rs.runHooks(ctx, HookStagePost, r); err != nil {
+		rs.logger.Error("unable to update repository", zap.Error(err))
+		return outcomeFailed, err
+	}
+
+	return o, nil
+}
+
+// commit returns the latest commit sha of the default branch.  Depending on
+// the sync mode, the sha is either looked up through the provider or by
+// listing the references of the remote repository.
+func (rs *Syncer) commit(ctx context.Context, r *Repo) (string, error) {
+	if rs.options.SyncMode == SyncModeGit {
+		ctx, cancel := withTimeout(ctx, rs.options.APITimeout)
+		defer cancel()
+		sha, err := rs.git.RemoteCommit(ctx, r, r.DefaultBranch)
+		return sha, wrap("commit", r, err, nil)
+	}
+
+	sha, err := rs.provider.Commit(ctx, r)
+	return sha, wrap("commit", r, err, nil)
+}
+
+// get determines whether or not a repository has already been cloned.  If it
+// does not yet exist, it is cloned.  Otherwise a pull is performed.  The
+// outcome reports which of the two took place and whether the pull found
+// anything new.  Repositories that can be seeded from an existing checkout
+// are pulled instead of cloned.  When atomic updates are enabled, the
+// repository is staged instead.  A local copy that is not a valid git
+// repository is removed first so that it is cloned again.
+func (rs *Syncer) get(ctx context.Context, r *Repo) (outcome, error) {
+	if err := rs.repair(r); err != nil {
+		return outcomeFailed, err
+	}
+
+	if _, err := os.Stat(r.LocalPath); os.IsNotExist(err) {
+		seeded, err := rs.seed(r)
+		if err != nil {
+			return outcomeFailed, err
+		}
+		if seeded {
+			ctx, cancel := withTimeout(ctx, rs.options.PullTimeout)
+			defer cancel()
+			return outcomeCloned, wrap("pull", r, ignoreUpToDate(rs.pull(ctx, r)), nil)
+		}
+	}
+
+	if rs.options.AtomicUpdates {
+		return rs.stage(ctx, r)
+	}
+
+	// if the path already exists and is a git repo, then pull otherwise clone
+	if _, err := os.Stat(r.LocalPath); os.IsNotExist(err) {
+		rs.logger.Info("cloning repository", zap.Any("repo", r))
+		staged, err := rs.clone(ctx, r, r.CommitSHA)
+		if err != nil {
+			return outcomeFailed, err
+		}
+		return outcomeCloned, place(staged, r.LocalPath)
+	} else {
+		rs.logger.Info("pulling repository", zap.Any("repo", r))
+		ctx, cancel := withTimeout(ctx, rs.options.PullTimeout)
+		defer cancel()
+		return pulled(wrap("pull", r, rs.pull(ctx, r), nil))
+	}
+}
+
+// pulled classifies the result of a pull.  A pull that found nothing to
+// fetch succeeded without updating the repository.
+func pulled(err error) (outcome, error) {
+	switch {
+	case err == nil:
+		return outcomeUpdated, nil
+	case upToDate(err):
+		return outcomeUpToDate, nil
+	default:
+		return outcomeFailed, err
+	}
+}
+
+// pull pulls the latest changes into the local copy of the repository.  If
+// the history of the remote branch has been rewritten, the local copy is
+// reset to the remote branch instead since it can never be fast forwarded.
+func (rs *Syncer) pull(ctx context.Context, r *Repo) error {
+	err := rs.git.Pull(ctx, r)
+	if !rewritten(err) {
+		return err
+	}
+
+	rs.logger.Warn("history has been rewritten, resetting repository", zap.Any("repo", r), zap.String("ref", r.Ref))
+	metrics.Add("rewritten", 1)
+	return rs.git.Reset(ctx, r)
+}
+
+// withTimeout returns a copy of the context that is cancelled after the
+// duration.  A duration of zero or less returns a context without a
+// timeout.
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
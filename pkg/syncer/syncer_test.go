@@ -0,0 +1,421 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// fixture is a syncer driven by fakes.
+type fixture struct {
+	clock    *fakeClock
+	provider *fakeProvider
+	git      *fakeGit
+	syncer   *Syncer
+}
+
+// newFixture returns a syncer for a single repository that has performed
+// its initial sync.
+func newFixture(t *testing.T, provider *fakeProvider, git *fakeGit, options SyncerOptions) *fixture {
+	t.Helper()
+
+	if provider == nil {
+		provider = &fakeProvider{}
+	}
+	provider.repos = []Repo{{
+		Owner:         "ctxswitch",
+		Name:          "gdoc",
+		CloneURL:      "https://github.com/ctxswitch/gdoc.git",
+		DefaultBranch: "main",
+	}}
+	provider.commits = map[string]string{"ctxswitch/gdoc": "a1"}
+
+	f := &fixture{
+		clock:    newFakeClock(),
+		provider: provider,
+		git:      git,
+	}
+
+	options.GodocRoot = t.TempDir()
+	options.GithubToken = "token"
+	options.GithubPollInterval = "1m"
+	options.Provider = f.provider
+	options.Git = f.git
+	options.Clock = f.clock
+	options.Logger = zap.NewNop()
+	f.syncer = New(context.Background(), options)
+	return f
+}
+
+// cycle runs a sync cycle and returns its summary.
+func (f *fixture) cycle() Summary {
+	f.syncer.sync(context.Background())
+	return f.syncer.Summary()
+}
+
+// repo returns the stored copy of the repository.
+func (f *fixture) repo() *Repo {
+	f.syncer.mu.RLock()
+	defer f.syncer.mu.RUnlock()
+	return f.syncer.repos["gdoc/ctxswitch"]
+}
+
+func TestSyncClonesNewRepository(t *testing.T) {
+	f := newFixture(t, nil, &fakeGit{}, SyncerOptions{})
+
+	s := f.syncer.Summary()
+	if s.Checked != 1 || s.Cloned != 1 {
+		t.Fatalf("expected one cloned repository, got %+v", s)
+	}
+	if clones, pulls := f.git.counts(); clones != 1 || pulls != 0 {
+		t.Fatalf("expected one clone and no pulls, got %d clones and %d pulls", clones, pulls)
+	}
+
+	r := f.repo()
+	if r == nil || r.CommitSHA != "a1" {
+		t.Fatalf("expected the repository at a1, got %+v", r)
+	}
+	if _, err := os.Stat(r.LocalPath); err != nil {
+		t.Fatalf("expected the local copy at %s: %v", r.LocalPath, err)
+	}
+}
+
+func TestSyncSkipsUnchangedRepository(t *testing.T) {
+	f := newFixture(t, nil, &fakeGit{}, SyncerOptions{})
+
+	s := f.cycle()
+	if s.Skipped != 1 || s.Cloned != 0 || s.Updated != 0 {
+		t.Fatalf("expected one skipped repository, got %+v", s)
+	}
+	if clones, pulls := f.git.counts(); clones != 1 || pulls != 0 {
+		t.Fatalf("expected no further git operations, got %d clones and %d pulls", clones, pulls)
+	}
+}
+
+func TestSyncPullsChangedRepository(t *testing.T) {
+	f := newFixture(t, nil, &fakeGit{}, SyncerOptions{})
+	f.provider.setCommit("ctxswitch", "gdoc", "b2")
+
+	s := f.cycle()
+	if s.Updated != 1 {
+		t.Fatalf("expected one updated repository, got %+v", s)
+	}
+	if _, pulls := f.git.counts(); pulls != 1 {
+		t.Fatalf("expected one pull, got %d", pulls)
+	}
+	if sha := f.repo().CommitSHA; sha != "b2" {
+		t.Fatalf("expected the repository at b2, got %s", sha)
+	}
+}
+
+func TestSyncRetriesFailedRepository(t *testing.T) {
+	git := &fakeGit{cloneErrs: []error{errors.New("connection reset")}}
+	f := newFixture(t, nil, git, SyncerOptions{RetryBackoff: time.Minute})
+
+	s := f.syncer.Summary()
+	if s.Failed != 1 {
+		t.Fatalf("expected one failed repository, got %+v", s)
+	}
+	failures := f.syncer.Failures()
+	if len(failures) != 1 || failures[0].Count != 1 {
+		t.Fatalf("expected one failure, got %+v", failures)
+	}
+	if want := f.clock.Now().Add(time.Minute); !failures[0].NextAttempt.Equal(want) {
+		t.Fatalf("expected the next attempt at %s, got %s", want, failures[0].NextAttempt)
+	}
+
+	// The repository is backing off until the next attempt.
+	s = f.cycle()
+	if s.Deferred != 1 {
+		t.Fatalf("expected one deferred repository, got %+v", s)
+	}
+	if clones, _ := f.git.counts(); clones != 1 {
+		t.Fatalf("expected no clone while backing off, got %d clones", clones)
+	}
+
+	f.clock.advance(time.Minute)
+	s = f.cycle()
+	if s.Cloned != 1 {
+		t.Fatalf("expected the repository to be cloned on retry, got %+v", s)
+	}
+	if failures := f.syncer.Failures(); len(failures) != 0 {
+		t.Fatalf("expected the failure to be cleared, got %+v", failures)
+	}
+}
+
+func TestSyncRetriesFailedCommitLookup(t *testing.T) {
+	provider := &fakeProvider{commitErrs: []error{errors.New("connection reset")}}
+	f := newFixture(t, provider, &fakeGit{}, SyncerOptions{RetryBackoff: time.Minute})
+
+	if s := f.syncer.Summary(); s.Failed != 1 {
+		t.Fatalf("expected one failed repository, got %+v", s)
+	}
+	if clones, _ := f.git.counts(); clones != 0 {
+		t.Fatalf("expected no clone without a commit, got %d clones", clones)
+	}
+
+	f.clock.advance(time.Minute)
+	if s := f.cycle(); s.Cloned != 1 {
+		t.Fatalf("expected the repository to be cloned on retry, got %+v", s)
+	}
+}
+
+func TestSyncMovesRepositoryToDeadLetter(t *testing.T) {
+	git := &fakeGit{cloneErrs: []error{errors.New("boom"), errors.New("boom")}}
+	f := newFixture(t, nil, git, SyncerOptions{RetryBackoff: time.Minute, DeadLetterAfter: 2})
+
+	f.clock.advance(time.Minute)
+	f.cycle()
+	failures := f.syncer.Failures()
+	if len(failures) != 1 || !failures[0].Dead {
+		t.Fatalf("expected the repository on the dead letter list, got %+v", failures)
+	}
+
+	f.clock.advance(time.Hour)
+	if s := f.cycle(); s.Deferred != 1 {
+		t.Fatalf("expected the dead repository to be deferred, got %+v", s)
+	}
+}
+
+func TestStartRunsCycleOnTick(t *testing.T) {
+	f := newFixture(t, nil, &fakeGit{}, SyncerOptions{})
+	f.provider.setCommit("ctxswitch", "gdoc", "b2")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- f.syncer.Start(ctx)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !f.clock.tick() {
+		if time.Now().After(deadline) {
+			t.Fatal("the syncer did not start its ticker")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	for {
+		if _, pulls := f.git.counts(); pulls == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the tick did not start a sync cycle")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("expected Start to return nil, got %v", err)
+	}
+}
+
+func TestOfflineSkipsSync(t *testing.T) {
+	f := newFixture(t, nil, &fakeGit{}, SyncerOptions{Offline: true})
+
+	if clones, pulls := f.git.counts(); clones != 0 || pulls != 0 {
+		t.Fatalf("expected no git operations, got %d clones and %d pulls", clones, pulls)
+	}
+	if err := f.syncer.Resync(context.Background(), "ctxswitch", "gdoc"); !errors.Is(err, ErrOffline) {
+		t.Fatalf("expected ErrOffline, got %v", err)
+	}
+}
+
+func TestSyncSkippedWhileLocked(t *testing.T) {
+	lock := &fakeLock{contended: true}
+	f := newFixture(t, nil, &fakeGit{}, SyncerOptions{Lock: lock})
+
+	if clones, _ := f.git.counts(); clones != 0 {
+		t.Fatalf("expected no clone while the lock is held elsewhere, got %d", clones)
+	}
+	if err := f.syncer.Resync(context.Background(), "ctxswitch", "gdoc"); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+}
+
+func TestLostLockCancelsUpdate(t *testing.T) {
+	lock := &fakeLock{}
+	f := newFixture(t, nil, &fakeGit{}, SyncerOptions{Lock: lock})
+	f.provider.setCommit("ctxswitch", "gdoc", "b2")
+
+	lock.lose = true
+	if s := f.cycle(); s.Updated != 0 {
+		t.Fatalf("expected the cycle to stop once the lock was lost, got %+v", s)
+	}
+	if err := f.syncer.Resync(context.Background(), "ctxswitch", "gdoc"); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+	if lock.held {
+		t.Fatal("expected the lock to be released")
+	}
+}
+
+func TestLockLostDuringCycle(t *testing.T) {
+	lock := &fakeLock{}
+	f := newFixture(t, nil, &fakeGit{}, SyncerOptions{Lock: lock})
+
+	f.provider.mu.Lock()
+	f.provider.repos = append(f.provider.repos, Repo{
+		Owner:         "ctxswitch",
+		Name:          "other",
+		CloneURL:      "https://github.com/ctxswitch/other.git",
+		DefaultBranch: "main",
+	})
+	f.provider.commits["ctxswitch/other"] = "c1"
+	f.provider.mu.Unlock()
+	f.provider.setCommit("ctxswitch", "gdoc", "b2")
+
+	// The lock expires while the first repository is pulled.
+	f.git.afterPull = lock.expire
+	s := f.cycle()
+	if s.Updated != 1 || s.Cloned != 0 {
+		t.Fatalf("expected only the first repository to be updated, got %+v", s)
+	}
+	if clones, pulls := f.git.counts(); clones != 1 || pulls != 1 {
+		t.Fatalf("expected the initial clone and one pull, got %d clones and %d pulls", clones, pulls)
+	}
+	f.syncer.mu.RLock()
+	other, ok := f.syncer.repos["other/ctxswitch"]
+	f.syncer.mu.RUnlock()
+	if ok && other.CommitSHA != "" {
+		t.Fatalf("expected the second repository not to be synced, got %+v", other)
+	}
+	if lock.held {
+		t.Fatal("expected the lock to be released")
+	}
+}
+
+func TestFetchDoesNotWaitForSyncCycle(t *testing.T) {
+	lock := &fakeLock{}
+	f := newFixture(t, nil, &fakeGit{}, SyncerOptions{Lazy: true, Lock: lock})
+	if clones, _ := f.git.counts(); clones != 0 {
+		t.Fatalf("expected no clones before the repository is requested, got %d", clones)
+	}
+
+	// A running cycle holds the locks until it has finished.
+	f.syncer.running.Lock()
+	defer f.syncer.running.Unlock()
+	_, unlock, err := f.syncer.lock(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- f.syncer.Fetch(context.Background(), "ctxswitch", "gdoc")
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the fetch not to wait for the sync cycle")
+	}
+
+	if clones, _ := f.git.counts(); clones != 1 {
+		t.Fatalf("expected one clone, got %d", clones)
+	}
+	if r := f.repo(); r.CommitSHA != "a1" {
+		t.Fatalf("expected the repository at a1, got %+v", r)
+	}
+	if !lock.held {
+		t.Fatal("expected the sync lock to be held until the cycle has finished")
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if lock.held {
+		t.Fatal("expected the sync lock to be released")
+	}
+}
+
+func TestFetchLockedByAnotherInstance(t *testing.T) {
+	lock := &fakeLock{contended: true}
+	f := newFixture(t, nil, &fakeGit{}, SyncerOptions{Lazy: true, Lock: lock})
+
+	if err := f.syncer.Fetch(context.Background(), "ctxswitch", "gdoc"); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+	if clones, _ := f.git.counts(); clones != 0 {
+		t.Fatalf("expected no clones, got %d", clones)
+	}
+}
+
+func TestFetchSkipsPausedRepository(t *testing.T) {
+	f := newFixture(t, nil, &fakeGit{}, SyncerOptions{Lazy: true})
+	if err := f.syncer.Pause("ctxswitch", "gdoc", "maintenance"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.syncer.Fetch(context.Background(), "ctxswitch", "gdoc"); !errors.Is(err, ErrPaused) {
+		t.Fatalf("expected ErrPaused, got %v", err)
+	}
+	if clones, _ := f.git.counts(); clones != 0 {
+		t.Fatalf("expected no clones, got %d", clones)
+	}
+}
+
+// walkCounter is a git client that records how often the local copy is
+// walked completely.
+type walkCounter struct {
+	*fakeGit
+	head  string
+	walks int
+}
+
+func (w *walkCounter) Head(r *Repo) (string, error) {
+	return w.head, nil
+}
+
+func (w *walkCounter) Verify(r *Repo) error {
+	w.walks++
+	return nil
+}
+
+func TestIntactOnlyWalksChangedCopies(t *testing.T) {
+	w := &walkCounter{fakeGit: &fakeGit{}, head: "a1"}
+	rs := &Syncer{git: w}
+	r := &Repo{LocalPath: t.TempDir()}
+
+	tests := []struct {
+		name   string
+		synced string
+		walks  int
+	}{
+		{"unchanged", "a1", 0},
+		{"changed", "b2", 1},
+		{"failed", "", 2},
+	}
+	for _, tt := range tests {
+		if !rs.intact(r, tt.synced) {
+			t.Errorf("%s: expected the local copy to be intact", tt.name)
+		}
+		if w.walks != tt.walks {
+			t.Errorf("%s: expected %d walks, got %d", tt.name, tt.walks, w.walks)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// TokenPrefix starts every API token so that tokens can be told apart from
+// other credentials and found by secret scanners.
+const TokenPrefix = "gdoc_"
+
+// ErrTokenNotFound is returned when revoking a token that does not exist.
+var ErrTokenNotFound = errors.New("token not found")
+
+// tokenRand is the source of the token ids and secrets.
+var tokenRand io.Reader = rand.Reader
+
+// Token is an API token for machine consumers of the management API.  Only
+// the hash of the token is stored.
+type Token struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// The role given to the callers using the token.
+	Role string `json:"role"`
+	// The sha256 hash of the token.  Never returned by Tokens.
+	Hash    string    `json:"hash,omitempty"`
+	Created time.Time `json:"created"`
+	// Nil if the token does not expire.
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// expired returns true if the token expired before now.
+func (t Token) expired(now time.Time) bool {
+	return t.Expires != nil && !now.Before(*t.Expires)
+}
+
+// newToken returns a new token along with its secret value.  A zero ttl
+// creates a token that does not expire.
+func newToken(name, role string, ttl time.Duration, now time.Time) (Token, string, error) {
+	id := make([]byte, 4)
+	secret := make([]byte, 32)
+	if _, err := io.ReadFull(tokenRand, id); err != nil {
+		return Token{}, "", err
+	}
+	if _, err := io.ReadFull(tokenRand, secret); err != nil {
+		return Token{}, "", err
+	}
+
+	t := Token{
+		ID:      hex.EncodeToString(id),
+		Name:    name,
+		Role:    role,
+		Created: now,
+	}
+	value := TokenPrefix + t.ID + "_" + hex.EncodeToString(secret)
+	t.Hash = hashToken(value)
+	if ttl > 0 {
+		expires := now.Add(ttl)
+		t.Expires = &expires
+	}
+	return t, value, nil
+}
+
+// addToken creates a token and adds it to the state.  The ids are short,
+// so a new token is generated when its id is already taken.
+func addToken(s *State, name, role string, ttl time.Duration, now time.Time) (Token, string, error) {
+	if s.Tokens == nil {
+		s.Tokens = make(map[string]Token)
+	}
+	for i := 0; i < 10; i++ {
+		t, value, err := newToken(name, role, ttl, now)
+		if err != nil {
+			return Token{}, "", err
+		}
+		if _, ok := s.Tokens[t.ID]; ok {
+			continue
+		}
+		s.Tokens[t.ID] = t
+		return t, value, nil
+	}
+	return Token{}, "", errors.New("unable to generate an unused token id")
+}
+
+// hashToken returns the hash of the token value that is stored.
+func hashToken(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// tokenID returns the id part of a token value.
+func tokenID(value string) (string, bool) {
+	rest := strings.TrimPrefix(value, TokenPrefix)
+	if rest == value {
+		return "", false
+	}
+	i := strings.Index(rest, "_")
+	if i <= 0 {
+		return "", false
+	}
+	return rest[:i], true
+}
+
+// listTokens returns the tokens of the state ordered by name without their
+// hashes.
+func listTokens(s State) []Token {
+	tokens := make([]Token, 0, len(s.Tokens))
+	for _, t := range s.Tokens {
+		t.Hash = ""
+		tokens = append(tokens, t)
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		if tokens[i].Name != tokens[j].Name {
+			return tokens[i].Name < tokens[j].Name
+		}
+		return tokens[i].ID < tokens[j].ID
+	})
+	return tokens
+}
+
+// CreateToken creates an API token with the role.  A zero ttl creates a
+// token that does not expire.  The token value is only returned here and
+// the token is discarded if the state cannot be saved.
+func (rs *Syncer) CreateToken(name, role string, ttl time.Duration) (string, Token, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	t, value, err := addToken(&rs.state, name, role, ttl, rs.clock.Now())
+	if err != nil {
+		return "", Token{}, err
+	}
+	if err := saveState(rs.statePath(), rs.state); err != nil {
+		delete(rs.state.Tokens, t.ID)
+		return "", Token{}, err
+	}
+
+	rs.logger.Info("api token created", zap.String("id", t.ID), zap.String("name", name), zap.String("role", role))
+	t.Hash = ""
+	return value, t, nil
+}
+
+// RevokeToken removes the API token with the id.
+func (rs *Syncer) RevokeToken(id string) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	t, ok := rs.state.Tokens[id]
+	if !ok {
+		return ErrTokenNotFound
+	}
+	delete(rs.state.Tokens, id)
+
+	rs.logger.Info("api token revoked", zap.String("id", id), zap.String("name", t.Name))
+	return saveState(rs.statePath(), rs.state)
+}
+
+// Tokens returns the API tokens ordered by name.
+func (rs *Syncer) Tokens() []Token {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	return listTokens(rs.state)
+}
+
+// HasTokens returns true if any API token exists.
+func (rs *Syncer) HasTokens() bool {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	return len(rs.state.Tokens) > 0
+}
+
+// VerifyToken returns the API token matching the value.  Expired tokens
+// are not returned.
+func (rs *Syncer) VerifyToken(value string) (Token, bool) {
+	id, ok := tokenID(value)
+	if !ok {
+		return Token{}, false
+	}
+
+	rs.mu.RLock()
+	t, ok := rs.state.Tokens[id]
+	rs.mu.RUnlock()
+
+	if !ok || subtle.ConstantTimeCompare([]byte(t.Hash), []byte(hashToken(value))) != 1 || t.expired(rs.clock.Now()) {
+		return Token{}, false
+	}
+	t.Hash = ""
+	return t, true
+}
+
+// CreateStateToken creates an API token in the state file while the
+// service is stopped.  See CreateToken.
+func CreateStateToken(stateName, name, role string, ttl time.Duration) (string, Token, error) {
+	s, err := loadState(stateName)
+	if err != nil {
+		return "", Token{}, err
+	}
+
+	t, value, err := addToken(&s, name, role, ttl, time.Now())
+	if err != nil {
+		return "", Token{}, err
+	}
+
+	t.Hash = ""
+	return value, t, saveState(stateName, s)
+}
+
+// RevokeStateToken removes an API token from the state file while the
+// service is stopped.
+func RevokeStateToken(stateName, id string) error {
+	s, err := loadState(stateName)
+	if err != nil {
+		return err
+	}
+	if _, ok := s.Tokens[id]; !ok {
+		return ErrTokenNotFound
+	}
+	delete(s.Tokens, id)
+	return saveState(stateName, s)
+}
+
+// StateTokens returns the API tokens in the state file ordered by name.
+func StateTokens(stateName string) ([]Token, error) {
+	s, err := loadState(stateName)
+	if err != nil {
+		return nil, err
+	}
+	return listTokens(s), nil
+}
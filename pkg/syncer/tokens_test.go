@@ -0,0 +1,93 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestAddTokenRegeneratesTakenID(t *testing.T) {
+	defer func(r io.Reader) { tokenRand = r }(tokenRand)
+
+	// The first token reuses the id of the existing token.
+	random := append(bytes.Repeat([]byte{1}, 4), bytes.Repeat([]byte{2}, 32)...)
+	random = append(random, bytes.Repeat([]byte{3}, 4)...)
+	random = append(random, bytes.Repeat([]byte{4}, 32)...)
+	tokenRand = bytes.NewReader(random)
+
+	s := State{Tokens: map[string]Token{"01010101": {ID: "01010101", Name: "existing"}}}
+	tok, _, err := addToken(&s, "new", "reader", 0, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.ID != "03030303" {
+		t.Fatalf("expected the token id 03030303, got %s", tok.ID)
+	}
+	if s.Tokens["01010101"].Name != "existing" {
+		t.Fatalf("expected the existing token to be kept, got %+v", s.Tokens["01010101"])
+	}
+	if len(s.Tokens) != 2 {
+		t.Fatalf("expected 2 tokens, got %d", len(s.Tokens))
+	}
+}
+
+func TestCreateTokenDiscardedWhenSaveFails(t *testing.T) {
+	// The state cannot be written below a regular file.
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	rs := &Syncer{
+		options: SyncerOptions{StatePath: filepath.Join(file, "state.json")},
+		clock:   newFakeClock(),
+		logger:  zap.NewNop(),
+	}
+
+	if _, _, err := rs.CreateToken("ci", "reader", 0); err == nil {
+		t.Fatal("expected an error")
+	}
+	if rs.HasTokens() {
+		t.Fatalf("expected no tokens, got %+v", rs.Tokens())
+	}
+}
+
+func TestSaveStateIsPrivate(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(name+".tmp", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := saveState(name, State{}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Fatalf("expected mode 0600, got %o", mode)
+	}
+}
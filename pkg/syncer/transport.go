@@ -0,0 +1,304 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// maxRetries is the number of times a failed request is retried.
+	maxRetries = 3
+	// retryBackoff is the initial wait between retries.  It is doubled
+	// after each attempt.
+	retryBackoff = time.Second
+	// rateLimitThreshold is the number of remaining requests at which
+	// requests start being spread out over the rest of the rate limit
+	// window.
+	rateLimitThreshold = 100
+)
+
+// userAgentTransport sets the User-Agent header of every request.
+type userAgentTransport struct {
+	userAgent string
+	next      http.RoundTripper
+}
+
+// RoundTrip sets the User-Agent header on a copy of the request and
+// executes it.
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+	return t.next.RoundTrip(req)
+}
+
+// retryTransport retries idempotent requests that failed because of network
+// errors, server errors or secondary rate limits.
+type retryTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip executes the request, retrying with an exponential backoff.  If
+// the response includes a Retry-After header, it is used as the wait time
+// instead.
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return t.next.RoundTrip(req)
+	}
+
+	backoff := retryBackoff
+	for attempt := 0; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+		if attempt == maxRetries || !retryable(resp, err) {
+			return resp, err
+		}
+
+		wait := backoff
+		if resp != nil {
+			if after, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+				wait = time.Duration(after) * time.Second
+			}
+			resp.Body.Close()
+		}
+
+		if err := sleep(req, wait); err != nil {
+			return nil, err
+		}
+		backoff *= 2
+	}
+}
+
+// retryable returns true if the request should be attempted again.
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	switch {
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return true
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return true
+	case resp.StatusCode == http.StatusForbidden && resp.Header.Get("Retry-After") != "":
+		// Secondary rate limits are reported as forbidden with a
+		// Retry-After header.
+		return true
+	}
+
+	return false
+}
+
+// rateLimitTransport spreads requests out once the remaining requests in the
+// current rate limit window drop below rateLimitThreshold, so the limit is
+// not exhausted before the window resets.  Github keeps a separate limit for
+// each resource, such as core and search, so only the requests that count
+// against a limit that is running out are spread out.
+type rateLimitTransport struct {
+	next http.RoundTripper
+
+	// The rate limit state keyed by the resource it applies to.
+	limits map[string]rateLimit
+	mu     sync.Mutex
+}
+
+// rateLimit is the state of the rate limit of a single resource.
+type rateLimit struct {
+	remaining int
+	reset     time.Time
+}
+
+// RoundTrip waits if the rate limit is close to being exhausted, executes
+// the request and records the rate limit state from the response.
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resource := rateLimitResource(req)
+	if err := sleep(req, t.delay(resource)); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	t.record(resource, resp)
+	return resp, nil
+}
+
+// delay returns how long to wait before the next request to the resource.
+func (t *rateLimitTransport) delay(resource string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	l, ok := t.limits[resource]
+	if !ok {
+		return 0
+	}
+
+	until := time.Until(l.reset)
+	if until <= 0 || l.remaining >= rateLimitThreshold {
+		return 0
+	}
+
+	if l.remaining <= 0 {
+		return until
+	}
+
+	return until / time.Duration(l.remaining)
+}
+
+// record updates the rate limit state from the response headers.  The
+// resource named in the X-RateLimit-Resource header takes precedence over
+// the one that the request was expected to count against.
+func (t *rateLimitTransport) record(resource string, resp *http.Response) {
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+
+	reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	if r := resp.Header.Get("X-RateLimit-Resource"); r != "" {
+		resource = r
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.limits == nil {
+		t.limits = make(map[string]rateLimit)
+	}
+	t.limits[resource] = rateLimit{remaining: remaining, reset: time.Unix(reset, 0)}
+}
+
+// rateLimitResource returns the rate limit resource that the request counts
+// against.  Enterprise servers serve the API below /api/v3.
+func rateLimitResource(req *http.Request) string {
+	p := strings.TrimPrefix(req.URL.Path, "/api/v3")
+	switch {
+	case strings.HasPrefix(p, "/search/code"):
+		return "code_search"
+	case strings.HasPrefix(p, "/search/"):
+		return "search"
+	case p == "/graphql" || p == "/api/graphql":
+		return "graphql"
+	default:
+		return "core"
+	}
+}
+
+// sleep waits for the duration or until the request's context is done.
+func sleep(req *http.Request, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
+
+// traceTransport logs every request made to the Github API while tracing
+// is enabled.  Credentials are never logged.
+type traceTransport struct {
+	next    http.RoundTripper
+	enabled int32
+	logger  *zap.Logger
+}
+
+// rateLimitHeaders are the response headers that describe the rate limit
+// of the request.
+var rateLimitHeaders = []string{
+	"X-RateLimit-Limit",
+	"X-RateLimit-Remaining",
+	"X-RateLimit-Used",
+	"X-RateLimit-Reset",
+	"X-RateLimit-Resource",
+}
+
+// RoundTrip executes the request and logs its method, redacted path,
+// status, rate limit headers and latency if tracing is enabled.
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if atomic.LoadInt32(&t.enabled) == 0 {
+		return t.next.RoundTrip(req)
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	fields := []zap.Field{
+		zap.String("method", req.Method),
+		zap.String("path", redactURL(req.URL)),
+		zap.Duration("latency", time.Since(start)),
+	}
+	if err != nil {
+		t.logger.Info("github api call", append(fields, zap.Error(err))...)
+		return resp, err
+	}
+
+	fields = append(fields, zap.Int("status", resp.StatusCode))
+	for _, h := range rateLimitHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			fields = append(fields, zap.String(strings.ToLower(h), v))
+		}
+	}
+	t.logger.Info("github api call", fields...)
+	return resp, nil
+}
+
+// set enables or disables tracing.
+func (t *traceTransport) set(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&t.enabled, v)
+}
+
+// secretParams are the query parameters whose values are redacted.
+var secretParams = []string{"access_token", "client_id", "client_secret", "token"}
+
+// redactURL returns the path and query of the URL with the credentials
+// removed.
+func redactURL(u *url.URL) string {
+	q := u.Query()
+	for _, p := range secretParams {
+		if q.Has(p) {
+			q.Set(p, "REDACTED")
+		}
+	}
+	if len(q) == 0 {
+		return u.Path
+	}
+	return u.Path + "?" + q.Encode()
+}
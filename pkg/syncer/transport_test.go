@@ -0,0 +1,85 @@
+// Copyright (C) 2022, Rob Lyon <rob@ctxswitch.com>
+//
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+package syncer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// roundTripFunc is an http.RoundTripper backed by a function.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip calls the function.
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRateLimitResource(t *testing.T) {
+	tests := map[string]string{
+		"https://api.github.com/search/repositories":         "search",
+		"https://api.github.com/search/code":                 "code_search",
+		"https://api.github.com/repos/o/n/commits/main":      "core",
+		"https://api.github.com/graphql":                     "graphql",
+		"https://ghe.example.com/api/v3/search/repositories": "search",
+		"https://ghe.example.com/api/v3/user/repos":          "core",
+		"https://ghe.example.com/api/graphql":                "graphql",
+	}
+
+	for u, want := range tests {
+		req := httptest.NewRequest(http.MethodGet, u, nil)
+		if got := rateLimitResource(req); got != want {
+			t.Errorf("%s: expected %s, got %s", u, want, got)
+		}
+	}
+}
+
+func TestRateLimitTransportTracksResources(t *testing.T) {
+	reset := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	transport := &rateLimitTransport{
+		next: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			resp := &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Request: req}
+			resp.Header.Set("X-RateLimit-Reset", reset)
+			if rateLimitResource(req) == "search" {
+				resp.Header.Set("X-RateLimit-Remaining", "0")
+				resp.Header.Set("X-RateLimit-Resource", "search")
+			} else {
+				resp.Header.Set("X-RateLimit-Remaining", "4000")
+				resp.Header.Set("X-RateLimit-Resource", "core")
+			}
+			return resp, nil
+		}),
+	}
+
+	for _, u := range []string{"https://api.github.com/search/repositories", "https://api.github.com/repos/o/n"} {
+		if _, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, u, nil)); err != nil {
+			t.Fatalf("%s: unexpected error: %v", u, err)
+		}
+	}
+
+	if d := transport.delay("search"); d <= 0 {
+		t.Errorf("expected searches to wait for the reset, got %s", d)
+	}
+	if d := transport.delay("core"); d != 0 {
+		t.Errorf("expected other calls not to wait, got %s", d)
+	}
+}